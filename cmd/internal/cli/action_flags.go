@@ -197,7 +197,7 @@ var actionNetworkFlag = cmdline.Flag{
 	Value:        &Network,
 	DefaultValue: "bridge",
 	Name:         "network",
-	Usage:        "specify desired network type separated by commas, each network will bring up a dedicated interface inside container",
+	Usage:        "specify desired network type separated by commas, each network will bring up a dedicated interface inside container, slirp provides user-mode networking to unprivileged users",
 	EnvKeys:      []string{"NETWORK"},
 	Tag:          "<name>",
 	ExcludedOS:   []string{cmdline.Darwin},
@@ -232,7 +232,7 @@ var actionSecurityFlag = cmdline.Flag{
 	Value:        &Security,
 	DefaultValue: []string{},
 	Name:         "security",
-	Usage:        "enable security features (SELinux, Apparmor, Seccomp)",
+	Usage:        "enable security features (SELinux, Apparmor, Seccomp, Landlock)",
 	EnvKeys:      []string{"SECURITY"},
 	ExcludedOS:   []string{cmdline.Darwin},
 }
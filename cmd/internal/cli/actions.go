@@ -11,7 +11,9 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hpcng/singularity/docs"
 	"github.com/hpcng/singularity/internal/pkg/cache"
@@ -19,9 +21,11 @@ import (
 	"github.com/hpcng/singularity/internal/pkg/client/net"
 	"github.com/hpcng/singularity/internal/pkg/client/oci"
 	"github.com/hpcng/singularity/internal/pkg/client/oras"
+	"github.com/hpcng/singularity/internal/pkg/client/s3"
 	"github.com/hpcng/singularity/internal/pkg/client/shub"
 	"github.com/hpcng/singularity/internal/pkg/util/uri"
 	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/singularityconf"
 	"github.com/spf13/cobra"
 )
 
@@ -30,9 +34,34 @@ const (
 )
 
 func getCacheHandle(cfg cache.Config) *cache.Handle {
+	var maxSize, sharedDir string
+	var lockTimeout uint64
+	if c := singularityconf.GetCurrentConfig(); c != nil {
+		maxSize = c.CacheMaxSize
+		sharedDir = c.SharedCacheDir
+		lockTimeout = uint64(c.CacheLockTimeout)
+	}
+	// the environment variable takes precedence over the configuration
+	if env := os.Getenv(cache.MaxSizeEnv); env != "" {
+		maxSize = env
+	}
+	size, err := cache.ParseSize(maxSize)
+	if err != nil {
+		sylog.Fatalf("Failed to parse the maximum size of the cache: %s", err)
+	}
+	if env := os.Getenv(cache.LockTimeoutEnv); env != "" {
+		lockTimeout, err = strconv.ParseUint(env, 10, 32)
+		if err != nil {
+			sylog.Fatalf("Failed to parse %s: %s", cache.LockTimeoutEnv, err)
+		}
+	}
+
 	h, err := cache.New(cache.Config{
-		ParentDir: os.Getenv(cache.DirEnv),
-		Disable:   cfg.Disable,
+		ParentDir:   os.Getenv(cache.DirEnv),
+		Disable:     cfg.Disable,
+		MaxSize:     size,
+		SharedDir:   sharedDir,
+		LockTimeout: time.Duration(lockTimeout) * time.Second,
 	})
 	if err != nil {
 		sylog.Fatalf("Failed to create an image cache handle: %s", err)
@@ -64,7 +93,7 @@ func handleOCI(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command,
 	if err != nil {
 		sylog.Fatalf("While creating Docker credentials: %v", err)
 	}
-	return oci.Pull(ctx, imgCache, pullFrom, tmpDir, ociAuth, noHTTPS, false)
+	return oci.Pull(ctx, imgCache, pullFrom, tmpDir, "", ociAuth, noHTTPS, false)
 }
 
 func handleOras(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command, pullFrom string) (string, error) {
@@ -102,6 +131,14 @@ func handleNet(ctx context.Context, imgCache *cache.Handle, pullFrom string) (st
 	return net.Pull(ctx, imgCache, pullFrom, tmpDir)
 }
 
+func handleS3(ctx context.Context, imgCache *cache.Handle, pullFrom string) (string, error) {
+	c, err := s3.DefaultConfig()
+	if err != nil {
+		return "", fmt.Errorf("while getting s3 client configuration: %v", err)
+	}
+	return s3.Pull(ctx, imgCache, pullFrom, tmpDir, c)
+}
+
 func replaceURIWithImage(ctx context.Context, cmd *cobra.Command, args []string) {
 	// If args[0] is not transport:ref (ex. instance://...) formatted return, not a URI
 	t, _ := uri.Split(args[0])
@@ -109,37 +146,41 @@ func replaceURIWithImage(ctx context.Context, cmd *cobra.Command, args []string)
 		return
 	}
 
-	var image string
-	var err error
-
 	// Create a cache handle only when we know we are are using a URI
 	imgCache := getCacheHandle(cache.Config{Disable: disableCache})
 	if imgCache == nil {
 		sylog.Fatalf("failed to create a new image cache handle")
 	}
 
+	image, err := handleURI(ctx, imgCache, cmd, args[0])
+	if err != nil {
+		sylog.Fatalf("Unable to handle %s uri: %v", args[0], err)
+	}
+
+	args[0] = image
+}
+
+// handleURI pulls the image referenced by the URI ref into the cache imgCache,
+// and returns the path of the cached image.
+func handleURI(ctx context.Context, imgCache *cache.Handle, cmd *cobra.Command, ref string) (string, error) {
+	t, _ := uri.Split(ref)
+
 	switch t {
 	case uri.Library:
-		image, err = handleLibrary(ctx, imgCache, args[0])
+		return handleLibrary(ctx, imgCache, ref)
 	case uri.Oras:
-		image, err = handleOras(ctx, imgCache, cmd, args[0])
+		return handleOras(ctx, imgCache, cmd, ref)
 	case uri.Shub:
-		image, err = handleShub(ctx, imgCache, args[0])
+		return handleShub(ctx, imgCache, ref)
 	case oci.IsSupported(t):
-		image, err = handleOCI(ctx, imgCache, cmd, args[0])
-	case uri.HTTP:
-		image, err = handleNet(ctx, imgCache, args[0])
-	case uri.HTTPS:
-		image, err = handleNet(ctx, imgCache, args[0])
+		return handleOCI(ctx, imgCache, cmd, ref)
+	case uri.HTTP, uri.HTTPS:
+		return handleNet(ctx, imgCache, ref)
+	case uri.S3:
+		return handleS3(ctx, imgCache, ref)
 	default:
-		sylog.Fatalf("Unsupported transport type: %s", t)
+		return "", fmt.Errorf("unsupported transport type: %s", t)
 	}
-
-	if err != nil {
-		sylog.Fatalf("Unable to handle %s uri: %v", args[0], err)
-	}
-
-	args[0] = image
 }
 
 // setVM will set the --vm option if needed by other options
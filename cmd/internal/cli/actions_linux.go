@@ -22,13 +22,16 @@ import (
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci"
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci/generate"
 	"github.com/hpcng/singularity/internal/pkg/security"
+	"github.com/hpcng/singularity/internal/pkg/security/seccomp"
 	"github.com/hpcng/singularity/internal/pkg/util/env"
 	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/hpcng/singularity/internal/pkg/util/fs/squashfs"
 	"github.com/hpcng/singularity/internal/pkg/util/shell/interpreter"
 	"github.com/hpcng/singularity/internal/pkg/util/starter"
 	"github.com/hpcng/singularity/internal/pkg/util/user"
 	imgutil "github.com/hpcng/singularity/pkg/image"
 	"github.com/hpcng/singularity/pkg/image/unpacker"
+	"github.com/hpcng/singularity/pkg/network"
 	clicallback "github.com/hpcng/singularity/pkg/plugin/callback/cli"
 	singularitycallback "github.com/hpcng/singularity/pkg/plugin/callback/runtime/engine/singularity"
 	"github.com/hpcng/singularity/pkg/runtime/engine/config"
@@ -117,6 +120,36 @@ func convertImage(filename string, unsquashfsPath string) (tempDir, imageDir str
 	return tempDir, imageDir, err
 }
 
+// checkKernelCompression checks if the host kernel is able to mount the
+// root filesystem of the image found at filename based on the compression
+// algorithm used by the squashfs root filesystem and warns otherwise.
+func checkKernelCompression(filename string) {
+	img, err := imgutil.Init(filename, false)
+	if err != nil {
+		// errors are reported later by the runtime
+		return
+	}
+	defer img.File.Close()
+
+	comp, err := imgutil.GetRootFsComp(img)
+	if err != nil || comp == "" {
+		return
+	}
+
+	supported, known, err := squashfs.KernelSupport(comp)
+	if err != nil {
+		sylog.Debugf("Could not check kernel support for %s compression: %s", comp, err)
+		return
+	} else if !known {
+		sylog.Debugf("Kernel configuration not found, can't check support for %s compression", comp)
+		return
+	}
+
+	if !supported {
+		sylog.Warningf("Image %s uses %s compression which is not supported by the host kernel, mounting the image will likely fail", filename, comp)
+	}
+}
+
 // checkHidepid checks if hidepid is set on /proc mount point, when this
 // option is an instance started with setuid workflow could not even be
 // joined later or stopped correctly.
@@ -447,7 +480,7 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	})
 
 	engineConfig.SetNoPrivs(NoPrivs)
-	engineConfig.SetSecurity(Security)
+	engineConfig.SetSecurity(absSeccompRecord(Security))
 	engineConfig.SetShell(ShellPath)
 	engineConfig.AppendLibrariesPath(ContainLibsPath...)
 	engineConfig.SetFakeroot(IsFakeroot)
@@ -577,7 +610,7 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 	}
 
 	if NetNamespace {
-		if IsFakeroot && Network != "none" {
+		if IsFakeroot && Network != "none" && Network != network.SlirpNetwork {
 			engineConfig.SetNetwork("fakeroot")
 
 			// unprivileged installation could not use fakeroot
@@ -729,6 +762,11 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		}
 	}
 
+	// image drivers may not rely on kernel squashfs support
+	if fs.IsFile(engineConfig.GetImage()) && engineConfig.File.ImageDriver == "" {
+		checkKernelCompression(engineConfig.GetImage())
+	}
+
 	// setuid workflow set RLIMIT_STACK to its default value,
 	// get the original value to restore it before executing
 	// container process
@@ -808,3 +846,26 @@ func execStarter(cobraCmd *cobra.Command, image string, args []string, name stri
 		sylog.Fatalf("%s", err)
 	}
 }
+
+// absSeccompRecord returns the security options with the path of a seccomp
+// profile to record made absolute, as it's written by the master process.
+func absSeccompRecord(options []string) []string {
+	path := seccomp.RecordPath(security.GetParam(options, "seccomp"))
+	if path == "" {
+		return options
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		sylog.Fatalf("While resolving path of seccomp profile %s: %s", path, err)
+	}
+
+	opts := make([]string, 0, len(options))
+	for _, o := range options {
+		if strings.HasPrefix(o, "seccomp:") {
+			o = "seccomp:record=" + abs
+		}
+		opts = append(opts, o)
+	}
+	return opts
+}
@@ -32,6 +32,9 @@ var buildArgs struct {
 	sections     []string
 	bindPaths    []string
 	arch         string
+	compression  string
+	compLevel    uint32
+	blockSize    string
 	builderURL   string
 	libraryURL   string
 	keyServerURL string
@@ -124,6 +127,36 @@ var buildArchFlag = cmdline.Flag{
 	EnvKeys:      []string{"BUILD_ARCH"},
 }
 
+// --compress
+var buildCompressFlag = cmdline.Flag{
+	ID:           "buildCompressFlag",
+	Value:        &buildArgs.compression,
+	DefaultValue: "",
+	Name:         "compress",
+	Usage:        "squashfs compression algorithm for SIF image (gzip, lzo, lz4, xz, zstd), defaults to singularity.conf setting",
+	EnvKeys:      []string{"COMPRESS"},
+}
+
+// --compress-level
+var buildCompressLevelFlag = cmdline.Flag{
+	ID:           "buildCompressLevelFlag",
+	Value:        &buildArgs.compLevel,
+	DefaultValue: uint32(0),
+	Name:         "compress-level",
+	Usage:        "squashfs compression level for SIF image (gzip and lzo: 1-9, zstd: 1-22)",
+	EnvKeys:      []string{"COMPRESS_LEVEL"},
+}
+
+// --block-size
+var buildBlockSizeFlag = cmdline.Flag{
+	ID:           "buildBlockSizeFlag",
+	Value:        &buildArgs.blockSize,
+	DefaultValue: "",
+	Name:         "block-size",
+	Usage:        "squashfs block size for SIF image, power of two between 4K and 1M (eg: 128K, 1M)",
+	EnvKeys:      []string{"BLOCK_SIZE"},
+}
+
 // -d|--detached
 var buildDetachedFlag = cmdline.Flag{
 	ID:           "buildDetachedFlag",
@@ -250,7 +283,10 @@ func init() {
 		cmdManager.RegisterCmd(buildCmd)
 
 		cmdManager.RegisterFlagForCmd(&buildArchFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildBlockSizeFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildBuilderFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildCompressFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&buildCompressLevelFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildDetachedFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildDisableCacheFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&buildEncryptFlag, buildCmd)
@@ -266,6 +302,7 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&buildUpdateFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonForceFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, buildCmd)
+		cmdManager.RegisterFlagForCmd(&commonPlatformFlag, buildCmd)
 		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, buildCmd)
 
 		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, buildCmd)
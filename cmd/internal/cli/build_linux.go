@@ -116,6 +116,14 @@ func runBuild(cmd *cobra.Command, args []string) {
 		os.Setenv("SINGULARITY_BINDPATH", strings.Join(buildArgs.bindPaths, ","))
 	}
 
+	if buildArgs.compression != "" || buildArgs.compLevel != 0 || buildArgs.blockSize != "" {
+		if buildArgs.remote {
+			sylog.Fatalf("--compress, --compress-level and --block-size options are not supported for remote build")
+		} else if buildArgs.sandbox {
+			sylog.Warningf("--compress, --compress-level and --block-size options are ignored for sandbox build")
+		}
+	}
+
 	if buildArgs.arch != runtime.GOARCH && !buildArgs.remote {
 		sylog.Fatalf("Requested architecture (%s) does not match host (%s). Cannot build locally.", buildArgs.arch, runtime.GOARCH)
 	}
@@ -339,6 +347,10 @@ func runBuildLocal(ctx context.Context, cmd *cobra.Command, dst, spec string) {
 				EncryptionKeyInfo: keyInfo,
 				FixPerms:          buildArgs.fixPerms,
 				SandboxTarget:     sandboxTarget,
+				Compression:       buildArgs.compression,
+				CompressionLevel:  uint(buildArgs.compLevel),
+				BlockSize:         buildArgs.blockSize,
+				Platform:          ociPlatform,
 			},
 		})
 	if err != nil {
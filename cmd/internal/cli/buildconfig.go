@@ -68,8 +68,10 @@ func printParam(name string) error {
 		{"MANDIR", buildcfg.MANDIR},
 		{"SINGULARITY_CONFDIR", buildcfg.SINGULARITY_CONFDIR},
 		{"SESSIONDIR", buildcfg.SESSIONDIR},
+		{"NETWORK_STATEDIR", buildcfg.NETWORK_STATEDIR},
 		{"PLUGIN_ROOTDIR", buildcfg.PLUGIN_ROOTDIR},
 		{"SINGULARITY_CONF_FILE", buildcfg.SINGULARITY_CONF_FILE},
+		{"SECCOMP_PROFILES_DIR", buildcfg.SECCOMP_PROFILES_DIR},
 		{"SINGULARITY_SUID_INSTALL", fmt.Sprintf("%d", buildcfg.SINGULARITY_SUID_INSTALL)},
 	}
 
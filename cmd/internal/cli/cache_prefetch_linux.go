@@ -0,0 +1,74 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"fmt"
+
+	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/pkg/cache"
+	"github.com/hpcng/singularity/pkg/cmdline"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/singularityconf"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterSubCmd(CacheCmd, cachePrefetchCmd)
+
+		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, cachePrefetchCmd)
+		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, cachePrefetchCmd)
+		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, cachePrefetchCmd)
+		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, cachePrefetchCmd)
+		cmdManager.RegisterFlagForCmd(&dockerLoginFlag, cachePrefetchCmd)
+	})
+}
+
+// cachePrefetchCmd is 'singularity cache prefetch' and populates the shared
+// system cache
+var cachePrefetchCmd = &cobra.Command{
+	Args:                  cobra.MinimumNArgs(1),
+	DisableFlagsInUseLine: true,
+	PreRun:                CheckRoot,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cachePrefetch(cmd, args); err != nil {
+			sylog.Fatalf("While prefetching images: %s", err)
+		}
+	},
+
+	Use:     docs.CachePrefetchUse,
+	Short:   docs.CachePrefetchShort,
+	Long:    docs.CachePrefetchLong,
+	Example: docs.CachePrefetchExample,
+}
+
+func cachePrefetch(cmd *cobra.Command, refs []string) error {
+	var dir string
+	if c := singularityconf.GetCurrentConfig(); c != nil {
+		dir = c.SharedCacheDir
+	}
+	if dir == "" {
+		return fmt.Errorf("no shared cache directory set by the 'shared cache dir' directive of singularity.conf")
+	}
+
+	imgCache, err := cache.NewShared(dir)
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+
+	for _, ref := range refs {
+		path, err := handleURI(ctx, imgCache, cmd, ref)
+		if err != nil {
+			return fmt.Errorf("unable to handle %s uri: %v", ref, err)
+		}
+		sylog.Infof("Cached %s at %s", ref, path)
+	}
+
+	return nil
+}
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -18,8 +18,10 @@ import (
 
 // CapConfig contains flag variables for capability commands
 type CapConfig struct {
-	CapUser  string
-	CapGroup string
+	CapUser        string
+	CapGroup       string
+	CapFingerprint string
+	CapExecgroup   string
 }
 
 var capConfig = new(CapConfig)
@@ -46,6 +48,26 @@ var capGroupFlag = cmdline.Flag{
 	EnvKeys:      []string{"CAP_GROUP"},
 }
 
+// --fingerprint
+var capFingerprintFlag = cmdline.Flag{
+	ID:           "capFingerprintFlag",
+	Value:        &capConfig.CapFingerprint,
+	DefaultValue: "",
+	Name:         "fingerprint",
+	Usage:        "manage capabilities for images signed by the key with this fingerprint",
+	EnvKeys:      []string{"CAP_FINGERPRINT"},
+}
+
+// --execgroup
+var capExecgroupFlag = cmdline.Flag{
+	ID:           "capExecgroupFlag",
+	Value:        &capConfig.CapExecgroup,
+	DefaultValue: "",
+	Name:         "execgroup",
+	Usage:        "manage capabilities for images allowed by the ECL execgroup with this tag name",
+	EnvKeys:      []string{"CAP_EXECGROUP"},
+}
+
 // CapabilityAvailCmd singularity capability avail
 var CapabilityAvailCmd = &cobra.Command{
 	Args:                  cobra.RangeArgs(0, 1),
@@ -76,9 +98,11 @@ var CapabilityAddCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	Run: func(cmd *cobra.Command, args []string) {
 		c := singularity.CapManageConfig{
-			Caps:  args[0],
-			User:  capConfig.CapUser,
-			Group: capConfig.CapGroup,
+			Caps:        args[0],
+			User:        capConfig.CapUser,
+			Group:       capConfig.CapGroup,
+			Fingerprint: capConfig.CapFingerprint,
+			Execgroup:   capConfig.CapExecgroup,
 		}
 
 		if err := singularity.CapabilityAdd(buildcfg.CAPABILITY_FILE, c); err != nil {
@@ -98,9 +122,11 @@ var CapabilityDropCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
 	Run: func(cmd *cobra.Command, args []string) {
 		c := singularity.CapManageConfig{
-			Caps:  args[0],
-			User:  capConfig.CapUser,
-			Group: capConfig.CapGroup,
+			Caps:        args[0],
+			User:        capConfig.CapUser,
+			Group:       capConfig.CapGroup,
+			Fingerprint: capConfig.CapFingerprint,
+			Execgroup:   capConfig.CapExecgroup,
 		}
 
 		if err := singularity.CapabilityDrop(buildcfg.CAPABILITY_FILE, c); err != nil {
@@ -166,5 +192,7 @@ func init() {
 
 		cmdManager.RegisterFlagForCmd(&capUserFlag, CapabilityAddCmd, CapabilityDropCmd)
 		cmdManager.RegisterFlagForCmd(&capGroupFlag, CapabilityAddCmd, CapabilityDropCmd)
+		cmdManager.RegisterFlagForCmd(&capFingerprintFlag, CapabilityAddCmd, CapabilityDropCmd)
+		cmdManager.RegisterFlagForCmd(&capExecgroupFlag, CapabilityAddCmd, CapabilityDropCmd)
 	})
 }
@@ -1,4 +1,4 @@
-// Copyright (c) 2019-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -7,6 +7,7 @@ package cli
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/hpcng/singularity/docs"
 	"github.com/hpcng/singularity/internal/app/singularity"
@@ -59,12 +60,79 @@ var fakerootConfigDisableFlag = cmdline.Flag{
 	Usage:        "disable a user fakeroot mapping entry preventing him to use the fakeroot feature (the user mapping must be present)",
 }
 
+// --start
+var fakerootConfigStart uint32
+var fakerootConfigStartFlag = cmdline.Flag{
+	ID:           "fakerootConfigStartFlag",
+	Value:        &fakerootConfigStart,
+	DefaultValue: uint32(0),
+	Name:         "start",
+	Usage:        "start of the ID range of the mapping entry added with --add (default: first available range)",
+}
+
+// --range-size
+var fakerootConfigRangeSize uint32
+var fakerootConfigRangeSizeFlag = cmdline.Flag{
+	ID:           "fakerootConfigRangeSizeFlag",
+	Value:        &fakerootConfigRangeSize,
+	DefaultValue: uint32(0),
+	Name:         "range-size",
+	Usage:        "number of IDs of the mapping entry added with --add (default: 65536)",
+}
+
+// --check
+var fakerootConfigCheck bool
+var fakerootConfigCheckFlag = cmdline.Flag{
+	ID:           "fakerootConfigCheckFlag",
+	Value:        &fakerootConfigCheck,
+	DefaultValue: false,
+	Name:         "check",
+	Usage:        "report invalid, overlapping or unusable mapping entries and users with missing mapping entries",
+}
+
+// --list
+var fakerootConfigList bool
+var fakerootConfigListFlag = cmdline.Flag{
+	ID:           "fakerootConfigListFlag",
+	Value:        &fakerootConfigList,
+	DefaultValue: false,
+	Name:         "list",
+	Usage:        "list user fakeroot mapping entries",
+}
+
+// --ldif
+var fakerootConfigLDIF string
+var fakerootConfigLDIFFlag = cmdline.Flag{
+	ID:           "fakerootConfigLDIFFlag",
+	Value:        &fakerootConfigLDIF,
+	DefaultValue: "",
+	Name:         "ldif",
+	Usage:        "list mapping entries with --list in LDIF format, as modifications of user entries under this base DN",
+}
+
 // configFakerootCmd singularity config fakeroot
 var configFakerootCmd = &cobra.Command{
-	Args:                  cobra.ExactArgs(1),
+	Args:                  cobra.RangeArgs(0, 1),
 	DisableFlagsInUseLine: true,
 	PreRun:                CheckRoot,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if fakerootConfigCheck || fakerootConfigList {
+			if len(args) > 0 {
+				return fmt.Errorf("--check and --list don't take a user argument")
+			}
+			if fakerootConfigCheck {
+				if err := singularity.FakerootCheck(os.Stdout); err != nil {
+					sylog.Fatalf("%s", err)
+				}
+			} else if err := singularity.FakerootList(os.Stdout, fakerootConfigLDIF); err != nil {
+				sylog.Fatalf("%s", err)
+			}
+			return nil
+		}
+		if len(args) != 1 {
+			return fmt.Errorf("you must specify a user")
+		}
+
 		username := args[0]
 		var op singularity.FakerootConfigOp
 
@@ -80,7 +148,15 @@ var configFakerootCmd = &cobra.Command{
 			return fmt.Errorf("you must specify an option (eg: --add/--remove)")
 		}
 
-		if err := singularity.FakerootConfig(username, op); err != nil {
+		if op != singularity.FakerootAddUser && (fakerootConfigStart != 0 || fakerootConfigRangeSize != 0) {
+			return fmt.Errorf("--start and --range-size can only be used with --add")
+		}
+
+		r := singularity.FakerootRange{
+			Start: fakerootConfigStart,
+			Count: fakerootConfigRangeSize,
+		}
+		if err := singularity.FakerootConfig(username, op, r); err != nil {
 			sylog.Fatalf("%s", err)
 		}
 
@@ -99,5 +175,10 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&fakerootConfigRemoveFlag, configFakerootCmd)
 		cmdManager.RegisterFlagForCmd(&fakerootConfigEnableFlag, configFakerootCmd)
 		cmdManager.RegisterFlagForCmd(&fakerootConfigDisableFlag, configFakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootConfigStartFlag, configFakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootConfigRangeSizeFlag, configFakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootConfigCheckFlag, configFakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootConfigListFlag, configFakerootCmd)
+		cmdManager.RegisterFlagForCmd(&fakerootConfigLDIFFlag, configFakerootCmd)
 	})
 }
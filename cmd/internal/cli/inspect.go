@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -18,6 +18,7 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/hpcng/sif/pkg/sif"
 	"github.com/hpcng/singularity/docs"
@@ -434,6 +435,26 @@ func (c *command) addLabelsCommand() {
 	}
 }
 
+func (c *command) addProvenanceCommand() {
+	if c.img.Type != image.SIF || c.appName != "" {
+		return
+	}
+	r, err := image.NewSectionReader(c.img, image.SIFDescProvenanceJSON, -1)
+	if err == image.ErrNoSection {
+		return
+	} else if err != nil {
+		sylog.Warningf("Unable to read %s SIF descriptor: %s", image.SIFDescProvenanceJSON, err)
+		return
+	}
+
+	provenance := new(inspect.Provenance)
+	if err := json.NewDecoder(r).Decode(provenance); err != nil {
+		sylog.Warningf("While decoding image provenance: %s", err)
+		return
+	}
+	c.metadata.Attributes.Provenance = provenance
+}
+
 func (c *command) addRunscriptCommand() {
 	if c.sifMetadata == nil {
 		c.addSingleFileCommand("runscript", "runscript")
@@ -540,6 +561,30 @@ func (c *command) addDefinitionCommand() {
 	}
 }
 
+func (c *command) addCompressionCommand() {
+	if c.img.Type != image.SIF && c.img.Type != image.SQUASHFS {
+		return
+	}
+	// prefer values recorded at build time
+	if c.sifMetadata != nil && c.sifMetadata.Attributes.Compression != "" {
+		c.metadata.Attributes.Compression = c.sifMetadata.Attributes.Compression
+		c.metadata.Attributes.BlockSize = c.sifMetadata.Attributes.BlockSize
+		return
+	}
+	comp, err := image.GetRootFsComp(c.img)
+	if err != nil {
+		sylog.Warningf("Unable to inspect root filesystem compression: %s", err)
+		return
+	}
+	c.metadata.Attributes.Compression = comp
+	blockSize, err := image.GetRootFsBlockSize(c.img)
+	if err != nil {
+		sylog.Warningf("Unable to inspect root filesystem block size: %s", err)
+		return
+	}
+	c.metadata.Attributes.BlockSize = blockSize
+}
+
 func getInspectMetadataFromSIF(img *image.Image) (*inspect.Metadata, error) {
 	r, err := image.NewSectionReader(img, metadataJSON, -1)
 	if err != nil {
@@ -645,6 +690,7 @@ var InspectCmd = &cobra.Command{
 			// container.
 			sylog.Debugf("Inspection of labels selected.")
 			inspectCmd.addLabelsCommand()
+			inspectCmd.addProvenanceCommand()
 		}
 
 		// Inspect the deffile.
@@ -684,6 +730,11 @@ var InspectCmd = &cobra.Command{
 			sylog.Debugf("Listing all apps in container")
 		}
 
+		if allData {
+			sylog.Debugf("Inspection of root filesystem compression selected.")
+			inspectCmd.addCompressionCommand()
+		}
+
 		inspectData, err := inspectCmd.getMetadata()
 		if err != nil {
 			sylog.Fatalf("%s", err)
@@ -748,6 +799,19 @@ var InspectCmd = &cobra.Command{
 					fmt.Printf("%s: %s\n", k, appAttr.Labels[k])
 				})
 			}
+			if p := inspectData.Data.Attributes.Provenance; p != nil {
+				fmt.Printf("provenance.source: %s\n", p.Source)
+				if p.Digest != "" {
+					fmt.Printf("provenance.digest: %s\n", p.Digest)
+				}
+				if p.Checksum != "" {
+					fmt.Printf("provenance.checksum: %s\n", p.Checksum)
+				}
+				if p.Platform != "" {
+					fmt.Printf("provenance.platform: %s\n", p.Platform)
+				}
+				fmt.Printf("provenance.time: %s\n", p.Time.Format(time.RFC3339))
+			}
 		}
 	},
 	TraverseChildren: true,
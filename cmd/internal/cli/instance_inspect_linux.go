@@ -0,0 +1,56 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"os"
+
+	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/pkg/cmdline"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&instanceInspectUserFlag, instanceInspectCmd)
+	})
+}
+
+// -u|--user
+var instanceInspectUser string
+var instanceInspectUserFlag = cmdline.Flag{
+	ID:           "instanceInspectUserFlag",
+	Value:        &instanceInspectUser,
+	DefaultValue: "",
+	Name:         "user",
+	ShortHand:    "u",
+	Usage:        `if running as root, inspect instance from "<username>"`,
+	Tag:          "<username>",
+	EnvKeys:      []string{"USER"},
+}
+
+// singularity instance inspect
+var instanceInspectCmd = &cobra.Command{
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if instanceInspectUser != "" && os.Getuid() != 0 {
+			sylog.Fatalf("Only root user can inspect user's instances")
+		}
+
+		err := singularity.InspectInstance(os.Stdout, args[0], instanceInspectUser)
+		if err != nil {
+			sylog.Fatalf("Could not inspect instance: %v", err)
+		}
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:     docs.InstanceInspectUse,
+	Short:   docs.InstanceInspectShort,
+	Long:    docs.InstanceInspectLong,
+	Example: docs.InstanceInspectExample,
+}
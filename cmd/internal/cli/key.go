@@ -84,6 +84,7 @@ func init() {
 		cmdManager.RegisterSubCmd(KeyCmd, KeyImportCmd)
 		cmdManager.RegisterSubCmd(KeyCmd, KeyRemoveCmd)
 		cmdManager.RegisterSubCmd(KeyCmd, KeyExportCmd)
+		cmdManager.RegisterSubCmd(KeyCmd, KeyTrustCmd)
 
 		cmdManager.RegisterFlagForCmd(&keyServerURIFlag, KeySearchCmd, KeyPushCmd, KeyPullCmd)
 		cmdManager.RegisterFlagForCmd(&keySearchLongListFlag, KeySearchCmd)
@@ -92,7 +93,7 @@ func init() {
 
 		cmdManager.RegisterFlagForCmd(
 			&keyGlobalPubKeyFlag,
-			KeyImportCmd, KeyExportCmd, KeyListCmd, KeyPullCmd, KeyPushCmd, KeyRemoveCmd,
+			KeyImportCmd, KeyExportCmd, KeyListCmd, KeyPullCmd, KeyPushCmd, KeyRemoveCmd, KeyTrustCmd,
 		)
 	})
 }
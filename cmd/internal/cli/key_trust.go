@@ -0,0 +1,64 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/pkg/cmdline"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/sypgp"
+	"github.com/spf13/cobra"
+)
+
+var keyTrustLevel string
+
+// --level
+var keyTrustLevelFlag = cmdline.Flag{
+	ID:           "keyTrustLevelFlag",
+	Value:        &keyTrustLevel,
+	DefaultValue: "",
+	Name:         "level",
+	Usage:        "trust level of the key: full, marginal, never or unknown",
+	Required:     true,
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterFlagForCmd(&keyTrustLevelFlag, KeyTrustCmd)
+	})
+}
+
+// KeyTrustCmd is `singularity key trust <fingerprint>' command
+var KeyTrustCmd = &cobra.Command{
+	PreRun:                checkGlobal,
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		var opts []sypgp.HandleOpt
+		path := ""
+
+		level, err := sypgp.ParseTrustLevel(keyTrustLevel)
+		if err != nil {
+			sylog.Fatalf("%s", err)
+		}
+
+		if keyGlobalPubKey {
+			path = buildcfg.SINGULARITY_CONFDIR
+			opts = append(opts, sypgp.GlobalHandleOpt())
+		}
+
+		keyring := sypgp.NewHandle(path, opts...)
+		if err := keyring.SetTrust(args[0], level); err != nil {
+			sylog.Fatalf("Unable to set key trust level: %s", err)
+		}
+	},
+
+	Use:     docs.KeyTrustUse,
+	Short:   docs.KeyTrustShort,
+	Long:    docs.KeyTrustLong,
+	Example: docs.KeyTrustExample,
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"github.com/hpcng/singularity/docs"
+	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/pkg/cmdline"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/singularityconf"
+	"github.com/spf13/cobra"
+)
+
+// --subnet
+var networkSubnet string
+var networkSubnetFlag = cmdline.Flag{
+	ID:           "networkSubnetFlag",
+	Value:        &networkSubnet,
+	DefaultValue: "",
+	Name:         "subnet",
+	Usage:        "subnet of the network in CIDR notation, a free 10.24.X.0/24 subnet is allocated by default",
+}
+
+func init() {
+	addCmdInit(func(cmdManager *cmdline.CommandManager) {
+		cmdManager.RegisterCmd(networkCmd)
+		cmdManager.RegisterSubCmd(networkCmd, networkCreateCmd)
+		cmdManager.RegisterSubCmd(networkCmd, networkListCmd)
+		cmdManager.RegisterSubCmd(networkCmd, networkRemoveCmd)
+
+		cmdManager.RegisterFlagForCmd(&networkSubnetFlag, networkCreateCmd)
+	})
+}
+
+// singularity network
+var networkCmd = &cobra.Command{
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return errors.New("invalid command")
+	},
+	DisableFlagsInUseLine: true,
+
+	Use:           docs.NetworkUse,
+	Short:         docs.NetworkShort,
+	Long:          docs.NetworkLong,
+	Example:       docs.NetworkExample,
+	SilenceErrors: true,
+}
+
+// singularity network create
+var networkCreateCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	PreRun:                CheckRoot,
+	Run: func(cmd *cobra.Command, args []string) {
+		confPath := singularityconf.GetCurrentConfig().CniConfPath
+		if err := singularity.NetworkCreate(confPath, args[0], networkSubnet); err != nil {
+			sylog.Fatalf("Could not create network %s: %s", args[0], err)
+		}
+	},
+
+	Use:     docs.NetworkCreateUse,
+	Short:   docs.NetworkCreateShort,
+	Long:    docs.NetworkCreateLong,
+	Example: docs.NetworkCreateExample,
+}
+
+// singularity network list
+var networkListCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(0),
+	DisableFlagsInUseLine: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		confPath := singularityconf.GetCurrentConfig().CniConfPath
+		if err := singularity.NetworkList(os.Stdout, confPath); err != nil {
+			sylog.Fatalf("Could not list networks: %s", err)
+		}
+	},
+
+	Use:     docs.NetworkListUse,
+	Short:   docs.NetworkListShort,
+	Long:    docs.NetworkListLong,
+	Example: docs.NetworkListExample,
+	Aliases: []string{"ls"},
+}
+
+// singularity network remove
+var networkRemoveCmd = &cobra.Command{
+	Args:                  cobra.ExactArgs(1),
+	DisableFlagsInUseLine: true,
+	PreRun:                CheckRoot,
+	Run: func(cmd *cobra.Command, args []string) {
+		confPath := singularityconf.GetCurrentConfig().CniConfPath
+		if err := singularity.NetworkRemove(confPath, args[0]); err != nil {
+			sylog.Fatalf("Could not remove network %s: %s", args[0], err)
+		}
+	},
+
+	Use:     docs.NetworkRemoveUse,
+	Short:   docs.NetworkRemoveShort,
+	Long:    docs.NetworkRemoveLong,
+	Example: docs.NetworkRemoveExample,
+	Aliases: []string{"rm"},
+}
@@ -13,6 +13,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/hpcng/singularity/internal/pkg/buildcfg"
 
@@ -20,6 +22,7 @@ import (
 	"github.com/hpcng/sif/pkg/integrity"
 	"github.com/hpcng/sif/pkg/sif"
 	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/internal/pkg/syecl"
 	"github.com/hpcng/singularity/internal/pkg/util/interactive"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/hpcng/singularity/pkg/sypgp"
@@ -128,7 +131,7 @@ func isLocal(e *openpgp.Entity) bool {
 		return false
 	}
 
-	keys := kr.KeysByIdUsage(e.PrimaryKey.KeyId, packet.KeyFlagSign)
+	keys := sypgp.NewRevokedKeyRing(kr).KeysByIdUsage(e.PrimaryKey.KeyId, packet.KeyFlagSign)
 	return len(keys) > 0
 }
 
@@ -140,10 +143,28 @@ func isGlobal(e *openpgp.Entity) bool {
 		return false
 	}
 
-	keys := kr.KeysByIdUsage(e.PrimaryKey.KeyId, packet.KeyFlagSign)
+	keys := sypgp.NewRevokedKeyRing(kr).KeysByIdUsage(e.PrimaryKey.KeyId, packet.KeyFlagSign)
 	return len(keys) > 0
 }
 
+// keyTrust returns the trust level of signing entity e, the level set in the local keyring
+// taking precedence over the level set in the global keyring.
+func keyTrust(e *openpgp.Entity) sypgp.TrustLevel {
+	global := sypgp.NewHandle(buildcfg.SINGULARITY_CONFDIR, sypgp.GlobalHandleOpt())
+	db, err := sypgp.MergeTrustDBs(global, sypgp.NewHandle(""))
+	if err != nil {
+		sylog.Warningf("Failed to load key trust levels: %v", err)
+		return sypgp.TrustUnknown
+	}
+	return db.Level(e)
+}
+
+// isExpired returns true if the key of signing entity e has expired, and false otherwise.
+func isExpired(e *openpgp.Entity) bool {
+	expiry, ok := sypgp.KeyExpiry(e)
+	return ok && !time.Now().Before(expiry)
+}
+
 // outputVerify outputs a textual representation of r to stdout.
 func outputVerify(f *sif.FileImage, r integrity.VerifyResult) bool {
 	e := r.Entity()
@@ -165,17 +186,38 @@ func outputVerify(f *sif.FileImage, r integrity.VerifyResult) bool {
 			sylog.Warningf("Primary identity unknown")
 		}
 
-		// Always print fingerprint.
+		// Always print fingerprint and trust level.
 		fmt.Printf("%-18v Fingerprint: %X\n", prefix, e.PrimaryKey.Fingerprint)
+		fmt.Printf("%-18v Trust: %s\n", prefix, keyTrust(e))
+
+		if expiry, ok := sypgp.KeyExpiry(e); ok {
+			fmt.Printf("%-18v Expires: %s\n", prefix, expiry)
+		}
+		if sig := sypgp.Revocation(e); sig != nil {
+			fmt.Printf("%-18v Revoked: %s\n", prefix, sig.CreationTime)
+		}
 	}
 
 	// Print table of signed objects.
-	if len(r.Verified()) > 0 {
+	if !outputVerifiedObjects(f, r.Verified()) {
+		return false
+	}
+
+	if err := r.Error(); err != nil {
+		fmt.Printf("\nError encountered during signature verification: %v\n", err)
+	}
+
+	return false
+}
+
+// outputVerifiedObjects outputs a table describing the verified objects ids of f to stdout.
+func outputVerifiedObjects(f *sif.FileImage, ids []uint32) bool {
+	if len(ids) > 0 {
 		fmt.Printf("Objects verified:\n")
 		fmt.Printf("%-4s|%-8s|%-8s|%s\n", "ID", "GROUP", "LINK", "TYPE")
 		fmt.Print("------------------------------------------------\n")
 	}
-	for _, id := range r.Verified() {
+	for _, id := range ids {
 		od, _, err := f.GetFromDescrID(id)
 		if err != nil {
 			sylog.Errorf("failed to get descriptor: %v", err)
@@ -199,11 +241,25 @@ func outputVerify(f *sif.FileImage, r integrity.VerifyResult) bool {
 		fmt.Printf("%-4d|%-8s|%-8s|%s\n", id, group, link, od.Datatype)
 	}
 
-	if err := r.Error(); err != nil {
-		fmt.Printf("\nError encountered during signature verification: %v\n", err)
-	}
+	return true
+}
 
-	return false
+// outputPolicyReport outputs a textual representation of the policy evaluation report r to stdout.
+func outputPolicyReport(r *syecl.PolicyReport) {
+	fmt.Printf("\nVerification policy:\n")
+	for _, rr := range r.Rules {
+		prefix := color.New(color.FgRed).Sprint("[FAIL]")
+		if rr.Satisfied {
+			prefix = color.New(color.FgGreen).Sprint("[PASS]")
+		}
+		fmt.Printf("%-18v Rule %s: %d of %d required keys\n", prefix, rr.Name, len(rr.Matched), rr.Required)
+	}
+	for _, fp := range r.Forbidden {
+		fmt.Printf("%-18v Signed by forbidden key %s\n", color.New(color.FgRed).Sprint("[FAIL]"), strings.ToUpper(fp))
+	}
+	for _, w := range r.Warnings {
+		sylog.Warningf("Signature ignored: %s", w)
+	}
 }
 
 type key struct {
@@ -217,6 +273,9 @@ type keyEntity struct {
 	Fingerprint string
 	KeyLocal    bool
 	KeyCheck    bool
+	KeyTrust    string
+	KeyExpired  bool
+	KeyRevoked  bool
 	DataCheck   bool
 }
 
@@ -224,13 +283,14 @@ type keyEntity struct {
 type keyList struct {
 	Signatures int
 	SignerKeys []*key
+	Policy     *syecl.PolicyReport `json:"Policy,omitempty"`
 }
 
 // getJSONCallback returns a singularity.VerifyCallback that appends to kl.
 func getJSONCallback(kl *keyList) singularity.VerifyCallback {
 	return func(f *sif.FileImage, r integrity.VerifyResult) bool {
-		name, fp := "unknown", ""
-		var keyLocal, keyCheck bool
+		name, fp, trust := "unknown", "", sypgp.TrustUnknown
+		var keyLocal, keyCheck, keyExpired, keyRevoked bool
 
 		// Increment signature count.
 		kl.Signatures++
@@ -242,7 +302,10 @@ func getJSONCallback(kl *keyList) singularity.VerifyCallback {
 			}
 			fp = hex.EncodeToString(e.PrimaryKey.Fingerprint[:])
 			keyLocal = isLocal(e)
-			keyCheck = true
+			trust = keyTrust(e)
+			keyExpired = isExpired(e)
+			keyRevoked = sypgp.Revocation(e) != nil
+			keyCheck = !keyRevoked && trust != sypgp.TrustNever
 		}
 
 		// For each verified object, append an entry to the list.
@@ -259,6 +322,9 @@ func getJSONCallback(kl *keyList) singularity.VerifyCallback {
 				Fingerprint: fp,
 				KeyLocal:    keyLocal,
 				KeyCheck:    keyCheck,
+				KeyTrust:    trust.String(),
+				KeyExpired:  keyExpired,
+				KeyRevoked:  keyRevoked,
 				DataCheck:   true,
 			}
 			kl.SignerKeys = append(kl.SignerKeys, &key{ke})
@@ -278,6 +344,9 @@ func getJSONCallback(kl *keyList) singularity.VerifyCallback {
 				Fingerprint: fp,
 				KeyLocal:    keyLocal,
 				KeyCheck:    keyCheck,
+				KeyTrust:    trust.String(),
+				KeyExpired:  keyExpired,
+				KeyRevoked:  keyRevoked,
 				DataCheck:   false,
 			}
 			kl.SignerKeys = append(kl.SignerKeys, &key{ke})
@@ -0,0 +1,138 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package cli
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/hpcng/sif/pkg/integrity"
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/app/singularity"
+	"github.com/hpcng/singularity/internal/pkg/sypki"
+	"github.com/hpcng/singularity/internal/pkg/util/interactive"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// askPKCS11PIN prompts the user for the PIN of a PKCS#11 token.
+func askPKCS11PIN() (string, error) {
+	return interactive.AskQuestionNoEcho("Enter PKCS#11 token PIN : ")
+}
+
+// loadX509Signer returns the private key referenced by keyRef along with its certificate chain,
+// read from the PEM file certPath, or from the PKCS#11 token holding the key if certPath is empty.
+func loadX509Signer(keyRef, certPath string) (sypki.Key, []*x509.Certificate, error) {
+	key, err := sypki.LoadKey(keyRef, askPKCS11PIN)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if certPath != "" {
+		certs, err := sypki.LoadCertificates(certPath)
+		if err != nil {
+			key.Close()
+			return nil, nil, err
+		}
+		return key, certs, nil
+	}
+
+	if cert := key.Certificate(); cert != nil {
+		return key, []*x509.Certificate{cert}, nil
+	}
+
+	key.Close()
+	return nil, nil, fmt.Errorf("no certificate found for key %s, use --certificate", keyRef)
+}
+
+// certFingerprint returns the SHA-256 fingerprint of cert.
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// outputX509Verify outputs a textual representation of r to stdout.
+func outputX509Verify(f *sif.FileImage, r sypki.VerifyResult) bool {
+	// Print signing certificate info.
+	if c := r.Certificate; c != nil {
+		prefix := color.New(color.FgYellow).Sprint("[X509]")
+		if r.Chain != nil {
+			prefix = color.New(color.FgGreen).Sprint("[X509]")
+		}
+
+		fmt.Printf("%-18v Signing certificate: %v\n", prefix, sypki.CertificateSubject(c))
+		fmt.Printf("%-18v Issuer: %v\n", prefix, c.Issuer.String())
+		fmt.Printf("%-18v Fingerprint: %X\n", prefix, sha256.Sum256(c.Raw))
+	}
+
+	// Print table of signed objects.
+	if !outputVerifiedObjects(f, r.Verified) {
+		return false
+	}
+
+	if r.Err != nil {
+		fmt.Printf("\nError encountered during signature verification: %v\n", r.Err)
+	}
+
+	return false
+}
+
+// getX509JSONCallback returns a singularity.X509VerifyCallback that appends to kl.
+func getX509JSONCallback(kl *keyList) singularity.X509VerifyCallback {
+	return func(f *sif.FileImage, r sypki.VerifyResult) bool {
+		name, fp := "unknown", ""
+
+		// Increment signature count.
+		kl.Signatures++
+
+		if c := r.Certificate; c != nil {
+			name = sypki.CertificateSubject(c)
+			fp = certFingerprint(c)
+		}
+		keyCheck := r.Chain != nil
+
+		// For each verified object, append an entry to the list.
+		for _, id := range r.Verified {
+			od, _, err := f.GetFromDescrID(id)
+			if err != nil {
+				sylog.Errorf("failed to get descriptor: %v", err)
+				continue
+			}
+
+			ke := keyEntity{
+				Partition:   od.Datatype.String(),
+				Name:        name,
+				Fingerprint: fp,
+				KeyCheck:    keyCheck,
+				DataCheck:   true,
+			}
+			kl.SignerKeys = append(kl.SignerKeys, &key{ke})
+		}
+
+		var integrityError *integrity.ObjectIntegrityError
+		if errors.As(r.Err, &integrityError) {
+			od, _, err := f.GetFromDescrID(integrityError.ID)
+			if err != nil {
+				sylog.Errorf("failed to get descriptor: %v", err)
+				return false
+			}
+
+			ke := keyEntity{
+				Partition:   od.Datatype.String(),
+				Name:        name,
+				Fingerprint: fp,
+				KeyCheck:    keyCheck,
+				DataCheck:   false,
+			}
+			kl.SignerKeys = append(kl.SignerKeys, &key{ke})
+		}
+
+		return false
+	}
+}
@@ -7,22 +7,28 @@
 package cli
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
 
+	ocitypes "github.com/containers/image/v5/types"
 	"github.com/hpcng/singularity/docs"
 	"github.com/hpcng/singularity/internal/pkg/cache"
 	"github.com/hpcng/singularity/internal/pkg/client/library"
 	"github.com/hpcng/singularity/internal/pkg/client/net"
 	"github.com/hpcng/singularity/internal/pkg/client/oci"
 	"github.com/hpcng/singularity/internal/pkg/client/oras"
+	"github.com/hpcng/singularity/internal/pkg/client/s3"
 	"github.com/hpcng/singularity/internal/pkg/client/shub"
 	"github.com/hpcng/singularity/internal/pkg/remote/endpoint"
 	"github.com/hpcng/singularity/internal/pkg/util/uri"
 	"github.com/hpcng/singularity/pkg/cmdline"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/spf13/cobra"
+	scskeyclient "github.com/sylabs/scs-key-client/client"
+	scslibclient "github.com/sylabs/scs-library-client/client"
 )
 
 const (
@@ -38,6 +44,8 @@ const (
 	HTTPSProtocol = "https"
 	// OrasProtocol holds the oras URI.
 	OrasProtocol = "oras"
+	// S3Protocol holds the s3 URI of objects in S3-compatible stores.
+	S3Protocol = "s3"
 )
 
 var (
@@ -52,6 +60,14 @@ var (
 	// pullArch is the architecture for which containers will be pulled from the
 	// SCS library.
 	pullArch string
+	// pullFromFile is the path of a file listing the images to pull.
+	pullFromFile string
+	// pullJobs is the maximum number of images pulled concurrently from
+	// pullFromFile.
+	pullJobs int
+	// pullDigestLock is the path of the lock file mapping docker image
+	// tags to digests.
+	pullDigestLock string
 )
 
 // --arch
@@ -95,6 +111,36 @@ var pullDirFlag = cmdline.Flag{
 	EnvKeys:      []string{"PULLDIR", "PULLFOLDER"},
 }
 
+// --from-file
+var pullFromFileFlag = cmdline.Flag{
+	ID:           "pullFromFileFlag",
+	Value:        &pullFromFile,
+	DefaultValue: "",
+	Name:         "from-file",
+	Usage:        "pull the images listed in the provided file",
+	EnvKeys:      []string{"PULL_FROM_FILE"},
+}
+
+// --jobs
+var pullJobsFlag = cmdline.Flag{
+	ID:           "pullJobsFlag",
+	Value:        &pullJobs,
+	DefaultValue: 4,
+	Name:         "jobs",
+	Usage:        "maximum number of images pulled concurrently with --from-file",
+	EnvKeys:      []string{"PULL_JOBS"},
+}
+
+// --digest-lock
+var pullDigestLockFlag = cmdline.Flag{
+	ID:           "pullDigestLockFlag",
+	Value:        &pullDigestLock,
+	DefaultValue: "",
+	Name:         "digest-lock",
+	Usage:        "record docker image digests in the provided lock file, or fail if they differ from the recorded ones",
+	EnvKeys:      []string{"PULL_DIGEST_LOCK"},
+}
+
 // --disable-cache
 var pullDisableCacheFlag = cmdline.Flag{
 	ID:           "pullDisableCacheFlag",
@@ -137,9 +183,13 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&pullLibraryURIFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullNameFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&commonNoHTTPSFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&commonPlatformFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&commonTmpDirFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullDisableCacheFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&pullDirFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullFromFileFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullJobsFlag, PullCmd)
+		cmdManager.RegisterFlagForCmd(&pullDigestLockFlag, PullCmd)
 
 		cmdManager.RegisterFlagForCmd(&dockerUsernameFlag, PullCmd)
 		cmdManager.RegisterFlagForCmd(&dockerPasswordFlag, PullCmd)
@@ -155,7 +205,7 @@ func init() {
 // PullCmd singularity pull
 var PullCmd = &cobra.Command{
 	DisableFlagsInUseLine: true,
-	Args:                  cobra.RangeArgs(1, 2),
+	Args:                  pullArgs,
 	Run:                   pullRun,
 	Use:                   docs.PullUse,
 	Short:                 docs.PullShort,
@@ -163,6 +213,18 @@ var PullCmd = &cobra.Command{
 	Example:               docs.PullExample,
 }
 
+// pullArgs checks the arguments of pull, images listed with --from-file
+// can't be combined with an image argument.
+func pullArgs(cmd *cobra.Command, args []string) error {
+	if pullFromFile != "" {
+		if len(args) > 0 {
+			return fmt.Errorf("no image argument allowed with --from-file")
+		}
+		return nil
+	}
+	return cobra.RangeArgs(1, 2)(cmd, args)
+}
+
 func pullRun(cmd *cobra.Command, args []string) {
 	ctx := cmd.Context()
 
@@ -171,6 +233,11 @@ func pullRun(cmd *cobra.Command, args []string) {
 		sylog.Fatalf("Failed to create an image cache handle")
 	}
 
+	if pullFromFile != "" {
+		pullFromManifest(cmd, imgCache)
+		return
+	}
+
 	pullFrom := args[len(args)-1]
 	transport, ref := uri.Split(pullFrom)
 	if ref == "" {
@@ -181,11 +248,7 @@ func pullRun(cmd *cobra.Command, args []string) {
 	if pullTo == "" {
 		pullTo = args[0]
 		if len(args) == 1 {
-			if transport == "" {
-				pullTo = uri.GetName("library://" + pullFrom)
-			} else {
-				pullTo = uri.GetName(pullFrom) // TODO: If not library/shub & no name specified, simply put to cache
-			}
+			pullTo = defaultPullName(pullFrom)
 		}
 	}
 
@@ -201,15 +264,105 @@ func pullRun(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	var ociAuth *ocitypes.DockerAuthConfig
+	if needsDockerCredentials(transport) {
+		ociAuth, err = makeDockerCredentials(cmd)
+		if err != nil {
+			sylog.Fatalf("While creating Docker credentials: %v", err)
+		}
+	}
+
+	p, err := newImagePull(pullFrom, pullTo, ociAuth)
+	if err != nil {
+		sylog.Fatalf("%v", err)
+	}
+	p.digestLock = loadDigestLock()
+	if err := p.checkDigest(ctx); err != nil {
+		sylog.Fatalf("%v", err)
+	}
+	if err := p.toFile(ctx, imgCache); err != nil {
+		sylog.Fatalf("%v", err)
+	}
+	p.recordDigest()
+	if p.digestLock != nil {
+		if err := p.digestLock.Save(); err != nil {
+			sylog.Fatalf("While writing digest lock file: %v", err)
+		}
+	}
+}
+
+// loadDigestLock returns the --digest-lock lock file, if any.
+func loadDigestLock() *oci.DigestLock {
+	if pullDigestLock == "" {
+		return nil
+	}
+	l, err := oci.LoadDigestLock(pullDigestLock)
+	if err != nil {
+		sylog.Fatalf("While loading digest lock file: %v", err)
+	}
+	return l
+}
+
+// defaultPullName returns the name of the image file pulled from pullFrom
+// when no name is specified.
+func defaultPullName(pullFrom string) string {
+	if transport, _ := uri.Split(pullFrom); transport == "" {
+		return uri.GetName("library://" + pullFrom)
+	}
+	return uri.GetName(pullFrom) // TODO: If not library/shub & no name specified, simply put to cache
+}
+
+// needsDockerCredentials returns whether pulling with transport uses docker
+// credentials.
+func needsDockerCredentials(transport string) bool {
+	return transport == OrasProtocol || (transport != "" && oci.IsSupported(transport) == transport)
+}
+
+// imagePull holds an image to pull from a URI to a file, along with the
+// client configuration of its transport.
+type imagePull struct {
+	from      string
+	to        string
+	transport string
+
+	libraryRef    *scslibclient.Ref
+	libraryConfig *scslibclient.Config
+	keyserverOpts []scskeyclient.Option
+	ociAuth       *ocitypes.DockerAuthConfig
+	s3Config      *s3.Config
+
+	// digestLock is the lock file the image digest is checked against,
+	// lockName and digest are set once checked.
+	digestLock *oci.DigestLock
+	lockName   string
+	digest     string
+}
+
+// newImagePull returns an imagePull of the image at URI pullFrom to the
+// file pullTo. Library client configuration is resolved here, as it uses
+// the global remote endpoint.
+func newImagePull(pullFrom, pullTo string, ociAuth *ocitypes.DockerAuthConfig) (*imagePull, error) {
+	transport, ref := uri.Split(pullFrom)
+	if ref == "" {
+		return nil, fmt.Errorf("bad URI %s", pullFrom)
+	}
+
+	p := &imagePull{
+		from:      pullFrom,
+		to:        pullTo,
+		transport: transport,
+		ociAuth:   ociAuth,
+	}
+
 	switch transport {
 	case LibraryProtocol, "":
 		ref, err := library.NormalizeLibraryRef(pullFrom)
 		if err != nil {
-			sylog.Fatalf("Malformed library reference: %v", err)
+			return nil, fmt.Errorf("malformed library reference: %v", err)
 		}
 
 		if pullLibraryURI != "" && ref.Host != "" {
-			sylog.Fatalf("Conflicting arguments; do not use --library with a library URI containing host name")
+			return nil, fmt.Errorf("conflicting arguments; do not use --library with a library URI containing host name")
 		}
 
 		var libraryURI string
@@ -222,51 +375,142 @@ func pullRun(cmd *cobra.Command, args []string) {
 
 		lc, err := getLibraryClientConfig(libraryURI)
 		if err != nil {
-			sylog.Fatalf("Unable to get library client configuration: %v", err)
+			return nil, fmt.Errorf("unable to get library client configuration: %v", err)
 		}
 		co, err := getKeyserverClientOpts("", endpoint.KeyserverVerifyOp)
 		if err != nil {
-			sylog.Fatalf("Unable to get keyserver client configuration: %v", err)
+			return nil, fmt.Errorf("unable to get keyserver client configuration: %v", err)
+		}
+
+		p.libraryRef = ref
+		p.libraryConfig = lc
+		p.keyserverOpts = co
+	case S3Protocol:
+		c, err := s3.DefaultConfig()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get s3 client configuration: %v", err)
 		}
+		p.s3Config = c
+	case ShubProtocol, OrasProtocol, HTTPProtocol, HTTPSProtocol:
+	case oci.IsSupported(transport):
+	default:
+		return nil, fmt.Errorf("unsupported transport type: %s", transport)
+	}
+
+	return p, nil
+}
+
+// checkDigest resolves the digest of the image and checks it against the
+// digest lock file, if any. The image is then pulled by digest, so the
+// recorded digest is the digest of the pulled image.
+func (p *imagePull) checkDigest(ctx context.Context) error {
+	if p.digestLock == nil {
+		return nil
+	}
+
+	name, digest, err := oci.ImageDigest(ctx, p.from, p.ociAuth, noHTTPS)
+	if err == oci.ErrNotLockable {
+		sylog.Warningf("Not locking digest of %s: %v", p.from, err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := p.digestLock.Verify(name, digest); err != nil {
+		return err
+	}
+	pinned, err := oci.PinnedURI(p.from, digest)
+	if err != nil {
+		return err
+	}
+	sylog.Debugf("Pulling %s as %s", p.from, pinned)
+
+	p.from = pinned
+	p.lockName = name
+	p.digest = digest
+	return nil
+}
+
+// recordDigest records the digest of the pulled image in the digest lock
+// file, if any.
+func (p *imagePull) recordDigest() {
+	if p.digestLock != nil && p.digest != "" {
+		p.digestLock.Record(p.lockName, p.digest)
+	}
+}
+
+// toFile pulls the image to its destination file, through the cache if
+// enabled, and records its provenance.
+func (p *imagePull) toFile(ctx context.Context, imgCache *cache.Handle) error {
+	if err := p.pullToFile(ctx, imgCache); err != nil {
+		return err
+	}
+	if p.transport != "" && oci.IsSupported(p.transport) == p.transport {
+		// converted images record their provenance when built
+		return nil
+	}
+	source := p.from
+	if p.transport == "" {
+		source = LibraryProtocol + "://" + p.from
+	}
+	return recordProvenance(p.to, source)
+}
 
-		_, err = library.PullToFile(ctx, imgCache, pullTo, ref, pullArch, tmpDir, lc, co)
+// pullToFile pulls the image to its destination file, through the cache
+// if enabled.
+func (p *imagePull) pullToFile(ctx context.Context, imgCache *cache.Handle) error {
+	switch p.transport {
+	case LibraryProtocol, "":
+		_, err := library.PullToFile(ctx, imgCache, p.to, p.libraryRef, pullArch, tmpDir, p.libraryConfig, p.keyserverOpts)
 		if err != nil && err != library.ErrLibraryPullUnsigned {
-			sylog.Fatalf("While pulling library image: %v", err)
+			return fmt.Errorf("while pulling library image: %v", err)
 		}
 		if err == library.ErrLibraryPullUnsigned {
 			sylog.Warningf("Skipping container verification")
 		}
 	case ShubProtocol:
-		_, err := shub.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, noHTTPS)
+		_, err := shub.PullToFile(ctx, imgCache, p.to, p.from, tmpDir, noHTTPS)
 		if err != nil {
-			sylog.Fatalf("While pulling shub image: %v\n", err)
+			return fmt.Errorf("while pulling shub image: %v", err)
 		}
 	case OrasProtocol:
-		ociAuth, err := makeDockerCredentials(cmd)
+		_, err := oras.PullToFile(ctx, imgCache, p.to, p.from, tmpDir, p.ociAuth)
 		if err != nil {
-			sylog.Fatalf("Unable to make docker oci credentials: %s", err)
-		}
-
-		_, err = oras.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth)
-		if err != nil {
-			sylog.Fatalf("While pulling image from oci registry: %v", err)
+			return fmt.Errorf("while pulling image from oci registry: %v", err)
 		}
 	case HTTPProtocol, HTTPSProtocol:
-		_, err := net.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir)
+		_, err := net.PullToFile(ctx, imgCache, p.to, p.from, tmpDir)
 		if err != nil {
-			sylog.Fatalf("While pulling from image from http(s): %v\n", err)
+			return fmt.Errorf("while pulling from image from http(s): %v", err)
 		}
-	case oci.IsSupported(transport):
-		ociAuth, err := makeDockerCredentials(cmd)
+	case S3Protocol:
+		_, err := s3.PullToFile(ctx, imgCache, p.to, p.from, tmpDir, p.s3Config)
 		if err != nil {
-			sylog.Fatalf("While creating Docker credentials: %v", err)
+			return fmt.Errorf("while pulling image from s3: %v", err)
 		}
-
-		_, err = oci.PullToFile(ctx, imgCache, pullTo, pullFrom, tmpDir, ociAuth, noHTTPS, buildArgs.noCleanUp)
+	default:
+		_, err := oci.PullToFile(ctx, imgCache, p.to, p.from, tmpDir, ociPlatform, p.ociAuth, noHTTPS, buildArgs.noCleanUp)
 		if err != nil {
-			sylog.Fatalf("While making image from oci registry: %v", err)
+			return fmt.Errorf("while making image from oci registry: %v", err)
 		}
+	}
+	return nil
+}
+
+// toCache pulls the image into the cache, and returns the path of the
+// cached image.
+func (p *imagePull) toCache(ctx context.Context, imgCache *cache.Handle) (string, error) {
+	switch p.transport {
+	case LibraryProtocol, "":
+		return library.Pull(ctx, imgCache, p.libraryRef, pullArch, tmpDir, p.libraryConfig)
+	case ShubProtocol:
+		return shub.Pull(ctx, imgCache, p.from, tmpDir, noHTTPS)
+	case OrasProtocol:
+		return oras.Pull(ctx, imgCache, p.from, tmpDir, p.ociAuth)
+	case HTTPProtocol, HTTPSProtocol:
+		return net.Pull(ctx, imgCache, p.from, tmpDir)
+	case S3Protocol:
+		return s3.Pull(ctx, imgCache, p.from, tmpDir, p.s3Config)
 	default:
-		sylog.Fatalf("Unsupported transport type: %s", transport)
+		return oci.Pull(ctx, imgCache, p.from, tmpDir, ociPlatform, p.ociAuth, noHTTPS, buildArgs.noCleanUp)
 	}
 }
@@ -0,0 +1,353 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/cache"
+	"github.com/hpcng/singularity/internal/pkg/client"
+	"github.com/hpcng/singularity/internal/pkg/client/oras"
+	"github.com/hpcng/singularity/internal/pkg/util/uri"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/spf13/cobra"
+	scslibclient "github.com/sylabs/scs-library-client/client"
+)
+
+// pullEntry is an image listed in a --from-file manifest.
+type pullEntry struct {
+	from string
+	name string
+}
+
+// pullResult is the outcome of the pull of an image listed in a manifest.
+type pullResult struct {
+	URI   string `json:"uri"`
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+}
+
+// pullSummary is the JSON summary of the pull of the images listed in a
+// manifest.
+type pullSummary struct {
+	Pulled  []pullResult `json:"pulled"`
+	Skipped []pullResult `json:"skipped"`
+	Failed  []pullResult `json:"failed"`
+}
+
+// parsePullManifest parses a manifest listing one image URI per line,
+// optionally followed by the name of the image file. Empty lines and lines
+// starting with # are ignored. Image names are file names relative to the
+// --dir directory, names with a directory component are rejected so images
+// are never written outside of it.
+func parsePullManifest(r io.Reader) ([]pullEntry, error) {
+	var entries []pullEntry
+	names := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected an image URI and an optional name, got %q", n, line)
+		}
+
+		e := pullEntry{from: fields[0]}
+		if len(fields) == 2 {
+			e.name = fields[1]
+		} else {
+			e.name = defaultPullName(e.from)
+		}
+		name := filepath.Clean(e.name)
+		if filepath.IsAbs(e.name) || name != filepath.Base(name) || name == "." || name == ".." {
+			return nil, fmt.Errorf("line %d: image name %s is not a file name", n, e.name)
+		}
+		e.name = name
+		if prev, ok := names[e.name]; ok {
+			return nil, fmt.Errorf("line %d: image name %s already used at line %d", n, e.name, prev)
+		}
+		names[e.name] = n
+
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// pullFromManifest pulls the images listed in the --from-file manifest to
+// the --dir directory, at most --jobs at the same time, and prints a JSON
+// summary of the pulls. Progress bars are displayed on the standard error so
+// the standard output only holds the summary.
+func pullFromManifest(cmd *cobra.Command, imgCache *cache.Handle) {
+	ctx := client.WithProgressOutput(cmd.Context(), os.Stderr)
+
+	f, err := os.Open(pullFromFile)
+	if err != nil {
+		sylog.Fatalf("Could not open %s: %v", pullFromFile, err)
+	}
+	entries, err := parsePullManifest(f)
+	f.Close()
+	if err != nil {
+		sylog.Fatalf("While parsing %s: %v", pullFromFile, err)
+	}
+
+	if pullDir != "" {
+		if err := os.MkdirAll(pullDir, 0o755); err != nil {
+			sylog.Fatalf("Could not create %s: %v", pullDir, err)
+		}
+	}
+	if pullJobs < 1 {
+		sylog.Fatalf("Invalid number of jobs %d", pullJobs)
+	}
+
+	var ociAuth *ocitypes.DockerAuthConfig
+	for _, e := range entries {
+		if transport, _ := uri.Split(e.from); needsDockerCredentials(transport) {
+			ociAuth, err = makeDockerCredentials(cmd)
+			if err != nil {
+				sylog.Fatalf("While creating Docker credentials: %v", err)
+			}
+			break
+		}
+	}
+
+	digestLock := loadDigestLock()
+
+	results := make([]pullResult, len(entries))
+	skipped := make([]bool, len(entries))
+
+	// all jobs display their progress bars in the same container
+	mp := client.NewMultiProgress(ctx)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, pullJobs)
+
+	for i, e := range entries {
+		results[i] = pullResult{
+			URI:  e.from,
+			Path: filepath.Join(pullDir, e.name),
+		}
+
+		// library configuration is resolved sequentially, as it sets
+		// the global remote endpoint
+		p, err := newImagePull(e.from, results[i].Path, ociAuth)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		p.digestLock = digestLock
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(i int, p *imagePull) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			ctx := client.WithMultiProgress(ctx, mp, filepath.Base(p.to))
+			err := p.checkDigest(ctx)
+			if err == nil {
+				skipped[i], err = p.pullIfOutdated(ctx, imgCache)
+			}
+			if err != nil {
+				sylog.Errorf("Failed to pull %s: %v", p.from, err)
+				results[i].Error = err.Error()
+				return
+			}
+			p.recordDigest()
+		}(i, p)
+	}
+	wg.Wait()
+	mp.Wait()
+
+	if digestLock != nil {
+		if err := digestLock.Save(); err != nil {
+			sylog.Fatalf("While writing digest lock file: %v", err)
+		}
+	}
+
+	summary := pullSummary{
+		Pulled:  []pullResult{},
+		Skipped: []pullResult{},
+		Failed:  []pullResult{},
+	}
+	for i, r := range results {
+		switch {
+		case r.Error != "":
+			summary.Failed = append(summary.Failed, r)
+		case skipped[i]:
+			summary.Skipped = append(summary.Skipped, r)
+		default:
+			summary.Pulled = append(summary.Pulled, r)
+		}
+	}
+
+	b, err := json.MarshalIndent(summary, "", "\t")
+	if err != nil {
+		sylog.Fatalf("Could not format pull summary: %v", err)
+	}
+	fmt.Println(string(b))
+
+	if len(summary.Failed) > 0 {
+		sylog.Fatalf("Failed to pull %d of %d images", len(summary.Failed), len(entries))
+	}
+}
+
+// pullIfOutdated pulls the image unless its destination file is up to date,
+// in which case it returns true. An existing destination file is up to date
+// if it's identical to the cached image. With the cache disabled, it's
+// compared to the checksum of the remote image for library:// and oras://
+// images, and to a temporary pull of the image otherwise. Outdated files are
+// only replaced with --force.
+func (p *imagePull) pullIfOutdated(ctx context.Context, imgCache *cache.Handle) (bool, error) {
+	if _, err := os.Stat(p.to); os.IsNotExist(err) {
+		return false, p.toFile(ctx, imgCache)
+	} else if err != nil {
+		return false, err
+	}
+
+	if imgCache.IsDisabled() {
+		return p.pullIfChanged(ctx, imgCache)
+	}
+
+	src, err := p.toCache(ctx, imgCache)
+	if err != nil {
+		return false, fmt.Errorf("error fetching image to cache: %v", err)
+	}
+	same, err := sameImage(src, p.to)
+	if err != nil {
+		return false, err
+	}
+	if same {
+		sylog.Infof("Image %s is up to date", p.to)
+		return true, nil
+	}
+	if !forceOverwrite {
+		return false, p.outdatedError()
+	}
+
+	return false, p.toFile(ctx, imgCache)
+}
+
+// outdatedError returns the error reported when the existing destination
+// file differs from the image and --force isn't set.
+func (p *imagePull) outdatedError() error {
+	return fmt.Errorf("image file %s already exists and differs from %s - will not overwrite", p.to, p.from)
+}
+
+// pullIfChanged pulls the image without the cache unless its existing
+// destination file is identical to the remote image, in which case it
+// returns true.
+func (p *imagePull) pullIfChanged(ctx context.Context, imgCache *cache.Handle) (bool, error) {
+	remote, local, err := p.remoteHash(ctx)
+	if err != nil {
+		return false, err
+	}
+	if remote != "" {
+		if remote == local {
+			sylog.Infof("Image %s is up to date", p.to)
+			return true, nil
+		}
+		if !forceOverwrite {
+			return false, p.outdatedError()
+		}
+		return false, p.toFile(ctx, imgCache)
+	}
+
+	// the image has no checksum to compare to, it's pulled next to the
+	// destination file and compared with it
+	dir, err := ioutil.TempDir(filepath.Dir(p.to), ".pull-")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(dir)
+
+	tp := *p
+	tp.to = filepath.Join(dir, filepath.Base(p.to))
+	if err := tp.toFile(ctx, imgCache); err != nil {
+		return false, err
+	}
+	same, err := sameImage(tp.to, p.to)
+	if err != nil {
+		return false, err
+	}
+	if same {
+		sylog.Infof("Image %s is up to date", p.to)
+		return true, nil
+	}
+	if !forceOverwrite {
+		return false, p.outdatedError()
+	}
+	return false, os.Rename(tp.to, p.to)
+}
+
+// remoteHash returns the checksum of the remote image and of the existing
+// destination file as it was pulled, for library:// and oras:// images which
+// are stored as-is, empty strings are returned for other images.
+func (p *imagePull) remoteHash(ctx context.Context) (remote, local string, err error) {
+	switch p.transport {
+	case LibraryProtocol, "":
+		c, err := scslibclient.NewClient(p.libraryConfig)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to initialize client library: %v", err)
+		}
+		ref := fmt.Sprintf("%s:%s", p.libraryRef.Path, p.libraryRef.Tags[0])
+		img, err := c.GetImage(ctx, pullArch, ref)
+		if err != nil {
+			return "", "", fmt.Errorf("while getting library image %s: %v", ref, err)
+		}
+		local, err := imageDigest(p.to)
+		if err != nil {
+			return "", "", err
+		}
+		// library checksums are in the sha256.<hex> format
+		return strings.Replace(img.Hash, ".", ":", 1), local, nil
+	case OrasProtocol:
+		remote, err := oras.ImageSHA(ctx, p.from, p.ociAuth)
+		if err != nil {
+			return "", "", err
+		}
+		local, err := imageDigest(p.to)
+		if err != nil {
+			return "", "", err
+		}
+		return remote, local, nil
+	}
+	return "", "", nil
+}
+
+// sameImage returns whether the image files a and b have the same content,
+// as they were pulled.
+func sameImage(a, b string) (bool, error) {
+	ha, err := imageDigest(a)
+	if err != nil {
+		return false, err
+	}
+	hb, err := imageDigest(b)
+	if err != nil {
+		return false, err
+	}
+	return ha == hb, nil
+}
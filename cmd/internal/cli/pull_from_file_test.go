@@ -0,0 +1,177 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hpcng/singularity/internal/pkg/cache"
+	useragent "github.com/hpcng/singularity/pkg/util/user-agent"
+)
+
+func TestParsePullManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []pullEntry
+		wantErr  bool
+	}{
+		{
+			name: "Valid",
+			manifest: `
+# images of the campaign
+docker://ubuntu:20.04
+library://alpine:3.11 alpine.sif
+
+  oras://registry/namespace/image:tag   image.sif
+`,
+			want: []pullEntry{
+				{from: "docker://ubuntu:20.04", name: "ubuntu_20.04.sif"},
+				{from: "library://alpine:3.11", name: "alpine.sif"},
+				{from: "oras://registry/namespace/image:tag", name: "image.sif"},
+			},
+		},
+		{
+			name:     "DuplicateName",
+			manifest: "docker://alpine:3.11 alpine.sif\nlibrary://alpine:3.11 alpine.sif\n",
+			wantErr:  true,
+		},
+		{
+			name:     "DuplicateCleanedName",
+			manifest: "docker://alpine:3.11 alpine.sif\nlibrary://alpine:3.11 ./alpine.sif\n",
+			wantErr:  true,
+		},
+		{
+			name:     "RelativePath",
+			manifest: "docker://alpine:3.11 ../../home/user/.bashrc\n",
+			wantErr:  true,
+		},
+		{
+			name:     "Subdirectory",
+			manifest: "docker://alpine:3.11 images/alpine.sif\n",
+			wantErr:  true,
+		},
+		{
+			name:     "AbsolutePath",
+			manifest: "docker://alpine:3.11 /tmp/alpine.sif\n",
+			wantErr:  true,
+		},
+		{
+			name:     "ParentDirectory",
+			manifest: "docker://alpine:3.11 ..\n",
+			wantErr:  true,
+		},
+		{
+			name:     "TooManyFields",
+			manifest: "docker://alpine:3.11 alpine.sif extra\n",
+			wantErr:  true,
+		},
+		{
+			name:     "CommentsOnly",
+			manifest: "# no images\n\n",
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePullManifest(strings.NewReader(tt.manifest))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPullIfOutdated(t *testing.T) {
+	useragent.InitValue("singularity", "3.0.0-alpha.1-303-gaed8d30-dirty")
+
+	var mu sync.Mutex
+	content := "image content"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprint(w, content)
+	}))
+	defer srv.Close()
+
+	setContent := func(c string) {
+		mu.Lock()
+		content = c
+		mu.Unlock()
+	}
+
+	defer func(force bool) { forceOverwrite = force }(forceOverwrite)
+
+	for _, disable := range []bool{true, false} {
+		t.Run(fmt.Sprintf("CacheDisabled=%t", disable), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "pull-outdated-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			imgCache, err := cache.New(cache.Config{ParentDir: dir, Disable: disable})
+			if err != nil {
+				t.Fatalf("while creating cache: %v", err)
+			}
+
+			setContent("image content")
+			forceOverwrite = false
+
+			to := filepath.Join(dir, "image.sif")
+			p, err := newImagePull(srv.URL+"/image.sif", to, nil)
+			if err != nil {
+				t.Fatalf("while creating pull: %v", err)
+			}
+			ctx := context.Background()
+
+			skipped, err := p.pullIfOutdated(ctx, imgCache)
+			if err != nil || skipped {
+				t.Fatalf("got skipped %t and error %v for a new image, want pull", skipped, err)
+			}
+
+			// an unchanged image is skipped
+			skipped, err = p.pullIfOutdated(ctx, imgCache)
+			if err != nil || !skipped {
+				t.Fatalf("got skipped %t and error %v for an unchanged image, want skip", skipped, err)
+			}
+
+			// a changed image isn't replaced without --force
+			setContent("new image content")
+			if _, err := p.pullIfOutdated(ctx, imgCache); err == nil {
+				t.Fatalf("unexpected success replacing a changed image without --force")
+			}
+
+			// a changed image is pulled again with --force
+			forceOverwrite = true
+			skipped, err = p.pullIfOutdated(ctx, imgCache)
+			if err != nil || skipped {
+				t.Fatalf("got skipped %t and error %v for a changed image, want pull", skipped, err)
+			}
+			b, err := ioutil.ReadFile(to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != "new image content" {
+				t.Errorf("got image content %q, want %q", b, "new image content")
+			}
+		})
+	}
+}
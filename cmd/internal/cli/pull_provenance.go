@@ -0,0 +1,117 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/client/oras"
+	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/inspect"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// provenanceDescriptor returns the descriptor of the provenance record of
+// the SIF image fimg, or nil if there is none.
+func provenanceDescriptor(fimg *sif.FileImage) *sif.Descriptor {
+	for i, d := range fimg.DescrArr {
+		if d.Used && d.Datatype == sif.DataGenericJSON && d.GetName() == image.SIFDescProvenanceJSON {
+			return &fimg.DescrArr[i]
+		}
+	}
+	return nil
+}
+
+// isSigned returns whether the SIF image fimg holds signatures.
+func isSigned(fimg *sif.FileImage) bool {
+	for _, d := range fimg.DescrArr {
+		if d.Used && d.Datatype == sif.DataSignature {
+			return true
+		}
+	}
+	return false
+}
+
+// recordProvenance records the provenance of the image pulled from the URI
+// from in the SIF file at path, along with the checksum of the file as
+// pulled. Images converted from docker and OCI sources already hold their
+// provenance. Other SIF images are stored as is by their transport, their
+// provenance is added to the object group of their primary partition, as
+// images built locally. Signed images are left unmodified, as any object
+// added to them would fail their verification, and images in other formats
+// can't record their provenance.
+func recordProvenance(path, from string) error {
+	checksum, err := oras.ImageHash(path)
+	if err != nil {
+		return err
+	}
+
+	fimg, err := sif.LoadContainer(path, false)
+	if err != nil {
+		sylog.Debugf("Not recording provenance of %s: %s", path, err)
+		return nil
+	}
+	defer fimg.UnloadContainer()
+
+	if provenanceDescriptor(&fimg) != nil {
+		return nil
+	}
+	if isSigned(&fimg) {
+		sylog.Verbosef("Not recording provenance of signed image %s", path)
+		return nil
+	}
+
+	groupID := uint32(sif.DescrDefaultGroup)
+	if d, _, err := fimg.GetPartPrimSys(); err == nil && d.Groupid != sif.DescrUnusedGroup {
+		groupID = d.Groupid
+	}
+
+	p, err := json.Marshal(inspect.Provenance{
+		Source:   from,
+		Checksum: checksum,
+		Time:     time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	in := sif.DescriptorInput{
+		Datatype: sif.DataGenericJSON,
+		Groupid:  groupID,
+		Link:     sif.DescrUnusedLink,
+		Data:     p,
+		Fname:    image.SIFDescProvenanceJSON,
+	}
+	in.Size = int64(binary.Size(in.Data))
+
+	if err := fimg.AddObject(in); err != nil {
+		return fmt.Errorf("while adding provenance to %s: %s", path, err)
+	}
+	return nil
+}
+
+// imageDigest returns the checksum of the image file at path, as it was
+// pulled if its provenance records it.
+func imageDigest(path string) (string, error) {
+	if fimg, err := sif.LoadContainer(path, true); err == nil {
+		defer fimg.UnloadContainer()
+
+		if d := provenanceDescriptor(&fimg); d != nil {
+			var p inspect.Provenance
+			if err := json.Unmarshal(d.GetData(&fimg), &p); err != nil {
+				return "", fmt.Errorf("while decoding provenance of %s: %s", path, err)
+			}
+			if p.Checksum != "" {
+				return p.Checksum, nil
+			}
+		}
+	}
+	return oras.ImageHash(path)
+}
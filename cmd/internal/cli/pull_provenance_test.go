@@ -0,0 +1,130 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/client/oras"
+	"github.com/hpcng/singularity/pkg/inspect"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestRecordProvenance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pull-provenance-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "image.sif")
+	data := []byte("image data")
+	created, err := sif.CreateContainer(sif.CreateInfo{
+		Pathname:   path,
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		ID:         uuid.Must(uuid.NewV4()),
+		InputDescr: []sif.DescriptorInput{
+			{
+				Datatype: sif.DataGeneric,
+				Groupid:  sif.DescrDefaultGroup,
+				Link:     sif.DescrUnusedLink,
+				Data:     data,
+				Size:     int64(len(data)),
+				Fname:    "data",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("while creating SIF: %v", err)
+	}
+	created.UnloadContainer()
+
+	pulled, err := oras.ImageHash(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recordProvenance(path, "oras://registry/image:tag"); err != nil {
+		t.Fatalf("while recording provenance: %v", err)
+	}
+
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := provenanceDescriptor(&fimg)
+	if d == nil {
+		fimg.UnloadContainer()
+		t.Fatalf("no provenance recorded")
+	}
+	if d.Groupid != sif.DescrDefaultGroup {
+		t.Errorf("provenance recorded in group %#x, want %#x", d.Groupid, sif.DescrDefaultGroup)
+	}
+	var p inspect.Provenance
+	err = json.Unmarshal(d.GetData(&fimg), &p)
+	fimg.UnloadContainer()
+	if err != nil {
+		t.Fatalf("while decoding provenance: %v", err)
+	}
+	if p.Source != "oras://registry/image:tag" || p.Checksum != pulled {
+		t.Errorf("got provenance %+v, want source oras://registry/image:tag and checksum %s", p, pulled)
+	}
+
+	// the digest of the image is its checksum as pulled
+	if current, err := oras.ImageHash(path); err != nil {
+		t.Fatal(err)
+	} else if current == pulled {
+		t.Errorf("image unchanged by provenance record")
+	}
+	if digest, err := imageDigest(path); err != nil {
+		t.Fatalf("while getting image digest: %v", err)
+	} else if digest != pulled {
+		t.Errorf("got image digest %s, want %s", digest, pulled)
+	}
+
+	// the provenance is only recorded once
+	if err := recordProvenance(path, "oras://registry/other:tag"); err != nil {
+		t.Fatalf("while recording provenance: %v", err)
+	}
+	if digest, err := imageDigest(path); err != nil || digest != pulled {
+		t.Errorf("got image digest %s (error %v), want %s", digest, err, pulled)
+	}
+
+	// signed images are left as is
+	signed := filepath.Join(dir, "signed.sif")
+	b, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "internal", "app", "singularity", "testdata", "images", "one-group-signed.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(signed, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordProvenance(signed, "library://user/collection/image:tag"); err != nil {
+		t.Errorf("unexpected error for a signed image: %v", err)
+	}
+	if s, err := ioutil.ReadFile(signed); err != nil || !bytes.Equal(s, b) {
+		t.Errorf("signed image modified (error %v)", err)
+	}
+
+	// images in other formats are left as is
+	other := filepath.Join(dir, "image.img")
+	if err := ioutil.WriteFile(other, []byte("not a SIF image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordProvenance(other, "https://example.com/image.img"); err != nil {
+		t.Errorf("unexpected error for a non-SIF image: %v", err)
+	}
+	if b, err := ioutil.ReadFile(other); err != nil || string(b) != "not a SIF image" {
+		t.Errorf("non-SIF image modified: %q (error %v)", b, err)
+	}
+}
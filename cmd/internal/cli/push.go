@@ -14,6 +14,7 @@ import (
 	"github.com/hpcng/singularity/docs"
 	"github.com/hpcng/singularity/internal/app/singularity"
 	"github.com/hpcng/singularity/internal/pkg/client/oras"
+	"github.com/hpcng/singularity/internal/pkg/client/s3"
 	"github.com/hpcng/singularity/internal/pkg/remote/endpoint"
 	"github.com/hpcng/singularity/internal/pkg/util/uri"
 	"github.com/hpcng/singularity/pkg/cmdline"
@@ -137,6 +138,19 @@ var PushCmd = &cobra.Command{
 				sylog.Fatalf("Unable to push image to oci registry: %v", err)
 			}
 			sylog.Infof("Upload complete")
+		case S3Protocol:
+			if cmd.Flag(pushDescriptionFlag.Name).Changed {
+				sylog.Warningf("Description is not supported for push to s3. Ignoring it.")
+			}
+			c, err := s3.DefaultConfig()
+			if err != nil {
+				sylog.Fatalf("Unable to get s3 client configuration: %v", err)
+			}
+
+			if err := s3.UploadImage(ctx, file, dest, c); err != nil {
+				sylog.Fatalf("Unable to push image to s3: %v", err)
+			}
+			sylog.Infof("Upload complete")
 		default:
 			sylog.Fatalf("Unsupported transport type: %s", transport)
 		}
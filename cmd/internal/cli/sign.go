@@ -17,8 +17,11 @@ import (
 )
 
 var (
-	privKey int // -k encryption key (index from 'keys list') specification
-	signAll bool
+	privKey      int // -k encryption key (index from 'keys list') specification
+	signAll      bool
+	signKeyRef   string // --key X.509 private key path or PKCS#11 URI
+	signCertPath string // --certificate X.509 certificate chain path
+	signDetached string // --detached signature bundle path
 )
 
 // -g|--group-id
@@ -82,6 +85,35 @@ var signAllFlag = cmdline.Flag{
 	Deprecated:   "now the default behavior",
 }
 
+// --key
+var signKeyFlag = cmdline.Flag{
+	ID:           "signKeyFlag",
+	Value:        &signKeyRef,
+	DefaultValue: "",
+	Name:         "key",
+	Usage:        "sign with an X.509 private key, either a PEM file path or a PKCS#11 URI",
+	EnvKeys:      []string{"SIGN_KEY"},
+}
+
+// --certificate
+var signCertificateFlag = cmdline.Flag{
+	ID:           "signCertificateFlag",
+	Value:        &signCertPath,
+	DefaultValue: "",
+	Name:         "certificate",
+	Usage:        "PEM file containing the X.509 certificate chain associated to --key, signing certificate first",
+	EnvKeys:      []string{"SIGN_CERTIFICATE"},
+}
+
+// --detached
+var signDetachedFlag = cmdline.Flag{
+	ID:           "signDetachedFlag",
+	Value:        &signDetached,
+	DefaultValue: "",
+	Name:         "detached",
+	Usage:        "write signature(s) to this file instead of adding them to the image",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(SignCmd)
@@ -92,6 +124,9 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&signSifDescIDFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signKeyIdxFlag, SignCmd)
 		cmdManager.RegisterFlagForCmd(&signAllFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signKeyFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signCertificateFlag, SignCmd)
+		cmdManager.RegisterFlagForCmd(&signDetachedFlag, SignCmd)
 	})
 }
 
@@ -114,15 +149,34 @@ var SignCmd = &cobra.Command{
 func doSignCmd(cmd *cobra.Command, cpath string) {
 	var opts []singularity.SignOpt
 
-	// Set entity selector option, and ensure the entity is decrypted.
-	var f sypgp.EntitySelector
-	if cmd.Flag(signKeyIdxFlag.Name).Changed {
-		f = selectEntityAtIndex(privKey)
+	if signKeyRef != "" {
+		// Set X.509 key and certificate chain.
+		if cmd.Flag(signKeyIdxFlag.Name).Changed {
+			sylog.Fatalf("--keyidx and --key options are mutually exclusive")
+		}
+
+		key, certs, err := loadX509Signer(signKeyRef, signCertPath)
+		if err != nil {
+			sylog.Fatalf("Failed to load X.509 signing key: %s", err)
+		}
+		defer key.Close()
+
+		opts = append(opts, singularity.OptSignX509(key, certs))
 	} else {
-		f = selectEntityInteractive()
+		if signCertPath != "" {
+			sylog.Fatalf("--certificate requires --key")
+		}
+
+		// Set entity selector option, and ensure the entity is decrypted.
+		var f sypgp.EntitySelector
+		if cmd.Flag(signKeyIdxFlag.Name).Changed {
+			f = selectEntityAtIndex(privKey)
+		} else {
+			f = selectEntityInteractive()
+		}
+		f = decryptSelectedEntityInteractive(f)
+		opts = append(opts, singularity.OptSignEntitySelector(f))
 	}
-	f = decryptSelectedEntityInteractive(f)
-	opts = append(opts, singularity.OptSignEntitySelector(f))
 
 	// Set group option, if applicable.
 	if cmd.Flag(signSifGroupIDFlag.Name).Changed || cmd.Flag(signOldSifGroupIDFlag.Name).Changed {
@@ -134,10 +188,19 @@ func doSignCmd(cmd *cobra.Command, cpath string) {
 		opts = append(opts, singularity.OptSignObjects(sifDescID))
 	}
 
+	// Set detached option, if applicable.
+	if signDetached != "" {
+		opts = append(opts, singularity.OptSignDetached(signDetached))
+	}
+
 	// Sign the image.
 	fmt.Printf("Signing image: %s\n", cpath)
 	if err := singularity.Sign(cpath, opts...); err != nil {
 		sylog.Fatalf("Failed to sign container: %s", err)
 	}
+	if signDetached != "" {
+		fmt.Printf("Signature of %s created and written to %s\n", cpath, signDetached)
+		return
+	}
 	fmt.Printf("Signature created and applied to %s\n", cpath)
 }
@@ -57,6 +57,7 @@ var (
 	forceOverwrite      bool
 	noHTTPS             bool
 	tmpDir              string
+	ociPlatform         string
 )
 
 const (
@@ -194,6 +195,16 @@ var commonNoHTTPSFlag = cmdline.Flag{
 	EnvKeys:      []string{"NOHTTPS"},
 }
 
+// --platform
+var commonPlatformFlag = cmdline.Flag{
+	ID:           "commonPlatformFlag",
+	Value:        &ociPlatform,
+	DefaultValue: "",
+	Name:         "platform",
+	Usage:        "platform (os/arch[/variant]) of the image to pull from OCI sources (default host platform)",
+	EnvKeys:      []string{"PLATFORM"},
+}
+
 // --tmpdir
 var commonTmpDirFlag = cmdline.Flag{
 	ID:           "commonTmpDirFlag",
@@ -7,12 +7,15 @@
 package cli
 
 import (
+	"crypto/x509"
 	"fmt"
 	"os"
 
 	"github.com/hpcng/singularity/docs"
 	"github.com/hpcng/singularity/internal/app/singularity"
 	"github.com/hpcng/singularity/internal/pkg/remote/endpoint"
+	"github.com/hpcng/singularity/internal/pkg/syecl"
+	"github.com/hpcng/singularity/internal/pkg/sypki"
 	"github.com/hpcng/singularity/pkg/cmdline"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/spf13/cobra"
@@ -25,6 +28,15 @@ var (
 	jsonVerify   bool   // -j flag
 	verifyAll    bool
 	verifyLegacy bool
+
+	verifyX509     bool
+	verifyCABundle string
+	verifySubjects []string
+	verifySANs     []string
+
+	verifyPolicy string
+
+	verifySignature string
 )
 
 // -u|--url
@@ -118,6 +130,62 @@ var verifyLegacyFlag = cmdline.Flag{
 	Usage:        "enable verification of (insecure) legacy signatures",
 }
 
+// --x509
+var verifyX509Flag = cmdline.Flag{
+	ID:           "verifyX509Flag",
+	Value:        &verifyX509,
+	DefaultValue: false,
+	Name:         "x509",
+	Usage:        "verify X.509 signatures against the system certificate pool instead of OpenPGP signatures",
+}
+
+// --ca-bundle
+var verifyCABundleFlag = cmdline.Flag{
+	ID:           "verifyCABundleFlag",
+	Value:        &verifyCABundle,
+	DefaultValue: "",
+	Name:         "ca-bundle",
+	Usage:        "verify X.509 signatures against the CA certificates in this PEM file (implies --x509)",
+	EnvKeys:      []string{"VERIFY_CA_BUNDLE"},
+}
+
+// --trusted-subject
+var verifyTrustedSubjectFlag = cmdline.Flag{
+	ID:           "verifyTrustedSubjectFlag",
+	Value:        &verifySubjects,
+	DefaultValue: cmdline.StringArray{}, // to allow commas in distinguished names
+	Name:         "trusted-subject",
+	Usage:        "only trust X.509 signing certificates with this subject DN or common name (can be specified multiple times)",
+}
+
+// --trusted-san
+var verifyTrustedSANFlag = cmdline.Flag{
+	ID:           "verifyTrustedSANFlag",
+	Value:        &verifySANs,
+	DefaultValue: []string{},
+	Name:         "trusted-san",
+	Usage:        "only trust X.509 signing certificates with this subject alternative name (email, DNS, URI)",
+}
+
+// --policy
+var verifyPolicyFlag = cmdline.Flag{
+	ID:           "verifyPolicyFlag",
+	Value:        &verifyPolicy,
+	DefaultValue: "",
+	Name:         "policy",
+	Usage:        "verify signatures against the rules of this verification policy file",
+	EnvKeys:      []string{"VERIFY_POLICY"},
+}
+
+// --signature
+var verifySignatureFlag = cmdline.Flag{
+	ID:           "verifySignatureFlag",
+	Value:        &verifySignature,
+	DefaultValue: "",
+	Name:         "signature",
+	Usage:        "verify the detached signature(s) in this file instead of the signatures in the image",
+}
+
 func init() {
 	addCmdInit(func(cmdManager *cmdline.CommandManager) {
 		cmdManager.RegisterCmd(VerifyCmd)
@@ -131,6 +199,12 @@ func init() {
 		cmdManager.RegisterFlagForCmd(&verifyJSONFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyAllFlag, VerifyCmd)
 		cmdManager.RegisterFlagForCmd(&verifyLegacyFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyX509Flag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyCABundleFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyTrustedSubjectFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyTrustedSANFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifyPolicyFlag, VerifyCmd)
+		cmdManager.RegisterFlagForCmd(&verifySignatureFlag, VerifyCmd)
 	})
 }
 
@@ -153,8 +227,53 @@ var VerifyCmd = &cobra.Command{
 func doVerifyCmd(cmd *cobra.Command, cpath string) {
 	var opts []singularity.VerifyOpt
 
+	x509Verify := verifyX509 || verifyCABundle != ""
+
+	if verifyPolicy != "" {
+		if x509Verify || verifyLegacy || verifyAll {
+			sylog.Fatalf("--policy can't be used with --x509, --ca-bundle, --legacy-insecure or --all")
+		}
+		if cmd.Flag(verifySifGroupIDFlag.Name).Changed || cmd.Flag(verifyOldSifGroupIDFlag.Name).Changed ||
+			cmd.Flag(verifySifDescSifIDFlag.Name).Changed || cmd.Flag(verifySifDescIDFlag.Name).Changed {
+			sylog.Fatalf("--policy can't be used with --group-id or --sif-id, object groups are selected by the policy")
+		}
+	}
+
+	if verifySignature != "" {
+		if verifyPolicy != "" || verifyLegacy || verifyAll {
+			sylog.Fatalf("--signature can't be used with --policy, --legacy-insecure or --all")
+		}
+		opts = append(opts, singularity.OptVerifyDetached(verifySignature))
+	}
+
+	if x509Verify {
+		if verifyLegacy || verifyAll {
+			sylog.Fatalf("--legacy-insecure and --all can't be used with X.509 signatures")
+		}
+
+		// Set X.509 roots, the system pool is used when no bundle is provided.
+		var roots *x509.CertPool
+		if verifyCABundle != "" {
+			pool, err := sypki.LoadCertPool(verifyCABundle)
+			if err != nil {
+				sylog.Fatalf("Failed to load CA bundle: %s", err)
+			}
+			roots = pool
+		}
+		opts = append(opts, singularity.OptVerifyX509(roots))
+
+		if len(verifySubjects) > 0 {
+			opts = append(opts, singularity.OptVerifyTrustedSubjects(verifySubjects...))
+		}
+		if len(verifySANs) > 0 {
+			opts = append(opts, singularity.OptVerifyTrustedSANs(verifySANs...))
+		}
+	} else if len(verifySubjects) > 0 || len(verifySANs) > 0 {
+		sylog.Fatalf("--trusted-subject and --trusted-san require --x509 or --ca-bundle")
+	}
+
 	// Set keyserver option, if applicable.
-	if !localVerify {
+	if !localVerify && !x509Verify {
 		co, err := getKeyserverClientOpts(keyServerURI, endpoint.KeyserverVerifyOp)
 		if err != nil {
 			sylog.Fatalf("Error while getting keyserver client config: %v", err)
@@ -163,6 +282,11 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 		opts = append(opts, singularity.OptVerifyUseKeyServer(co...))
 	}
 
+	if verifyPolicy != "" {
+		doVerifyPolicyCmd(cmd, cpath, opts)
+		return
+	}
+
 	// Set group option, if applicable.
 	if cmd.Flag(verifySifGroupIDFlag.Name).Changed || cmd.Flag(verifyOldSifGroupIDFlag.Name).Changed {
 		opts = append(opts, singularity.OptVerifyGroup(sifGroupID))
@@ -188,6 +312,7 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 		var kl keyList
 
 		opts = append(opts, singularity.OptVerifyCallback(getJSONCallback(&kl)))
+		opts = append(opts, singularity.OptVerifyX509Callback(getX509JSONCallback(&kl)))
 
 		verifyErr := singularity.Verify(cmd.Context(), cpath, opts...)
 
@@ -201,6 +326,7 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 		}
 	} else {
 		opts = append(opts, singularity.OptVerifyCallback(outputVerify))
+		opts = append(opts, singularity.OptVerifyX509Callback(outputX509Verify))
 
 		fmt.Printf("Verifying image: %s\n", cpath)
 
@@ -211,3 +337,53 @@ func doVerifyCmd(cmd *cobra.Command, cpath string) {
 		fmt.Printf("Container verified: %s\n", cpath)
 	}
 }
+
+// doVerifyPolicyCmd verifies the image at cpath against the verification policy file specified
+// with --policy.
+func doVerifyPolicyCmd(cmd *cobra.Command, cpath string, opts []singularity.VerifyOpt) {
+	p, err := syecl.LoadPolicy(verifyPolicy)
+	if err != nil {
+		sylog.Fatalf("Failed to load verification policy: %s", err)
+	}
+	if err := p.Validate(); err != nil {
+		sylog.Fatalf("Invalid verification policy %s: %s", verifyPolicy, err)
+	}
+
+	if jsonVerify {
+		var kl keyList
+
+		opts = append(opts, singularity.OptVerifyCallback(getJSONCallback(&kl)))
+
+		report, verifyErr := singularity.VerifyPolicy(cmd.Context(), cpath, p, opts...)
+		kl.Policy = report
+
+		// Always output JSON.
+		if err := outputJSON(os.Stdout, kl); err != nil {
+			sylog.Fatalf("Failed to output JSON: %v", err)
+		}
+
+		if verifyErr != nil {
+			sylog.Fatalf("Failed to verify container: %s", verifyErr)
+		}
+		if err := report.Err(); err != nil {
+			sylog.Fatalf("Failed to verify container: %s", err)
+		}
+		return
+	}
+
+	opts = append(opts, singularity.OptVerifyCallback(outputVerify))
+
+	fmt.Printf("Verifying image: %s\n", cpath)
+
+	report, err := singularity.VerifyPolicy(cmd.Context(), cpath, p, opts...)
+	if err != nil {
+		sylog.Fatalf("Failed to verify container: %s", err)
+	}
+	outputPolicyReport(report)
+
+	if err := report.Err(); err != nil {
+		sylog.Fatalf("Failed to verify container: %s", err)
+	}
+
+	fmt.Printf("Container verified: %s\n", cpath)
+}
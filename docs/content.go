@@ -61,7 +61,8 @@ Enterprise Performance Computing (EPC)`
       library://  an image library (default https://cloud.sylabs.io/library)
       docker://   a Docker/OCI registry (default Docker Hub)
       shub://     a Singularity registry (default Singularity Hub)
-      oras://     an OCI registry that holds SIF files using ORAS`
+      oras://     an OCI registry that holds SIF files using ORAS
+      s3://       a SIF image stored in an S3-compatible object store`
 
 	BuildExample string = `
 
@@ -155,7 +156,13 @@ Enterprise Performance Computing (EPC)`
       Build a base sandbox from DockerHub, make changes to it, then build sif
           $ singularity build --sandbox /tmp/debian docker://debian:latest
           $ singularity exec --writable /tmp/debian apt-get install python
-          $ singularity build /tmp/debian2.sif /tmp/debian`
+          $ singularity build /tmp/debian2.sif /tmp/debian
+
+      Build a sif image with zstd compression and 1M squashfs block size:
+          $ singularity build --compress zstd --compress-level 19 --block-size 1M /tmp/debian3.sif docker://debian:latest
+
+      Build a sif image for another platform from a multi-platform image:
+          $ singularity build --platform linux/arm64 /tmp/debian4.sif docker://debian:latest`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Cache
@@ -164,7 +171,12 @@ Enterprise Performance Computing (EPC)`
 	CacheShort string = `Manage the local cache`
 	CacheLong  string = `
   Manage your local Singularity cache. You can list/clean using the specific 
-  types.`
+  types.
+
+  The size of the cache can be limited with the 'cache max size' directive of
+  singularity.conf, or the SINGULARITY_CACHE_MAXSIZE environment variable
+  (e.g. 10G). The least recently used entries are evicted when a new entry is
+  written to a cache exceeding this size.`
 	CacheExample string = `
   All group commands have their own help output:
 
@@ -196,7 +208,8 @@ Enterprise Performance Computing (EPC)`
 	CacheListShort string = `List your local Singularity cache`
 	CacheListLong  string = `
   This will list your local cache (stored at $HOME/.singularity/cache if
-  SINGULARITY_CACHEDIR is not set).`
+  SINGULARITY_CACHEDIR is not set). With --verbose, the creation and last use
+  dates of each entry are displayed.`
 	CacheListExample string = `
   All group commands have their own help output:
 
@@ -204,6 +217,22 @@ Enterprise Performance Computing (EPC)`
   $ singularity help cache list --type=library,oci
   $ singularity cache list --help`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// Cache Prefetch
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	CachePrefetchUse   string = `prefetch [prefetch options...] <URI> [<URI>...]`
+	CachePrefetchShort string = `Pull images into the shared system cache (root user only)`
+	CachePrefetchLong  string = `
+  This will pull images into the shared system cache, set by the 'shared cache
+  dir' directive of singularity.conf. The shared cache is consulted before the
+  cache of each user, so images pulled once by the administrator are available
+  to all users of the host without being copied to their own cache. Users have
+  read-only access to the shared cache. The checksum of the shared images is
+  recorded by this command in an index of the shared cache, and images which
+  don't match it are not used. Images are hashed again each time they are used.`
+	CachePrefetchExample string = `
+  $ sudo singularity cache prefetch library://alpine:latest docker://ubuntu:20.04`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// key
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -229,10 +258,14 @@ Enterprise Performance Computing (EPC)`
 	KeyImportShort string = `Import a local key into the local or global keyring`
 	KeyImportLong  string = `
   The 'key import' command allows you to add a key to your local or global keyring
-  from a specific file.`
+  from a specific file. Importing a revocation certificate revokes the matching
+  public key of the keyring.`
 	KeyImportExample string = `
   $ singularity key import ./my-key.asc
 
+  # Revoke a public key with its revocation certificate
+  $ singularity key import ./my-key-revocation.asc
+
   # Import into global keyring (root user only)
   $ singularity key import --global ./my-key.asc`
 
@@ -272,7 +305,8 @@ Enterprise Performance Computing (EPC)`
 	KeyListShort string = `List keys in your local or in the global keyring`
 	KeyListLong  string = `
   List your local keys in your keyring. Will list public (trusted) keys
-  by default.`
+  by default, along with their trust level (T:), and their expiration (E:)
+  and revocation (R:) dates if any.`
 	KeyListExample string = `
   $ singularity key list
   $ singularity key list --secret
@@ -335,6 +369,28 @@ Enterprise Performance Computing (EPC)`
 	KeyRemoveExample string = `
   $ singularity key remove D87FE3AF5C1F063FCBCC9B02F812842B5EEE5934`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// key trust
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	KeyTrustUse   string = `trust [trust options...] <fingerprint>`
+	KeyTrustShort string = `Set the trust level of a public key of your local or the global keyring`
+	KeyTrustLong  string = `
+  The 'key trust' command sets how much a public key of the local or the
+  global keyring is trusted to sign images:
+    full:     signatures made with the key are trusted
+    marginal: signatures made with the key are accepted with a warning
+    never:    signatures made with the key are rejected
+    unknown:  the default, signatures are accepted with a warning
+
+  Trust levels set in the local keyring take precedence over those set in the
+  global keyring. 'singularity verify' also rejects signatures made with revoked
+  keys, and warns about expired keys.`
+	KeyTrustExample string = `
+  $ singularity key trust --level full D87FE3AF5C1F063FCBCC9B02F812842B5EEE5934
+
+  # distrust a key for all users (root user only)
+  $ singularity key trust --global --level never D87FE3AF5C1F063FCBCC9B02F812842B5EEE5934`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// delete
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -376,6 +432,14 @@ Enterprise Performance Computing (EPC)`
   The capabilities argument must be separated by commas and is not case 
   sensitive.
 
+  Capabilities added with --fingerprint or --execgroup are granted to any user
+  running a SIF image signed by the key with this fingerprint, or allowed by
+  the ECL execgroup with this tag name. Signatures are verified with the global
+  keyring, and revoked, expired or distrusted keys grant no capability. Only
+  whitelist, whitestrict and policy execgroups of an activated ECL grant
+  capabilities, legacy signatures never do. The image file and its directory
+  must be owned by root and not writable by group and others.
+
   To see available capabilities, type "singularity capability avail" or refer to
   capabilities manual "man 7 capabilities".`
 	CapabilityAddExample string = `
@@ -384,7 +448,11 @@ Enterprise Performance Computing (EPC)`
 
   To add all capabilities to a user:
 
-  $ sudo singularity capability add --user nobody all`
+  $ sudo singularity capability add --user nobody all
+
+  To let any user ping from images signed by a trusted key:
+
+  $ sudo singularity capability add --fingerprint 8883491F4268F173C6E5DC49323042233D602F10 net_raw`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// capability drop
@@ -406,7 +474,11 @@ Enterprise Performance Computing (EPC)`
 
   To drop all capabilities for a user:
 
-  $ sudo singularity capability drop --user nobody all`
+  $ sudo singularity capability drop --user nobody all
+
+  To drop a capability granted to images of an ECL execgroup:
+
+  $ sudo singularity capability drop --execgroup network net_raw`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// capability list
@@ -470,7 +542,9 @@ Enterprise Performance Computing (EPC)`
   shub://*            A container hosted on Singularity Hub.
 
   oras://*            A SIF container hosted on an OCI registry that supports
-                      the OCI Registry As Storage (ORAS) specification.`
+                      the OCI Registry As Storage (ORAS) specification.
+
+  s3://*              A SIF container stored in an S3-compatible object store.`
 	ExecUse   string = `exec [exec options...] <container> <command>`
 	ExecShort string = `Run a command within a container`
 	ExecLong  string = `
@@ -481,7 +555,37 @@ Enterprise Performance Computing (EPC)`
   $ cat hello_world.py | singularity exec /tmp/debian.sif python
   $ sudo singularity exec --writable /tmp/debian.sif apt-get update
   $ singularity exec instance://my_instance ps -ef
-  $ singularity exec library://centos cat /etc/os-release`
+  $ singularity exec library://centos cat /etc/os-release
+
+  Record the system calls of a command into a seccomp profile, which can then
+  be used to run it with --security seccomp:profile.json (requires a kernel
+  5.5 or later). Recording stops a second after the command exited, system
+  calls of processes it left running then fail with ENOSYS:
+
+  $ singularity exec --security seccomp:record=profile.json /tmp/debian.sif ls
+  $ singularity exec --security seccomp:profile.json /tmp/debian.sif ls
+
+  Restrict filesystem access with Landlock, on kernels supporting it, to read
+  access beneath /data and the system directories of the container, and
+  write access beneath /scratch:
+
+  $ singularity exec --security landlock:ro=/data,rw=/scratch /tmp/debian.sif ./job.sh
+
+  Run a command in its own network namespace with user-mode networking, as a
+  non-root user with slirp4netns installed, forwarding port 8080 of the host
+  to port 80 of the container:
+
+  $ singularity exec --userns --net --network slirp --network-args portmap=8080:80/tcp /tmp/debian.sif ./server
+
+  Limit the ingress and egress bandwidth of the container network interface
+  with the CNI bandwidth plugin, rates are in bits per second:
+
+  $ sudo singularity exec --net --network-args "bandwidth=ingress:10M,egress:5M" /tmp/debian.sif ./download.sh
+
+  Tag the traffic of the container with the traffic control class 10:1, and
+  give it the priority 5 on the host interface ib0, as root:
+
+  $ sudo singularity exec --net --network macvlan --network-args "classid=10:1;priority=ib0:5" /tmp/debian.sif ./transfer.sh`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance
@@ -522,6 +626,46 @@ Enterprise Performance Computing (EPC)`
   test               11963     /home/mibauer/singularity/sinstance/test.sif
   test2              16219     /home/mibauer/singularity/sinstance/test.sif`
 
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	// instance inspect
+	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
+	InstanceInspectUse   string = `inspect [inspect options...] <instance name>`
+	InstanceInspectShort string = `Show information about a named Singularity instance`
+	InstanceInspectLong  string = `
+  The instance inspect command shows information about a running instance in
+  JSON format, with the details of each network attached to the instance: the
+  interface name, IPv4/IPv6 addresses, MAC address, gateways and active port
+  mappings.`
+	InstanceInspectExample string = `
+  $ sudo singularity instance start --net --network-args "portmap=8080:80/tcp" nginx.sif web
+  $ sudo singularity instance inspect web
+  {
+  	"instance": "web",
+  	"pid": 11963,
+  	"img": "/home/mibauer/nginx.sif",
+  	"ip": "10.22.0.2",
+  	"logErrPath": "/root/.singularity/instances/logs/host/root/web.err",
+  	"logOutPath": "/root/.singularity/instances/logs/host/root/web.out",
+  	"networks": [
+  		{
+  			"network": "bridge",
+  			"interface": "eth0",
+  			"mac": "5e:d4:82:5f:1c:a3",
+  			"ipv4": [
+  				"10.22.0.2/16"
+  			],
+  			"gateway4": "10.22.0.1",
+  			"portMappings": [
+  				{
+  					"hostPort": 8080,
+  					"containerPort": 80,
+  					"protocol": "tcp"
+  				}
+  			]
+  		}
+  	]
+  }`
+
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// instance start
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
@@ -590,6 +734,13 @@ Enterprise Performance Computing (EPC)`
 
   docker: Pull a Docker/OCI image from Docker Hub, or another OCI registry.
       docker://user/image:tag
+
+      Registry mirrors and locations are configured in a registries.conf
+      file, using the containers registries.conf format, read from
+      ~/.singularity/registries.conf or from the singularity configuration
+      directory, and otherwise from /etc/containers/registries.conf.
+      Credentials given with --docker-username and --docker-password are
+      only sent to the registry host of the reference.
     
   shub: Pull an image from Singularity Hub
       shub://user/image:tag
@@ -598,7 +749,45 @@ Enterprise Performance Computing (EPC)`
       oras://registry/namespace/image:tag
 
   http, https: Pull an image using the http(s?) protocol
-      https://library.sylabs.io/v1/imagefile/library/default/alpine:latest`
+      https://library.sylabs.io/v1/imagefile/library/default/alpine:latest
+
+  s3: Pull a SIF image from Amazon S3 or an S3-compatible object store.
+      s3://bucket/key
+
+      Credentials, region and endpoint are read from the AWS_ACCESS_KEY_ID,
+      AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION and
+      AWS_ENDPOINT_URL environment variables, or from the access keys,
+      region and endpoint_url of the AWS_PROFILE profile of
+      ~/.aws/credentials and ~/.aws/config. Profiles using roles, IAM
+      Identity Center (SSO) or credential_process are not supported, and
+      instance or task roles are not used. Requests are anonymous without
+      credentials. Images are cached until the ETag of the object changes.
+
+  With --from-file, the images listed in a file are pulled to the --dir
+  directory, at most --jobs at the same time. Each line of the file holds an
+  image URI, optionally followed by the name of the image file in the --dir
+  directory, which can't include a directory component. Existing
+  image files identical to the cached image, or to the remote image when the
+  cache is disabled, are skipped. A JSON summary of pulled, skipped and
+  failed images is printed on the standard output, while progress is
+  displayed on the standard error.
+
+  With --digest-lock, the manifest digests docker:// image tags resolve to are
+  recorded in a lock file. Once recorded, pulling an image whose tag now
+  resolves to another digest fails. Checked images are pulled by digest, so
+  the pulled image is the one whose digest is recorded.
+
+  Images converted from docker:// and OCI sources record their provenance:
+  the source URI, the manifest digest it resolved to, the platform and the
+  pull time, shown by inspect. Unsigned SIF images pulled as is from
+  library://, oras://, http(s)://, shub:// and s3:// sources record their
+  source URI, the pull time and the checksum of the file as pulled. Signed
+  images are stored unmodified, so their signatures still verify, and don't
+  record provenance.
+
+  With --platform os/arch[/variant], the image of the given platform is
+  selected from docker:// and OCI multi-platform images, instead of the
+  image matching the host.`
 	PullExample string = `
   From Sylabs cloud library
   $ singularity pull alpine.sif library://alpine:latest
@@ -610,7 +799,22 @@ Enterprise Performance Computing (EPC)`
   $ singularity pull singularity-images.sif shub://vsoch/singularity-images
 
   From supporting OCI registry (e.g. Azure Container Registry)
-  $ singularity pull image.sif oras://<username>.azurecr.io/namespace/image:tag`
+  $ singularity pull image.sif oras://<username>.azurecr.io/namespace/image:tag
+
+  From an S3-compatible object store
+  $ singularity pull image.sif s3://bucket/images/image.sif
+
+  From a list of images
+  $ cat images.txt
+  docker://ubuntu:20.04
+  library://alpine:3.11 alpine.sif
+  $ singularity pull --from-file images.txt --dir images --jobs 8
+
+  Lock docker image tags to their current digests
+  $ singularity pull --digest-lock images.lock docker://python:3.9
+
+  Pull the arm64 image of a multi-platform image
+  $ singularity pull --platform linux/arm64/v8 alpine-arm64.sif docker://alpine:latest`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// push
@@ -627,6 +831,8 @@ Enterprise Performance Computing (EPC)`
   oras:
       oras://registry/namespace/repo:tag
 
+  s3:
+      s3://bucket/key
 
   NOTE: It's always good practice to sign your containers before
   pushing them to the library. An auth token is required to push to the library,
@@ -636,7 +842,10 @@ Enterprise Performance Computing (EPC)`
   $ singularity push /home/user/my.sif library://user/collection/my.sif:latest
 
   To supported OCI registry
-  $ singularity push /home/user/my.sif oras://registry/namespace/image:tag`
+  $ singularity push /home/user/my.sif oras://registry/namespace/image:tag
+
+  To an S3-compatible object store
+  $ AWS_ENDPOINT_URL=https://minio.example.com:9000 singularity push /home/user/my.sif s3://bucket/images/my.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// search
@@ -722,9 +931,29 @@ Enterprise Performance Computing (EPC)`
   image. By default, one digital signature is added for each object group in
   the file.
   
-  To generate a keypair, see 'singularity help key newpair'`
+  To generate a keypair, see 'singularity help key newpair'
+
+  Images can also be signed with an X.509 certificate using the --key and
+  --certificate options. The private key is either a PEM file or a key stored
+  in a PKCS#11 token (smart card, HSM) referenced by a PKCS#11 URI, in which
+  case the certificate may be read from the token.
+
+  With the --detached option, the image is left untouched and the signatures
+  are written to a separate file, which can be kept next to the image or
+  distributed on its own. Detached signatures cover the same data as the
+  signatures added to the image, and are checked with 'singularity verify
+  --signature'.`
 	SignExample string = `
-  $ singularity sign container.sif`
+  $ singularity sign container.sif
+
+  Sign with an X.509 certificate:
+  $ singularity sign --key signer.key --certificate signer.pem container.sif
+
+  Sign with a key stored in a PKCS#11 token:
+  $ singularity sign --key 'pkcs11:token=mytoken;object=signer?module-path=/usr/lib/softhsm/libsofthsm2.so' container.sif
+
+  Write the signature to a separate file:
+  $ singularity sign --detached container.sig container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// verify
@@ -737,9 +966,44 @@ Enterprise Performance Computing (EPC)`
   multiple data objects signed. By default the command searches for the primary 
   partition signature. If found, a list of all verification blocks applied on 
   the primary partition is gathered so that data integrity (hashing) and 
-  signature verification is done for all those blocks.`
+  signature verification is done for all those blocks.
+
+  Signatures made with revoked OpenPGP keys, or keys with the trust level
+  'never' (see 'singularity key trust'), are rejected. A warning is displayed
+  for expired keys and, once trust levels have been set, for keys which are
+  not fully trusted.
+
+  X.509 signatures are verified with the --x509 or --ca-bundle options, the
+  signing certificate must chain up to the system certificate pool or to a
+  certificate of the CA bundle. Trusted signers can be restricted with the
+  --trusted-subject and --trusted-san options.
+
+  With the --policy option, signatures are checked against the rules of a
+  verification policy file in TOML format. A policy selects the object groups
+  to verify, requires signatures from all or a number of the keys listed in
+  each rule, and can forbid keys. The reasons of a failure are reported, and
+  included in the --json output.
+
+  With the --signature option, the detached signatures written by 'singularity
+  sign --detached' are verified instead of the signatures in the image. OpenPGP
+  or X.509 signatures are verified, depending on the --x509 and --ca-bundle
+  options.`
 	VerifyExample string = `
-  $ singularity verify container.sif`
+  $ singularity verify container.sif
+
+  Verify X.509 signatures:
+  $ singularity verify --ca-bundle ca.pem --trusted-san signer@example.com container.sif
+
+  Verify signatures against a policy requiring any 2 of 3 keys:
+  $ cat policy.toml
+  [[rule]]
+    name = "release"
+    threshold = 2
+    keyfp = ["<fingerprint 1>", "<fingerprint 2>", "<fingerprint 3>"]
+  $ singularity verify --policy policy.toml container.sif
+
+  Verify detached signatures:
+  $ singularity verify --signature container.sig container.sif`
 
 	// ~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~
 	// Run-help
@@ -782,6 +1046,13 @@ Enterprise Performance Computing (EPC)`
   Inspect will show you labels, environment variables, apps and scripts associated 
   with the image determined by the flags you pass. By default, they will be shown in 
   plain text. If you would like to list them in json format, you should use the --json flag.
+
+  Images built from docker and OCI sources also show their provenance with the
+  labels: the source URI, the manifest digest it resolved to, the platform and
+  the time it was pulled. Unsigned SIF images pulled as is from library://,
+  oras://, http(s)://, shub:// and s3:// sources show their source URI, the
+  time they were pulled and the checksum of the file as pulled. Signed images
+  have no provenance record.
   `
 	InspectExample string = `
   $ singularity inspect ubuntu.sif
@@ -1001,11 +1272,19 @@ Enterprise Performance Computing (EPC)`
   $ singularity help config fakeroot
   $ singularity config fakeroot --help`
 
-	ConfigFakerootUse   string = `fakeroot <option> <user>`
+	ConfigFakerootUse   string = `fakeroot <option> [user]`
 	ConfigFakerootShort string = `Manage fakeroot user mappings entries (root user only)`
 	ConfigFakerootLong  string = `
   The config fakeroot command allow a root user to add/remove/enable/disable fakeroot
-  user mappings.`
+  user mappings.
+
+  A mapping entry added with --add gets the first available range of 65536 IDs
+  unless --start and --range-size are specified, ranges overlapping existing
+  entries, or differing from the existing entry of the user, are refused. The
+  --check option reports invalid, overlapping or
+  unusable entries and users with a mapping entry in only one of /etc/subuid
+  and /etc/subgid. The --list option lists user mapping entries, in LDIF
+  format with --ldif to push them to a LDAP directory.`
 	ConfigFakerootExample string = `
   To add a fakeroot user mapping for vagrant user:
   $ singularity config fakeroot --add vagrant
@@ -1017,7 +1296,16 @@ Enterprise Performance Computing (EPC)`
   $ singularity config fakeroot --disable vagrant
 
   To enable a fakeroot user mapping for vagrant user:
-  $ singularity config fakeroot --enable vagrant`
+  $ singularity config fakeroot --enable vagrant
+
+  To add a fakeroot user mapping of 131072 IDs starting at 200000 for vagrant user:
+  $ singularity config fakeroot --add --start 200000 --range-size 131072 vagrant
+
+  To check fakeroot user mappings:
+  $ singularity config fakeroot --check
+
+  To export fakeroot user mappings as LDIF:
+  $ singularity config fakeroot --list --ldif ou=people,dc=example,dc=com`
 
 	ConfigGlobalUse   string = `global <option> <directive> [value,...]`
 	ConfigGlobalShort string = `Edit singularity.conf from command line (root user only or unprivileged installation)`
@@ -1040,6 +1328,50 @@ Enterprise Performance Computing (EPC)`
   To display the resulting configuration instead of writing it to file:
   $ singularity config global --dry-run --set "bind path" /etc/resolv.conf`
 
+	NetworkUse   string = `network`
+	NetworkShort string = `Manage named networks shared between instances`
+	NetworkLong  string = `
+  The network command allows management of named networks. Instances started
+  with the same named network are attached to the same bridge and can reach
+  each other by instance name.`
+	NetworkExample string = `
+  All network commands have their own help output:
+
+  $ singularity help network create
+  $ singularity network create --help`
+
+	NetworkCreateUse   string = `create [create options...] <network name>`
+	NetworkCreateShort string = `Create a named network (root user only)`
+	NetworkCreateLong  string = `
+  The network create command creates a named network, a CNI bridge network with
+  a dedicated subnet. If no subnet is specified, a free 10.24.X.0/24 subnet is
+  allocated. Instances started with --net --network <network name> find the
+  other instances of the network by name through their /etc/hosts file. As the
+  network is shared by all users, an instance can't join it while a running
+  instance of another user has the same name.`
+	NetworkCreateExample string = `
+  $ sudo singularity network create mystack
+  $ sudo singularity network create --subnet 10.50.0.0/24 mystack
+  $ sudo singularity instance start --net --network mystack db.sif db
+  $ sudo singularity instance start --net --network mystack app.sif app
+  $ sudo singularity exec instance://app ping -c 1 db`
+
+	NetworkListUse   string = `list`
+	NetworkListShort string = `List named networks`
+	NetworkListLong  string = `
+  The network list command lists the named networks, with their subnet, bridge
+  and the instances attached to them.`
+	NetworkListExample string = `
+  $ singularity network list`
+
+	NetworkRemoveUse   string = `remove <network name>`
+	NetworkRemoveShort string = `Remove a named network (root user only)`
+	NetworkRemoveLong  string = `
+  The network remove command removes a named network. A network can't be
+  removed while instances are attached to it.`
+	NetworkRemoveExample string = `
+  $ sudo singularity network remove mystack`
+
 	OverlayUse   string = `overlay`
 	OverlayShort string = `Manage an EXT3 writable overlay image`
 	OverlayLong  string = `
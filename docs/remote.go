@@ -72,7 +72,14 @@ const (
   The 'remote login' command allows you to set credentials for a specific endpoint,
   an OCI/Docker registry or a keyserver. This command can produce a link directing you to
   the token service you can use to generate a valid token. If no endpoint or registry is
-  specified, it will try the default remote endpoint (SylabsCloud).`
+  specified, it will try the default remote endpoint (SylabsCloud).
+
+  When a docker credential helper is configured for a registry or a keyserver,
+  with the 'credsStore' or 'credHelpers' settings of ~/.singularity/docker-config.json
+  or ~/.docker/config.json, credentials are stored by the helper
+  (docker-credential-<name>) rather than in the configuration files. Credentials
+  of registries are also read from ~/.docker/config.json and containers auth.json
+  files, so logins made with docker or podman are used by pull, push and build.`
 	RemoteLoginExample string = `
   To log in to an endpoint:
   $ singularity remote login SylabsCloud
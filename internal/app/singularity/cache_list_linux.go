@@ -20,7 +20,7 @@ import (
 // listTypeCache will list a cache type with given name (cacheType). The options are 'library', and 'oci'.
 // Will return: the number of containers for that type (int), the total space the container type is using (int64),
 // and an error if one occurs.
-func listTypeCache(printList bool, name, cachePath string) (int, int64, error) {
+func listTypeCache(imgCache *cache.Handle, printList bool, name, cachePath string) (int, int64, error) {
 	_, err := os.Stat(cachePath)
 	if os.IsNotExist(err) {
 		return 0, 0, nil
@@ -40,9 +40,10 @@ func listTypeCache(printList bool, name, cachePath string) (int, int64, error) {
 	for _, entry := range cacheEntries {
 
 		if printList {
-			fmt.Printf("%-24.22s %-22s %-16s %s\n",
+			fmt.Printf("%-24.22s %-22s %-22s %-16s %s\n",
 				entry.Name(),
 				entry.ModTime().Format("2006-01-02 15:04:05"),
+				imgCache.LastUsed(name, entry).Format("2006-01-02 15:04:05"),
 				fs.FindSize(entry.Size()),
 				name)
 		}
@@ -68,7 +69,7 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 	)
 
 	if cacheListVerbose {
-		fmt.Printf("%-24s %-22s %-16s %s\n", "NAME", "DATE CREATED", "SIZE", "TYPE")
+		fmt.Printf("%-24s %-22s %-22s %-16s %s\n", "NAME", "DATE CREATED", "LAST USED", "SIZE", "TYPE")
 	}
 
 	containersShown := false
@@ -91,7 +92,7 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 			return err
 		}
 		cacheDir = filepath.Join(cacheDir, "blobs", "sha256")
-		blobsCount, blobsSize, err := listTypeCache(cacheListVerbose, cacheType, cacheDir)
+		blobsCount, blobsSize, err := listTypeCache(imgCache, cacheListVerbose, cacheType, cacheDir)
 		if err != nil {
 			fmt.Print(err)
 			return err
@@ -109,7 +110,7 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 		if err != nil {
 			return err
 		}
-		count, size, err := listTypeCache(cacheListVerbose, cacheType, cacheDir)
+		count, size, err := listTypeCache(imgCache, cacheListVerbose, cacheType, cacheDir)
 		if err != nil {
 			fmt.Print(err)
 			return err
@@ -139,6 +140,9 @@ func ListSingularityCache(imgCache *cache.Handle, cacheListTypes []string, cache
 
 	fmt.Print(out.String())
 	fmt.Printf("Total space used: %s\n", fs.FindSize(totalSpace))
+	if maxSize := imgCache.MaxSize(); maxSize > 0 {
+		fmt.Printf("Maximum cache size: %s\n", fs.FindSize(maxSize))
+	}
 
 	return nil
 }
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -61,8 +61,24 @@ func CapabilityList(capFile string, c CapListConfig) error {
 			}
 		}
 
+		fingerprints, execgroups := capConfig.ListAllImageCaps()
+
+		for fp, cap := range fingerprints {
+			if len(cap) > 0 {
+				fmt.Printf("%s [fingerprint]: %s\n", fp, strings.Join(cap, ","))
+				outputCaps++
+			}
+		}
+
+		for tag, cap := range execgroups {
+			if len(cap) > 0 {
+				fmt.Printf("%s [execgroup]: %s\n", tag, strings.Join(cap, ","))
+				outputCaps++
+			}
+		}
+
 		if outputCaps == 0 {
-			return fmt.Errorf("no capability set for users or groups")
+			return fmt.Errorf("no capability set for users, groups or images")
 		}
 
 		return nil
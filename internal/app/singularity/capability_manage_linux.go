@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -6,8 +6,10 @@
 package singularity
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
+	"strings"
 	"syscall"
 
 	"github.com/hpcng/singularity/internal/pkg/util/user"
@@ -17,14 +19,18 @@ import (
 
 // CapManageConfig specifies what capability set to edit in the capability file
 type CapManageConfig struct {
-	Caps  string
-	User  string
-	Group string
+	Caps        string
+	User        string
+	Group       string
+	Fingerprint string
+	Execgroup   string
 }
 
 type manageType struct {
-	UserFn  func(*capabilities.Config, string, []string) error
-	GroupFn func(*capabilities.Config, string, []string) error
+	UserFn        func(*capabilities.Config, string, []string) error
+	GroupFn       func(*capabilities.Config, string, []string) error
+	FingerprintFn func(*capabilities.Config, string, []string) error
+	ExecgroupFn   func(*capabilities.Config, string, []string) error
 }
 
 // CapabilityAdd adds the specified capability set to the capability file
@@ -36,6 +42,12 @@ func CapabilityAdd(capFile string, c CapManageConfig) error {
 		GroupFn: func(c *capabilities.Config, a string, b []string) error {
 			return c.AddGroupCaps(a, b)
 		},
+		FingerprintFn: func(c *capabilities.Config, a string, b []string) error {
+			return c.AddFingerprintCaps(a, b)
+		},
+		ExecgroupFn: func(c *capabilities.Config, a string, b []string) error {
+			return c.AddExecgroupCaps(a, b)
+		},
 	}
 
 	return manageCaps(capFile, c, addType)
@@ -50,6 +62,12 @@ func CapabilityDrop(capFile string, c CapManageConfig) error {
 		GroupFn: func(c *capabilities.Config, a string, b []string) error {
 			return c.DropGroupCaps(a, b)
 		},
+		FingerprintFn: func(c *capabilities.Config, a string, b []string) error {
+			return c.DropFingerprintCaps(a, b)
+		},
+		ExecgroupFn: func(c *capabilities.Config, a string, b []string) error {
+			return c.DropExecgroupCaps(a, b)
+		},
 	}
 
 	return manageCaps(capFile, c, dropType)
@@ -79,8 +97,8 @@ func manageCaps(capFile string, c CapManageConfig, t manageType) error {
 		sylog.Warningf("Ignoring unknown capabilities: %s", ign)
 	}
 
-	if c.User == "" && c.Group == "" {
-		return fmt.Errorf("no user or group specified")
+	if c.User == "" && c.Group == "" && c.Fingerprint == "" && c.Execgroup == "" {
+		return fmt.Errorf("no user, group, fingerprint or execgroup specified")
 	}
 
 	if c.User != "" {
@@ -103,6 +121,22 @@ func manageCaps(capFile string, c CapManageConfig, t manageType) error {
 		}
 	}
 
+	if c.Fingerprint != "" {
+		if !validFingerprint(c.Fingerprint) {
+			return fmt.Errorf("while setting capabilities for fingerprint %s: not a valid key fingerprint", c.Fingerprint)
+		}
+
+		if err := t.FingerprintFn(capConfig, c.Fingerprint, caps); err != nil {
+			return fmt.Errorf("while setting capabilities for fingerprint %s: %s", c.Fingerprint, err)
+		}
+	}
+
+	if c.Execgroup != "" {
+		if err := t.ExecgroupFn(capConfig, c.Execgroup, caps); err != nil {
+			return fmt.Errorf("while setting capabilities for execgroup %s: %s", c.Execgroup, err)
+		}
+	}
+
 	if err := file.Truncate(0); err != nil {
 		return fmt.Errorf("while truncating capability config file: %s", err)
 	}
@@ -135,3 +169,10 @@ func groupExists(group string) bool {
 	}
 	return true
 }
+
+// validFingerprint returns whether fp is a 20 bytes hexadecimal key
+// fingerprint, spaces are ignored.
+func validFingerprint(fp string) bool {
+	b, err := hex.DecodeString(strings.Join(strings.Fields(fp), ""))
+	return err == nil && len(b) == 20
+}
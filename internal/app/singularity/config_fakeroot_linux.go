@@ -1,4 +1,4 @@
-// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -7,8 +7,13 @@ package singularity
 
 import (
 	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/hpcng/singularity/internal/pkg/fakeroot"
+	"github.com/hpcng/singularity/internal/pkg/util/user"
 )
 
 // FakerootConfigOp defines a type for a fakeroot
@@ -26,9 +31,17 @@ const (
 	FakerootDisableUser
 )
 
+// FakerootRange is the range of a user fakeroot mapping entry added
+// with FakerootAddUser, a zero Start selects the first available range
+// and a zero Count selects the default range count.
+type FakerootRange struct {
+	Start uint32
+	Count uint32
+}
+
 // FakerootConfig allows to add/remove/enable/disable a user fakeroot
 // mapping entry in /etc/subuid and /etc/subgid files.
-func FakerootConfig(username string, op FakerootConfigOp) error {
+func FakerootConfig(username string, op FakerootConfigOp, r FakerootRange) error {
 	subUIDConfig, err := fakeroot.GetConfig(fakeroot.SubUIDFile, true, nil)
 	if err != nil {
 		return fmt.Errorf("while opening %s: %s", fakeroot.SubUIDFile, err)
@@ -40,10 +53,10 @@ func FakerootConfig(username string, op FakerootConfigOp) error {
 
 	switch op {
 	case FakerootAddUser:
-		if err := subUIDConfig.AddUser(username); err != nil {
+		if err := subUIDConfig.AddUserRange(username, r.Start, r.Count); err != nil {
 			return fmt.Errorf("while adding %s: %s", username, err)
 		}
-		if err := subGIDConfig.AddUser(username); err != nil {
+		if err := subGIDConfig.AddUserRange(username, r.Start, r.Count); err != nil {
 			return fmt.Errorf("while adding %s: %s", username, err)
 		}
 	case FakerootRemoveUser:
@@ -80,3 +93,167 @@ func FakerootConfig(username string, op FakerootConfigOp) error {
 
 	return nil
 }
+
+// getFakerootConfigs returns the read-only configurations of
+// /etc/subuid and /etc/subgid files.
+func getFakerootConfigs() (*fakeroot.Config, *fakeroot.Config, error) {
+	subUIDConfig, err := fakeroot.GetConfig(fakeroot.SubUIDFile, false, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("while opening %s: %s", fakeroot.SubUIDFile, err)
+	}
+	subGIDConfig, err := fakeroot.GetConfig(fakeroot.SubGIDFile, false, nil)
+	if err != nil {
+		subUIDConfig.Close()
+		return nil, nil, fmt.Errorf("while opening %s: %s", fakeroot.SubGIDFile, err)
+	}
+	return subUIDConfig, subGIDConfig, nil
+}
+
+// FakerootCheck reports to w the problems found in /etc/subuid and
+// /etc/subgid files: invalid, overlapping or unusable entries and users
+// with a mapping entry in only one of the files. It returns an error if
+// any problem was found.
+func FakerootCheck(w io.Writer) error {
+	subUIDConfig, subGIDConfig, err := getFakerootConfigs()
+	if err != nil {
+		return err
+	}
+	defer subUIDConfig.Close()
+	defer subGIDConfig.Close()
+
+	count := 0
+	for _, c := range []struct {
+		file      string
+		otherFile string
+		config    *fakeroot.Config
+		other     *fakeroot.Config
+	}{
+		{fakeroot.SubUIDFile, fakeroot.SubGIDFile, subUIDConfig, subGIDConfig},
+		{fakeroot.SubGIDFile, fakeroot.SubUIDFile, subGIDConfig, subUIDConfig},
+	} {
+		for _, problem := range c.config.Check() {
+			fmt.Fprintf(w, "%s: %s\n", c.file, problem)
+			count++
+		}
+		for _, uid := range c.config.MissingUsers(c.other) {
+			name := fmt.Sprintf("%d", uid)
+			if u, err := user.GetPwUID(uid); err == nil {
+				name = u.Name
+			}
+			fmt.Fprintf(w, "%s: user %s has no usable mapping entry in %s\n", c.file, name, c.otherFile)
+			count++
+		}
+	}
+
+	if count > 0 {
+		return fmt.Errorf("%d problem(s) found", count)
+	}
+	fmt.Fprintf(w, "No problem found in %s and %s\n", fakeroot.SubUIDFile, fakeroot.SubGIDFile)
+	return nil
+}
+
+// fakerootMapping holds the mapping entries of a user.
+type fakerootMapping struct {
+	name   string
+	subUID *fakeroot.Entry
+	subGID *fakeroot.Entry
+}
+
+// fakerootMappings returns the mapping entries of users found in
+// /etc/subuid and /etc/subgid files, sorted by user name. Entries of
+// unknown users are ignored.
+func fakerootMappings(subUIDConfig, subGIDConfig *fakeroot.Config) []fakerootMapping {
+	names := make(map[string]bool)
+	for _, config := range []*fakeroot.Config{subUIDConfig, subGIDConfig} {
+		for _, e := range config.Entries() {
+			if u, err := user.GetPwUID(e.UID); err == nil {
+				names[u.Name] = true
+			}
+		}
+	}
+
+	mappings := make([]fakerootMapping, 0, len(names))
+	for name := range names {
+		m := fakerootMapping{name: name}
+		m.subUID, _ = subUIDConfig.GetUserEntry(name)
+		m.subGID, _ = subGIDConfig.GetUserEntry(name)
+		if m.subUID != nil || m.subGID != nil {
+			mappings = append(mappings, m)
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].name < mappings[j].name
+	})
+	return mappings
+}
+
+// FakerootList prints the user fakeroot mapping entries to w. If ldifBase
+// is not empty, entries are printed in LDIF format as modifications of the
+// user entries uid=<user>,<ldifBase>, disabled entries are omitted.
+func FakerootList(w io.Writer, ldifBase string) error {
+	subUIDConfig, subGIDConfig, err := getFakerootConfigs()
+	if err != nil {
+		return err
+	}
+	defer subUIDConfig.Close()
+	defer subGIDConfig.Close()
+
+	mappings := fakerootMappings(subUIDConfig, subGIDConfig)
+
+	if ldifBase != "" {
+		return fakerootListLDIF(w, mappings, ldifBase)
+	}
+
+	tabWriter := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+	defer tabWriter.Flush()
+
+	_, err = fmt.Fprintln(tabWriter, "USER\tSUBUID\tSUBGID\tSTATUS")
+	if err != nil {
+		return fmt.Errorf("could not write list header: %v", err)
+	}
+
+	entryRange := func(e *fakeroot.Entry) string {
+		if e == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%d-%d", e.Start, uint64(e.Start)+uint64(e.Count)-1)
+	}
+
+	for _, m := range mappings {
+		status := "enabled"
+		if (m.subUID != nil && m.subUID.Disabled()) || (m.subGID != nil && m.subGID.Disabled()) {
+			status = "disabled"
+		}
+		_, err := fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\n", m.name, entryRange(m.subUID), entryRange(m.subGID), status)
+		if err != nil {
+			return fmt.Errorf("could not write mapping info: %v", err)
+		}
+	}
+	return nil
+}
+
+// fakerootListLDIF prints the enabled mappings to w as LDIF records
+// replacing the subUidNumber, subUidCount, subGidNumber and subGidCount
+// attributes of the user entries under base.
+func fakerootListLDIF(w io.Writer, mappings []fakerootMapping, base string) error {
+	for _, m := range mappings {
+		var b strings.Builder
+
+		fmt.Fprintf(&b, "dn: uid=%s,%s\nchangetype: modify\n", m.name, base)
+		if m.subUID != nil && !m.subUID.Disabled() {
+			fmt.Fprintf(&b, "replace: subUidNumber\nsubUidNumber: %d\n-\n", m.subUID.Start)
+			fmt.Fprintf(&b, "replace: subUidCount\nsubUidCount: %d\n-\n", m.subUID.Count)
+		}
+		if m.subGID != nil && !m.subGID.Disabled() {
+			fmt.Fprintf(&b, "replace: subGidNumber\nsubGidNumber: %d\n-\n", m.subGID.Start)
+			fmt.Fprintf(&b, "replace: subGidCount\nsubGidCount: %d\n-\n", m.subGID.Count)
+		}
+		if !strings.HasSuffix(b.String(), "-\n") {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, b.String()); err != nil {
+			return fmt.Errorf("could not write mapping record: %v", err)
+		}
+	}
+	return nil
+}
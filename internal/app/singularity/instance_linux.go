@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/hpcng/singularity/internal/pkg/instance"
+	"github.com/hpcng/singularity/pkg/network"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/hpcng/singularity/pkg/util/fs/proc"
 )
@@ -97,6 +98,52 @@ func PrintInstanceList(w io.Writer, name, user string, formatJSON bool, showLogs
 	return nil
 }
 
+// InspectInstance prints the information of the instance name, including
+// the details of its networks, in JSON format to the passed writer.
+func InspectInstance(w io.Writer, name, user string) error {
+	ii, err := instance.List(user, name, instance.SingSubDir)
+	if err != nil {
+		return fmt.Errorf("could not retrieve instance list: %v", err)
+	}
+	if len(ii) == 0 {
+		return fmt.Errorf("no instance %s found", name)
+	} else if len(ii) > 1 {
+		return fmt.Errorf("%s matches %d instances, only one instance can be inspected", name, len(ii))
+	}
+	i := ii[0]
+
+	networks := make([]*network.Info, 0, len(i.Networks))
+	for _, r := range i.Networks {
+		info, err := r.Info()
+		if err != nil {
+			return err
+		}
+		networks = append(networks, info)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	err = enc.Encode(
+		struct {
+			instanceInfo
+			Networks []*network.Info `json:"networks"`
+		}{
+			instanceInfo: instanceInfo{
+				Instance:   i.Name,
+				Pid:        i.Pid,
+				Image:      i.Image,
+				IP:         i.IP,
+				LogErrPath: i.LogErrPath,
+				LogOutPath: i.LogOutPath,
+			},
+			Networks: networks,
+		})
+	if err != nil {
+		return fmt.Errorf("could not encode instance information: %v", err)
+	}
+	return nil
+}
+
 // WriteInstancePidFile fetches instance's PID and writes it to the pidFile,
 // truncating it if it already exists. Note that the name should not be a glob,
 // i.e. name should identify a single instance only, otherwise an error is returned.
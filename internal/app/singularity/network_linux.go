@@ -0,0 +1,110 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/util/fs/files"
+	"github.com/hpcng/singularity/pkg/network"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// cniConfDir returns the CNI configuration directory set by the
+// "cni configuration path" directive confPath, or the default one.
+func cniConfDir(confPath string) string {
+	if confPath == "" {
+		return filepath.Join(buildcfg.SINGULARITY_CONFDIR, "network")
+	}
+	return confPath
+}
+
+// NetworkCreate creates the managed network name in the CNI configuration
+// directory confPath, with the hosts file shared by its instances. If subnet
+// is empty, a free subnet is allocated.
+func NetworkCreate(confPath string, name string, subnet string) error {
+	if err := os.MkdirAll(buildcfg.NETWORK_STATEDIR, 0755); err != nil {
+		return fmt.Errorf("while creating %s: %s", buildcfg.NETWORK_STATEDIR, err)
+	}
+
+	n, err := network.CreateManagedNetwork(cniConfDir(confPath), name, subnet)
+	if err != nil {
+		return err
+	}
+
+	hosts := network.ManagedHostsFile(buildcfg.NETWORK_STATEDIR, name)
+	if err := ioutil.WriteFile(hosts, files.DefaultHosts(), 0644); err != nil {
+		network.RemoveManagedNetwork(cniConfDir(confPath), name)
+		return fmt.Errorf("while creating hosts file %s: %s", hosts, err)
+	}
+
+	sylog.Infof("Network %s created with subnet %s", n.Name, n.Subnet)
+	return nil
+}
+
+// NetworkList prints the managed networks of the CNI configuration
+// directory confPath, with the instances attached to them, to w.
+func NetworkList(w io.Writer, confPath string) error {
+	networks, err := network.ManagedNetworks(cniConfDir(confPath))
+	if err != nil {
+		return fmt.Errorf("could not retrieve network list: %v", err)
+	}
+
+	tabWriter := tabwriter.NewWriter(w, 0, 8, 4, ' ', 0)
+	defer tabWriter.Flush()
+
+	_, err = fmt.Fprintln(tabWriter, "NETWORK NAME\tSUBNET\tBRIDGE\tINSTANCES")
+	if err != nil {
+		return fmt.Errorf("could not write list header: %v", err)
+	}
+
+	for _, n := range networks {
+		hosts, err := network.Hosts(network.ManagedHostsFile(buildcfg.NETWORK_STATEDIR, n.Name))
+		if err != nil && !os.IsNotExist(err) {
+			sylog.Warningf("Could not read instances of network %s: %s", n.Name, err)
+		}
+		_, err = fmt.Fprintf(tabWriter, "%s\t%s\t%s\t%s\n", n.Name, n.Subnet, n.Bridge, strings.Join(hosts, ","))
+		if err != nil {
+			return fmt.Errorf("could not write network info: %v", err)
+		}
+	}
+	return nil
+}
+
+// NetworkRemove removes the managed network name from the CNI configuration
+// directory confPath. A network still used by instances can't be removed,
+// the entries of killed instances are dropped first.
+func NetworkRemove(confPath string, name string) error {
+	hostsFile := network.ManagedHostsFile(buildcfg.NETWORK_STATEDIR, name)
+
+	if err := network.PruneHosts(hostsFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("while removing instances of network %s: %s", name, err)
+	}
+	hosts, err := network.Hosts(hostsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("while reading instances of network %s: %s", name, err)
+	}
+	if len(hosts) > 0 {
+		return fmt.Errorf("network %s is used by instances %s", name, strings.Join(hosts, ","))
+	}
+
+	if err := network.RemoveManagedNetwork(cniConfDir(confPath), name); err != nil {
+		return err
+	}
+	if err := os.Remove(hostsFile); err != nil && !os.IsNotExist(err) {
+		sylog.Warningf("Could not remove hosts file %s: %s", hostsFile, err)
+	}
+
+	sylog.Infof("Network %s removed", name)
+	return nil
+}
@@ -6,13 +6,24 @@
 package singularity
 
 import (
+	"crypto"
+	"crypto/x509"
+
 	"github.com/hpcng/sif/pkg/integrity"
 	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/sypki"
 	"github.com/hpcng/singularity/pkg/sypgp"
+	"golang.org/x/crypto/openpgp"
 )
 
 type signer struct {
-	opts []integrity.SignerOpt
+	opts      []integrity.SignerOpt
+	groupIDs  []uint32
+	objectIDs [][]uint32
+	key       crypto.Signer
+	certs     []*x509.Certificate
+	entity    *openpgp.Entity
+	detached  string
 }
 
 // SignOpt are used to configure s.
@@ -28,7 +39,19 @@ func OptSignEntitySelector(f sypgp.EntitySelector) SignOpt {
 		}
 
 		s.opts = append(s.opts, integrity.OptSignWithEntity(e))
+		s.entity = e
+
+		return nil
+	}
+}
 
+// OptSignX509 specifies that X.509 signature(s) be generated with key, certs is the certificate
+// chain starting with the certificate associated to key. When set, OpenPGP key material provided
+// via OptSignEntitySelector is ignored.
+func OptSignX509(key crypto.Signer, certs []*x509.Certificate) SignOpt {
+	return func(s *signer) error {
+		s.key = key
+		s.certs = certs
 		return nil
 	}
 }
@@ -37,7 +60,7 @@ func OptSignEntitySelector(f sypgp.EntitySelector) SignOpt {
 // specified groupID. This may be called multiple times to add multiple group signatures.
 func OptSignGroup(groupID uint32) SignOpt {
 	return func(s *signer) error {
-		s.opts = append(s.opts, integrity.OptSignGroup(groupID))
+		s.groupIDs = append(s.groupIDs, groupID)
 		return nil
 	}
 }
@@ -47,16 +70,26 @@ func OptSignGroup(groupID uint32) SignOpt {
 // This may be called multiple times to add multiple signatures.
 func OptSignObjects(ids ...uint32) SignOpt {
 	return func(s *signer) error {
-		s.opts = append(s.opts, integrity.OptSignObjects(ids...))
+		s.objectIDs = append(s.objectIDs, ids)
+		return nil
+	}
+}
+
+// OptSignDetached specifies that signature(s) be written to a signature bundle at path, instead of
+// being added to the image.
+func OptSignDetached(path string) SignOpt {
+	return func(s *signer) error {
+		s.detached = path
 		return nil
 	}
 }
 
 // Sign adds one or more digital signatures to the SIF image found at path, according to opts. Key
-// material must be provided via OptSignEntitySelector.
+// material must be provided via OptSignEntitySelector or OptSignX509.
 //
 // By default, one digital signature is added per object group in f. To override this behavior,
-// consider using OptSignGroup and/or OptSignObject.
+// consider using OptSignGroup and/or OptSignObject. To leave the image untouched and write the
+// signature(s) to a separate file, use OptSignDetached.
 func Sign(path string, opts ...SignOpt) error {
 	// Apply options to signer.
 	s := signer{}
@@ -66,6 +99,10 @@ func Sign(path string, opts ...SignOpt) error {
 		}
 	}
 
+	if s.detached != "" {
+		return s.signDetached(path)
+	}
+
 	// Load container.
 	f, err := sif.LoadContainer(path, false)
 	if err != nil {
@@ -73,10 +110,80 @@ func Sign(path string, opts ...SignOpt) error {
 	}
 	defer f.UnloadContainer()
 
+	if s.key != nil {
+		return s.signX509(&f)
+	}
+
+	iopts := s.opts
+	for _, groupID := range s.groupIDs {
+		iopts = append(iopts, integrity.OptSignGroup(groupID))
+	}
+	for _, ids := range s.objectIDs {
+		iopts = append(iopts, integrity.OptSignObjects(ids...))
+	}
+
+	// By default, don't sign the group holding X.509 signatures, as it grows with each X.509
+	// signature.
+	if len(s.groupIDs) == 0 && len(s.objectIDs) == 0 && sypki.SignatureGroupID(&f) != 0 {
+		for _, groupID := range sypki.ObjectGroupIDs(&f) {
+			iopts = append(iopts, integrity.OptSignGroup(groupID))
+		}
+	}
+
 	// Apply signature(s).
-	is, err := integrity.NewSigner(&f, s.opts...)
+	is, err := integrity.NewSigner(&f, iopts...)
 	if err != nil {
 		return err
 	}
 	return is.Sign()
 }
+
+// signX509 adds X.509 signature(s) to f.
+func (s signer) signX509(f *sif.FileImage) error {
+	var opts []sypki.SignerOpt
+	for _, groupID := range s.groupIDs {
+		opts = append(opts, sypki.OptSignGroup(groupID))
+	}
+	for _, ids := range s.objectIDs {
+		opts = append(opts, sypki.OptSignObjects(ids...))
+	}
+
+	ps, err := sypki.NewSigner(f, s.key, s.certs, opts...)
+	if err != nil {
+		return err
+	}
+	return ps.Sign()
+}
+
+// signDetached writes signature(s) of the SIF image found at path to a signature bundle.
+func (s signer) signDetached(path string) error {
+	f, err := sif.LoadContainer(path, true)
+	if err != nil {
+		return err
+	}
+	defer f.UnloadContainer()
+
+	var opts []sypki.SignerOpt
+	for _, groupID := range s.groupIDs {
+		opts = append(opts, sypki.OptSignGroup(groupID))
+	}
+	for _, ids := range s.objectIDs {
+		opts = append(opts, sypki.OptSignObjects(ids...))
+	}
+
+	var ps *sypki.Signer
+	if s.key != nil {
+		ps, err = sypki.NewSigner(&f, s.key, s.certs, opts...)
+	} else {
+		ps, err = sypki.NewOpenPGPSigner(&f, s.entity, opts...)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := ps.SignDetached()
+	if err != nil {
+		return err
+	}
+	return b.WriteFile(s.detached)
+}
@@ -6,13 +6,21 @@
 package singularity
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/hpcng/sif/pkg/integrity"
 	"github.com/hpcng/singularity/pkg/sypgp"
@@ -53,8 +61,37 @@ func mockEntitySelector(t *testing.T) sypgp.EntitySelector {
 	}
 }
 
+// getTestX509Signer returns a private key along with a self-signed code signing certificate.
+func getTestX509Signer(t *testing.T) (crypto.Signer, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
 func TestSign(t *testing.T) {
 	mockEntityOpt := OptSignEntitySelector(mockEntitySelector(t))
+	x509Key, x509Cert := getTestX509Signer(t)
 
 	tests := []struct {
 		name    string
@@ -82,6 +119,16 @@ func TestSign(t *testing.T) {
 			path: filepath.Join("testdata", "images", "one-group.sif"),
 			opts: []SignOpt{mockEntityOpt, OptSignObjects(1)},
 		},
+		{
+			name: "OptSignX509",
+			path: filepath.Join("testdata", "images", "one-group.sif"),
+			opts: []SignOpt{OptSignX509(x509Key, []*x509.Certificate{x509Cert})},
+		},
+		{
+			name: "OptSignX509Signed",
+			path: filepath.Join("testdata", "images", "one-group-signed.sif"),
+			opts: []SignOpt{OptSignX509(x509Key, []*x509.Certificate{x509Cert}), OptSignGroup(1)},
+		},
 	}
 
 	for _, tt := range tests {
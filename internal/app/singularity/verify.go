@@ -8,13 +8,18 @@ package singularity
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/hex"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/hpcng/sif/pkg/integrity"
 	"github.com/hpcng/sif/pkg/sif"
 	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/syecl"
+	"github.com/hpcng/singularity/internal/pkg/sypki"
+	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/hpcng/singularity/pkg/sypgp"
 	"github.com/sylabs/scs-key-client/client"
 	"golang.org/x/crypto/openpgp"
@@ -23,8 +28,15 @@ import (
 // TODO - error overlaps with ECL - should probably become part of a common errors package at some point.
 var errNotSignedByRequired = errors.New("image not signed by required entities")
 
+var errDetachedLegacy = errors.New("legacy signatures can't be detached")
+
+var errX509Legacy = errors.New("legacy signatures can't be verified with X.509 certificates")
+
 type VerifyCallback func(*sif.FileImage, integrity.VerifyResult) bool
 
+// X509VerifyCallback is called after each X.509 signature is verified.
+type X509VerifyCallback func(*sif.FileImage, sypki.VerifyResult) bool
+
 type verifier struct {
 	opts      []client.Option
 	groupIDs  []uint32
@@ -32,6 +44,12 @@ type verifier struct {
 	all       bool
 	legacy    bool
 	cb        VerifyCallback
+	x509      bool
+	roots     *x509.CertPool
+	subjects  []string
+	sans      []string
+	x509cb    X509VerifyCallback
+	detached  string
 }
 
 // VerifyOpt are used to configure v.
@@ -90,6 +108,53 @@ func OptVerifyCallback(cb VerifyCallback) VerifyOpt {
 	}
 }
 
+// OptVerifyX509 enables verification of X.509 signatures instead of OpenPGP signatures, the
+// signing certificates must chain up to one of the certificates in roots, or to the system
+// certificate pool if roots is nil.
+func OptVerifyX509(roots *x509.CertPool) VerifyOpt {
+	return func(v *verifier) error {
+		v.x509 = true
+		v.roots = roots
+		return nil
+	}
+}
+
+// OptVerifyTrustedSubjects restricts the trusted X.509 signing certificates to those with a
+// subject distinguished name or common name in subjects.
+func OptVerifyTrustedSubjects(subjects ...string) VerifyOpt {
+	return func(v *verifier) error {
+		v.subjects = append(v.subjects, subjects...)
+		return nil
+	}
+}
+
+// OptVerifyTrustedSANs restricts the trusted X.509 signing certificates to those with a subject
+// alternative name in sans.
+func OptVerifyTrustedSANs(sans ...string) VerifyOpt {
+	return func(v *verifier) error {
+		v.sans = append(v.sans, sans...)
+		return nil
+	}
+}
+
+// OptVerifyX509Callback registers cb as the X.509 verification callback.
+func OptVerifyX509Callback(cb X509VerifyCallback) VerifyOpt {
+	return func(v *verifier) error {
+		v.x509cb = cb
+		return nil
+	}
+}
+
+// OptVerifyDetached specifies that signatures be read from the signature bundle at path, instead
+// of the image. Legacy signatures can't be detached, so OptVerifyAll and OptVerifyLegacy can't be
+// used along with this option.
+func OptVerifyDetached(path string) VerifyOpt {
+	return func(v *verifier) error {
+		v.detached = path
+		return nil
+	}
+}
+
 // newVerifier constructs a new verifier based on opts.
 func newVerifier(opts []VerifyOpt) (verifier, error) {
 	v := verifier{}
@@ -98,14 +163,14 @@ func newVerifier(opts []VerifyOpt) (verifier, error) {
 			return verifier{}, err
 		}
 	}
+	if v.x509 && (v.legacy || v.all) {
+		return verifier{}, errX509Legacy
+	}
 	return v, nil
 }
 
-// getOpts returns integrity.VerifierOpt necessary to validate f.
-func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.VerifierOpt, error) {
-	var iopts []integrity.VerifierOpt
-
-	// Add keyring.
+// keyRing returns the keyring providing key material for verification.
+func (v verifier) keyRing(ctx context.Context) (openpgp.KeyRing, error) {
 	var kr openpgp.KeyRing
 	if v.opts != nil {
 		hkr, err := sypgp.NewHybridKeyRing(ctx, v.opts...)
@@ -127,9 +192,84 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 	if err != nil {
 		return nil, err
 	}
-	kr = sypgp.NewMultiKeyRing(gkr, kr)
+	return sypgp.NewMultiKeyRing(gkr, kr), nil
+}
+
+// keyStatusResult marks a verification result as not valid because of the status of the signing
+// entity.
+type keyStatusResult struct {
+	integrity.VerifyResult
+	err error
+}
+
+// Verified returns nil, as no object is verified by a signature which isn't valid.
+func (r keyStatusResult) Verified() []uint32 {
+	return nil
+}
+
+// Error returns the key status error.
+func (r keyStatusResult) Error() error {
+	return r.err
+}
+
+// keyChecker checks the revocation, expiration and trust level of signing entities.
+type keyChecker struct {
+	db  sypgp.TrustDB
+	now time.Time
+	err error // first error preventing the use of a signing entity
+}
+
+// newKeyChecker returns a keyChecker using the trust levels of the global and local keyrings,
+// those of the local keyring taking precedence.
+func newKeyChecker() (*keyChecker, error) {
+	global := sypgp.NewHandle(buildcfg.SINGULARITY_CONFDIR, sypgp.GlobalHandleOpt())
+	db, err := sypgp.MergeTrustDBs(global, sypgp.NewHandle(""))
+	if err != nil {
+		return nil, err
+	}
+	return &keyChecker{db: db, now: time.Now()}, nil
+}
+
+// wrap returns a VerifyCallback which checks the signing entity of valid signatures before
+// calling cb. Signatures made with revoked or distrusted keys are reported as not valid, while
+// expired keys produce a warning. Keys not fully trusted only produce a warning when trust
+// levels have been set, otherwise every key would be reported.
+func (kc *keyChecker) wrap(cb VerifyCallback) VerifyCallback {
+	return func(f *sif.FileImage, r integrity.VerifyResult) bool {
+		var keyErr error
+		if e := r.Entity(); e != nil && r.Error() == nil {
+			err := kc.db.CheckKey(e, kc.now)
+			if errors.Is(err, sypgp.ErrKeyRevoked) || errors.Is(err, sypgp.ErrKeyDistrusted) {
+				keyErr = &integrity.SignatureNotValidError{ID: r.Signature(), Err: err}
+				r = keyStatusResult{r, keyErr}
+			} else if errors.Is(err, sypgp.ErrKeyNotFullyTrusted) && len(kc.db) == 0 {
+				sylog.Debugf("Signing key %v", err)
+			} else if err != nil {
+				sylog.Warningf("Signing key %v", err)
+			}
+		}
+
+		ignoreError := false
+		if cb != nil {
+			ignoreError = cb(f, r)
+		}
+		if keyErr != nil && !ignoreError && kc.err == nil {
+			kc.err = keyErr
+		}
+		return ignoreError
+	}
+}
 
-	iopts = append(iopts, integrity.OptVerifyWithKeyRing(kr))
+// getOpts returns integrity.VerifierOpt necessary to validate f.
+func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.VerifierOpt, error) {
+	var iopts []integrity.VerifierOpt
+
+	// Add keyring, revoked keys are reported by the key checker.
+	kr, err := v.keyRing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	iopts = append(iopts, integrity.OptVerifyWithKeyRing(sypgp.NewRevokedKeyRing(kr)))
 
 	// Add group IDs, if applicable.
 	for _, groupID := range v.groupIDs {
@@ -141,9 +281,23 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 		iopts = append(iopts, integrity.OptVerifyObject(objectID))
 	}
 
+	// Objects holding X.509 signatures aren't covered by OpenPGP signatures.
+	sigGroupID := sypki.SignatureGroupID(f)
+
 	// Set legacy options, if applicable.
 	if v.legacy {
-		if v.all {
+		if v.all && sigGroupID != 0 {
+			iopts = append(iopts, integrity.OptVerifyLegacy())
+
+			for _, od := range f.DescrArr {
+				if !od.Used || od.Datatype == sif.DataSignature || od.Groupid == sif.DescrUnusedGroup {
+					continue
+				}
+				if od.Groupid&^sif.DescrGroupMask != sigGroupID {
+					iopts = append(iopts, integrity.OptVerifyObject(od.ID))
+				}
+			}
+		} else if v.all {
 			iopts = append(iopts, integrity.OptVerifyLegacyAll())
 		} else {
 			iopts = append(iopts, integrity.OptVerifyLegacy())
@@ -157,6 +311,10 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 				iopts = append(iopts, integrity.OptVerifyObject(od.ID))
 			}
 		}
+	} else if len(v.groupIDs) == 0 && len(v.objectIDs) == 0 && sigGroupID != 0 {
+		for _, groupID := range sypki.ObjectGroupIDs(f) {
+			iopts = append(iopts, integrity.OptVerifyGroup(groupID))
+		}
 	}
 
 	// Add callback, if applicable.
@@ -170,13 +328,132 @@ func (v verifier) getOpts(ctx context.Context, f *sif.FileImage) ([]integrity.Ve
 	return iopts, nil
 }
 
+// getX509Opts returns sypki.VerifierOpt necessary to validate X.509 signatures of f.
+func (v verifier) getX509Opts(f *sif.FileImage) []sypki.VerifierOpt {
+	var vopts []sypki.VerifierOpt
+
+	if v.roots != nil {
+		vopts = append(vopts, sypki.OptVerifyWithRoots(v.roots))
+	}
+	if len(v.subjects) > 0 {
+		vopts = append(vopts, sypki.OptVerifyTrustedSubjects(v.subjects...))
+	}
+	if len(v.sans) > 0 {
+		vopts = append(vopts, sypki.OptVerifyTrustedSANs(v.sans...))
+	}
+	for _, groupID := range v.groupIDs {
+		vopts = append(vopts, sypki.OptVerifyGroup(groupID))
+	}
+	for _, objectID := range v.objectIDs {
+		vopts = append(vopts, sypki.OptVerifyObject(objectID))
+	}
+
+	if v.x509cb != nil {
+		fn := func(r sypki.VerifyResult) bool {
+			return v.x509cb(f, r)
+		}
+		vopts = append(vopts, sypki.OptVerifyCallback(fn))
+	}
+
+	return vopts
+}
+
+// detachedResult adapts the result of the verification of a detached OpenPGP signature to
+// integrity.VerifyResult.
+type detachedResult struct {
+	r sypki.VerifyResult
+}
+
+// Signature returns the position of the signature in the bundle.
+func (r detachedResult) Signature() uint32 {
+	return r.r.Signature
+}
+
+// Signed returns the IDs of data objects that were signed.
+func (r detachedResult) Signed() []uint32 {
+	return r.r.Signed
+}
+
+// Verified returns the IDs of data objects that were verified.
+func (r detachedResult) Verified() []uint32 {
+	return r.r.Verified
+}
+
+// Entity returns the signing entity, or nil if it could not be determined.
+func (r detachedResult) Entity() *openpgp.Entity {
+	return r.r.Entity
+}
+
+// Error returns the verification error, or nil if verification was successful.
+func (r detachedResult) Error() error {
+	return r.r.Err
+}
+
+// verifyDetached verifies the signatures of f read from the signature bundle of v.
+func (v verifier) verifyDetached(ctx context.Context, f *sif.FileImage) error {
+	if v.legacy || v.all {
+		return errDetachedLegacy
+	}
+
+	b, err := sypki.LoadBundle(v.detached)
+	if err != nil {
+		return err
+	}
+
+	if v.x509 {
+		pv, err := sypki.NewVerifier(f, append(v.getX509Opts(f), sypki.OptVerifyBundle(b))...)
+		if err != nil {
+			return err
+		}
+		return pv.Verify()
+	}
+
+	// Check signing entities, revoked keys are reported by the key checker.
+	kc, err := newKeyChecker()
+	if err != nil {
+		return err
+	}
+	cb := kc.wrap(v.cb)
+
+	kr, err := v.keyRing(ctx)
+	if err != nil {
+		return err
+	}
+
+	vopts := []sypki.VerifierOpt{
+		sypki.OptVerifyBundle(b),
+		sypki.OptVerifyWithKeyRing(sypgp.NewRevokedKeyRing(kr)),
+		sypki.OptVerifyCallback(func(r sypki.VerifyResult) bool {
+			return cb(f, detachedResult{r})
+		}),
+	}
+	for _, groupID := range v.groupIDs {
+		vopts = append(vopts, sypki.OptVerifyGroup(groupID))
+	}
+	for _, objectID := range v.objectIDs {
+		vopts = append(vopts, sypki.OptVerifyObject(objectID))
+	}
+
+	pv, err := sypki.NewVerifier(f, vopts...)
+	if err != nil {
+		return err
+	}
+	if err := pv.Verify(); err != nil {
+		return err
+	}
+	return kc.err
+}
+
 // Verify verifies digital signature(s) in the SIF image found at path, according to opts.
 //
 // By default, the singularity public keyring provides key material. To supplement this with a
-// keyserver, use OptVerifyUseKeyServer.
+// keyserver, use OptVerifyUseKeyServer. To verify X.509 signatures instead, use OptVerifyX509. To
+// verify signatures stored in a signature bundle instead of the image, use OptVerifyDetached.
 //
 // By default, non-legacy signatures for all object groups are verified. To override the default
 // behavior, consider using OptVerifyGroup, OptVerifyObject, OptVerifyAll, and/or OptVerifyLegacy.
+//
+// OpenPGP signatures made with revoked keys, or keys with the trust level never, are not valid.
 func Verify(ctx context.Context, path string, opts ...VerifyOpt) error {
 	v, err := newVerifier(opts)
 	if err != nil {
@@ -190,6 +467,25 @@ func Verify(ctx context.Context, path string, opts ...VerifyOpt) error {
 	}
 	defer f.UnloadContainer()
 
+	if v.detached != "" {
+		return v.verifyDetached(ctx, &f)
+	}
+
+	if v.x509 {
+		pv, err := sypki.NewVerifier(&f, v.getX509Opts(&f)...)
+		if err != nil {
+			return err
+		}
+		return pv.Verify()
+	}
+
+	// Check signing entities.
+	kc, err := newKeyChecker()
+	if err != nil {
+		return err
+	}
+	v.cb = kc.wrap(v.cb)
+
 	// Get options to validate f.
 	vopts, err := v.getOpts(ctx, &f)
 	if err != nil {
@@ -201,7 +497,10 @@ func Verify(ctx context.Context, path string, opts ...VerifyOpt) error {
 	if err != nil {
 		return err
 	}
-	return iv.Verify()
+	if err := iv.Verify(); err != nil {
+		return err
+	}
+	return kc.err
 }
 
 // VerifyFingerprints verifies an image and checks it was signed by *all* of the provided fingerprints
@@ -211,6 +510,8 @@ func Verify(ctx context.Context, path string, opts ...VerifyOpt) error {
 //
 // By default, non-legacy signatures for all object groups are verified. To override the default
 // behavior, consider using OptVerifyGroup, OptVerifyObject, OptVerifyAll, and/or OptVerifyLegacy.
+//
+// Signatures made with revoked keys, or keys with the trust level never, are not valid.
 func VerifyFingerprints(ctx context.Context, path string, fingerprints []string, opts ...VerifyOpt) error {
 	v, err := newVerifier(opts)
 	if err != nil {
@@ -224,6 +525,13 @@ func VerifyFingerprints(ctx context.Context, path string, fingerprints []string,
 	}
 	defer f.UnloadContainer()
 
+	// Check signing entities.
+	kc, err := newKeyChecker()
+	if err != nil {
+		return err
+	}
+	v.cb = kc.wrap(v.cb)
+
 	// Get options to validate f.
 	vopts, err := v.getOpts(ctx, &f)
 	if err != nil {
@@ -239,6 +547,9 @@ func VerifyFingerprints(ctx context.Context, path string, fingerprints []string,
 	if err != nil {
 		return err
 	}
+	if kc.err != nil {
+		return kc.err
+	}
 
 	// get signing entities fingerprints that have signed all selected objects
 	keyfps, err := iv.AllSignedBy()
@@ -263,3 +574,44 @@ func VerifyFingerprints(ctx context.Context, path string, fingerprints []string,
 	}
 	return nil
 }
+
+// VerifyPolicy verifies the SIF image found at path against the verification policy p, and
+// returns the policy evaluation report. A non-nil error is returned only if the evaluation
+// couldn't be completed, the report tells if the image satisfies p.
+//
+// By default, the singularity public keyring provides key material. To supplement this with a
+// keyserver, use OptVerifyUseKeyServer. Object groups are selected by p, and a verification
+// callback can be set with OptVerifyCallback.
+func VerifyPolicy(ctx context.Context, path string, p *syecl.Policy, opts ...VerifyOpt) (*syecl.PolicyReport, error) {
+	v, err := newVerifier(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load container.
+	f, err := sif.LoadContainer(path, true)
+	if err != nil {
+		return nil, err
+	}
+	defer f.UnloadContainer()
+
+	// Signers are checked against the trust levels of the key checker.
+	kc, err := newKeyChecker()
+	if err != nil {
+		return nil, err
+	}
+
+	kr, err := v.keyRing(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var cb integrity.VerifyCallback
+	if v.cb != nil {
+		cb = func(r integrity.VerifyResult) bool {
+			return v.cb(&f, r)
+		}
+	}
+
+	return p.Evaluate(&f, kr, kc.db, cb)
+}
@@ -6,20 +6,30 @@
 package singularity
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/x509"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hpcng/sif/pkg/integrity"
 	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/syecl"
+	"github.com/hpcng/singularity/internal/pkg/sypki"
+	"github.com/hpcng/singularity/pkg/sypgp"
 	"github.com/sylabs/scs-key-client/client"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 const (
@@ -49,7 +59,8 @@ func getTestEntity(t *testing.T) *openpgp.Entity {
 }
 
 type mockHKP struct {
-	e *openpgp.Entity
+	e          *openpgp.Entity
+	revocation *packet.Signature
 }
 
 func (m mockHKP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -64,9 +75,52 @@ func (m mockHKP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if err := m.e.Serialize(wr); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if m.revocation != nil {
+		if err := m.revocation.Serialize(wr); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 	}
 }
 
+// revocationSignature returns a revocation signature of the primary key of e.
+func revocationSignature(t *testing.T, e *openpgp.Entity) *packet.Signature {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := e.PrimaryKey.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// skip the new format packet header
+	b := buf.Bytes()
+	switch l := b[1]; {
+	case l < 192:
+		b = b[2:]
+	case l < 224:
+		b = b[3:]
+	default:
+		b = b[6:]
+	}
+
+	h := crypto.SHA256.New()
+	e.PrimaryKey.SerializeSignaturePrefix(h)
+	h.Write(b)
+
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeKeyRevocation,
+		PubKeyAlgo:   e.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &e.PrimaryKey.KeyId,
+	}
+	if err := sig.Sign(h, e.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
 func Test_newVerifier(t *testing.T) {
 	opts := []client.Option{client.OptBearerToken("token")}
 
@@ -105,6 +159,36 @@ func Test_newVerifier(t *testing.T) {
 			opts:         []VerifyOpt{OptVerifyLegacy()},
 			wantVerifier: verifier{legacy: true},
 		},
+		{
+			name:         "OptVerifyX509",
+			opts:         []VerifyOpt{OptVerifyX509(nil)},
+			wantVerifier: verifier{x509: true},
+		},
+		{
+			name:    "OptVerifyX509All",
+			opts:    []VerifyOpt{OptVerifyX509(nil), OptVerifyAll()},
+			wantErr: errX509Legacy,
+		},
+		{
+			name:    "OptVerifyX509Legacy",
+			opts:    []VerifyOpt{OptVerifyLegacy(), OptVerifyX509(nil)},
+			wantErr: errX509Legacy,
+		},
+		{
+			name:         "OptVerifyTrustedSubjects",
+			opts:         []VerifyOpt{OptVerifyTrustedSubjects("CN=test")},
+			wantVerifier: verifier{subjects: []string{"CN=test"}},
+		},
+		{
+			name:         "OptVerifyTrustedSANs",
+			opts:         []VerifyOpt{OptVerifyTrustedSANs("test@example.com")},
+			wantVerifier: verifier{sans: []string{"test@example.com"}},
+		},
+		{
+			name:         "OptVerifyDetached",
+			opts:         []VerifyOpt{OptVerifyDetached("image.sig")},
+			wantVerifier: verifier{detached: "image.sig"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -529,3 +613,333 @@ func TestVerifyFingerPrint(t *testing.T) {
 		})
 	}
 }
+
+// mockResult is a successful verification result for entity e.
+type mockResult struct {
+	e *openpgp.Entity
+}
+
+func (r mockResult) Signature() uint32       { return 3 }
+func (r mockResult) Signed() []uint32        { return []uint32{1, 2} }
+func (r mockResult) Verified() []uint32      { return []uint32{1, 2} }
+func (r mockResult) Entity() *openpgp.Entity { return r.e }
+func (r mockResult) Error() error            { return nil }
+
+func TestKeyChecker(t *testing.T) {
+	e := getTestEntity(t)
+
+	revoked := *e
+	revoked.Revocations = []*packet.Signature{{CreationTime: time.Now()}}
+
+	tests := []struct {
+		name        string
+		e           *openpgp.Entity
+		level       sypgp.TrustLevel
+		ignoreError bool
+		wantErr     error
+	}{
+		{name: "Full", e: e, level: sypgp.TrustFull},
+		{name: "Unknown", e: e, level: sypgp.TrustUnknown},
+		{name: "Marginal", e: e, level: sypgp.TrustMarginal},
+		{name: "Never", e: e, level: sypgp.TrustNever, wantErr: sypgp.ErrKeyDistrusted},
+		{name: "Revoked", e: &revoked, level: sypgp.TrustFull, wantErr: sypgp.ErrKeyRevoked},
+		{name: "RevokedIgnored", e: &revoked, level: sypgp.TrustFull, ignoreError: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			kc := &keyChecker{
+				db:  sypgp.TrustDB{testFingerPrint: tt.level},
+				now: time.Now(),
+			}
+
+			var gotErr error
+			var gotVerified []uint32
+			cb := kc.wrap(func(f *sif.FileImage, r integrity.VerifyResult) bool {
+				gotErr = r.Error()
+				gotVerified = r.Verified()
+				return tt.ignoreError
+			})
+			cb(nil, mockResult{tt.e})
+
+			if tt.wantErr != nil {
+				if len(gotVerified) != 0 {
+					t.Errorf("got verified %v, want none", gotVerified)
+				}
+				if !errors.Is(gotErr, tt.wantErr) {
+					t.Errorf("got result error %v, want %v", gotErr, tt.wantErr)
+				}
+				if !errors.Is(kc.err, &integrity.SignatureNotValidError{}) || !errors.Is(kc.err, tt.wantErr) {
+					t.Errorf("got error %v, want %v", kc.err, tt.wantErr)
+				}
+			} else if kc.err != nil {
+				t.Errorf("unexpected error: %v", kc.err)
+			}
+		})
+	}
+}
+
+func TestVerifyPolicy(t *testing.T) {
+	// Start up a mock HKP server.
+	e := getTestEntity(t)
+	s := httptest.NewServer(mockHKP{e: e})
+	defer s.Close()
+
+	// Create an option that points to the mock HKP server.
+	keyServerOpt := OptVerifyUseKeyServer(client.OptBaseURL(s.URL))
+
+	tests := []struct {
+		name          string
+		path          string
+		p             syecl.Policy
+		wantSatisfied bool
+	}{
+		{
+			name: "SignatureNotFound",
+			path: filepath.Join("testdata", "images", "one-group.sif"),
+			p:    syecl.Policy{Rules: []syecl.PolicyRule{{KeyFPs: []string{testFingerPrint}}}},
+		},
+		{
+			name:          "Satisfied",
+			path:          filepath.Join("testdata", "images", "one-group-signed.sif"),
+			p:             syecl.Policy{Rules: []syecl.PolicyRule{{Threshold: 1, KeyFPs: []string{testFingerPrint, invalidFingerPrint}}}},
+			wantSatisfied: true,
+		},
+		{
+			name: "NotSatisfied",
+			path: filepath.Join("testdata", "images", "one-group-signed.sif"),
+			p:    syecl.Policy{Rules: []syecl.PolicyRule{{KeyFPs: []string{testFingerPrint, invalidFingerPrint}}}},
+		},
+		{
+			name: "Forbidden",
+			path: filepath.Join("testdata", "images", "one-group-signed.sif"),
+			p:    syecl.Policy{Forbidden: []string{testFingerPrint}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := VerifyPolicy(context.Background(), tt.path, &tt.p, keyServerOpt)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, want := r.Satisfied, tt.wantSatisfied; got != want {
+				t.Errorf("got satisfied %v, want %v (reasons: %v)", got, want, r.Reasons)
+			}
+		})
+	}
+}
+
+func TestVerifyPolicyRevokedKey(t *testing.T) {
+	// Start up a mock HKP server serving a revoked key.
+	e := getTestEntity(t)
+	s := httptest.NewServer(mockHKP{e: e, revocation: revocationSignature(t, e)})
+	defer s.Close()
+
+	p := syecl.Policy{Rules: []syecl.PolicyRule{{KeyFPs: []string{testFingerPrint}}}}
+	path := filepath.Join("testdata", "images", "one-group-signed.sif")
+
+	r, err := VerifyPolicy(context.Background(), path, &p, OptVerifyUseKeyServer(client.OptBaseURL(s.URL)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.Satisfied {
+		t.Errorf("policy satisfied by a revoked key")
+	}
+	if len(r.Warnings) != 1 || !strings.Contains(r.Warnings[0], sypgp.ErrKeyRevoked.Error()) {
+		t.Errorf("got warnings %v, want revoked key", r.Warnings)
+	}
+}
+
+func TestVerifyX509(t *testing.T) {
+	// Start up a mock HKP server.
+	e := getTestEntity(t)
+	s := httptest.NewServer(mockHKP{e: e})
+	defer s.Close()
+
+	key, cert := getTestX509Signer(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	// Add an X.509 signature to an image already holding an OpenPGP signature.
+	path, err := tempFileFrom(filepath.Join("testdata", "images", "one-group-signed.sif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	if err := Sign(path, OptSignX509(key, []*x509.Certificate{cert})); err != nil {
+		t.Fatalf("failed to sign image: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		opts         []VerifyOpt
+		wantVerified [][]uint32
+		wantErr      error
+	}{
+		{
+			name:         "OpenPGP",
+			opts:         []VerifyOpt{OptVerifyUseKeyServer(client.OptBaseURL(s.URL))},
+			wantVerified: [][]uint32{{1, 2}},
+		},
+		{
+			name:         "X509",
+			opts:         []VerifyOpt{OptVerifyX509(roots)},
+			wantVerified: [][]uint32{{1, 2}},
+		},
+		{
+			name:         "X509TrustedSubject",
+			opts:         []VerifyOpt{OptVerifyX509(roots), OptVerifyTrustedSubjects("Test Signer")},
+			wantVerified: [][]uint32{{1, 2}},
+		},
+		{
+			name:         "X509OptVerifyObject",
+			opts:         []VerifyOpt{OptVerifyX509(roots), OptVerifyObject(1)},
+			wantVerified: [][]uint32{{1}},
+		},
+		{
+			name:    "X509UnknownAuthority",
+			opts:    []VerifyOpt{OptVerifyX509(x509.NewCertPool())},
+			wantErr: &integrity.SignatureNotValidError{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var verified [][]uint32
+
+			cb := func(f *sif.FileImage, r integrity.VerifyResult) bool {
+				verified = append(verified, r.Verified())
+				return false
+			}
+			x509cb := func(f *sif.FileImage, r sypki.VerifyResult) bool {
+				verified = append(verified, r.Verified)
+				return false
+			}
+			tt.opts = append(tt.opts, OptVerifyCallback(cb), OptVerifyX509Callback(x509cb))
+
+			err := Verify(context.Background(), path, tt.opts...)
+
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			if got, want := verified, tt.wantVerified; !reflect.DeepEqual(got, want) {
+				t.Errorf("got verified %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyDetached(t *testing.T) {
+	// Start up a mock HKP server.
+	e := getTestEntity(t)
+	s := httptest.NewServer(mockHKP{e: e})
+	defer s.Close()
+
+	keyServerOpt := OptVerifyUseKeyServer(client.OptBaseURL(s.URL))
+
+	key, cert := getTestX509Signer(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	dir, err := ioutil.TempDir("", "detached-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join("testdata", "images", "one-group.sif")
+	pgpSig := filepath.Join(dir, "pgp.sig")
+	x509Sig := filepath.Join(dir, "x509.sig")
+
+	if err := Sign(path, OptSignEntitySelector(mockEntitySelector(t)), OptSignDetached(pgpSig)); err != nil {
+		t.Fatalf("failed to sign image: %v", err)
+	}
+	if err := Sign(path, OptSignX509(key, []*x509.Certificate{cert}), OptSignDetached(x509Sig)); err != nil {
+		t.Fatalf("failed to sign image: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		opts         []VerifyOpt
+		wantVerified [][]uint32
+		wantErr      error
+	}{
+		{
+			name:    "Embedded",
+			opts:    []VerifyOpt{keyServerOpt},
+			wantErr: &integrity.SignatureNotFoundError{},
+		},
+		{
+			name:         "OpenPGP",
+			opts:         []VerifyOpt{keyServerOpt, OptVerifyDetached(pgpSig)},
+			wantVerified: [][]uint32{{1, 2}},
+		},
+		{
+			name:         "OpenPGPOptVerifyObject",
+			opts:         []VerifyOpt{keyServerOpt, OptVerifyDetached(pgpSig), OptVerifyObject(1)},
+			wantVerified: [][]uint32{{1}},
+		},
+		{
+			name:    "OpenPGPLegacy",
+			opts:    []VerifyOpt{keyServerOpt, OptVerifyDetached(pgpSig), OptVerifyLegacy()},
+			wantErr: errDetachedLegacy,
+		},
+		{
+			name:         "X509",
+			opts:         []VerifyOpt{OptVerifyX509(roots), OptVerifyDetached(x509Sig)},
+			wantVerified: [][]uint32{{1, 2}},
+		},
+		{
+			name:    "X509UnknownAuthority",
+			opts:    []VerifyOpt{OptVerifyX509(x509.NewCertPool()), OptVerifyDetached(x509Sig)},
+			wantErr: &integrity.SignatureNotValidError{},
+		},
+		{
+			name:    "X509BundleOpenPGP",
+			opts:    []VerifyOpt{keyServerOpt, OptVerifyDetached(x509Sig)},
+			wantErr: &integrity.SignatureNotFoundError{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var verified [][]uint32
+
+			cb := func(f *sif.FileImage, r integrity.VerifyResult) bool {
+				if r.Entity() != nil && r.Entity().PrimaryKey.Fingerprint != e.PrimaryKey.Fingerprint {
+					t.Errorf("unexpected signing entity")
+				}
+				verified = append(verified, r.Verified())
+				return false
+			}
+			x509cb := func(f *sif.FileImage, r sypki.VerifyResult) bool {
+				verified = append(verified, r.Verified)
+				return false
+			}
+			tt.opts = append(tt.opts, OptVerifyCallback(cb), OptVerifyX509Callback(x509cb))
+
+			err := Verify(context.Background(), path, tt.opts...)
+
+			if got, want := err, tt.wantErr; !errors.Is(got, want) {
+				t.Fatalf("got error %v, want %v", got, want)
+			}
+			if err != nil {
+				return
+			}
+
+			if got, want := verified, tt.wantVerified; !reflect.DeepEqual(got, want) {
+				t.Errorf("got verified %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -7,7 +7,9 @@ package assemblers
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"regexp"
@@ -17,9 +19,12 @@ import (
 	"syscall"
 
 	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/util/fs/squashfs"
 	"github.com/hpcng/singularity/internal/pkg/util/machine"
 	"github.com/hpcng/singularity/pkg/build/types"
+	"github.com/hpcng/singularity/pkg/image"
 	"github.com/hpcng/singularity/pkg/image/packer"
+	"github.com/hpcng/singularity/pkg/inspect"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/hpcng/singularity/pkg/util/crypt"
 	uuid "github.com/satori/go.uuid"
@@ -27,10 +32,13 @@ import (
 
 // SIFAssembler doesn't store anything.
 type SIFAssembler struct {
-	GzipFlag        bool
-	MksquashfsProcs uint
-	MksquashfsMem   string
-	MksquashfsPath  string
+	CompFlag            bool
+	Compression         string
+	CompressionLevel    uint
+	MksquashfsBlockSize uint
+	MksquashfsProcs     uint
+	MksquashfsMem       string
+	MksquashfsPath      string
 }
 
 type encryptionOptions struct {
@@ -171,6 +179,53 @@ func createSIF(path string, b *types.Bundle, squashfile string, encOpts *encrypt
 	return nil
 }
 
+// recordSquashfsInfo stores the compression and the block size of the
+// squashfs image at fsPath in the inspect metadata of the bundle, the
+// values are read back from the squashfs super block so they reflect
+// the mksquashfs defaults when none were requested.
+func recordSquashfsInfo(b *types.Bundle, fsPath string) error {
+	data, ok := b.JSONObjects[image.SIFDescInspectMetadataJSON]
+	if !ok {
+		return nil
+	}
+
+	f, err := os.Open(fsPath)
+	if err != nil {
+		return fmt.Errorf("while opening squashfs image: %v", err)
+	}
+	defer f.Close()
+
+	sb := make([]byte, 4096)
+	n, err := f.ReadAt(sb, 0)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("while reading squashfs super block: %v", err)
+	}
+	sb = sb[:n]
+	comp, err := image.GetSquashfsComp(sb)
+	if err != nil {
+		return err
+	}
+	blockSize, err := image.GetSquashfsBlockSize(sb)
+	if err != nil {
+		return err
+	}
+
+	metadata := inspect.NewMetadata()
+	if err := json.Unmarshal(data, metadata); err != nil {
+		return fmt.Errorf("while decoding inspect metadata: %v", err)
+	}
+	metadata.Attributes.Compression = comp
+	metadata.Attributes.BlockSize = blockSize
+
+	data, err = json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("while encoding inspect metadata: %v", err)
+	}
+	b.JSONObjects[image.SIFDescInspectMetadataJSON] = data
+
+	return nil
+}
+
 // Assemble creates a SIF image from a Bundle.
 func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 	sylog.Infof("Creating SIF file...")
@@ -192,9 +247,17 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 	if syscall.Getuid() != 0 {
 		flags = append(flags, "-all-root")
 	}
-	// specify compression if needed
-	if a.GzipFlag {
-		flags = append(flags, "-comp", "gzip")
+	// specify compression if needed, compression level
+	// requires the compression to be explicitly set
+	if a.CompFlag || a.CompressionLevel != 0 {
+		args, err := squashfs.CompressionArgs(a.Compression, a.CompressionLevel)
+		if err != nil {
+			return err
+		}
+		flags = append(flags, args...)
+	}
+	if a.MksquashfsBlockSize != 0 {
+		flags = append(flags, "-b", fmt.Sprint(a.MksquashfsBlockSize))
 	}
 	if a.MksquashfsMem != "" {
 		flags = append(flags, "-mem", a.MksquashfsMem)
@@ -203,16 +266,31 @@ func (a *SIFAssembler) Assemble(b *types.Bundle, path string) error {
 		flags = append(flags, "-processors", fmt.Sprint(a.MksquashfsProcs))
 	}
 	arch := machine.ArchFromContainer(b.RootfsPath)
-	if arch == "" {
+	if arch == "" && b.Opts.Platform != "" {
+		p, err := machine.ParsePlatform(b.Opts.Platform)
+		if err != nil {
+			return err
+		}
+		sylog.Infof("Architecture not recognized, use requested platform architecture")
+		arch = p.Arch
+	} else if arch == "" {
 		sylog.Infof("Architecture not recognized, use native")
 		arch = runtime.GOARCH
 	}
 	sylog.Verbosef("Set SIF container architecture to %s", arch)
 
+	if a.Compression != "" {
+		sylog.Verbosef("Using %s compression for squashfs", a.Compression)
+	}
+
 	if err := s.Create([]string{b.RootfsPath}, fsPath, flags); err != nil {
 		return fmt.Errorf("while creating squashfs: %v", err)
 	}
 
+	if err := recordSquashfsInfo(b, fsPath); err != nil {
+		return err
+	}
+
 	var encOpts *encryptionOptions
 
 	if b.Opts.EncryptionKeyInfo != nil {
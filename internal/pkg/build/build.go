@@ -192,7 +192,47 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 			return nil, fmt.Errorf("while searching for mksquashfs: %v", err)
 		}
 
-		flag, err := ensureGzipComp(b.stages[lastStageIndex].b.TmpDir, mksquashfsPath)
+		opts := b.stages[lastStageIndex].b.Opts
+
+		comp := opts.Compression
+		if comp == "" {
+			comp, err = squashfs.GetCompression()
+			if err != nil {
+				return nil, fmt.Errorf("while searching for mksquashfs compression: %v", err)
+			}
+		}
+		compLevel := opts.CompressionLevel
+		if compLevel == 0 {
+			compLevel, err = squashfs.GetCompressionLevel()
+			if err != nil {
+				return nil, fmt.Errorf("while searching for mksquashfs compression level: %v", err)
+			}
+			// compression level from configuration only applies
+			// to compression algorithms supporting it
+			if squashfs.CheckCompression(comp, compLevel) != nil {
+				compLevel = 0
+			}
+		}
+		if err := squashfs.CheckCompression(comp, compLevel); err != nil {
+			return nil, err
+		}
+
+		blockSize := opts.BlockSize
+		if blockSize == "" {
+			blockSize, err = squashfs.GetBlockSize()
+			if err != nil {
+				return nil, fmt.Errorf("while searching for mksquashfs block size: %v", err)
+			}
+		}
+		var mksquashfsBlockSize uint
+		if blockSize != "" {
+			mksquashfsBlockSize, err = squashfs.ParseBlockSize(blockSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		flag, err := ensureComp(b.stages[lastStageIndex].b.TmpDir, mksquashfsPath, comp)
 		if err != nil {
 			return nil, fmt.Errorf("while ensuring correct compression algorithm: %v", err)
 		}
@@ -205,10 +245,13 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 			return nil, fmt.Errorf("while searching for mksquashfs mem limits: %v", err)
 		}
 		b.stages[lastStageIndex].a = &assemblers.SIFAssembler{
-			GzipFlag:        flag,
-			MksquashfsProcs: mksquashfsProcs,
-			MksquashfsMem:   mksquashfsMem,
-			MksquashfsPath:  mksquashfsPath,
+			CompFlag:            flag,
+			Compression:         comp,
+			CompressionLevel:    compLevel,
+			MksquashfsBlockSize: mksquashfsBlockSize,
+			MksquashfsProcs:     mksquashfsProcs,
+			MksquashfsMem:       mksquashfsMem,
+			MksquashfsPath:      mksquashfsPath,
 		}
 	default:
 		return nil, fmt.Errorf("unrecognized output format %s", conf.Format)
@@ -217,12 +260,12 @@ func newBuild(defs []types.Definition, conf Config) (*Build, error) {
 	return b, nil
 }
 
-// ensureGzipComp builds dummy squashfs images and checks the type of compression used
-// to deduce if we can successfully build with gzip compression. It returns an error
+// ensureComp builds dummy squashfs images and checks the type of compression used
+// to deduce if we can successfully build with comp compression. It returns an error
 // if we cannot and a boolean to indicate if the `-comp` flag is needed to specify
-// gzip compression when the final squashfs is built
-func ensureGzipComp(tmpdir, mksquashfsPath string) (bool, error) {
-	sylog.Debugf("Ensuring gzip compression for mksquashfs")
+// the compression when the final squashfs is built
+func ensureComp(tmpdir, mksquashfsPath, comp string) (bool, error) {
+	sylog.Debugf("Ensuring %s compression for mksquashfs", comp)
 
 	var err error
 	s := packer.NewSquashfs()
@@ -268,21 +311,21 @@ func ensureGzipComp(tmpdir, mksquashfsPath string) (bool, error) {
 		return false, fmt.Errorf("while reading test squashfs: %v", err)
 	}
 
-	comp, err := image.GetSquashfsComp(content)
+	defaultComp, err := image.GetSquashfsComp(content)
 	if err != nil {
 		return false, fmt.Errorf("could not verify squashfs compression type: %v", err)
 	}
 
-	if comp == "gzip" {
-		sylog.Debugf("Gzip compression by default ensured")
+	if defaultComp == comp {
+		sylog.Debugf("%s compression by default ensured", comp)
 		return false, nil
 	}
 
-	// Now force add `-comp gzip` in addition to -noappend -mem -processors
-	flags = append(flags, "-comp", "gzip")
+	// Now force add `-comp` in addition to -noappend -mem -processors
+	flags = append(flags, "-comp", comp)
 
 	if err := s.Create([]string{srcf.Name()}, f.Name(), flags); err != nil {
-		return false, fmt.Errorf("could not build squashfs with required gzip compression")
+		return false, fmt.Errorf("could not build squashfs with required %s compression", comp)
 	}
 
 	content, err = ioutil.ReadFile(f.Name())
@@ -290,17 +333,17 @@ func ensureGzipComp(tmpdir, mksquashfsPath string) (bool, error) {
 		return false, fmt.Errorf("while reading test squashfs: %v", err)
 	}
 
-	comp, err = image.GetSquashfsComp(content)
+	forcedComp, err := image.GetSquashfsComp(content)
 	if err != nil {
 		return false, fmt.Errorf("could not verify squashfs compression type: %v", err)
 	}
 
-	if comp == "gzip" {
-		sylog.Debugf("Gzip compression with -comp flag ensured")
+	if forcedComp == comp {
+		sylog.Debugf("%s compression with -comp flag ensured", comp)
 		return true, nil
 	}
 
-	return false, fmt.Errorf("could not build squashfs with required gzip compression")
+	return false, fmt.Errorf("could not build squashfs with required %s compression", comp)
 }
 
 // cleanUp removes remnants of build from file system unless NoCleanUp is specified.
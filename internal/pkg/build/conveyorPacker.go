@@ -39,6 +39,8 @@ func conveyorPacker(def types.Definition) (ConveyorPacker, error) {
 		return &sources.OrasConveyorPacker{}, nil
 	case "shub":
 		return &sources.ShubConveyorPacker{}, nil
+	case "s3":
+		return &sources.S3ConveyorPacker{}, nil
 	case "docker", "docker-archive", "docker-daemon", "oci", "oci-archive":
 		return &sources.OCIConveyorPacker{}, nil
 	case "busybox":
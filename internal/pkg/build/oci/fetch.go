@@ -0,0 +1,314 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/client"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/fs/lock"
+	"github.com/hpcng/singularity/pkg/util/singularityconf"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DownloadConcurrencyEnv specifies the environment variable which can
+	// set the number of concurrent layer downloads, overriding the
+	// 'download concurrency' directive of singularity.conf
+	DownloadConcurrencyEnv = "SINGULARITY_DOWNLOAD_CONCURRENCY"
+
+	// defaultDownloadConcurrency is the number of concurrent layer
+	// downloads when not configured.
+	defaultDownloadConcurrency = 3
+	// downloadAttempts is the number of attempts to download a blob, each
+	// attempt resumes the download where the previous one stopped.
+	downloadAttempts = 5
+	// partialPrefix is the prefix of the partially downloaded blobs in the
+	// blob cache, also ignored by the cache eviction.
+	partialPrefix = "tmp_"
+)
+
+// downloadConcurrency returns the maximum number of concurrent layer
+// downloads.
+func downloadConcurrency() uint {
+	if env := os.Getenv(DownloadConcurrencyEnv); env != "" {
+		n, err := strconv.ParseUint(env, 10, 32)
+		if err == nil && n > 0 {
+			return uint(n)
+		}
+		sylog.Warningf("Ignoring invalid %s value %q", DownloadConcurrencyEnv, env)
+	}
+	if c := singularityconf.GetCurrentConfig(); c != nil && c.DownloadConcurrency > 0 {
+		return c.DownloadConcurrency
+	}
+	return defaultDownloadConcurrency
+}
+
+// blobFetcher downloads the blobs of an image from a docker registry into
+// the blob directory of the OCI layout cache. Downloads run concurrently,
+// and partially downloaded blobs are kept in the cache so an interrupted
+// download is resumed with HTTP range requests instead of restarting.
+// Blobs are fetched from the first of the registry mirrors and the registry
+// itself able to serve them.
+type blobFetcher struct {
+	sources     []pullSource
+	dir         string
+	concurrency uint
+}
+
+// newBlobFetcher returns a blobFetcher for the docker image reference ref,
+// storing blobs in the blobs/sha256 directory of the OCI layout layoutDir.
+func newBlobFetcher(ctx context.Context, ref types.ImageReference, sys *types.SystemContext, layoutDir string) (*blobFetcher, error) {
+	named := ref.DockerReference()
+	if named == nil {
+		return nil, fmt.Errorf("%s is not a docker reference", transports.ImageName(ref))
+	}
+
+	sources, err := pullSources(ctx, named, sys)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(layoutDir, "blobs", "sha256")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &blobFetcher{
+		sources:     sources,
+		dir:         dir,
+		concurrency: downloadConcurrency(),
+	}, nil
+}
+
+// fetchAll downloads the blobs which are not already in the cache, with at
+// most concurrency downloads at the same time.
+func (f *blobFetcher) fetchAll(ctx context.Context, blobs []types.BlobInfo) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mp := client.NewMultiProgress(ctx)
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, f.concurrency)
+	seen := make(map[digest.Digest]bool)
+
+	for _, b := range blobs {
+		// images may reference the same blob several times
+		if seen[b.Digest] {
+			continue
+		}
+		seen[b.Digest] = true
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(b types.BlobInfo) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := f.fetch(ctx, b, mp); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(b)
+	}
+
+	wg.Wait()
+	mp.Wait()
+
+	return firstErr
+}
+
+// fetch downloads the blob b unless it's already in the cache, resuming a
+// previous partial download if any.
+func (f *blobFetcher) fetch(ctx context.Context, b types.BlobInfo, mp *client.MultiProgress) error {
+	if b.Digest.Algorithm() != digest.SHA256 {
+		return fmt.Errorf("unsupported digest algorithm for blob %s", b.Digest)
+	}
+
+	path := filepath.Join(f.dir, b.Digest.Encoded())
+	if _, err := os.Stat(path); err == nil {
+		sylog.Debugf("Blob %s found in cache", b.Digest)
+		return nil
+	}
+
+	// the partial blob is locked by the process downloading it, concurrent
+	// pulls of the same image wait and reuse the downloaded blob
+	partial := filepath.Join(f.dir, partialPrefix+b.Digest.Encoded()+".partial")
+	fd, err := lockPartial(partial)
+	if err != nil {
+		return fmt.Errorf("while locking %s: %v", partial, err)
+	}
+	defer lock.Release(fd)
+
+	// the blob was downloaded while waiting for the lock, the partial blob
+	// was created afterwards by a waiting process
+	if _, err := os.Stat(path); err == nil {
+		return os.Remove(partial)
+	}
+
+	pf, err := os.OpenFile(partial, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer pf.Close()
+
+	// a source failing without downloading anything is skipped, so every
+	// source is tried at least once
+	attempts := downloadAttempts + len(f.sources) - 1
+	src := 0
+	for attempt := 1; ; attempt++ {
+		var offset int64
+		if offset, err = partialSize(pf); err != nil {
+			return err
+		}
+		err = f.download(ctx, f.sources[src], b, pf, mp)
+		if err == nil || ctx.Err() != nil || attempt == attempts {
+			break
+		}
+		if size, _ := partialSize(pf); size > offset {
+			sylog.Warningf("Download of blob %s interrupted, resuming: %s", b.Digest.Encoded()[:12], err)
+			continue
+		}
+		next := (src + 1) % len(f.sources)
+		if next != src {
+			sylog.Debugf("Could not download blob %s from %s, trying %s: %s", b.Digest.Encoded()[:12], f.sources[src].name, f.sources[next].name, err)
+		}
+		src = next
+	}
+	if err != nil {
+		// keep the partial blob only if there is a download to resume
+		if size, _ := partialSize(pf); size == 0 {
+			os.Remove(partial)
+		}
+		return fmt.Errorf("while downloading blob %s: %v", b.Digest, err)
+	}
+
+	if err := verifyBlob(partial, b.Digest); err != nil {
+		// restart from scratch the next time
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, path)
+}
+
+// lockPartial creates the partial blob at path if needed, and returns a lock
+// on it. The previous lock holder may have renamed or removed the locked
+// file, so the lock is only returned once it's held on the file at path.
+func lockPartial(path string) (int, error) {
+	for {
+		pf, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			return -1, err
+		}
+		pf.Close()
+
+		fd, err := lock.Exclusive(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return -1, err
+		}
+
+		var locked, linked unix.Stat_t
+		if err := unix.Fstat(fd, &locked); err != nil {
+			lock.Release(fd)
+			return -1, err
+		}
+		if err := unix.Stat(path, &linked); err == nil && linked.Dev == locked.Dev && linked.Ino == locked.Ino {
+			return fd, nil
+		}
+		lock.Release(fd)
+	}
+}
+
+// partialSize returns the size of the partial blob pf.
+func partialSize(pf *os.File) (int64, error) {
+	fi, err := pf.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// download appends the missing content of the blob b, fetched from the
+// source src, to the partial blob pf.
+func (f *blobFetcher) download(ctx context.Context, src pullSource, b types.BlobInfo, pf *os.File, mp *client.MultiProgress) error {
+	offset, err := partialSize(pf)
+	if err != nil {
+		return err
+	}
+	if b.Size >= 0 && offset >= b.Size {
+		return nil
+	}
+
+	rc, err := src.fetcher.Fetch(ctx, ocispec.Descriptor{
+		MediaType: b.MediaType,
+		Digest:    b.Digest,
+		Size:      b.Size,
+		URLs:      b.URLs,
+	})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if offset > 0 {
+		s, ok := rc.(io.Seeker)
+		if !ok {
+			return fmt.Errorf("resuming download is not supported")
+		}
+		if _, err := s.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		sylog.Debugf("Resuming download of blob %s at offset %d", b.Digest, offset)
+	}
+
+	remaining := int64(-1)
+	if b.Size >= 0 {
+		remaining = b.Size - offset
+	}
+	return mp.Callback(b.Digest.Encoded()[:12], offset)(remaining, rc, pf)
+}
+
+// verifyBlob checks that the content of the file at path matches the
+// digest d.
+func verifyBlob(path string, d digest.Digest) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	v := d.Verifier()
+	if _, err := io.Copy(v, f); err != nil {
+		return err
+	}
+	if !v.Verified() {
+		return fmt.Errorf("digest mismatch for blob %s", d)
+	}
+	return nil
+}
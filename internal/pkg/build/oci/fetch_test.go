@@ -0,0 +1,342 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/cache"
+	"github.com/hpcng/singularity/internal/pkg/client"
+	"github.com/hpcng/singularity/pkg/util/fs/lock"
+	digest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// testRegistry is a minimal docker registry serving a single image
+// test/image:latest. The first download of each layer is interrupted
+// halfway, so clients must resume it.
+type testRegistry struct {
+	*httptest.Server
+
+	manifest []byte
+	config   digest.Digest
+	blobs    map[digest.Digest][]byte
+
+	mu          sync.Mutex
+	interrupted map[digest.Digest]bool
+	ranges      []string
+	layerGets   int
+}
+
+func newTestRegistry(t *testing.T, layers int) *testRegistry {
+	r := &testRegistry{
+		blobs:       make(map[digest.Digest][]byte),
+		interrupted: make(map[digest.Digest]bool),
+	}
+
+	m := ocispec.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+	}
+
+	config := ocispec.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		RootFS:       ocispec.RootFS{Type: "layers"},
+	}
+	for i := 0; i < layers; i++ {
+		b := make([]byte, 64*1024)
+		if _, err := rand.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		d := digest.FromBytes(b)
+		r.blobs[d] = b
+		m.Layers = append(m.Layers, ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageLayer,
+			Digest:    d,
+			Size:      int64(len(b)),
+		})
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, d)
+	}
+
+	cb, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.config = digest.FromBytes(cb)
+	r.blobs[r.config] = cb
+	m.Config = ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageConfig,
+		Digest:    digest.FromBytes(cb),
+		Size:      int64(len(cb)),
+	}
+
+	if r.manifest, err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r
+}
+
+func (r *testRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	const prefix = "/v2/test/image/"
+
+	switch {
+	case req.URL.Path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case req.URL.Path == prefix+"manifests/latest" || req.URL.Path == prefix+"manifests/"+digest.FromBytes(r.manifest).String():
+		w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(r.manifest).String())
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(r.manifest))
+	case strings.HasPrefix(req.URL.Path, prefix+"blobs/"):
+		d := digest.Digest(strings.TrimPrefix(req.URL.Path, prefix+"blobs/"))
+		b, ok := r.blobs[d]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+
+		r.mu.Lock()
+		layer := d != r.config
+		if layer && req.Method == http.MethodGet {
+			r.layerGets++
+		}
+		if rg := req.Header.Get("Range"); rg != "" {
+			r.ranges = append(r.ranges, rg)
+		}
+		interrupt := layer && !r.interrupted[d]
+		r.interrupted[d] = true
+		r.mu.Unlock()
+
+		if interrupt && req.Method == http.MethodGet {
+			w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(b[:len(b)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(b))
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestFetchBlobs(t *testing.T) {
+	os.Setenv(DownloadConcurrencyEnv, "2")
+	defer os.Unsetenv(DownloadConcurrencyEnv)
+
+	tests := []struct {
+		name string
+		// ref returns the image reference and the registries configuration
+		// for the registry at host
+		ref func(host string) (string, string)
+	}{
+		{
+			name: "Registry",
+			ref: func(host string) (string, string) {
+				return host + "/test/image:latest", ""
+			},
+		},
+		{
+			name: "Mirror",
+			ref: func(host string) (string, string) {
+				// the registry and the first mirror are unreachable,
+				// blobs are fetched from the second mirror
+				conf := fmt.Sprintf(`[[registry]]
+prefix = "registry.invalid/library"
+location = "127.0.0.1:1/test"
+
+[[registry.mirror]]
+location = "127.0.0.1:1/test"
+insecure = true
+
+[[registry.mirror]]
+location = "%s/test"
+insecure = true
+`, host)
+				return "registry.invalid/library/image:latest", conf
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRegistry(t, 4)
+			defer r.Close()
+
+			dir, err := ioutil.TempDir("", "oci-fetch-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			imgCache, err := cache.New(cache.Config{ParentDir: dir})
+			if err != nil {
+				t.Fatalf("while creating cache: %v", err)
+			}
+			if imgCache.IsDisabled() {
+				t.Skip("cache is disabled, blobs can't be fetched into it")
+			}
+
+			ref, conf := tt.ref(strings.TrimPrefix(r.URL, "http://"))
+			src, err := docker.Transport.ParseReference("//" + ref)
+			if err != nil {
+				t.Fatalf("while parsing reference: %v", err)
+			}
+
+			sys := &types.SystemContext{}
+			if conf == "" {
+				sys.DockerInsecureSkipTLSVerify = types.NewOptionalBool(true)
+			} else {
+				sys.SystemRegistriesConfPath = filepath.Join(dir, "registries.conf")
+				sys.SystemRegistriesConfDirPath = filepath.Join(dir, "registries.conf.d")
+				if err := ioutil.WriteFile(sys.SystemRegistriesConfPath, []byte(conf), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			testFetchBlobs(t, r, imgCache, src, sys)
+		})
+	}
+}
+
+func testFetchBlobs(t *testing.T, r *testRegistry, imgCache *cache.Handle, src types.ImageReference, sys *types.SystemContext) {
+	ctx := context.Background()
+	ref, err := ConvertReference(ctx, imgCache, src, sys)
+	if err != nil {
+		t.Fatalf("while converting reference: %v", err)
+	}
+
+	is, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		t.Fatalf("while pulling image: %v", err)
+	}
+	is.Close()
+
+	cacheDir, err := imgCache.GetOciCacheDir(cache.OciBlobCacheType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for d, b := range r.blobs {
+		got, err := ioutil.ReadFile(filepath.Join(cacheDir, "blobs", "sha256", d.Encoded()))
+		if err != nil {
+			t.Errorf("blob %s not in cache: %v", d, err)
+		} else if !bytes.Equal(got, b) {
+			t.Errorf("blob %s corrupted in cache", d)
+		}
+		if _, err := os.Stat(filepath.Join(cacheDir, "blobs", "sha256", partialPrefix+d.Encoded()+".partial")); !os.IsNotExist(err) {
+			t.Errorf("partial blob %s left in cache", d)
+		}
+	}
+
+	// layers are downloaded once, and not downloaded again by copy.Image
+	if r.layerGets != 2*4 {
+		t.Errorf("got %d layer requests, want %d", r.layerGets, 2*4)
+	}
+
+	// each interrupted layer download is resumed where it stopped
+	if len(r.ranges) != 4 {
+		t.Errorf("got %d resumed downloads, want 4", len(r.ranges))
+	}
+	for _, rg := range r.ranges {
+		if rg != fmt.Sprintf("bytes=%d-", 32*1024) {
+			t.Errorf("unexpected range %q", rg)
+		}
+	}
+}
+
+// failingFetcher fails to fetch any blob.
+type failingFetcher struct{}
+
+func (failingFetcher) Fetch(context.Context, ocispec.Descriptor) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("registry unreachable")
+}
+
+// TestFetchNoPartial checks that a failed download with nothing to resume
+// leaves no partial blob.
+func TestFetchNoPartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oci-fetch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := &blobFetcher{
+		sources: []pullSource{{name: "registry.invalid", fetcher: failingFetcher{}}},
+		dir:     dir,
+	}
+	b := types.BlobInfo{Digest: digest.FromString("blob"), Size: 4}
+	ctx := context.Background()
+
+	if err := f.fetch(ctx, b, client.NewMultiProgress(ctx)); err == nil {
+		t.Fatalf("unexpected success fetching from an unreachable registry")
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range fis {
+		if strings.HasPrefix(fi.Name(), partialPrefix) {
+			t.Errorf("partial blob %s left in cache", fi.Name())
+		}
+	}
+}
+
+func TestLockPartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oci-fetch-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	partial := filepath.Join(dir, partialPrefix+"blob.partial")
+	fd, err := lockPartial(partial)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	locked := make(chan error, 1)
+	go func() {
+		fd, err := lockPartial(partial)
+		if err == nil {
+			lock.Release(fd)
+		}
+		locked <- err
+	}()
+
+	// the lock holder completes the download while the other one waits,
+	// the waiter must not keep a lock on the renamed blob
+	time.Sleep(100 * time.Millisecond)
+	if err := os.Rename(partial, filepath.Join(dir, "blob")); err != nil {
+		t.Fatal(err)
+	}
+	lock.Release(fd)
+
+	if err := <-locked; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(partial); err != nil {
+		t.Errorf("partial blob not created by the waiting process: %s", err)
+	}
+}
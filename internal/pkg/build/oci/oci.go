@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -8,24 +8,30 @@ package oci
 
 import (
 	"context"
-	"crypto/sha256"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 
 	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/oci/layout"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/hpcng/singularity/internal/pkg/cache"
+	"github.com/hpcng/singularity/internal/pkg/remote/credential"
 	"github.com/hpcng/singularity/pkg/sylog"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 )
 
 // ImageReference wraps containers/image ImageReference type
 type ImageReference struct {
-	source types.ImageReference
+	source   types.ImageReference
+	imgCache *cache.Handle
 	types.ImageReference
 }
 
@@ -54,6 +60,7 @@ func ConvertReference(ctx context.Context, imgCache *cache.Handle, src types.Ima
 
 	return &ImageReference{
 		source:         src,
+		imgCache:       imgCache,
 		ImageReference: c,
 	}, nil
 
@@ -71,17 +78,82 @@ func (t *ImageReference) newImageSource(ctx context.Context, sys *types.SystemCo
 		return nil, err
 	}
 
+	// Layers of docker images are downloaded into the cache first, so they are
+	// fetched concurrently and interrupted downloads are resumed, copy.Image
+	// then reuses them
+	if t.source.Transport().Name() == "docker" && t.imgCache != nil {
+		if err := t.fetchBlobs(ctx, sys); ctx.Err() != nil {
+			return nil, ctx.Err()
+		} else if err != nil {
+			sylog.Warningf("Falling back to the default download of layers: %s", err)
+		}
+	}
+
 	// First we are fetching into the cache
-	_, err = copy.Image(ctx, policyCtx, t.ImageReference, t.source, &copy.Options{
-		ReportWriter: w,
-		SourceCtx:    sys,
+	mb, err := copy.Image(ctx, policyCtx, t.ImageReference, t.source, &copy.Options{
+		ReportWriter:         w,
+		SourceCtx:            sys,
+		MaxParallelDownloads: downloadConcurrency(),
 	})
 	if err != nil {
 		return nil, err
 	}
+
+	if t.imgCache != nil {
+		digests, err := manifestBlobs(mb)
+		if err != nil {
+			return nil, err
+		}
+		t.imgCache.UseBlobs(digests)
+	}
+
 	return t.ImageReference.NewImageSource(ctx, sys)
 }
 
+// fetchBlobs downloads the layers and configuration of the source image into
+// the blob cache.
+func (t *ImageReference) fetchBlobs(ctx context.Context, sys *types.SystemContext) error {
+	img, err := t.source.NewImage(ctx, sys)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	blobs := img.LayerInfos()
+	if ci := img.ConfigInfo(); ci.Digest != "" {
+		blobs = append(blobs, ci)
+	}
+
+	dir, err := t.imgCache.GetOciCacheDir(cache.OciBlobCacheType)
+	if err != nil {
+		return err
+	}
+	f, err := newBlobFetcher(ctx, t.source, sys, dir)
+	if err != nil {
+		return err
+	}
+	return f.fetchAll(ctx, blobs)
+}
+
+// manifestBlobs returns the digests of the blobs referenced by the image
+// manifest mb, including the manifest itself.
+func manifestBlobs(mb []byte) ([]string, error) {
+	m, err := manifest.FromBlob(mb, manifest.GuessMIMEType(mb))
+	if err != nil {
+		return nil, fmt.Errorf("while parsing image manifest: %v", err)
+	}
+	md, err := manifest.Digest(mb)
+	if err != nil {
+		return nil, err
+	}
+
+	digests := []string{md.String(), m.ConfigInfo().Digest.String()}
+	for _, l := range m.LayerInfos() {
+		digests = append(digests, l.Digest.String())
+	}
+	return digests, nil
+}
+
 // ParseImageName parses a uri (e.g. docker://ubuntu) into it's transport:reference
 // combination and then returns the proper reference
 func ParseImageName(ctx context.Context, imgCache *cache.Handle, uri string, sys *types.SystemContext) (types.ImageReference, error) {
@@ -116,13 +188,82 @@ func ImageSHA(ctx context.Context, uri string, sys *types.SystemContext) (string
 		return "", fmt.Errorf("unable to parse image name %v: %v", uri, err)
 	}
 
+	SetRegistryCredentials(sys, ref)
+
 	return calculateRefHash(ctx, ref, sys)
 }
 
-func calculateRefHash(ctx context.Context, ref types.ImageReference, sys *types.SystemContext) (hash string, err error) {
+// SetRegistryCredentials sets the credentials of sys for the registry of the docker reference
+// ref from the docker configuration files and credential helpers, unless credentials were
+// explicitly provided.
+func SetRegistryCredentials(sys *types.SystemContext, ref types.ImageReference) {
+	if sys == nil || sys.DockerAuthConfig != nil || ref.Transport().Name() != "docker" {
+		return
+	}
+	if named := ref.DockerReference(); named != nil {
+		sys.DockerAuthConfig = credential.RegistryCredentials(reference.Domain(named))
+	}
+}
+
+// ManifestDigest returns the digest of the manifest ref resolves to. For
+// multi-platform images, this is the digest of the manifest list.
+func ManifestDigest(ctx context.Context, ref types.ImageReference, sys *types.SystemContext) (digest.Digest, error) {
+	return manifestDigest(ctx, ref, sys, false)
+}
+
+// PinDigest returns the docker reference ref pinned to the manifest digest d
+// it resolved to, so the image is pulled by digest and its tag isn't
+// resolved again, possibly to another image. Other references and
+// references already holding a digest are returned as is.
+func PinDigest(ref types.ImageReference, d digest.Digest) (types.ImageReference, error) {
+	if ref.Transport().Name() != "docker" {
+		return ref, nil
+	}
+	named := ref.DockerReference()
+	if _, ok := named.(reference.Canonical); ok || named == nil {
+		return ref, nil
+	}
+	pinned, err := reference.WithDigest(reference.TrimNamed(named), d)
+	if err != nil {
+		return nil, err
+	}
+	return docker.NewReference(pinned)
+}
+
+// resolvedManifest is a manifest a docker reference resolved to.
+type resolvedManifest struct {
+	man []byte
+	mt  string
+}
+
+// resolvedManifests holds the manifests docker references resolved to, so a
+// reference is resolved once by a process, e.g. while checking its digest,
+// computing its cache key and recording its provenance. This also ensures
+// these steps see the same digest.
+var resolvedManifests = struct {
+	sync.Mutex
+	m map[string]resolvedManifest
+}{m: make(map[string]resolvedManifest)}
+
+// getManifest returns the manifest ref resolves to and its MIME type. The
+// manifests of docker references are only fetched once, and are also
+// recorded for the reference to their digest.
+func getManifest(ctx context.Context, ref types.ImageReference, sys *types.SystemContext) (man []byte, mt string, err error) {
+	isDocker := ref.Transport().Name() == "docker"
+	name := transports.ImageName(ref)
+
+	if isDocker {
+		resolvedManifests.Lock()
+		rm, ok := resolvedManifests.m[name]
+		resolvedManifests.Unlock()
+		if ok {
+			return rm.man, rm.mt, nil
+		}
+	}
+
 	source, err := ref.NewImageSource(ctx, sys)
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
 	defer func() {
 		if closeErr := source.Close(); closeErr != nil {
@@ -130,11 +271,54 @@ func calculateRefHash(ctx context.Context, ref types.ImageReference, sys *types.
 		}
 	}()
 
-	man, _, err := source.GetManifest(ctx, nil)
+	man, mt, err = source.GetManifest(ctx, nil)
+	if err != nil || !isDocker {
+		return man, mt, err
+	}
+
+	resolvedManifests.Lock()
+	defer resolvedManifests.Unlock()
+
+	resolvedManifests.m[name] = resolvedManifest{man: man, mt: mt}
+	if named := ref.DockerReference(); named != nil {
+		pinned, err := reference.WithDigest(reference.TrimNamed(named), digest.FromBytes(man))
+		if err != nil {
+			return man, mt, nil
+		}
+		if pinnedRef, err := docker.NewReference(pinned); err == nil {
+			resolvedManifests.m[transports.ImageName(pinnedRef)] = resolvedManifest{man: man, mt: mt}
+		}
+	}
+	return man, mt, nil
+}
+
+// manifestDigest returns the digest of the manifest ref resolves to. With
+// instance set, the digest of the image selected in manifest lists for the
+// platform of sys is returned instead.
+func manifestDigest(ctx context.Context, ref types.ImageReference, sys *types.SystemContext, instance bool) (digest.Digest, error) {
+	man, mt, err := getManifest(ctx, ref, sys)
 	if err != nil {
 		return "", err
 	}
 
-	hash = fmt.Sprintf("%x", sha256.Sum256(man))
-	return hash, nil
+	if instance && manifest.MIMETypeIsMultiImage(mt) {
+		list, err := manifest.ListFromBlob(man, mt)
+		if err != nil {
+			return "", fmt.Errorf("while parsing manifest list: %v", err)
+		}
+		return list.ChooseInstance(sys)
+	}
+
+	return digest.FromBytes(man), nil
+}
+
+// calculateRefHash returns the hash identifying the image ref resolves to,
+// for multi-platform images it identifies the image selected for the
+// platform of sys.
+func calculateRefHash(ctx context.Context, ref types.ImageReference, sys *types.SystemContext) (hash string, err error) {
+	d, err := manifestDigest(ctx, ref, sys, true)
+	if err != nil {
+		return "", err
+	}
+	return d.Encoded(), nil
 }
@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -15,11 +15,14 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/v5/docker"
 	"github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/hpcng/singularity/internal/pkg/cache"
 	"github.com/hpcng/singularity/internal/pkg/test"
 	buildTypes "github.com/hpcng/singularity/pkg/build/types"
+	digest "github.com/opencontainers/go-digest"
 )
 
 const (
@@ -432,3 +435,48 @@ func TestNewImageSource(t *testing.T) {
 		})
 	}
 }
+
+func TestPinDigest(t *testing.T) {
+	d := digest.FromString("manifest")
+
+	tests := []struct {
+		name string
+		ref  func() (types.ImageReference, error)
+		want string
+	}{
+		{
+			name: "Tag",
+			ref:  func() (types.ImageReference, error) { return docker.ParseReference("//alpine:3.13") },
+			want: "docker://alpine@" + d.String(),
+		},
+		{
+			name: "Digest",
+			ref: func() (types.ImageReference, error) {
+				return docker.ParseReference("//alpine@" + digest.FromString("other").String())
+			},
+			want: "docker://alpine@" + digest.FromString("other").String(),
+		},
+		{
+			name: "Layout",
+			ref:  func() (types.ImageReference, error) { return layout.ParseReference("/tmp/layout:tag") },
+			want: "oci:/tmp/layout:tag",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := tt.ref()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pinned, err := PinDigest(ref, d)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := transports.ImageName(pinned); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
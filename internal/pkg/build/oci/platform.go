@@ -0,0 +1,29 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/util/machine"
+)
+
+// SetPlatform sets the platform of sys, in the os/arch[/variant] format,
+// selecting the image pulled from multi-platform image indexes. The host
+// platform is selected when platform is empty.
+func SetPlatform(sys *types.SystemContext, platform string) error {
+	if platform == "" {
+		return nil
+	}
+
+	p, err := machine.ParsePlatform(platform)
+	if err != nil {
+		return err
+	}
+	sys.OSChoice = p.OS
+	sys.ArchitectureChoice = p.Arch
+	sys.VariantChoice = p.Variant
+	return nil
+}
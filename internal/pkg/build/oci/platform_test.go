@@ -0,0 +1,104 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestImageSHAPlatform(t *testing.T) {
+	amd64 := digest.FromString("amd64 manifest")
+	arm64 := digest.FromString("arm64 manifest")
+
+	index, err := json.Marshal(ocispec.Index{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		Manifests: []ocispec.Descriptor{
+			{
+				MediaType: ocispec.MediaTypeImageManifest,
+				Digest:    amd64,
+				Size:      1,
+				Platform:  &ocispec.Platform{OS: "linux", Architecture: "amd64"},
+			},
+			{
+				MediaType: ocispec.MediaTypeImageManifest,
+				Digest:    arm64,
+				Size:      1,
+				Platform:  &ocispec.Platform{OS: "linux", Architecture: "arm64"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/test/image/manifests/latest":
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageIndex)
+			w.Write(index)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	uri := "docker://" + strings.TrimPrefix(s.URL, "http://") + "/test/image:latest"
+
+	tests := []struct {
+		platform string
+		want     digest.Digest
+	}{
+		{platform: "linux/amd64", want: amd64},
+		{platform: "linux/arm64", want: arm64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			sys := &types.SystemContext{
+				DockerInsecureSkipTLSVerify: types.NewOptionalBool(true),
+			}
+			if err := SetPlatform(sys, tt.platform); err != nil {
+				t.Fatalf("while setting platform: %v", err)
+			}
+
+			hash, err := ImageSHA(context.Background(), uri, sys)
+			if err != nil {
+				t.Fatalf("while computing image hash: %v", err)
+			}
+			if hash != tt.want.Encoded() {
+				t.Errorf("got hash %s, want %s", hash, tt.want.Encoded())
+			}
+		})
+	}
+
+	// the digest of the index is used to lock the image tag
+	sys := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.NewOptionalBool(true),
+	}
+	ref, err := parseURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ManifestDigest(context.Background(), ref, sys)
+	if err != nil {
+		t.Fatalf("while getting manifest digest: %v", err)
+	}
+	if want := digest.FromBytes(index); d != want {
+		t.Errorf("got digest %s, want %s", d, want)
+	}
+}
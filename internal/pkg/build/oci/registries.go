@@ -0,0 +1,150 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/pkg/sysregistriesv2"
+	"github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/remote/credential"
+	"github.com/hpcng/singularity/pkg/syfs"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// RegistriesConfPath returns the path of the registries configuration
+// file, in the containers registries.conf format, used to resolve docker
+// references to registry locations and mirrors. The user configuration
+// file takes precedence over the one in the singularity configuration
+// directory. If neither exists, an empty string is returned, and the
+// containers default /etc/containers/registries.conf is used.
+func RegistriesConfPath() string {
+	for _, path := range []string{
+		syfs.RegistriesConf(),
+		filepath.Join(buildcfg.SINGULARITY_CONFDIR, syfs.RegistriesConfFile),
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// SetRegistriesConf sets the registries configuration file of the system
+// context sys to the one returned by RegistriesConfPath, if any.
+func SetRegistriesConf(sys *types.SystemContext) {
+	if path := RegistriesConfPath(); path != "" {
+		sylog.Debugf("Using registries configuration %s", path)
+		sys.SystemRegistriesConfPath = path
+	}
+}
+
+// pullSource is a location, either the registry or one of its mirrors,
+// from which the blobs of an image are fetched.
+type pullSource struct {
+	name    string
+	fetcher remotes.Fetcher
+}
+
+// pullSources returns the locations from which the blobs of the image named
+// are fetched, in order of preference, as configured in the registries
+// configuration: mirrors come first and the registry itself last.
+func pullSources(ctx context.Context, named reference.Named, sys *types.SystemContext) ([]pullSource, error) {
+	var auth *types.DockerAuthConfig
+	insecure := false
+	if sys != nil {
+		auth = sys.DockerAuthConfig
+		insecure = sys.DockerInsecureSkipTLSVerify == types.OptionalBoolTrue
+	}
+
+	sources := []sysregistriesv2.PullSource{{Reference: named}}
+
+	reg, err := sysregistriesv2.FindRegistry(sys, named.Name())
+	if err != nil {
+		return nil, fmt.Errorf("while loading registries configuration: %v", err)
+	}
+	if reg != nil {
+		if reg.Blocked {
+			return nil, fmt.Errorf("registry %s is blocked in registries configuration", reference.Domain(named))
+		}
+		sources, err = reg.PullSourcesFromReference(named)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ps := make([]pullSource, 0, len(sources))
+	for _, s := range sources {
+		resolver := docker.NewResolver(docker.ResolverOptions{
+			Hosts: registryHosts(sourceAuth(named, s.Reference, auth), insecure || s.Endpoint.Insecure),
+		})
+		fetcher, err := resolver.Fetcher(ctx, s.Reference.String())
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, pullSource{
+			name:    reference.Domain(s.Reference),
+			fetcher: fetcher,
+		})
+	}
+	return ps, nil
+}
+
+// sourceAuth returns the explicit credentials auth, given for the image
+// named, if the pull source src is on the same registry host. Mirrors and
+// rewritten locations get no explicit credentials, so they are only
+// authenticated with the credentials stored for their own host.
+func sourceAuth(named, src reference.Named, auth *types.DockerAuthConfig) *types.DockerAuthConfig {
+	if reference.Domain(src) != reference.Domain(named) {
+		return nil
+	}
+	return auth
+}
+
+// registryHosts returns the registry hosts configuration of the docker
+// resolver. Like containers/image, insecure registries are first accessed
+// with HTTPS without certificate verification and then with plain HTTP.
+// Without explicit credentials auth, hosts are authenticated with the
+// credentials returned by credential.RegistryCredentials.
+func registryHosts(auth *types.DockerAuthConfig, insecure bool) docker.RegistryHosts {
+	return func(host string) ([]docker.RegistryHost, error) {
+		client := &http.Client{}
+		config := docker.RegistryHost{
+			Client: client,
+			Authorizer: docker.NewDockerAuthorizer(
+				docker.WithAuthClient(client),
+				docker.WithAuthCreds(credential.ResolverCredentials(auth)),
+			),
+			Host:         host,
+			Scheme:       "https",
+			Path:         "/v2",
+			Capabilities: docker.HostCapabilityPull | docker.HostCapabilityResolve,
+		}
+		if host == "docker.io" {
+			config.Host = "registry-1.docker.io"
+		}
+		if !insecure {
+			return []docker.RegistryHost{config}, nil
+		}
+
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint:gosec
+		}
+		plain := config
+		plain.Scheme = "http"
+		return []docker.RegistryHost{config, plain}, nil
+	}
+}
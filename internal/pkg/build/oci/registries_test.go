@@ -0,0 +1,44 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+)
+
+func TestSourceAuth(t *testing.T) {
+	auth := &types.DockerAuthConfig{Username: "user", Password: "pass"}
+
+	tests := []struct {
+		name string
+		src  string
+		want *types.DockerAuthConfig
+	}{
+		{name: "Registry", src: "registry.example.com/library/image:latest", want: auth},
+		{name: "Repository", src: "registry.example.com/mirror/image:latest", want: auth},
+		{name: "Mirror", src: "mirror.example.com/library/image:latest", want: nil},
+		{name: "Port", src: "registry.example.com:5000/library/image:latest", want: nil},
+	}
+
+	named, err := reference.ParseNormalizedNamed("registry.example.com/library/image:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := reference.ParseNormalizedNamed(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sourceAuth(named, src, auth); got != tt.want {
+				t.Errorf("got credentials %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/docker"
@@ -27,11 +28,13 @@ import (
 	ociarchive "github.com/containers/image/v5/oci/archive"
 	ocilayout "github.com/containers/image/v5/oci/layout"
 	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/hpcng/singularity/internal/pkg/build/oci"
 	"github.com/hpcng/singularity/internal/pkg/util/shell"
 	sytypes "github.com/hpcng/singularity/pkg/build/types"
 	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/inspect"
 	"github.com/hpcng/singularity/pkg/syfs"
 	"github.com/hpcng/singularity/pkg/sylog"
 	useragent "github.com/hpcng/singularity/pkg/util/user-agent"
@@ -40,12 +43,13 @@ import (
 
 // OCIConveyorPacker holds stuff that needs to be packed into the bundle
 type OCIConveyorPacker struct {
-	srcRef    types.ImageReference
-	b         *sytypes.Bundle
-	tmpfsRef  types.ImageReference
-	policyCtx *signature.PolicyContext
-	imgConfig imgspecv1.ImageConfig
-	sysCtx    *types.SystemContext
+	srcRef     types.ImageReference
+	b          *sytypes.Bundle
+	tmpfsRef   types.ImageReference
+	policyCtx  *signature.PolicyContext
+	imgConfig  imgspecv1.ImageConfig
+	sysCtx     *types.SystemContext
+	provenance inspect.Provenance
 }
 
 // Get downloads container information from the specified source
@@ -75,6 +79,10 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 	if cp.b.Opts.NoHTTPS {
 		cp.sysCtx.DockerInsecureSkipTLSVerify = types.NewOptionalBool(true)
 	}
+	oci.SetRegistriesConf(cp.sysCtx)
+	if err := oci.SetPlatform(cp.sysCtx, cp.b.Opts.Platform); err != nil {
+		return err
+	}
 
 	// add registry and namespace to reference if specified
 	ref := b.Recipe.Header["from"]
@@ -133,6 +141,25 @@ func (cp *OCIConveyorPacker) Get(ctx context.Context, b *sytypes.Bundle) (err er
 		return fmt.Errorf("invalid image source: %v", err)
 	}
 
+	oci.SetRegistryCredentials(cp.sysCtx, cp.srcRef)
+
+	// record the manifest digest the tag resolved to, so the image can be
+	// traced back to its source, and pull the image by this digest
+	cp.provenance.Source = b.Recipe.Header["bootstrap"] + ":" + ref
+	if cp.srcRef.Transport().Name() == "docker" {
+		cp.provenance.Source = transports.ImageName(cp.srcRef)
+		d, err := oci.ManifestDigest(ctx, cp.srcRef, cp.sysCtx)
+		if err != nil {
+			return fmt.Errorf("while resolving image digest: %v", err)
+		}
+		cp.provenance.Digest = d.String()
+
+		cp.srcRef, err = oci.PinDigest(cp.srcRef, d)
+		if err != nil {
+			return fmt.Errorf("while pinning image digest: %v", err)
+		}
+	}
+
 	if !cp.b.Opts.NoCache {
 		// Grab the modified source ref from the cache
 		cp.srcRef, err = oci.ConvertReference(ctx, b.Opts.ImgCache, cp.srcRef, cp.sysCtx)
@@ -185,6 +212,11 @@ func (cp *OCIConveyorPacker) Pack(ctx context.Context) (*sytypes.Bundle, error)
 		return nil, fmt.Errorf("while inserting oci config: %v", err)
 	}
 
+	err = cp.insertProvenance()
+	if err != nil {
+		return nil, fmt.Errorf("while inserting provenance: %v", err)
+	}
+
 	return cp.b, nil
 }
 
@@ -209,6 +241,31 @@ func (cp *OCIConveyorPacker) getConfig(ctx context.Context) (imgspecv1.ImageConf
 		return imgspecv1.ImageConfig{}, err
 	}
 
+	// the variant is missing from the image configuration structure, it's
+	// decoded from the configuration blob, or is the variant selected in a
+	// multi-platform image if the configuration doesn't hold it
+	blob, err := img.ConfigBlob(ctx)
+	if err != nil {
+		return imgspecv1.ImageConfig{}, err
+	}
+	var platform struct {
+		Variant string `json:"variant"`
+	}
+	if err := json.Unmarshal(blob, &platform); err != nil {
+		return imgspecv1.ImageConfig{}, err
+	}
+	if platform.Variant == "" && cp.sysCtx.ArchitectureChoice == imgSpec.Architecture {
+		platform.Variant = cp.sysCtx.VariantChoice
+	}
+
+	cp.provenance.Platform = imgSpec.OS + "/" + imgSpec.Architecture
+	if platform.Variant != "" {
+		cp.provenance.Platform += "/" + platform.Variant
+	}
+	if arch := cp.sysCtx.ArchitectureChoice; arch != "" && arch != imgSpec.Architecture {
+		sylog.Warningf("Image architecture %s doesn't match the requested platform %s", imgSpec.Architecture, cp.b.Opts.Platform)
+	}
+
 	return imgSpec.Config, nil
 }
 
@@ -222,6 +279,18 @@ func (cp *OCIConveyorPacker) insertOCIConfig() error {
 	return nil
 }
 
+func (cp *OCIConveyorPacker) insertProvenance() error {
+	cp.provenance.Time = time.Now().UTC()
+
+	p, err := json.Marshal(cp.provenance)
+	if err != nil {
+		return err
+	}
+
+	cp.b.JSONObjects[image.SIFDescProvenanceJSON] = p
+	return nil
+}
+
 // Perform a dumb tar(gz) extraction with no chown, id remapping etc.
 // This is needed for non-root handling of `oci-archive` as the extraction
 // by containers/archive is failing when uid/gid don't match local machine
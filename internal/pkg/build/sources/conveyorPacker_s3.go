@@ -0,0 +1,50 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hpcng/singularity/internal/pkg/client/s3"
+	"github.com/hpcng/singularity/pkg/build/types"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// S3ConveyorPacker only needs to hold a packer to pack the image it pulls
+// from an S3 object store.
+type S3ConveyorPacker struct {
+	LocalPacker
+}
+
+// Get downloads container from an S3 object store
+func (cp *S3ConveyorPacker) Get(ctx context.Context, b *types.Bundle) (err error) {
+	sylog.Debugf("Getting container from S3 object store")
+
+	ref := b.Recipe.Header["from"]
+	if !strings.HasPrefix(ref, "s3://") {
+		ref = "s3://" + ref
+	}
+
+	c, err := s3.DefaultConfig()
+	if err != nil {
+		return fmt.Errorf("while getting s3 client configuration: %v", err)
+	}
+
+	imagePath, err := s3.Pull(ctx, b.Opts.ImgCache, ref, b.Opts.TmpDir, c)
+	if err != nil {
+		return fmt.Errorf("while fetching s3 image: %v", err)
+	}
+
+	// insert base metadata before unpacking fs
+	if err = makeBaseEnv(b.RootfsPath); err != nil {
+		return fmt.Errorf("while inserting base environment: %v", err)
+	}
+
+	cp.LocalPacker, err = GetLocalPacker(ctx, imagePath, b)
+	return err
+}
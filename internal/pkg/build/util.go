@@ -23,7 +23,7 @@ import (
 )
 
 // ConvertOciToSIf will convert an OCI source into a SIF using the build routines
-func ConvertOciToSIF(ctx context.Context, imgCache *cache.Handle, image, cachedImgPath, tmpDir string, noHTTPS, noCleanUp bool, authConf *ocitypes.DockerAuthConfig) error {
+func ConvertOciToSIF(ctx context.Context, imgCache *cache.Handle, image, cachedImgPath, tmpDir, platform string, noHTTPS, noCleanUp bool, authConf *ocitypes.DockerAuthConfig) error {
 	if imgCache == nil {
 		return fmt.Errorf("image cache is undefined")
 	}
@@ -41,6 +41,7 @@ func ConvertOciToSIF(ctx context.Context, imgCache *cache.Handle, image, cachedI
 				NoHTTPS:          noHTTPS,
 				DockerAuthConfig: authConf,
 				ImgCache:         imgCache,
+				Platform:         platform,
 			},
 		},
 	)
@@ -50,6 +50,8 @@ const (
 	OrasCacheType = "oras"
 	// The Net cache holds images pulled from http(s) internet sources
 	NetCacheType = "net"
+	// The S3 cache holds images pulled from S3 object stores
+	S3CacheType = "s3"
 )
 
 var (
@@ -59,6 +61,7 @@ var (
 		ShubCacheType,
 		OrasCacheType,
 		NetCacheType,
+		S3CacheType,
 	}
 	OciCacheTypes = []string{
 		OciBlobCacheType,
@@ -72,6 +75,15 @@ type Config struct {
 	ParentDir string
 	// Disable specifies whether the user request the cache to be disabled by default.
 	Disable bool
+	// MaxSize specifies the maximum size of the cache in bytes, least recently used
+	// entries are evicted when it's exceeded. Zero means the size is not limited.
+	MaxSize int64
+	// SharedDir specifies the location of the shared system cache, consulted
+	// before the user cache. Shared entries are read-only.
+	SharedDir string
+	// LockTimeout specifies how long to wait for another process creating
+	// the same entry before giving up. Zero means waiting indefinitely.
+	LockTimeout time.Duration
 }
 
 // Handle is an structure representing the image cache, it's location and subdirectories
@@ -86,6 +98,16 @@ type Handle struct {
 	rootDir string
 	// If the cache is disabled
 	disabled bool
+	// maxSize is the maximum size of the cache in bytes, 0 if not limited
+	maxSize int64
+	// sharedDir is the root of the shared system cache consulted before this
+	// cache, if any
+	sharedDir string
+	// shared is true if the handle manages the shared system cache itself
+	shared bool
+	// lockTimeout is how long to wait for another process creating the same
+	// entry, 0 if not limited
+	lockTimeout time.Duration
 }
 
 func (h *Handle) GetFileCacheDir(cacheType string) (cacheDir string, err error) {
@@ -108,7 +130,14 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 		return nil, nil
 	}
 
-	e = &Entry{}
+	if se := h.sharedEntry(cacheType, hash); se != nil {
+		return se, nil
+	}
+
+	e = &Entry{
+		CacheType: cacheType,
+		handle:    h,
+	}
 
 	cacheDir, err := h.GetFileCacheDir(cacheType)
 	if err != nil {
@@ -135,14 +164,34 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 		return nil, fmt.Errorf("could not check for cache entry '%s': %v", e.Path, err)
 	}
 
+	if !pathExists {
+		// Only one process creates the entry, others wait for the lock
+		// to be released and then use the entry it created
+		e.lockFd, err = h.lockEntry(cacheType, hash)
+		if err != nil {
+			return nil, fmt.Errorf("could not lock cache entry '%s': %w", e.Path, err)
+		}
+		e.locked = true
+
+		pathExists, err = fs.PathExists(e.Path)
+		if err != nil || pathExists {
+			e.unlock()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not check for cache entry '%s': %v", e.Path, err)
+		}
+	}
+
 	if !pathExists {
 		e.Exists = false
-		f, err := fs.MakeTmpFile(cacheDir, "tmp_", 0700)
+		f, err := fs.MakeTmpFile(cacheDir, tmpPrefix, h.fileMode())
 		if err != nil {
+			e.unlock()
 			return nil, err
 		}
 		err = f.Close()
 		if err != nil {
+			e.unlock()
 			return nil, err
 		}
 		e.TmpPath = f.Name()
@@ -156,6 +205,11 @@ func (h *Handle) GetEntry(cacheType string, hash string) (e *Entry, err error) {
 
 	// It exists in the cache and it's a file. Caller can use the Path directly
 	e.Exists = true
+	if !h.shared {
+		if err := h.touch(cacheType, hash); err != nil {
+			sylog.Warningf("Could not update metadata of cache entry '%s': %v", e.Path, err)
+		}
+	}
 	return e, nil
 }
 
@@ -189,6 +243,10 @@ func (h *Handle) CleanCache(cacheType string, dryRun bool, days int) (err error)
 		}
 	}
 
+	if !dryRun {
+		h.pruneMetadata(cacheType)
+	}
+
 	if errCount > 0 {
 		return fmt.Errorf("failed to remove %d cache entries", errCount)
 	}
@@ -210,6 +268,12 @@ func (h *Handle) cleanAllCaches() {
 		}
 	}
 
+	// lock files are kept, as concurrent processes could be waiting on them
+	dir := path.Join(h.rootDir, metadataDirName)
+	if err := os.RemoveAll(dir); err != nil {
+		sylog.Verbosef("unable to clean cache metadata, directory %s: %v", dir, err)
+	}
+
 }
 
 // IsDisabled returns true if the cache is disabled
@@ -243,6 +307,9 @@ func New(cfg Config) (h *Handle, err error) {
 	if cacheDisabled || cfg.Disable {
 		h.disabled = true
 	}
+	h.maxSize = cfg.MaxSize
+	h.sharedDir = cfg.SharedDir
+	h.lockTimeout = cfg.LockTimeout
 	// If the cache is disabled, we stop here. Basically we return a valid handle that is not fully initialized
 	// since it would create the directories required by an enabled cache.
 	if h.disabled {
@@ -276,13 +343,13 @@ func New(cfg Config) (h *Handle, err error) {
 	// Initialize the root directory of the cache
 	rootDir := path.Join(parentDir, SubDirName)
 	h.rootDir = rootDir
-	if err = initCacheDir(rootDir); err != nil {
+	if err = initCacheDir(rootDir, h.dirMode()); err != nil {
 		return nil, fmt.Errorf("failed initializing caching directory: %s", err)
 	}
 	// Initialize the subdirectories of the cache
 	for _, ct := range FileCacheTypes {
 		dir := h.getCacheTypeDir(ct)
-		if err = initCacheDir(dir); err != nil {
+		if err = initCacheDir(dir, h.dirMode()); err != nil {
 			return nil, fmt.Errorf("failed initializing caching directory: %s", err)
 		}
 	}
@@ -314,19 +381,19 @@ func getCacheParentDir() string {
 	return parentDir
 }
 
-func initCacheDir(dir string) error {
+func initCacheDir(dir string, mode os.FileMode) error {
 	if fi, err := os.Stat(dir); os.IsNotExist(err) {
 		sylog.Debugf("Creating cache directory: %s", dir)
-		if err := fs.MkdirAll(dir, 0700); err != nil {
+		if err := fs.MkdirAll(dir, mode); err != nil {
 			return fmt.Errorf("couldn't create cache directory %v: %v", dir, err)
 		}
 	} else if err != nil {
 		return fmt.Errorf("unable to stat %s: %s", dir, err)
-	} else if fi.Mode().Perm() != 0700 {
+	} else if fi.Mode().Perm() != mode {
 		// enforce permission on cache directory to prevent
 		// potential information leak
-		if err := os.Chmod(dir, 0700); err != nil {
-			return fmt.Errorf("couldn't enforce permission 0700 on %s: %s", dir, err)
+		if err := os.Chmod(dir, mode); err != nil {
+			return fmt.Errorf("couldn't enforce permission %#o on %s: %s", mode, dir, err)
 		}
 	}
 
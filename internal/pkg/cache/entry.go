@@ -9,9 +9,11 @@ package cache
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/hpcng/singularity/internal/pkg/util/fs"
 	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/fs/lock"
 )
 
 // Entry is a structure representing an entry in the cache. An entry is a file under the
@@ -27,10 +29,33 @@ type Entry struct {
 	// tmpPath is the temporary location that should be used for a new cache entry as it
 	// is created
 	TmpPath string
+	// handle is the cache holding the entry
+	handle *Handle
+	// locked is true while the lock of a new entry is held by lockFd
+	locked bool
+	lockFd int
+}
+
+// unlock releases the lock of a new entry, allowing processes waiting for
+// the entry to use it.
+func (e *Entry) unlock() {
+	if !e.locked {
+		return
+	}
+	e.locked = false
+	if err := lock.Release(e.lockFd); err != nil {
+		sylog.Errorf("Could not release lock of cache entry '%s': %v", e.Path, err)
+	}
 }
 
 // Finalize an entry by renaming it to its permanent path atomically
 func (e *Entry) Finalize() error {
+	defer e.unlock()
+
+	if e.handle != nil && e.handle.shared {
+		return e.handle.finalizeShared(e)
+	}
+
 	// Try to rename the temporary file to its permanent path
 	// This is a file, so we won't have an IsExist error since...
 	//   If newpath already exists and is not a directory, Rename replaces it.
@@ -39,11 +64,22 @@ func (e *Entry) Finalize() error {
 	if err != nil {
 		return fmt.Errorf("could not finalize cached file: %v", err)
 	}
+
+	if e.handle != nil {
+		name := filepath.Base(e.Path)
+		if err := e.handle.touch(e.CacheType, name); err != nil {
+			sylog.Warningf("Could not update metadata of cache entry '%s': %v", e.Path, err)
+		}
+		// make room for the new entry, which is the most recently used
+		e.handle.evict(e.Path)
+	}
 	return nil
 }
 
 // CleanTmp should be defer'd when an Entry is created and will remove any temporary file
 func (e *Entry) CleanTmp() {
+	e.unlock()
+
 	// If there is no TmpPath / file there then there is nothing to clean up
 	if e.TmpPath == "" || !fs.IsFile(e.TmpPath) {
 		return
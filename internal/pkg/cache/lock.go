@@ -0,0 +1,83 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/util/fs/lock"
+)
+
+const (
+	// LockTimeoutEnv specifies the environment variable which can set the
+	// number of seconds to wait for another process creating the same
+	// cache entry, overriding the 'cache lock timeout' directive of
+	// singularity.conf
+	LockTimeoutEnv = "SINGULARITY_CACHE_LOCK_TIMEOUT"
+
+	// lockDirName is the name of the directory, relative to the cache root,
+	// holding the lock files of the cache entries.
+	lockDirName = "locks"
+)
+
+// lockNoticeInterval is the interval between two messages reporting that
+// a process still waits for another process creating the same cache entry.
+var lockNoticeInterval = 5 * time.Minute
+
+// createLockFile creates the lock file at path if it doesn't exist.
+func createLockFile(path string, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, mode)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// lockEntry acquires the lock of the cache entry name and returns the file
+// descriptor holding it. If another process is creating the same entry, it
+// waits until the lock is released. A lock can't be stale as it's released
+// by the kernel when its holder exits, but a live holder can be stuck, e.g.
+// on a hung network filesystem, so waiting gives up after the lock timeout
+// of the handle, if any. Lock files are never removed, as a process could
+// be waiting on a removed file while another one creates a new lock.
+func (h *Handle) lockEntry(cacheType, name string) (int, error) {
+	dir := filepath.Join(h.rootDir, lockDirName, cacheType)
+	if err := fs.MkdirAll(dir, h.dirMode()); err != nil {
+		return -1, err
+	}
+	path := filepath.Join(dir, name+".lock")
+	if err := createLockFile(path, h.fileMode()); err != nil {
+		return -1, err
+	}
+
+	fd, err := lock.ExclusiveTimeout(path, 0)
+	if err == lock.ErrLockTimeout {
+		sylog.Infof("Waiting for another process to create %s cache entry %s", cacheType, name)
+	}
+	for start := time.Now(); err == lock.ErrLockTimeout; {
+		wait := lockNoticeInterval
+		if h.lockTimeout > 0 {
+			left := h.lockTimeout - time.Since(start)
+			if left <= 0 {
+				return -1, fmt.Errorf("another process has been creating %s cache entry %s for more than %s, giving up (the timeout can be set with %s)", cacheType, name, h.lockTimeout, LockTimeoutEnv)
+			}
+			if left < wait {
+				wait = left
+			}
+		}
+		fd, err = lock.ExclusiveTimeout(path, wait)
+		// no notice when the timeout expires
+		if err == lock.ErrLockTimeout && wait == lockNoticeInterval {
+			sylog.Infof("Still waiting for another process to create %s cache entry %s after %s", cacheType, name, time.Since(start).Round(time.Second))
+		}
+	}
+	return fd, err
+}
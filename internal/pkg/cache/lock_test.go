@@ -0,0 +1,219 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hpcng/singularity/pkg/util/fs/lock"
+)
+
+const lockHolderEnv = "CACHE_LOCK_HOLDER"
+
+func TestMain(m *testing.M) {
+	if path := os.Getenv(lockHolderEnv); path != "" {
+		lockHolder(path)
+	}
+	os.Exit(m.Run())
+}
+
+// lockHolder acquires the lock file at path, reports it on its standard
+// output and holds the lock until killed, like a process stuck while
+// creating a cache entry.
+func lockHolder(path string) {
+	if _, err := lock.Exclusive(path); err != nil {
+		fmt.Fprintf(os.Stderr, "while locking %s: %s\n", path, err)
+		os.Exit(1)
+	}
+	fmt.Println("locked")
+	select {}
+}
+
+func TestEntryLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-lock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	if h.IsDisabled() {
+		t.Skip("cache is disabled")
+	}
+
+	e, err := h.GetEntry(OciTempCacheType, "image")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if e == nil {
+		t.Fatalf("no entry returned")
+	}
+	if e.Exists {
+		t.Fatalf("unexpected existing entry")
+	}
+
+	// a concurrent user of the entry waits until it's created
+	ch := make(chan *Entry, 1)
+	go func() {
+		we, err := h.GetEntry(OciTempCacheType, "image")
+		if err != nil {
+			t.Errorf("while getting entry: %v", err)
+		}
+		ch <- we
+	}()
+
+	select {
+	case <-ch:
+		t.Fatalf("entry returned while being created")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if err := ioutil.WriteFile(e.TmpPath, []byte("image"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("while finalizing entry: %v", err)
+	}
+
+	select {
+	case we := <-ch:
+		if we == nil || !we.Exists || we.Path != e.Path {
+			t.Errorf("got entry %+v, want existing entry %s", we, e.Path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("entry not returned once created")
+	}
+
+	// waiting for a lock held by another process doesn't give up while
+	// the lock is held
+	defer func(d time.Duration) { lockNoticeInterval = d }(lockNoticeInterval)
+	lockNoticeInterval = 100 * time.Millisecond
+
+	held, err := h.GetEntry(OciTempCacheType, "held")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	defer held.CleanTmp()
+
+	go func() {
+		we, err := h.GetEntry(OciTempCacheType, "held")
+		if err != nil {
+			t.Errorf("while getting entry: %v", err)
+		}
+		ch <- we
+	}()
+
+	select {
+	case <-ch:
+		t.Fatalf("entry returned while being created")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	if err := ioutil.WriteFile(held.TmpPath, []byte("image"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := held.Finalize(); err != nil {
+		t.Fatalf("while finalizing entry: %v", err)
+	}
+
+	select {
+	case we := <-ch:
+		if we == nil || !we.Exists || we.Path != held.Path {
+			t.Errorf("got entry %+v, want existing entry %s", we, held.Path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("entry not returned once created")
+	}
+
+	// cleaning the cache keeps the lock files
+	lockFile := filepath.Join(h.rootDir, lockDirName, OciTempCacheType, "held.lock")
+	h.cleanAllCaches()
+	if _, err := os.Stat(lockFile); err != nil {
+		t.Errorf("lock file removed by cache clean: %v", err)
+	}
+}
+
+func TestEntryLockTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-lock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	timeout := 500 * time.Millisecond
+	h, err := New(Config{ParentDir: dir, LockTimeout: timeout})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+	if h.IsDisabled() {
+		t.Skip("cache is disabled")
+	}
+
+	lockDir := filepath.Join(h.rootDir, lockDirName, OciTempCacheType)
+	if err := os.MkdirAll(lockDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	lockFile := filepath.Join(lockDir, "stuck.lock")
+	if err := createLockFile(lockFile, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the lock is held by a live process never creating the entry
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), lockHolderEnv+"="+lockFile)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "locked\n" {
+		t.Fatalf("lock holder failed: %q %v", line, err)
+	}
+
+	start := time.Now()
+	e, err := h.GetEntry(OciTempCacheType, "stuck")
+	if err == nil {
+		e.CleanTmp()
+		t.Fatalf("entry returned while locked by another process")
+	}
+	if !strings.Contains(err.Error(), "giving up") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if d := time.Since(start); d < timeout {
+		t.Errorf("gave up after %s, before the %s timeout", d, timeout)
+	}
+
+	// the entry can be created once its holder exited
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	e, err = h.GetEntry(OciTempCacheType, "stuck")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	defer e.CleanTmp()
+	if e.Exists {
+		t.Errorf("unexpected existing entry")
+	}
+}
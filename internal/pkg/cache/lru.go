@@ -0,0 +1,292 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+const (
+	// MaxSizeEnv specifies the environment variable which can set the
+	// maximum size of the cache, overriding the 'cache max size'
+	// directive of singularity.conf
+	MaxSizeEnv = "SINGULARITY_CACHE_MAXSIZE"
+
+	// metadataDirName is the name of the directory, relative to the cache
+	// root, holding the metadata of the cache entries.
+	metadataDirName = "metadata"
+	// tmpPrefix is the prefix of temporary files of entries being created.
+	tmpPrefix = "tmp_"
+)
+
+// entryMetadata holds the metadata of a cache entry.
+type entryMetadata struct {
+	// LastUsed is the last time the entry was written or read. Access
+	// time of files can't be used as the cache may be on a filesystem
+	// mounted with noatime.
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// cachedFile is a file held by the cache and considered for eviction.
+type cachedFile struct {
+	cacheType string
+	path      string
+	size      int64
+	lastUsed  time.Time
+}
+
+// ParseSize parses the cache size s, a number of bytes with an optional
+// K, M, G or T suffix (eg: 500M, 10G). An empty string or 0 means no limit.
+func ParseSize(s string) (int64, error) {
+	size := strings.ToUpper(strings.TrimSpace(s))
+	if size == "" {
+		return 0, nil
+	}
+
+	mult := int64(1)
+	for i, suffix := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(size, suffix) {
+			mult = 1 << (10 * uint(i+1))
+			size = strings.TrimSuffix(size, suffix)
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid cache size %q", s)
+	}
+	return n * mult, nil
+}
+
+// MaxSize returns the maximum size of the cache in bytes, 0 if the cache
+// size is not limited.
+func (h *Handle) MaxSize() int64 {
+	return h.maxSize
+}
+
+// entryDir returns the directory holding the files of the cache type.
+func (h *Handle) entryDir(cacheType string) string {
+	if cacheType == OciBlobCacheType {
+		return filepath.Join(h.getCacheTypeDir(cacheType), "blobs", "sha256")
+	}
+	return h.getCacheTypeDir(cacheType)
+}
+
+// metadataFile returns the path of the metadata of the cache entry name
+// in the cache rooted at rootDir.
+func metadataFile(rootDir, cacheType, name string) string {
+	return filepath.Join(rootDir, metadataDirName, cacheType, name+".json")
+}
+
+// metadataPath returns the path of the metadata of the cache entry name.
+func (h *Handle) metadataPath(cacheType, name string) string {
+	return metadataFile(h.rootDir, cacheType, name)
+}
+
+// readMetadata reads the entry metadata stored at path.
+func readMetadata(path string) (*entryMetadata, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	md := new(entryMetadata)
+	if err := json.Unmarshal(b, md); err != nil {
+		return nil, fmt.Errorf("while decoding %s: %v", path, err)
+	}
+	return md, nil
+}
+
+// touch records that the cache entry name has just been used.
+func (h *Handle) touch(cacheType, name string) error {
+	return h.writeMetadata(cacheType, name, &entryMetadata{LastUsed: time.Now()})
+}
+
+// writeMetadata writes md as the metadata of the cache entry name.
+func (h *Handle) writeMetadata(cacheType, name string, md *entryMetadata) error {
+	dir := filepath.Join(h.rootDir, metadataDirName, cacheType)
+	if err := fs.MkdirAll(dir, h.dirMode()); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so concurrent readers never see
+	// a partial metadata file
+	f, err := ioutil.TempFile(dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Chmod(h.fileMode()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), h.metadataPath(cacheType, name)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// LastUsed returns the last time the cache entry fi of the cache type was
+// used. The modification time of the entry is returned for entries without
+// metadata, created by older versions of Singularity.
+func (h *Handle) LastUsed(cacheType string, fi os.FileInfo) time.Time {
+	md, err := readMetadata(h.metadataPath(cacheType, fi.Name()))
+	if os.IsNotExist(err) {
+		return fi.ModTime()
+	} else if err != nil || md.LastUsed.IsZero() {
+		sylog.Debugf("Ignoring invalid metadata of %s cache entry %s", cacheType, fi.Name())
+		return fi.ModTime()
+	}
+	return md.LastUsed
+}
+
+// UseBlobs records that the OCI blobs with the given digests (eg:
+// sha256:<hex>) have just been used, then evicts least recently used
+// entries if the cache exceeds its maximum size. Blobs in use are never
+// evicted.
+func (h *Handle) UseBlobs(digests []string) {
+	if h.disabled {
+		return
+	}
+
+	dir := h.entryDir(OciBlobCacheType)
+	keep := make([]string, 0, len(digests))
+
+	for _, d := range digests {
+		name := strings.TrimPrefix(d, "sha256:")
+		if err := h.touch(OciBlobCacheType, name); err != nil {
+			sylog.Warningf("Could not update metadata of blob %s: %s", name, err)
+		}
+		keep = append(keep, filepath.Join(dir, name))
+	}
+
+	h.evict(keep...)
+}
+
+// cachedFiles returns the files held by the cache, temporary files of
+// entries being created are ignored.
+func (h *Handle) cachedFiles() ([]cachedFile, error) {
+	var files []cachedFile
+
+	for _, ct := range append(FileCacheTypes, OciCacheTypes...) {
+		dir := h.entryDir(ct)
+
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, fi := range entries {
+			if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), tmpPrefix) {
+				continue
+			}
+			files = append(files, cachedFile{
+				cacheType: ct,
+				path:      filepath.Join(dir, fi.Name()),
+				size:      fi.Size(),
+				lastUsed:  h.LastUsed(ct, fi),
+			})
+		}
+	}
+
+	return files, nil
+}
+
+// evict removes the least recently used files of the cache until its size
+// is below its maximum size, files whose path is in keep are preserved.
+// Errors are reported as warnings, a failed eviction must not fail the
+// operation which triggered it.
+func (h *Handle) evict(keep ...string) {
+	if h.disabled || h.maxSize <= 0 {
+		return
+	}
+
+	files, err := h.cachedFiles()
+	if err != nil {
+		sylog.Warningf("Could not list cache entries for eviction: %s", err)
+		return
+	}
+
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	if total <= h.maxSize {
+		return
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].lastUsed.Before(files[j].lastUsed)
+	})
+
+	for _, f := range files {
+		if total <= h.maxSize {
+			break
+		}
+		if stringInSlice(f.path, keep) {
+			continue
+		}
+
+		sylog.Debugf("Evicting %s cache entry %s, last used %s", f.cacheType, filepath.Base(f.path), f.lastUsed.Format(time.RFC3339))
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			sylog.Warningf("Could not evict cache entry %s: %s", f.path, err)
+			continue
+		}
+		os.Remove(h.metadataPath(f.cacheType, filepath.Base(f.path)))
+		total -= f.size
+	}
+
+	if total > h.maxSize {
+		sylog.Warningf("Cache size %s exceeds its maximum size %s", fs.FindSize(total), fs.FindSize(h.maxSize))
+	}
+}
+
+// pruneMetadata removes the metadata of the cache type whose entries don't
+// exist anymore.
+func (h *Handle) pruneMetadata(cacheType string) {
+	dir := filepath.Join(h.rootDir, metadataDirName, cacheType)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".json")
+		if _, err := os.Stat(filepath.Join(h.entryDir(cacheType), name)); os.IsNotExist(err) {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size      string
+		want      int64
+		expectErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"512", 512, false},
+		{"10k", 10 << 10, false},
+		{"500M", 500 << 20, false},
+		{" 2G ", 2 << 30, false},
+		{"1T", 1 << 40, false},
+		{"-1", 0, true},
+		{"1.5G", 0, true},
+		{"G", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.size)
+		if (err != nil) != tt.expectErr {
+			t.Errorf("ParseSize(%q): unexpected error: %v", tt.size, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q): got %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+// addEntry creates a cache entry of size bytes last used at lastUsed.
+func addEntry(t *testing.T, h *Handle, cacheType, name string, size int, lastUsed time.Time) string {
+	e, err := h.GetEntry(cacheType, name)
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if err := ioutil.WriteFile(e.TmpPath, make([]byte, size), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("while finalizing entry: %v", err)
+	}
+
+	// backdate the last use recorded by Finalize
+	md := `{"lastUsed":"` + lastUsed.Format(time.RFC3339Nano) + `"}`
+	if err := ioutil.WriteFile(h.metadataPath(cacheType, name), []byte(md), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return e.Path
+}
+
+func TestEvict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-lru-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := New(Config{ParentDir: dir})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+
+	now := time.Now()
+	oldest := addEntry(t, h, LibraryCacheType, "oldest", 100, now.Add(-3*time.Hour))
+	recent := addEntry(t, h, NetCacheType, "recent", 100, now.Add(-1*time.Hour))
+	old := addEntry(t, h, OrasCacheType, "old", 100, now.Add(-2*time.Hour))
+
+	blobDir := h.entryDir(OciBlobCacheType)
+	if err := os.MkdirAll(blobDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	blob := filepath.Join(blobDir, "0123")
+	if err := ioutil.WriteFile(blob, make([]byte, 100), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the blob in use and the new entry must be kept
+	h.maxSize = 250
+	h.UseBlobs([]string{"sha256:0123"})
+	newest := addEntry(t, h, ShubCacheType, "newest", 50, now)
+
+	for _, path := range []string{oldest, old} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was not evicted", path)
+		}
+	}
+	for _, path := range []string{recent, newest, blob} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was evicted: %v", path, err)
+		}
+	}
+
+	if _, err := os.Stat(h.metadataPath(LibraryCacheType, "oldest")); !os.IsNotExist(err) {
+		t.Errorf("metadata of evicted entry was not removed")
+	}
+
+	// reading an entry records its use
+	fi, err := os.Stat(recent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.GetEntry(NetCacheType, "recent"); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.LastUsed(NetCacheType, fi); got.Before(now) {
+		t.Errorf("got last use %s, want after %s", got, now)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// NewShared initializes a handle managing the shared system cache rooted at
+// dir, which is populated by administrators and consulted by user caches
+// configured with the same Config.SharedDir. Unlike user caches, the shared
+// cache is readable by all users, its entries are content addressed and
+// never evicted.
+func NewShared(dir string) (*Handle, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no shared cache directory specified")
+	}
+
+	h := &Handle{
+		parentDir: dir,
+		rootDir:   dir,
+		shared:    true,
+	}
+
+	if err := initCacheDir(h.rootDir, h.dirMode()); err != nil {
+		return nil, fmt.Errorf("failed initializing shared cache directory: %s", err)
+	}
+	for _, ct := range FileCacheTypes {
+		if err := initCacheDir(h.getCacheTypeDir(ct), h.dirMode()); err != nil {
+			return nil, fmt.Errorf("failed initializing shared cache directory: %s", err)
+		}
+	}
+
+	return h, nil
+}
+
+// dirMode returns the permissions of the cache directories, only the
+// shared cache is accessible to other users.
+func (h *Handle) dirMode() os.FileMode {
+	if h.shared {
+		return 0o755
+	}
+	return 0o700
+}
+
+// fileMode returns the permissions of the cache entries, only the shared
+// cache is readable by other users.
+func (h *Handle) fileMode() os.FileMode {
+	if h.shared {
+		return 0o644
+	}
+	return 0o600
+}
+
+// fileSHA256 returns the hex encoded SHA256 checksum of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sharedBlobPrefix prefixes the name of the files holding shared cache
+// entries, named after the SHA256 checksum of their content. Entries are
+// symlinks to these files.
+const sharedBlobPrefix = "sha256."
+
+// indexDirName is the name of the directory, relative to the shared cache
+// root, holding the index of the shared cache entries.
+const indexDirName = "index"
+
+// indexRecord is the record of a shared cache entry in the index, written
+// by root when the entry is created.
+type indexRecord struct {
+	// SHA256 is the checksum of the content of the entry.
+	SHA256 string `json:"sha256"`
+	// Size is the size of the content of the entry, checked before its
+	// checksum so truncated files are rejected without being read.
+	Size int64 `json:"size"`
+}
+
+// indexPath returns the path of the index record of the shared cache entry
+// name in the shared cache rooted at rootDir.
+func indexPath(rootDir, cacheType, name string) string {
+	return filepath.Join(rootDir, indexDirName, cacheType, name+".json")
+}
+
+// isTrusted returns if the file described by fi can only be modified by
+// root or the current user, so it can't be replaced by another user once
+// it has been checked.
+func isTrusted(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+	if st.Uid != 0 && int(st.Uid) != os.Geteuid() {
+		return false
+	}
+	return fi.Mode()&0o022 == 0
+}
+
+// finalizeShared moves the content of the new shared cache entry e to a
+// file named after its checksum and readable by all users, records it in
+// the index and links the entry to this file.
+func (h *Handle) finalizeShared(e *Entry) error {
+	if err := os.Chmod(e.TmpPath, h.fileMode()); err != nil {
+		return fmt.Errorf("could not change permission of cached file: %v", err)
+	}
+
+	sum, err := fileSHA256(e.TmpPath)
+	if err != nil {
+		return fmt.Errorf("could not compute checksum of cached file: %v", err)
+	}
+	dir := filepath.Dir(e.Path)
+	blob := sharedBlobPrefix + sum
+	blobPath := filepath.Join(dir, blob)
+	if err := os.Rename(e.TmpPath, blobPath); err != nil {
+		return fmt.Errorf("could not finalize cached file: %v", err)
+	}
+	fi, err := os.Stat(blobPath)
+	if err != nil {
+		return fmt.Errorf("could not stat cached file: %v", err)
+	}
+
+	rec := &indexRecord{
+		SHA256: sum,
+		Size:   fi.Size(),
+	}
+	if err := h.writeIndex(e.CacheType, filepath.Base(e.Path), rec); err != nil {
+		return fmt.Errorf("could not record cached file in index: %v", err)
+	}
+
+	// replace any previous entry atomically
+	link := filepath.Join(dir, tmpPrefix+filepath.Base(e.Path)+".link")
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not link cached file: %v", err)
+	}
+	if err := os.Symlink(blob, link); err != nil {
+		return fmt.Errorf("could not link cached file: %v", err)
+	}
+	if err := os.Rename(link, e.Path); err != nil {
+		os.Remove(link)
+		return fmt.Errorf("could not link cached file: %v", err)
+	}
+	return nil
+}
+
+// writeIndex writes rec as the index record of the shared cache entry name.
+func (h *Handle) writeIndex(cacheType, name string, rec *indexRecord) error {
+	dir := filepath.Join(h.rootDir, indexDirName, cacheType)
+	if err := fs.MkdirAll(dir, h.dirMode()); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so concurrent readers never see
+	// a partial record
+	f, err := ioutil.TempFile(dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Chmod(h.fileMode()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), indexPath(h.rootDir, cacheType, name)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// readIndex reads the index record of the shared cache entry name, the
+// record is only returned if it was written by root or the current user.
+func (h *Handle) readIndex(cacheType, name string) (*indexRecord, error) {
+	path := indexPath(h.sharedDir, cacheType, name)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() || !isTrusted(fi) {
+		return nil, fmt.Errorf("%s is not a trusted index record", path)
+	}
+
+	rec := new(indexRecord)
+	if err := json.NewDecoder(f).Decode(rec); err != nil {
+		return nil, fmt.Errorf("while decoding %s: %v", path, err)
+	}
+	if rec.SHA256 == "" {
+		return nil, fmt.Errorf("no checksum recorded in %s", path)
+	}
+	return rec, nil
+}
+
+// sharedEntry returns the entry of the shared system cache for the specified
+// file cache type and hash, or nil if there is no shared cache or it doesn't
+// hold a valid entry. The checksum of shared entries is recorded in the
+// index when they are written, and the file of the entry is hashed again on
+// each use and only used if it matches this record, as size and
+// modification time can be preserved by a modification. Both the file and
+// its directory must not be writable by other users, so the entry can't be
+// replaced between this check and its use.
+func (h *Handle) sharedEntry(cacheType, hash string) *Entry {
+	if h.shared || h.sharedDir == "" || !stringInSlice(cacheType, FileCacheTypes) {
+		return nil
+	}
+
+	dir := filepath.Join(h.sharedDir, cacheType)
+	path := filepath.Join(dir, hash)
+
+	rec, err := h.readIndex(cacheType, hash)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		sylog.Warningf("Ignoring shared cache entry %s: %s", path, err)
+		return nil
+	}
+
+	di, err := os.Stat(dir)
+	if err != nil || !isTrusted(di) {
+		sylog.Warningf("Ignoring shared cache entry %s: %s is writable by other users", path, dir)
+		return nil
+	}
+
+	blobPath := filepath.Join(dir, sharedBlobPrefix+rec.SHA256)
+	fi, err := os.Lstat(blobPath)
+	if err != nil || !fi.Mode().IsRegular() {
+		sylog.Warningf("Ignoring shared cache entry %s: %s is not a file", path, blobPath)
+		return nil
+	}
+	if !isTrusted(fi) {
+		sylog.Warningf("Ignoring shared cache entry %s: %s is writable by other users", path, blobPath)
+		return nil
+	}
+
+	if fi.Size() != rec.Size {
+		sylog.Warningf("Ignoring shared cache entry %s: %s", path, ErrBadChecksum)
+		return nil
+	}
+	sum, err := fileSHA256(blobPath)
+	if err != nil {
+		sylog.Warningf("Ignoring shared cache entry %s: %s", path, err)
+		return nil
+	}
+	if sum != rec.SHA256 {
+		sylog.Warningf("Ignoring shared cache entry %s: %s", path, ErrBadChecksum)
+		return nil
+	}
+
+	sylog.Debugf("Using shared cache entry %s", blobPath)
+	return &Entry{
+		CacheType: cacheType,
+		Exists:    true,
+		Path:      blobPath,
+	}
+}
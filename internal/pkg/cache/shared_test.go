@@ -0,0 +1,171 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSharedCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-shared-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sharedDir := filepath.Join(dir, "shared")
+	shared, err := NewShared(sharedDir)
+	if err != nil {
+		t.Fatalf("while creating shared cache: %v", err)
+	}
+
+	e, err := shared.GetEntry(LibraryCacheType, "image")
+	if err != nil {
+		t.Fatalf("while getting shared entry: %v", err)
+	}
+	fi, err := os.Stat(e.TmpPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o644 {
+		t.Errorf("got shared temporary file permissions %#o, want %#o", fi.Mode().Perm(), 0o644)
+	}
+	if err := ioutil.WriteFile(e.TmpPath, []byte("image content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Finalize(); err != nil {
+		t.Fatalf("while finalizing shared entry: %v", err)
+	}
+	// the entry links to a file named after the checksum of its content
+	blob, err := os.Readlink(filepath.Join(sharedDir, LibraryCacheType, "image"))
+	if err != nil {
+		t.Fatalf("while reading shared entry link: %v", err)
+	}
+	if want := "sha256.b78f9dfd81d9bc073cad0a0e3acb1d6b164ede188bd71beb775b8004d7237117"; blob != want {
+		t.Errorf("got shared entry link to %s, want %s", blob, want)
+	}
+	sharedPath := filepath.Join(sharedDir, LibraryCacheType, blob)
+
+	fi, err = os.Stat(sharedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o644 {
+		t.Errorf("got shared entry permissions %#o, want %#o", fi.Mode().Perm(), 0o644)
+	}
+
+	h, err := New(Config{ParentDir: filepath.Join(dir, "user"), SharedDir: sharedDir})
+	if err != nil {
+		t.Fatalf("while creating cache: %v", err)
+	}
+
+	e, err = h.GetEntry(LibraryCacheType, "image")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if !e.Exists || e.Path != sharedPath {
+		t.Errorf("got entry %s (exists: %t), want shared entry %s", e.Path, e.Exists, sharedPath)
+	}
+
+	// entries missing from the shared cache are looked up in the user cache
+	e, err = h.GetEntry(NetCacheType, "image")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if e.Exists {
+		t.Errorf("unexpected entry %s", e.Path)
+	}
+	e.CleanTmp()
+
+	// a shared entry with unchanged content is still used after being touched
+	now := time.Now().Add(time.Minute)
+	if err := os.Chtimes(sharedPath, now, now); err != nil {
+		t.Fatal(err)
+	}
+	e, err = h.GetEntry(LibraryCacheType, "image")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if !e.Exists || e.Path != sharedPath {
+		t.Errorf("got entry %s (exists: %t), want shared entry %s", e.Path, e.Exists, sharedPath)
+	}
+
+	// a shared entry tampered with the same size and modification time is
+	// ignored
+	fi, err = os.Stat(sharedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Repeat([]byte{'x'}, int(fi.Size()))
+	if err := ioutil.WriteFile(sharedPath, tampered, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(sharedPath, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	e, err = h.GetEntry(LibraryCacheType, "image")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if e.Exists || e.Path == sharedPath {
+		t.Errorf("tampered shared entry %s was used", sharedPath)
+	}
+	e.CleanTmp()
+
+	// a tampered shared entry is ignored
+	if err := ioutil.WriteFile(sharedPath, []byte("tampered content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err = h.GetEntry(LibraryCacheType, "image")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if e.Exists || e.Path == sharedPath {
+		t.Errorf("tampered shared entry %s was used", sharedPath)
+	}
+	e.CleanTmp()
+
+	// an entry repointed to another checksummed file is ignored
+	other := []byte("other content")
+	otherBlob := "sha256.923b805711041e23a99f07e146591c500261d1c289f62a9d39f8581ceb8a10ca"
+	otherPath := filepath.Join(sharedDir, LibraryCacheType, otherBlob)
+	if err := ioutil.WriteFile(otherPath, other, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entryPath := filepath.Join(sharedDir, LibraryCacheType, "image")
+	if err := os.Remove(entryPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(otherBlob, entryPath); err != nil {
+		t.Fatal(err)
+	}
+	e, err = h.GetEntry(LibraryCacheType, "image")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if e.Path == otherPath {
+		t.Errorf("shared entry %s not recorded in the index was used", otherPath)
+	}
+	e.CleanTmp()
+
+	// an entry missing from the index is ignored
+	if err := os.Remove(indexPath(sharedDir, LibraryCacheType, "image")); err != nil {
+		t.Fatal(err)
+	}
+	e, err = h.GetEntry(LibraryCacheType, "image")
+	if err != nil {
+		t.Fatalf("while getting entry: %v", err)
+	}
+	if e.Exists {
+		t.Errorf("unrecorded shared entry %s was used", e.Path)
+	}
+	e.CleanTmp()
+}
@@ -22,7 +22,9 @@ type Manager struct {
 	cgroup cgroups.Cgroup
 }
 
-func readSpecFromFile(path string) (spec specs.LinuxResources, err error) {
+// ReadSpecFromFile returns the OCI resources restriction described by the
+// TOML configuration file at path
+func ReadSpecFromFile(path string) (spec specs.LinuxResources, err error) {
 	conf, err := LoadConfig(path)
 	if err != nil {
 		return
@@ -91,7 +93,7 @@ func (m *Manager) ApplyFromSpec(spec *specs.LinuxResources) (err error) {
 // ApplyFromFile applies cgroups resources restriction from TOML configuration
 // file
 func (m *Manager) ApplyFromFile(path string) error {
-	spec, err := readSpecFromFile(path)
+	spec, err := ReadSpecFromFile(path)
 	if err != nil {
 		return err
 	}
@@ -120,7 +122,7 @@ func (m *Manager) UpdateFromSpec(spec *specs.LinuxResources) (err error) {
 
 // UpdateFromFile updates cgroups resources restriction from TOML configuration
 func (m *Manager) UpdateFromFile(path string) error {
-	spec, err := readSpecFromFile(path)
+	spec, err := ReadSpecFromFile(path)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,166 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/transports"
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/build/oci"
+	"github.com/hpcng/singularity/internal/pkg/util/uri"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// ErrNotLockable is returned by ImageDigest for images which can't be
+// locked to a digest, only docker:// images can be.
+var ErrNotLockable = errors.New("only docker:// images can be locked to a digest")
+
+// ImageDigest returns the normalized URI of the docker image pullFrom, and
+// the digest of the manifest its tag currently resolves to.
+func ImageDigest(ctx context.Context, pullFrom string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) (name, digest string, err error) {
+	transport, ref := uri.Split(pullFrom)
+	if transport != "docker" {
+		return "", "", ErrNotLockable
+	}
+
+	srcRef, err := docker.ParseReference(ref)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to parse image name %v: %v", pullFrom, err)
+	}
+
+	sysCtx := systemContext("", ociAuth, noHTTPS)
+	oci.SetRegistryCredentials(sysCtx, srcRef)
+
+	d, err := oci.ManifestDigest(ctx, srcRef, sysCtx)
+	if err != nil {
+		return "", "", fmt.Errorf("while resolving digest of %s: %v", pullFrom, err)
+	}
+
+	return transports.ImageName(srcRef), d.String(), nil
+}
+
+// PinnedURI returns the URI of the docker image pullFrom referencing the
+// manifest digest d instead of a tag, so the image pulled is the one whose
+// digest was checked even if the tag moves in the meantime.
+func PinnedURI(pullFrom, d string) (string, error) {
+	_, ref := uri.Split(pullFrom)
+
+	srcRef, err := docker.ParseReference(ref)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse image name %v: %v", pullFrom, err)
+	}
+	dg, err := digest.Parse(d)
+	if err != nil {
+		return "", fmt.Errorf("invalid digest %s: %v", d, err)
+	}
+	pinned, err := reference.WithDigest(reference.TrimNamed(srcRef.DockerReference()), dg)
+	if err != nil {
+		return "", err
+	}
+	return "docker://" + pinned.String(), nil
+}
+
+// DigestLock is a lock file mapping docker image URIs, usually referencing
+// tags, to the manifest digests they resolved to when first pulled.
+type DigestLock struct {
+	path string
+
+	mu      sync.Mutex
+	digests map[string]string
+	changed bool
+}
+
+// LoadDigestLock loads the lock file at path, a missing file is created
+// by Save.
+func LoadDigestLock(path string) (*DigestLock, error) {
+	l := &DigestLock{
+		path:    path,
+		digests: make(map[string]string),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &l.digests); err != nil {
+		return nil, fmt.Errorf("while parsing digest lock file %s: %v", path, err)
+	}
+	return l, nil
+}
+
+// Verify checks that the image name resolves to the digest recorded in the
+// lock file, if any.
+func (l *DigestLock) Verify(name, digest string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if locked, ok := l.digests[name]; ok && locked != digest {
+		return fmt.Errorf("%s moved from locked digest %s to %s", name, locked, digest)
+	}
+	return nil
+}
+
+// Record records the digest of the image name in the lock file, unless a
+// digest is already recorded.
+func (l *DigestLock) Record(name, digest string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.digests[name]; !ok {
+		l.digests[name] = digest
+		l.changed = true
+	}
+}
+
+// Save writes the lock file if new digests were recorded.
+func (l *DigestLock) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.changed {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(l.digests, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), l.path); err != nil {
+		return err
+	}
+
+	l.changed = false
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	useragent "github.com/hpcng/singularity/pkg/util/user-agent"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestMain(m *testing.M) {
+	useragent.InitValue("singularity", "3.0.0-alpha.1-303-gaed8d30-dirty")
+
+	os.Exit(m.Run())
+}
+
+func TestImageDigest(t *testing.T) {
+	manifest := []byte(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`)
+
+	manifestGets := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/test/image/manifests/latest", "/v2/test/image/manifests/" + digest.FromBytes(manifest).String():
+			manifestGets++
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Write(manifest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	host := strings.TrimPrefix(s.URL, "http://")
+	name, d, err := ImageDigest(context.Background(), "docker://"+host+"/test/image:latest", nil, true)
+	if err != nil {
+		t.Fatalf("while resolving digest: %v", err)
+	}
+	if want := "docker://" + host + "/test/image:latest"; name != want {
+		t.Errorf("got name %s, want %s", name, want)
+	}
+	if want := digest.FromBytes(manifest).String(); d != want {
+		t.Errorf("got digest %s, want %s", d, want)
+	}
+
+	// the image is pulled by digest, without resolving its manifest again
+	pinned, err := PinnedURI(name, d)
+	if err != nil {
+		t.Fatalf("while pinning digest: %v", err)
+	}
+	if want := "docker://" + host + "/test/image@" + d; pinned != want {
+		t.Errorf("got pinned URI %s, want %s", pinned, want)
+	}
+	_, pd, err := ImageDigest(context.Background(), pinned, nil, true)
+	if err != nil {
+		t.Fatalf("while resolving digest: %v", err)
+	}
+	if pd != d {
+		t.Errorf("got digest %s, want %s", pd, d)
+	}
+	if manifestGets != 1 {
+		t.Errorf("got %d manifest requests, want 1", manifestGets)
+	}
+
+	if _, _, err := ImageDigest(context.Background(), "oras://"+host+"/test/image:latest", nil, true); err != ErrNotLockable {
+		t.Errorf("got error %v, want %v", err, ErrNotLockable)
+	}
+}
+
+func TestDigestLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "digest-lock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "images.lock")
+	const (
+		name  = "docker://docker.io/library/alpine:3.11"
+		first = "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+		moved = "sha256:0000000000000000000000000000000000000000000000000000000000000002"
+	)
+
+	l, err := LoadDigestLock(path)
+	if err != nil {
+		t.Fatalf("while loading missing lock file: %v", err)
+	}
+	if err := l.Verify(name, first); err != nil {
+		t.Errorf("unexpected error for unlocked image: %v", err)
+	}
+	l.Record(name, first)
+	if err := l.Save(); err != nil {
+		t.Fatalf("while saving lock file: %v", err)
+	}
+
+	l, err = LoadDigestLock(path)
+	if err != nil {
+		t.Fatalf("while loading lock file: %v", err)
+	}
+	if err := l.Verify(name, first); err != nil {
+		t.Errorf("unexpected error for locked digest: %v", err)
+	}
+	if err := l.Verify(name, moved); err == nil {
+		t.Errorf("unexpected success for moved image")
+	}
+
+	// recorded digests are never replaced
+	l.Record(name, moved)
+	if err := l.Verify(name, first); err != nil {
+		t.Errorf("locked digest was replaced: %v", err)
+	}
+}
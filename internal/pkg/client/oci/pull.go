@@ -21,8 +21,9 @@ import (
 	useragent "github.com/hpcng/singularity/pkg/util/user-agent"
 )
 
-// pull will build a SIF image into the cache if directTo="", or a specific file if directTo is set.
-func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+// systemContext returns the containers/image system context used to pull
+// images.
+func systemContext(tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS bool) *ocitypes.SystemContext {
 	// DockerInsecureSkipTLSVerify is set only if --nohttps is specified to honor
 	// configuration from /etc/containers/registries.conf because DockerInsecureSkipTLSVerify
 	// can have three possible values true/false and undefined, so we left it as undefined instead
@@ -38,6 +39,16 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDi
 	if noHTTPS {
 		sysCtx.DockerInsecureSkipTLSVerify = ocitypes.NewOptionalBool(true)
 	}
+	oci.SetRegistriesConf(sysCtx)
+	return sysCtx
+}
+
+// pull will build a SIF image into the cache if directTo="", or a specific file if directTo is set.
+func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDir, platform string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+	sysCtx := systemContext(tmpDir, ociAuth, noHTTPS)
+	if err := oci.SetPlatform(sysCtx, platform); err != nil {
+		return "", err
+	}
 
 	hash, err := oci.ImageSHA(ctx, pullFrom, sysCtx)
 	if err != nil {
@@ -46,7 +57,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDi
 
 	if directTo != "" {
 		sylog.Infof("Converting OCI blobs to SIF format")
-		if err := build.ConvertOciToSIF(ctx, imgCache, pullFrom, directTo, tmpDir, noHTTPS, noCleanUp, ociAuth); err != nil {
+		if err := build.ConvertOciToSIF(ctx, imgCache, pullFrom, directTo, tmpDir, platform, noHTTPS, noCleanUp, ociAuth); err != nil {
 			return "", fmt.Errorf("while building SIF from layers: %v", err)
 		}
 		imagePath = directTo
@@ -60,7 +71,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDi
 		if !cacheEntry.Exists {
 			sylog.Infof("Converting OCI blobs to SIF format")
 
-			if err := build.ConvertOciToSIF(ctx, imgCache, pullFrom, cacheEntry.TmpPath, tmpDir, noHTTPS, noCleanUp, ociAuth); err != nil {
+			if err := build.ConvertOciToSIF(ctx, imgCache, pullFrom, cacheEntry.TmpPath, tmpDir, platform, noHTTPS, noCleanUp, ociAuth); err != nil {
 				return "", fmt.Errorf("while building SIF from layers: %v", err)
 			}
 
@@ -79,7 +90,7 @@ func pull(ctx context.Context, imgCache *cache.Handle, directTo, pullFrom, tmpDi
 }
 
 // Pull will build a SIF image to the cache or direct to a temporary file if cache is disabled
-func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir, platform string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
 
 	directTo := ""
 
@@ -92,11 +103,11 @@ func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string,
 		sylog.Infof("Downloading library image to tmp cache: %s", directTo)
 	}
 
-	return pull(ctx, imgCache, directTo, pullFrom, tmpDir, ociAuth, noHTTPS, noCleanUp)
+	return pull(ctx, imgCache, directTo, pullFrom, tmpDir, platform, ociAuth, noHTTPS, noCleanUp)
 }
 
 // PullToFile will build a SIF image from the specified oci URI and place it at the specified dest
-func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir, platform string, ociAuth *ocitypes.DockerAuthConfig, noHTTPS, noCleanUp bool) (imagePath string, err error) {
 
 	directTo := ""
 	if imgCache.IsDisabled() {
@@ -104,7 +115,7 @@ func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, t
 		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
 	}
 
-	src, err := pull(ctx, imgCache, directTo, pullFrom, tmpDir, ociAuth, noHTTPS, noCleanUp)
+	src, err := pull(ctx, imgCache, directTo, pullFrom, tmpDir, platform, ociAuth, noHTTPS, noCleanUp)
 	if err != nil {
 		return "", fmt.Errorf("error fetching image to cache: %v", err)
 	}
@@ -24,12 +24,11 @@ import (
 	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
 	ocitypes "github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/internal/pkg/remote/credential"
 	"github.com/hpcng/singularity/pkg/image"
-	"github.com/hpcng/singularity/pkg/syfs"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
-	auth "oras.land/oras-go/pkg/auth/docker"
 	"oras.land/oras-go/pkg/content"
 	orasctx "oras.land/oras-go/pkg/context"
 	"oras.land/oras-go/pkg/oras"
@@ -58,18 +57,8 @@ const (
 var SifLayerMediaTypes = []string{SifLayerMediaTypeV1, SifLayerMediaTypeProto}
 
 func getResolver(ociAuth *ocitypes.DockerAuthConfig) (remotes.Resolver, error) {
-	opts := docker.ResolverOptions{Credentials: genCredfn(ociAuth)}
-	if ociAuth != nil && (ociAuth.Username != "" || ociAuth.Password != "") {
-		return docker.NewResolver(opts), nil
-	}
-
-	cli, err := auth.NewClient(syfs.DockerConf())
-	if err != nil {
-		sylog.Warningf("Couldn't load auth credential file: %s", err)
-		return docker.NewResolver(opts), nil
-	}
-
-	return cli.Resolver(context.Background(), &http.Client{}, false)
+	opts := docker.ResolverOptions{Credentials: credential.ResolverCredentials(ociAuth), Client: &http.Client{}}
+	return docker.NewResolver(opts), nil
 }
 
 // DownloadImage downloads a SIF image specified by an oci reference to a file using the included credentials
@@ -317,13 +306,3 @@ func sha256sum(r io.Reader) (result string, nBytes int64, err error) {
 
 	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nBytes, nil
 }
-
-func genCredfn(ociAuth *ocitypes.DockerAuthConfig) func(string) (string, string, error) {
-	return func(_ string) (string, string, error) {
-		if ociAuth != nil {
-			return ociAuth.Username, ociAuth.Password, nil
-		}
-
-		return "", "", nil
-	}
-}
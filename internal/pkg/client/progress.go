@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -8,6 +8,7 @@ package client
 import (
 	"context"
 	"io"
+	"os"
 
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/vbauerster/mpb/v6"
@@ -19,11 +20,48 @@ type readerFunc func(p []byte) (n int, err error)
 
 func (rf readerFunc) Read(p []byte) (n int, err error) { return rf(p) }
 
+type progressOutputKey struct{}
+
+// WithProgressOutput returns a copy of ctx sending the progress bars of the
+// transfers using it to w instead of the standard output, e.g. to keep the
+// standard output for the result of a command.
+func WithProgressOutput(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, progressOutputKey{}, w)
+}
+
+// progressOutput returns the output of the progress bars set in ctx, the
+// standard output by default.
+func progressOutput(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(progressOutputKey{}).(io.Writer); ok {
+		return w
+	}
+	return os.Stdout
+}
+
+type multiProgressKey struct{}
+
+// namedProgress is a MultiProgress displaying the progress bars of the
+// transfers of a context, under a name.
+type namedProgress struct {
+	mp   *MultiProgress
+	name string
+}
+
+// WithMultiProgress returns a copy of ctx displaying the progress bars of the
+// transfers using it with mp, so concurrent transfers share a single display.
+// Bars displayed by ProgressBarCallback are named name.
+func WithMultiProgress(ctx context.Context, mp *MultiProgress, name string) context.Context {
+	return context.WithValue(ctx, multiProgressKey{}, namedProgress{mp: mp, name: name})
+}
+
 // ProgressCallback is a function that provides progress information copying from a Reader to a Writer
 type ProgressCallback func(int64, io.Reader, io.Writer) error
 
 // ProgressBarCallback returns a progress bar callback unless e.g. --quiet or lower loglevel is set
 func ProgressBarCallback(ctx context.Context) ProgressCallback {
+	if np, ok := ctx.Value(multiProgressKey{}).(namedProgress); ok {
+		return np.mp.Callback(np.name, 0)
+	}
 
 	if sylog.GetLevel() <= -1 {
 		// If we don't need a bar visible, we just copy data through the callback func
@@ -33,7 +71,7 @@ func ProgressBarCallback(ctx context.Context) ProgressCallback {
 	}
 
 	return func(totalSize int64, r io.Reader, w io.Writer) error {
-		p := mpb.New()
+		p := mpb.New(mpb.WithOutput(progressOutput(ctx)))
 		var bar *mpb.Bar
 		if totalSize > 0 {
 			bar = p.AddBar(totalSize,
@@ -91,3 +129,87 @@ func CopyWithContext(ctx context.Context, dst io.Writer, src io.Reader) error {
 	}))
 	return err
 }
+
+// MultiProgress displays the progress bars of concurrent transfers, one bar
+// per transfer, unless e.g. --quiet or lower loglevel is set.
+type MultiProgress struct {
+	ctx context.Context
+	p   *mpb.Progress
+	// shared is true if p belongs to the MultiProgress set in ctx
+	shared bool
+}
+
+// NewMultiProgress returns a MultiProgress, Wait must be called once all
+// transfers are done. Bars are displayed with the MultiProgress set in ctx
+// by WithMultiProgress, if any.
+func NewMultiProgress(ctx context.Context) *MultiProgress {
+	if np, ok := ctx.Value(multiProgressKey{}).(namedProgress); ok {
+		return &MultiProgress{ctx: ctx, p: np.mp.p, shared: true}
+	}
+
+	mp := &MultiProgress{ctx: ctx}
+	if sylog.GetLevel() > -1 {
+		mp.p = mpb.NewWithContext(ctx, mpb.WithOutput(progressOutput(ctx)))
+	}
+	return mp
+}
+
+// Callback returns a progress bar callback for the transfer name, resumed
+// at offset bytes from the start of the transferred content. The total size
+// passed to the callback is the size of the remaining content.
+func (mp *MultiProgress) Callback(name string, offset int64) ProgressCallback {
+	if mp.p == nil {
+		return func(totalSize int64, r io.Reader, w io.Writer) error {
+			return CopyWithContext(mp.ctx, w, r)
+		}
+	}
+
+	return func(totalSize int64, r io.Reader, w io.Writer) error {
+		var bar *mpb.Bar
+		if totalSize > 0 {
+			bar = mp.p.AddBar(offset+totalSize,
+				mpb.PrependDecorators(
+					decor.Name(name, decor.WC{W: len(name) + 1, C: decor.DidentRight}),
+					decor.Counters(decor.UnitKiB, "%.1f / %.1f"),
+				),
+				mpb.AppendDecorators(
+					decor.Percentage(),
+					decor.AverageSpeed(decor.UnitKiB, " % .1f "),
+				),
+			)
+		} else {
+			bar = mp.p.AddBar(0,
+				mpb.PrependDecorators(
+					decor.Name(name, decor.WC{W: len(name) + 1, C: decor.DidentRight}),
+					decor.Current(decor.UnitKiB, "%.1f / ???"),
+				),
+				mpb.AppendDecorators(
+					decor.AverageSpeed(decor.UnitKiB, " % .1f "),
+				),
+			)
+		}
+		bar.SetCurrent(offset)
+
+		// create proxy reader
+		bodyProgress := bar.ProxyReader(r)
+		defer bodyProgress.Close()
+
+		if err := CopyWithContext(mp.ctx, w, bodyProgress); err != nil {
+			// drop the bar, a new one is displayed if the transfer is resumed
+			bar.Abort(true)
+			return err
+		}
+		if totalSize <= 0 {
+			bar.SetTotal(-1, true)
+		}
+		return nil
+	}
+}
+
+// Wait waits for all progress bars to complete. Bars displayed with a
+// shared MultiProgress are waited for by its owner.
+func (mp *MultiProgress) Wait() {
+	if mp.p != nil && !mp.shared {
+		mp.p.Wait()
+	}
+}
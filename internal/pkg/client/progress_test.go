@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -9,6 +9,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"testing"
 
 	"github.com/hpcng/singularity/pkg/sylog"
@@ -50,3 +51,75 @@ func TestProgressCallback(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiProgress(t *testing.T) {
+	const input = "Hello World!"
+	ctx := context.Background()
+
+	for _, l := range []int{int(sylog.InfoLevel), int(sylog.ErrorLevel)} {
+		t.Run(fmt.Sprintf("level%d", l), func(t *testing.T) {
+			sylog.SetLevel(l, true)
+
+			mp := NewMultiProgress(ctx)
+			dst := []bytes.Buffer{{}, {}}
+
+			// a transfer resumed after the first 6 bytes, and a new one
+			if err := mp.Callback("resumed", 6)(int64(len(input)-6), bytes.NewBufferString(input[6:]), &dst[0]); err != nil {
+				t.Errorf("Unexpected error from callback: %v", err)
+			}
+			if err := mp.Callback("new", 0)(-1, bytes.NewBufferString(input), &dst[1]); err != nil {
+				t.Errorf("Unexpected error from callback: %v", err)
+			}
+			mp.Wait()
+
+			if output := dst[0].String(); output != input[6:] {
+				t.Errorf("Output from callback '%s' != input '%s'", output, input[6:])
+			}
+			if output := dst[1].String(); output != input {
+				t.Errorf("Output from callback '%s' != input '%s'", output, input)
+			}
+		})
+	}
+}
+
+func TestProgressOutput(t *testing.T) {
+	ctx := context.Background()
+	if w := progressOutput(ctx); w != os.Stdout {
+		t.Errorf("got progress output %v, want standard output", w)
+	}
+
+	out := &bytes.Buffer{}
+	if w := progressOutput(WithProgressOutput(ctx, out)); w != out {
+		t.Errorf("got progress output %v, want %v", w, out)
+	}
+}
+
+func TestWithMultiProgress(t *testing.T) {
+	const input = "Hello World!"
+	sylog.SetLevel(int(sylog.InfoLevel), true)
+
+	mp := NewMultiProgress(WithProgressOutput(context.Background(), &bytes.Buffer{}))
+	ctx := WithMultiProgress(context.Background(), mp, "shared")
+
+	// a nested MultiProgress displays its bars with mp, only mp waits
+	nested := NewMultiProgress(ctx)
+	if nested.p != mp.p {
+		t.Errorf("nested MultiProgress doesn't share the progress container")
+	}
+
+	dst := []bytes.Buffer{{}, {}}
+	if err := ProgressBarCallback(ctx)(int64(len(input)), bytes.NewBufferString(input), &dst[0]); err != nil {
+		t.Errorf("Unexpected error from callback: %v", err)
+	}
+	if err := nested.Callback("nested", 0)(int64(len(input)), bytes.NewBufferString(input), &dst[1]); err != nil {
+		t.Errorf("Unexpected error from callback: %v", err)
+	}
+	nested.Wait()
+	mp.Wait()
+
+	for i := range dst {
+		if output := dst[i].String(); output != input {
+			t.Errorf("Output from callback '%s' != input '%s'", output, input)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package s3 implements pulling and pushing images from and to Amazon S3 and
+// S3-compatible object stores, like MinIO.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/client"
+	"github.com/hpcng/singularity/pkg/sylog"
+	useragent "github.com/hpcng/singularity/pkg/util/user-agent"
+)
+
+const (
+	// maxObjectSize is the maximum size of an S3 object.
+	maxObjectSize = 5 << 40
+	// maxParts is the maximum number of parts of a multipart upload.
+	maxParts = 10000
+)
+
+// multipartSize is the size above which objects are uploaded in parts, it's
+// also the minimum size of these parts. Objects uploaded with a single PUT
+// are limited to 5GiB.
+var multipartSize int64 = 64 << 20
+
+// Ref is a reference to an S3 object, in the s3://bucket/key format.
+type Ref struct {
+	Bucket string
+	Key    string
+}
+
+// ParseRef parses the s3://bucket/key reference ref.
+func ParseRef(ref string) (Ref, error) {
+	s := strings.TrimPrefix(ref, "s3:")
+	if !strings.HasPrefix(s, "//") {
+		return Ref{}, fmt.Errorf("not a valid s3 reference: %s", ref)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, "//"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Ref{}, fmt.Errorf("s3 reference %s must be in the s3://bucket/key format", ref)
+	}
+	return Ref{Bucket: parts[0], Key: parts[1]}, nil
+}
+
+func (r Ref) String() string {
+	return "s3://" + r.Bucket + "/" + r.Key
+}
+
+// Object describes an S3 object.
+type Object struct {
+	ETag string
+	Size int64
+}
+
+// Client is a minimal S3 client, supporting the object operations needed
+// to pull and push images.
+type Client struct {
+	config *Config
+	http   *http.Client
+}
+
+// NewClient returns a client with the configuration config.
+func NewClient(config *Config) *Client {
+	return &Client{
+		config: config,
+		http:   &http.Client{},
+	}
+}
+
+// objectURL returns the URL of the object ref. Virtual-hosted style URLs
+// are used with AWS, path-style URLs with custom endpoints, and buckets
+// whose names aren't valid host names.
+func (c *Client) objectURL(ref Ref) (*url.URL, error) {
+	key := "/" + ref.Key
+
+	var u *url.URL
+	var err error
+	switch {
+	case c.config.Endpoint != "":
+		u, err = url.Parse(strings.TrimSuffix(c.config.Endpoint, "/"))
+		key = "/" + ref.Bucket + key
+	case strings.Contains(ref.Bucket, "."):
+		u, err = url.Parse(fmt.Sprintf("https://s3.%s.amazonaws.com", c.config.Region))
+		key = "/" + ref.Bucket + key
+	default:
+		u, err = url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com", ref.Bucket, c.config.Region))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %v", err)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + key
+	u.RawPath = escape(u.Path, false)
+	return u, nil
+}
+
+// do signs and sends a request with method for the object ref.
+func (c *Client) do(ctx context.Context, method string, ref Ref, prepare func(*http.Request)) (*http.Response, error) {
+	u, err := c.objectURL(ref)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", useragent.Value())
+	if prepare != nil {
+		prepare(req)
+	}
+	if c.config.Credentials != nil {
+		creds, err := c.config.Credentials.Retrieve()
+		if err != nil {
+			return nil, err
+		}
+		if creds != nil {
+			sign(req, creds, c.config.Region, time.Now())
+		}
+	}
+
+	sylog.Debugf("S3 request: %s %s", method, u)
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		return nil, responseError(ref, res)
+	}
+	return res, nil
+}
+
+// responseError returns the error of an unsuccessful response, as
+// described by the XML error document S3 returns.
+func responseError(ref Ref, res *http.Response) error {
+	var e struct {
+		Code    string
+		Message string
+	}
+	if b, err := ioutil.ReadAll(res.Body); err == nil && len(b) > 0 {
+		_ = xml.Unmarshal(b, &e)
+	}
+	switch {
+	case res.StatusCode == http.StatusPreconditionFailed:
+		return fmt.Errorf("%s: object changed while being pulled", ref)
+	case e.Code != "":
+		return fmt.Errorf("%s: %s: %s", ref, e.Code, e.Message)
+	case res.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s: object not found", ref)
+	default:
+		return fmt.Errorf("%s: %s", ref, res.Status)
+	}
+}
+
+// Head returns the description of the object ref.
+func (c *Client) Head(ctx context.Context, ref Ref) (Object, error) {
+	res, err := c.do(ctx, http.MethodHead, ref, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	res.Body.Close()
+
+	return Object{
+		ETag: strings.Trim(res.Header.Get("ETag"), `"`),
+		Size: res.ContentLength,
+	}, nil
+}
+
+// Download downloads the object ref to the file path. If etag is set, the
+// download fails unless the object still has this ETag, so the content
+// downloaded is the one the ETag identifies.
+func (c *Client) Download(ctx context.Context, ref Ref, path, etag string) error {
+	res, err := c.do(ctx, http.MethodGet, ref, func(req *http.Request) {
+		if etag != "" {
+			req.Header.Set("If-Match", `"`+etag+`"`)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Perms are 777 *prior* to umask
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o777)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	pb := client.ProgressBarCallback(ctx)
+	if err := pb(res.ContentLength, res.Body, out); err != nil {
+		out.Close()
+		sylog.Infof("Cleaning up incomplete download: %s", path)
+		if err := os.Remove(path); err != nil {
+			sylog.Errorf("Error while removing incomplete download: %v", err)
+		}
+		return err
+	}
+	return out.Close()
+}
+
+// Upload uploads the file path to the object ref. Files larger than
+// multipartSize are uploaded in parts.
+func (c *Client) Upload(ctx context.Context, path string, ref Ref) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() > maxObjectSize {
+		return fmt.Errorf("%s is larger than the maximum object size (5TiB)", path)
+	}
+	if fi.Size() > multipartSize {
+		return c.uploadParts(ctx, f, fi.Size(), ref)
+	}
+
+	res, err := c.do(ctx, http.MethodPut, ref, func(req *http.Request) {
+		if fi.Size() > 0 {
+			req.Body = f
+			req.ContentLength = fi.Size()
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+	})
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// partSize returns the size of the parts of the multipart upload of an
+// object of size bytes.
+func partSize(size int64) int64 {
+	if n := (size + maxParts - 1) / maxParts; n > multipartSize {
+		return n
+	}
+	return multipartSize
+}
+
+// completedPart is an uploaded part of a multipart upload.
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// uploadParts uploads the size bytes of f to the object ref with a multipart
+// upload, which is aborted on failure so uploaded parts aren't kept.
+func (c *Client) uploadParts(ctx context.Context, f *os.File, size int64, ref Ref) (err error) {
+	res, err := c.do(ctx, http.MethodPost, ref, func(req *http.Request) {
+		req.URL.RawQuery = "uploads="
+		req.Header.Set("Content-Type", "application/octet-stream")
+	})
+	if err != nil {
+		return err
+	}
+	var initiate struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(res.Body).Decode(&initiate)
+	res.Body.Close()
+	if err != nil {
+		return fmt.Errorf("%s: while decoding multipart upload: %v", ref, err)
+	} else if initiate.UploadID == "" {
+		return fmt.Errorf("%s: no multipart upload ID returned", ref)
+	}
+	uploadQuery := url.Values{"uploadId": {initiate.UploadID}}.Encode()
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		res, abortErr := c.do(context.Background(), http.MethodDelete, ref, func(req *http.Request) {
+			req.URL.RawQuery = uploadQuery
+		})
+		if abortErr != nil {
+			sylog.Warningf("Could not abort multipart upload of %s: %v", ref, abortErr)
+			return
+		}
+		res.Body.Close()
+	}()
+
+	var complete struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}
+
+	ps := partSize(size)
+	for n, off := 1, int64(0); off < size; n, off = n+1, off+ps {
+		length := ps
+		if size-off < length {
+			length = size - off
+		}
+		partQuery := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {initiate.UploadID}}.Encode()
+
+		sylog.Debugf("Uploading part %d of %s", n, ref)
+		res, err := c.do(ctx, http.MethodPut, ref, func(req *http.Request) {
+			req.URL.RawQuery = partQuery
+			req.Body = ioutil.NopCloser(io.NewSectionReader(f, off, length))
+			req.ContentLength = length
+		})
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+
+		etag := res.Header.Get("ETag")
+		if etag == "" {
+			return fmt.Errorf("%s: no ETag returned for part %d", ref, n)
+		}
+		complete.Parts = append(complete.Parts, completedPart{PartNumber: n, ETag: etag})
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	res, err = c.do(ctx, http.MethodPost, ref, func(req *http.Request) {
+		req.URL.RawQuery = uploadQuery
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Set("Content-Type", "application/xml")
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// the completion can fail after a successful status was sent
+	var e struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if b, err := ioutil.ReadAll(res.Body); err != nil {
+		return err
+	} else if xml.Unmarshal(b, &e) == nil && e.XMLName.Local == "Error" {
+		return fmt.Errorf("%s: %s: %s", ref, e.Code, e.Message)
+	}
+	return nil
+}
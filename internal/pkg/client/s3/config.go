@@ -0,0 +1,209 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package s3
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// defaultRegion is the region used when none is configured.
+const defaultRegion = "us-east-1"
+
+// Credentials holds AWS credentials used to sign requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Retrieve returns c, so fixed credentials are their own provider.
+func (c *Credentials) Retrieve() (*Credentials, error) {
+	return c, nil
+}
+
+// CredentialsProvider provides the credentials used to sign requests.
+type CredentialsProvider interface {
+	// Retrieve returns the credentials, or nil for anonymous requests.
+	Retrieve() (*Credentials, error)
+}
+
+// Config holds the configuration of an S3 client.
+type Config struct {
+	// Endpoint is the URL of an S3-compatible object store, if empty the
+	// AWS endpoint of Region is used.
+	Endpoint string
+	// Region is the region requests are signed for.
+	Region string
+	// Credentials provides the credentials used to sign requests, requests
+	// are anonymous if nil or if it provides no credentials.
+	Credentials CredentialsProvider
+}
+
+// DefaultConfig returns the client configuration resolved like the AWS
+// tools do, from the environment first, then from the shared credentials
+// and configuration files of the AWS_PROFILE profile:
+//
+//   - region: AWS_REGION, AWS_DEFAULT_REGION, or region in ~/.aws/config
+//   - endpoint: AWS_ENDPOINT_URL_S3, AWS_ENDPOINT_URL, or endpoint_url in
+//     ~/.aws/config
+//   - credentials: resolved when the first request is signed, see
+//     resolveCredentials
+func DefaultConfig() (*Config, error) {
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	keys, err := loadProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Config{
+		Endpoint: firstOf(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"), keys["endpoint_url"]),
+		Region:   firstOf(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), keys["region"], defaultRegion),
+	}
+	c.Credentials = &chainCredentials{profile: profile}
+	return c, nil
+}
+
+// awsDir returns the path of the directory holding the AWS files.
+func awsDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		u, err := user.Current()
+		if err != nil {
+			return ""
+		}
+		home = u.HomeDir
+	}
+	return filepath.Join(home, ".aws")
+}
+
+// awsFile returns the path of the AWS file name, overridden by the
+// environment variable env.
+func awsFile(env, name string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	if dir := awsDir(); dir != "" {
+		return filepath.Join(dir, name)
+	}
+	return ""
+}
+
+// loadProfile returns the keys of the profile, from the configuration file
+// overridden by the shared credentials file.
+func loadProfile(profile string) (map[string]string, error) {
+	// profiles other than default are prefixed in the configuration file
+	section := profile
+	if profile != "default" {
+		section = "profile " + profile
+	}
+	keys, err := readProfile(awsFile("AWS_CONFIG_FILE", "config"), section)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := readProfile(awsFile("AWS_SHARED_CREDENTIALS_FILE", "credentials"), profile)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range creds {
+		keys[k] = v
+	}
+	return keys, nil
+}
+
+// readProfile returns the keys of the section of the INI file at path, a
+// missing file has no keys. Values may be quoted, and continued on the
+// following indented lines. Indented keys following a key without value
+// are keys of a sub-section, returned as <key>.<sub-key>.
+func readProfile(path, section string) (map[string]string, error) {
+	keys := make(map[string]string)
+	if path == "" {
+		return keys, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return keys, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	inSection := false
+	// key is the last key read, continued by indented lines
+	key := ""
+	subSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		indented := raw[0] == ' ' || raw[0] == '\t'
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == section
+			key = ""
+			continue
+		}
+		if !inSection {
+			continue
+		}
+
+		if indented && key != "" {
+			if !subSection {
+				keys[key] += "\n" + line
+				continue
+			}
+			if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+				keys[key+"."+strings.TrimSpace(kv[0])] = unquote(strings.TrimSpace(kv[1]))
+			}
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			key = ""
+			continue
+		}
+		key = strings.TrimSpace(kv[0])
+		value := unquote(strings.TrimSpace(kv[1]))
+		subSection = value == ""
+		if !subSection {
+			keys[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("while reading %s: %v", path, err)
+	}
+	return keys, nil
+}
+
+// unquote removes the double or single quotes around the value s.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
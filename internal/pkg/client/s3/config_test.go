@@ -0,0 +1,238 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package s3
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	credentials := filepath.Join(dir, "credentials")
+	err = ioutil.WriteFile(credentials, []byte(`
+[default]
+aws_access_key_id = default-key
+aws_secret_access_key = default-secret
+
+[minio]
+aws_access_key_id = minio-key
+aws_secret_access_key = minio-secret
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "config")
+	err = ioutil.WriteFile(config, []byte(`
+[default]
+region = eu-west-1
+
+[profile minio]
+region = local
+endpoint_url = http://minio.example.com:9000
+
+[profile quoted]
+region = "eu-central-1"
+aws_access_key_id = "quoted-key"
+aws_secret_access_key = 'quoted secret'
+
+[profile process]
+credential_process = /usr/bin/credentials
+
+[profile role]
+role_arn = arn:aws:iam::123456789012:role/s3
+source_profile = default
+
+[profile sso]
+sso_session = corp
+sso_account_id = 123456789012
+sso_role_name = sso-role
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"HOME":                        dir,
+		"AWS_SHARED_CREDENTIALS_FILE": credentials,
+		"AWS_CONFIG_FILE":             config,
+	}
+	for _, k := range []string{
+		"AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION",
+		"AWS_ENDPOINT_URL", "AWS_ENDPOINT_URL_S3",
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+	} {
+		env[k] = ""
+	}
+	for k, v := range env {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		env      map[string]string
+		endpoint string
+		region   string
+		want     *Credentials
+		wantErr  bool
+	}{
+		{
+			name:   "Default",
+			region: "eu-west-1",
+			want:   &Credentials{AccessKeyID: "default-key", SecretAccessKey: "default-secret"},
+		},
+		{
+			name:     "Profile",
+			env:      map[string]string{"AWS_PROFILE": "minio"},
+			endpoint: "http://minio.example.com:9000",
+			region:   "local",
+			want:     &Credentials{AccessKeyID: "minio-key", SecretAccessKey: "minio-secret"},
+		},
+		{
+			name:   "ConfigFile",
+			env:    map[string]string{"AWS_PROFILE": "quoted"},
+			region: "eu-central-1",
+			want:   &Credentials{AccessKeyID: "quoted-key", SecretAccessKey: "quoted secret"},
+		},
+		{
+			name: "Environment",
+			env: map[string]string{
+				"AWS_PROFILE":           "minio",
+				"AWS_REGION":            "us-west-2",
+				"AWS_ENDPOINT_URL_S3":   "https://s3.example.com",
+				"AWS_ACCESS_KEY_ID":     "env-key",
+				"AWS_SECRET_ACCESS_KEY": "env-secret",
+				"AWS_SESSION_TOKEN":     "env-token",
+			},
+			endpoint: "https://s3.example.com",
+			region:   "us-west-2",
+			want:     &Credentials{AccessKeyID: "env-key", SecretAccessKey: "env-secret", SessionToken: "env-token"},
+		},
+		{
+			name: "EnvironmentOverUnsupported",
+			env: map[string]string{
+				"AWS_PROFILE":           "role",
+				"AWS_ACCESS_KEY_ID":     "env-key",
+				"AWS_SECRET_ACCESS_KEY": "env-secret",
+			},
+			region: defaultRegion,
+			want:   &Credentials{AccessKeyID: "env-key", SecretAccessKey: "env-secret"},
+		},
+		{
+			name:    "Process",
+			env:     map[string]string{"AWS_PROFILE": "process"},
+			region:  defaultRegion,
+			wantErr: true,
+		},
+		{
+			name:    "AssumeRole",
+			env:     map[string]string{"AWS_PROFILE": "role"},
+			region:  defaultRegion,
+			wantErr: true,
+		},
+		{
+			name:    "SSO",
+			env:     map[string]string{"AWS_PROFILE": "sso"},
+			region:  defaultRegion,
+			wantErr: true,
+		},
+		{
+			name:   "Anonymous",
+			env:    map[string]string{"AWS_PROFILE": "missing"},
+			region: defaultRegion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+				defer os.Setenv(k, env[k])
+			}
+
+			// credentials are only resolved when retrieved
+			c, err := DefaultConfig()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.Endpoint != tt.endpoint || c.Region != tt.region {
+				t.Errorf("got endpoint %q and region %q, want %q and %q", c.Endpoint, c.Region, tt.endpoint, tt.region)
+			}
+
+			creds, err := c.Credentials.Retrieve()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("unexpected success")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(creds, tt.want) {
+				t.Errorf("got credentials %+v, want %+v", creds, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadProfile(t *testing.T) {
+	f, err := ioutil.TempFile("", "s3-profile-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`
+[default]
+region = eu-west-1
+
+# comment
+[profile test]
+region = "us-west-2"
+role_session_name = 'session'
+s3 =
+  endpoint_url = http://nested.example.com
+  region = nested
+; comment
+description = first line
+  second line
+endpoint_url=http://example.com
+`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := readProfile(f.Name(), "profile test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"region":            "us-west-2",
+		"role_session_name": "session",
+		"s3.endpoint_url":   "http://nested.example.com",
+		"s3.region":         "nested",
+		"description":       "first line\nsecond line",
+		"endpoint_url":      "http://example.com",
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("got keys %q, want %q", keys, want)
+	}
+}
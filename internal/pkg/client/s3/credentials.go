@@ -0,0 +1,119 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package s3
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// unsupportedKeys are the profile keys of the credential sources which are
+// not supported, prefixes end with an underscore.
+var unsupportedKeys = []string{
+	"role_arn",
+	"web_identity_token_file",
+	"credential_source",
+	"credential_process",
+	"sso_",
+}
+
+// chainCredentials resolves the credentials of a profile when they are
+// first retrieved, so anonymous requests don't require a valid profile.
+type chainCredentials struct {
+	profile  string
+	mu       sync.Mutex
+	resolved bool
+	creds    *Credentials
+}
+
+// Retrieve returns the credentials of the profile, resolved with
+// resolveCredentials.
+func (c *chainCredentials) Retrieve() (*Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resolved {
+		return c.creds, nil
+	}
+	creds, err := resolveCredentials(c.profile)
+	if err != nil {
+		return nil, err
+	}
+	c.creds = creds
+	c.resolved = true
+	return creds, nil
+}
+
+// resolveCredentials returns the credentials of the profile, or nil if
+// there are none, from:
+//
+//   - AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+//   - aws_access_key_id, aws_secret_access_key and aws_session_token of
+//     the profile in ~/.aws/credentials (AWS_SHARED_CREDENTIALS_FILE) or
+//     ~/.aws/config (AWS_CONFIG_FILE)
+//
+// Profiles using other credential sources, like roles, SSO or
+// credential_process, are rejected rather than sending requests with
+// other credentials than the user expects.
+func resolveCredentials(profile string) (*Credentials, error) {
+	if creds := envCredentials(); creds != nil {
+		return creds, nil
+	}
+
+	keys, err := loadProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	if unsupported := unsupportedProfileKeys(keys); len(unsupported) > 0 {
+		return nil, fmt.Errorf("profile %s: unsupported credential source %s, only access keys are supported", profile, strings.Join(unsupported, ", "))
+	}
+	return staticCredentials(keys), nil
+}
+
+// unsupportedProfileKeys returns the sorted profile keys of unsupported
+// credential sources.
+func unsupportedProfileKeys(keys map[string]string) []string {
+	var unsupported []string
+	for k := range keys {
+		for _, u := range unsupportedKeys {
+			if k == u || strings.HasSuffix(u, "_") && strings.HasPrefix(k, u) {
+				unsupported = append(unsupported, k)
+				break
+			}
+		}
+	}
+	sort.Strings(unsupported)
+	return unsupported
+}
+
+// envCredentials returns the credentials set in the environment, or nil.
+func envCredentials() *Credentials {
+	creds := &Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil
+	}
+	return creds
+}
+
+// staticCredentials returns the credentials set in the profile keys, or nil.
+func staticCredentials(keys map[string]string) *Credentials {
+	creds := &Credentials{
+		AccessKeyID:     keys["aws_access_key_id"],
+		SecretAccessKey: keys["aws_secret_access_key"],
+		SessionToken:    keys["aws_session_token"],
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil
+	}
+	return creds
+}
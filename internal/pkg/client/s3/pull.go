@@ -0,0 +1,127 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/hpcng/singularity/internal/pkg/cache"
+	"github.com/hpcng/singularity/internal/pkg/util/fs"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// pull will pull an s3 image into the cache if directTo="", or a specific file if directTo is set.
+func pull(ctx context.Context, imgCache *cache.Handle, directTo string, ref Ref, config *Config) (imagePath string, err error) {
+	c := NewClient(config)
+
+	if directTo != "" {
+		sylog.Infof("Downloading s3 image")
+		if err := c.Download(ctx, ref, directTo, ""); err != nil {
+			return "", fmt.Errorf("unable to download image: %v", err)
+		}
+		return directTo, nil
+	}
+
+	// We cache using a sha256 over the reference and the ETag of the
+	// object, which changes whenever the object is replaced.
+	obj, err := c.Head(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if obj.ETag == "" {
+		return "", fmt.Errorf("no ETag returned for %s", ref)
+	}
+	sylog.Debugf("S3 object ETag is: %s", obj.ETag)
+
+	h := sha256.Sum256([]byte(ref.String() + obj.ETag))
+	hash := hex.EncodeToString(h[:])
+	sylog.Debugf("Image hash for cache is: %s", hash)
+
+	cacheEntry, err := imgCache.GetEntry(cache.S3CacheType, hash)
+	if err != nil {
+		return "", fmt.Errorf("unable to check if %v exists in cache: %v", hash, err)
+	}
+	defer cacheEntry.CleanTmp()
+
+	if !cacheEntry.Exists {
+		sylog.Infof("Downloading s3 image")
+		// the object must not be replaced between the HEAD and GET
+		// requests, as it's cached under the ETag returned by the former
+		if err := c.Download(ctx, ref, cacheEntry.TmpPath, obj.ETag); err != nil {
+			return "", fmt.Errorf("unable to download image: %v", err)
+		}
+		if err := cacheEntry.Finalize(); err != nil {
+			return "", err
+		}
+	} else {
+		sylog.Verbosef("Using image from cache")
+	}
+
+	return cacheEntry.Path, nil
+}
+
+// Pull will pull an s3 image to the cache or direct to a temporary file if cache is disabled
+func Pull(ctx context.Context, imgCache *cache.Handle, pullFrom, tmpDir string, config *Config) (imagePath string, err error) {
+	ref, err := ParseRef(pullFrom)
+	if err != nil {
+		return "", err
+	}
+
+	directTo := ""
+	if imgCache.IsDisabled() {
+		file, err := ioutil.TempFile(tmpDir, "sbuild-tmp-cache-")
+		if err != nil {
+			return "", fmt.Errorf("unable to create tmp file: %v", err)
+		}
+		file.Close()
+		directTo = file.Name()
+		sylog.Infof("Downloading s3 image to tmp cache: %s", directTo)
+	}
+
+	return pull(ctx, imgCache, directTo, ref, config)
+}
+
+// PullToFile will pull an s3 image to the specified location, through the cache, or directly if cache is disabled
+func PullToFile(ctx context.Context, imgCache *cache.Handle, pullTo, pullFrom, tmpDir string, config *Config) (imagePath string, err error) {
+	ref, err := ParseRef(pullFrom)
+	if err != nil {
+		return "", err
+	}
+
+	directTo := ""
+	if imgCache.IsDisabled() {
+		directTo = pullTo
+		sylog.Debugf("Cache disabled, pulling directly to: %s", directTo)
+	}
+
+	src, err := pull(ctx, imgCache, directTo, ref, config)
+	if err != nil {
+		return "", fmt.Errorf("error fetching image to cache: %v", err)
+	}
+
+	if directTo == "" {
+		// mode is before umask if pullTo doesn't exist
+		err = fs.CopyFileAtomic(src, pullTo, 0o777)
+		if err != nil {
+			return "", fmt.Errorf("error copying image out of cache: %v", err)
+		}
+	}
+
+	return pullTo, nil
+}
+
+// UploadImage uploads the image file path to the s3 object pushTo.
+func UploadImage(ctx context.Context, path, pushTo string, config *Config) error {
+	ref, err := ParseRef(pushTo)
+	if err != nil {
+		return err
+	}
+	return NewClient(config).Upload(ctx, path, ref)
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hpcng/singularity/internal/pkg/cache"
+	useragent "github.com/hpcng/singularity/pkg/util/user-agent"
+)
+
+func TestMain(m *testing.M) {
+	useragent.InitValue("singularity", "3.0.0-alpha.1-303-gaed8d30-dirty")
+
+	os.Exit(m.Run())
+}
+
+// objectStore is a minimal S3-compatible object store, serving path-style
+// requests signed with the minio access key.
+type objectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	gets    int
+	// uploads holds the parts of pending multipart uploads
+	uploads map[string]map[int][]byte
+}
+
+func (s *objectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied.</Message></Error>`))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := r.URL.Query()
+	id := q.Get("uploadId")
+	_, initiate := q["uploads"]
+
+	switch {
+	case r.Method == http.MethodPost && initiate:
+		s.uploads[r.URL.Path] = make(map[int][]byte)
+		w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>` + r.URL.Path + `</UploadId></InitiateMultipartUploadResult>`))
+	case r.Method == http.MethodPost:
+		var complete struct {
+			Parts []completedPart `xml:"Part"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var b []byte
+		for _, p := range complete.Parts {
+			part, ok := s.uploads[id][p.PartNumber]
+			if sum := md5.Sum(part); !ok || p.ETag != `"`+hex.EncodeToString(sum[:])+`"` {
+				w.Write([]byte(`<Error><Code>InvalidPart</Code><Message>One or more of the specified parts could not be found.</Message></Error>`))
+				return
+			}
+			b = append(b, part...)
+		}
+		delete(s.uploads, id)
+		s.objects[r.URL.Path] = b
+		w.Write([]byte(`<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`))
+	case r.Method == http.MethodDelete && id != "":
+		delete(s.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if id == "" {
+			s.objects[r.URL.Path] = b
+			return
+		}
+		parts, ok := s.uploads[id]
+		n, err := strconv.Atoi(q.Get("partNumber"))
+		if !ok || err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchUpload</Code><Message>The specified upload does not exist.</Message></Error>`))
+			return
+		}
+		parts[n] = b
+		sum := md5.Sum(b)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == http.MethodHead, r.Method == http.MethodGet:
+		b, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		sum := md5.Sum(b)
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+		if m := r.Header.Get("If-Match"); m != "" && m != etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		if r.Method == http.MethodGet {
+			s.gets++
+			w.Write(b)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPullToFile(t *testing.T) {
+	store := &objectStore{
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "s3-pull-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	imgCache, err := cache.New(cache.Config{ParentDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		Endpoint: srv.URL,
+		Region:   defaultRegion,
+		Credentials: &Credentials{
+			AccessKeyID:     "minio",
+			SecretAccessKey: "minio123",
+		},
+	}
+	ctx := context.Background()
+	const uri = "s3://images/dir/image.sif"
+
+	push := func(content string) {
+		src := filepath.Join(dir, "src.sif")
+		if err := ioutil.WriteFile(src, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := UploadImage(ctx, src, uri, config); err != nil {
+			t.Fatalf("while uploading image: %v", err)
+		}
+	}
+	pull := func(want string, gets int) {
+		dst := filepath.Join(dir, "dst.sif")
+		if _, err := PullToFile(ctx, imgCache, dst, uri, dir, config); err != nil {
+			t.Fatalf("while pulling image: %v", err)
+		}
+		b, err := ioutil.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("got image content %q, want %q", b, want)
+		}
+		if store.gets != gets {
+			t.Errorf("got %d downloads, want %d", store.gets, gets)
+		}
+	}
+
+	push("first image")
+	if _, ok := store.objects["/images/dir/image.sif"]; !ok {
+		t.Fatalf("image not uploaded with a path-style request")
+	}
+	pull("first image", 1)
+	// unchanged objects are pulled from the cache
+	pull("first image", 1)
+	// replaced objects have a new ETag
+	push("second image")
+	pull("second image", 2)
+
+	// large objects are uploaded in parts
+	defer func(size int64) { multipartSize = size }(multipartSize)
+	multipartSize = 4
+	push("third image")
+	if len(store.uploads) != 0 {
+		t.Errorf("multipart upload not completed")
+	}
+	pull("third image", 3)
+
+	// an object replaced after its ETag was read isn't downloaded
+	ref, err := ParseRef(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewClient(config).Download(ctx, ref, filepath.Join(dir, "changed.sif"), "outdated"); err == nil || !strings.Contains(err.Error(), "object changed") {
+		t.Errorf("unexpected error for changed object: %v", err)
+	}
+
+	if _, err := Pull(ctx, imgCache, "s3://images/missing.sif", dir, config); err == nil || !strings.Contains(err.Error(), "object not found") {
+		t.Errorf("unexpected error for missing object: %v", err)
+	}
+
+	config.Credentials = &Credentials{AccessKeyID: "other", SecretAccessKey: "minio123"}
+	if _, err := Pull(ctx, imgCache, uri, dir, config); err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Errorf("unexpected error for denied access: %v", err)
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    Ref
+		wantErr bool
+	}{
+		{ref: "s3://bucket/image.sif", want: Ref{Bucket: "bucket", Key: "image.sif"}},
+		{ref: "s3://bucket/dir/image.sif", want: Ref{Bucket: "bucket", Key: "dir/image.sif"}},
+		{ref: "//bucket/image.sif", want: Ref{Bucket: "bucket", Key: "image.sif"}},
+		{ref: "s3://bucket", wantErr: true},
+		{ref: "s3://bucket/", wantErr: true},
+		{ref: "s3:bucket/image.sif", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRef(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRef(%q) unexpected error: %v", tt.ref, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRef(%q) = %+v, want %+v", tt.ref, got, tt.want)
+		}
+	}
+}
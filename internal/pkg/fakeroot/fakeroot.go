@@ -1,4 +1,4 @@
-// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -8,6 +8,7 @@ package fakeroot
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -26,6 +27,9 @@ const (
 	SubGIDFile = "/etc/subgid"
 	// validRangeCount is the valid fakeroot range count.
 	validRangeCount = uint32(65536)
+	// DefaultRangeCount is the range count of mapping entries added
+	// without an explicit range count, it's also the minimal range count.
+	DefaultRangeCount = validRangeCount
 	// StartMax is the maximum possible range start.
 	startMax = uint32(4294967296 - 131072)
 	// StartMin is the minimum possible range start.
@@ -40,6 +44,10 @@ const (
 	maxUID = ^uint32(0)
 )
 
+// ErrNoMapping is the error returned when there is no usable mapping
+// entry for a user.
+var ErrNoMapping = errors.New("no usable mapping entry")
+
 // Entry represents an entry line of subuid/subgid configuration file.
 type Entry struct {
 	line     string
@@ -89,7 +97,7 @@ func GetConfig(filename string, edit bool, getUserFn GetUserFn) (*Config, error)
 
 	config.file, err = os.OpenFile(filename, flags, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open: %s: %s", filename, err)
+		return nil, fmt.Errorf("failed to open: %s: %w", filename, err)
 	}
 
 	config.entries = make([]*Entry, 0)
@@ -197,8 +205,22 @@ func (c *Config) Close() error {
 // find the first available range. It doesn't return any error
 // if the user is already present and ignores the operation.
 func (c *Config) AddUser(username string) error {
-	_, err := c.GetUserEntry(username)
+	return c.AddUserRange(username, 0, 0)
+}
+
+// AddUserRange adds a user mapping entry of count IDs starting at
+// start. If start is zero, it will automatically find the first
+// available range and if count is zero, DefaultRangeCount is used.
+// It returns an error if the range overlaps another entry range. If
+// the user is already present, the operation is ignored, unless an
+// explicit start or count differing from the user entry is requested,
+// in which case an error is returned.
+func (c *Config) AddUserRange(username string, start uint32, count uint32) error {
+	e, err := c.GetUserEntry(username)
 	if err == nil {
+		if (start != 0 && start != e.Start) || (count != 0 && count != e.Count) {
+			return fmt.Errorf("user %s already has the range %d-%d", username, e.Start, uint64(e.Start)+uint64(e.Count)-1)
+		}
 		return nil
 	}
 
@@ -206,36 +228,71 @@ func (c *Config) AddUser(username string) error {
 	if err != nil {
 		return fmt.Errorf("could not retrieve user information for %s: %s", username, err)
 	}
-	for i := startMax; i >= startMin; i -= validRangeCount {
-		current := i
-		available := true
-		for _, entry := range c.entries {
-			if entry.invalid {
-				continue
-			}
-			start := entry.Start
-			end := entry.Start + entry.Count - 1
-			if current >= start && current <= end {
-				available = false
-				break
-			}
+
+	if count == 0 {
+		count = DefaultRangeCount
+	} else if count < validRangeCount {
+		return fmt.Errorf("range count %d is lower than the minimal range count %d", count, validRangeCount)
+	}
+
+	if start == 0 {
+		start, err = c.freeRange(count)
+		if err != nil {
+			return err
 		}
-		if available {
-			c.requireUpdate = true
-			line := fmt.Sprintf("%d:%d:%d", u.UID, current, validRangeCount)
-			c.entries = append(
-				c.entries,
-				&Entry{
-					UID:      u.UID,
-					Start:    current,
-					Count:    validRangeCount,
-					disabled: false,
-					line:     line,
-				})
-			return nil
+	} else if start < startMin {
+		return fmt.Errorf("range start %d is lower than the minimal range start %d", start, startMin)
+	} else if uint64(start)+uint64(count)-1 > uint64(maxUID) {
+		return fmt.Errorf("range %d-%d exceeds the maximal ID %d", start, uint64(start)+uint64(count)-1, maxUID)
+	} else if e := c.overlappingEntry(start, count); e != nil {
+		return fmt.Errorf("range %d-%d overlaps the entry %q", start, start+count-1, e.line)
+	}
+
+	c.requireUpdate = true
+	line := fmt.Sprintf("%d:%d:%d", u.UID, start, count)
+	c.entries = append(
+		c.entries,
+		&Entry{
+			UID:      u.UID,
+			Start:    start,
+			Count:    count,
+			disabled: false,
+			line:     line,
+		})
+	return nil
+}
+
+// overlappingEntry returns the first valid entry whose range overlaps
+// the range of count IDs starting at start, or nil if there is none.
+func (c *Config) overlappingEntry(start uint32, count uint32) *Entry {
+	end := uint64(start) + uint64(count) - 1
+	for _, entry := range c.entries {
+		if entry.invalid {
+			continue
+		}
+		entryEnd := uint64(entry.Start) + uint64(entry.Count) - 1
+		if uint64(start) <= entryEnd && end >= uint64(entry.Start) {
+			return entry
 		}
 	}
-	return fmt.Errorf("no range available")
+	return nil
+}
+
+// freeRange returns the start of the highest available range of count
+// IDs aligned on validRangeCount.
+func (c *Config) freeRange(count uint32) (uint32, error) {
+	if uint64(count) > uint64(startMax)+uint64(validRangeCount)-uint64(startMin) {
+		return 0, fmt.Errorf("no range available")
+	}
+	first := uint64(startMax) + uint64(validRangeCount) - uint64(count)
+	first -= first % uint64(validRangeCount)
+
+	for i := first; i >= uint64(startMin); i -= uint64(validRangeCount) {
+		if c.overlappingEntry(uint32(i), count) == nil {
+			return uint32(i), nil
+		}
+	}
+	return 0, fmt.Errorf("no range available")
 }
 
 // RemoveUser removes a user mapping entry. It returns an error
@@ -328,11 +385,84 @@ func (c *Config) GetUserEntry(username string) (*Entry, error) {
 
 	if entryCount > 0 {
 		return nil, fmt.Errorf(
-			"mapping entries for user %s found in %s but all with a range count lower than %d",
-			username, c.file.Name(), validRangeCount,
+			"%w: mapping entries for user %s found in %s but all with a range count lower than %d",
+			ErrNoMapping, username, c.file.Name(), validRangeCount,
 		)
 	}
-	return nil, fmt.Errorf("no mapping entry found in %s for %s", c.file.Name(), username)
+	return nil, fmt.Errorf("%w: no mapping entry found in %s for %s", ErrNoMapping, c.file.Name(), username)
+}
+
+// Disabled returns whether the entry is disabled.
+func (e *Entry) Disabled() bool {
+	return e.disabled
+}
+
+// Entries returns the valid entries of the configuration.
+func (c *Config) Entries() []*Entry {
+	entries := make([]*Entry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		if !entry.invalid {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Check returns the problems found in the configuration: invalid
+// entries, entries of unknown users, entries with a range count
+// too small to be used by fakeroot and overlapping entries.
+func (c *Config) Check() []error {
+	var problems []error
+
+	entries := c.Entries()
+	for _, entry := range c.entries {
+		if entry.invalid {
+			problems = append(problems, fmt.Errorf("invalid entry %q", entry.line))
+		}
+	}
+	for i, entry := range entries {
+		if entry.UID == maxUID {
+			problems = append(problems, fmt.Errorf("entry %q refers to an unknown user", entry.line))
+		}
+		if entry.Count < validRangeCount {
+			problems = append(problems, fmt.Errorf("entry %q has a range count lower than %d", entry.line, validRangeCount))
+		}
+		end := uint64(entry.Start) + uint64(entry.Count) - 1
+		for _, other := range entries[i+1:] {
+			otherEnd := uint64(other.Start) + uint64(other.Count) - 1
+			if uint64(entry.Start) <= otherEnd && end >= uint64(other.Start) {
+				problems = append(problems, fmt.Errorf("entry %q overlaps entry %q", entry.line, other.line))
+			}
+		}
+	}
+	return problems
+}
+
+// MissingUsers returns the UIDs of users with a usable mapping entry
+// in the configuration but without usable mapping entry in other.
+func (c *Config) MissingUsers(other *Config) []uint32 {
+	usable := func(config *Config) map[uint32]bool {
+		uids := make(map[uint32]bool)
+		for _, entry := range config.Entries() {
+			if entry.UID != maxUID && entry.Count >= validRangeCount {
+				uids[entry.UID] = true
+			}
+		}
+		return uids
+	}
+
+	uids := usable(c)
+	otherUIDs := usable(other)
+	missing := make([]uint32, 0)
+	for _, entry := range c.Entries() {
+		if !uids[entry.UID] || otherUIDs[entry.UID] {
+			continue
+		}
+		// report each user once
+		otherUIDs[entry.UID] = true
+		missing = append(missing, entry.UID)
+	}
+	return missing
 }
 
 // getPwUID is also used for mocking purpose
@@ -343,7 +473,9 @@ var getPwNam = user.GetPwNam
 // file provided in path.
 func GetIDRange(path string, uid uint32) (*specs.LinuxIDMapping, error) {
 	config, err := GetConfig(path, false, getPwNam)
-	if err != nil {
+	if os.IsNotExist(errors.Unwrap(err)) {
+		return nil, fmt.Errorf("%w: %s", ErrNoMapping, err)
+	} else if err != nil {
 		return nil, err
 	}
 	defer config.Close()
@@ -365,3 +497,29 @@ func GetIDRange(path string, uid uint32) (*specs.LinuxIDMapping, error) {
 		Size:        e.Count,
 	}, nil
 }
+
+// GetIDMappings returns the UID and GID mappings of the fakeroot user
+// namespace of the user uid with the primary group gid: the user and its
+// group are mapped to root and the ranges returned by getIDRange for the
+// subuid and subgid files are mapped from ID 1. If singleID is allowed and
+// there is no usable mapping entry for the user, only the user and its
+// group are mapped and the returned singleID is true.
+func GetIDMappings(getIDRange func(string, uint32) (*specs.LinuxIDMapping, error), uid, gid uint32, allowSingleID bool) (uidMappings, gidMappings []specs.LinuxIDMapping, singleID bool, err error) {
+	uidMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: uid, Size: 1}}
+	gidMappings = []specs.LinuxIDMapping{{ContainerID: 0, HostID: gid, Size: 1}}
+
+	uidRange, err := getIDRange(SubUIDFile, uid)
+	if err == nil {
+		var gidRange *specs.LinuxIDMapping
+		gidRange, err = getIDRange(SubGIDFile, uid)
+		if err == nil {
+			uidMappings = append(uidMappings, *uidRange)
+			gidMappings = append(gidMappings, *gidRange)
+			return uidMappings, gidMappings, false, nil
+		}
+	}
+	if !allowSingleID || !errors.Is(err, ErrNoMapping) {
+		return nil, nil, false, err
+	}
+	return uidMappings, gidMappings, true, nil
+}
@@ -7,6 +7,7 @@ package fakeroot
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -517,3 +518,254 @@ func TestConfig(t *testing.T) {
 	testGetUserEntry(t, config)
 	testEditEntry(t, config)
 }
+
+func TestAddUserRange(t *testing.T) {
+	f, err := fs.MakeTmpFile("", "subid-", 0644)
+	if err != nil {
+		t.Fatalf("failed to create temporary config: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	content := fmt.Sprintf("existing_10:%d:%d\n", startMax, validRangeCount)
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+	f.Close()
+
+	config, err := GetConfig(f.Name(), true, getUserFn)
+	if err != nil {
+		t.Fatalf("unexpected error while getting config %s: %s", f.Name(), err)
+	}
+	defer config.Close()
+
+	tests := []struct {
+		desc          string
+		username      string
+		start         uint32
+		count         uint32
+		expectedStart uint32
+		expectSuccess bool
+	}{
+		{
+			desc:          "DefaultRange",
+			username:      "default_11",
+			expectedStart: startMax - validRangeCount,
+			expectSuccess: true,
+		},
+		{
+			desc:          "LargeRange",
+			username:      "large_12",
+			count:         2 * validRangeCount,
+			expectedStart: startMax - 3*validRangeCount,
+			expectSuccess: true,
+		},
+		{
+			desc:          "ExplicitStart",
+			username:      "explicit_13",
+			start:         200000,
+			count:         100000,
+			expectedStart: 200000,
+			expectSuccess: true,
+		},
+		{
+			desc:          "ExistingSameRange",
+			username:      "explicit_13",
+			start:         200000,
+			count:         100000,
+			expectedStart: 200000,
+			expectSuccess: true,
+		},
+		{
+			desc:          "ExistingDefaultRange",
+			username:      "explicit_13",
+			expectedStart: 200000,
+			expectSuccess: true,
+		},
+		{
+			desc:          "ExistingDifferentStart",
+			username:      "explicit_13",
+			start:         400000,
+			expectSuccess: false,
+		},
+		{
+			desc:          "ExistingDifferentCount",
+			username:      "default_11",
+			count:         2 * validRangeCount,
+			expectSuccess: false,
+		},
+		{
+			desc:          "OverlappingStart",
+			username:      "overlap_14",
+			start:         250000,
+			expectSuccess: false,
+		},
+		{
+			desc:          "OverlappingEnd",
+			username:      "overlap_15",
+			start:         200000 - validRangeCount + 1,
+			expectSuccess: false,
+		},
+		{
+			desc:          "SmallRange",
+			username:      "small_16",
+			count:         1000,
+			expectSuccess: false,
+		},
+		{
+			desc:          "LowStart",
+			username:      "low_17",
+			start:         1000,
+			expectSuccess: false,
+		},
+		{
+			desc:          "HighStart",
+			username:      "high_18",
+			start:         maxUID - 1000,
+			expectSuccess: false,
+		},
+	}
+	for _, tt := range tests {
+		err := config.AddUserRange(tt.username, tt.start, tt.count)
+		if err != nil && tt.expectSuccess {
+			t.Errorf("unexpected error for %q: %s", tt.desc, err)
+		} else if err == nil && !tt.expectSuccess {
+			t.Errorf("unexpected success for %q", tt.desc)
+		} else if err == nil {
+			e, err := config.GetUserEntry(tt.username)
+			if err != nil {
+				t.Errorf("unexpected error for %q: %s", tt.desc, err)
+			} else if e.Start != tt.expectedStart {
+				t.Errorf("%q entry start range should be %d, got %d", tt.desc, tt.expectedStart, e.Start)
+			}
+		}
+	}
+
+	if problems := config.Check(); len(problems) != 0 {
+		t.Errorf("unexpected problems found: %v", problems)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	file := createConfig(t)
+	defer os.Remove(file)
+
+	config, err := GetConfig(file, false, getUserFn)
+	if err != nil {
+		t.Fatalf("unexpected error while getting config %s: %s", file, err)
+	}
+	defer config.Close()
+
+	// 10 badstart entries, 10 badcount entries and 1 nouser entry
+	// reported as invalid entries, 10 sameuser entries with a small
+	// range count
+	if problems := config.Check(); len(problems) != 31 {
+		t.Errorf("expected 31 problems, got %d: %v", len(problems), problems)
+	}
+
+	if err := config.AddUserRange("overlap_60", 0, 0); err != nil {
+		t.Fatalf("unexpected error while adding overlap_60: %s", err)
+	}
+	e, err := config.GetUserEntry("overlap_60")
+	if err != nil {
+		t.Fatalf("unexpected error for overlap_60: %s", err)
+	}
+	e.Start = startMax
+	if problems := config.Check(); len(problems) != 32 {
+		t.Errorf("expected 32 problems with overlapping entry, got %d: %v", len(problems), problems)
+	}
+	if err := config.RemoveUser("overlap_60"); err != nil {
+		t.Fatalf("unexpected error while removing overlap_60: %s", err)
+	}
+
+	other, err := GetConfig(file, false, getUserFn)
+	if err != nil {
+		t.Fatalf("unexpected error while getting config %s: %s", file, err)
+	}
+	defer other.Close()
+
+	if err := other.RemoveUser("valid_10"); err != nil {
+		t.Fatalf("unexpected error while removing valid_10: %s", err)
+	}
+	missing := config.MissingUsers(other)
+	if len(missing) != 1 || missing[0] != 10 {
+		t.Errorf("expected missing user 10, got %v", missing)
+	}
+	if missing := other.MissingUsers(config); len(missing) != 0 {
+		t.Errorf("unexpected missing users %v", missing)
+	}
+}
+
+func TestGetIDMappings(t *testing.T) {
+	idRange := &specs.LinuxIDMapping{ContainerID: 1, HostID: startMax, Size: validRangeCount}
+
+	withRange := func(path string, uid uint32) (*specs.LinuxIDMapping, error) {
+		return idRange, nil
+	}
+	noSubGID := func(path string, uid uint32) (*specs.LinuxIDMapping, error) {
+		if path == SubGIDFile {
+			return nil, fmt.Errorf("%w: no entry for %d", ErrNoMapping, uid)
+		}
+		return idRange, nil
+	}
+	disabled := func(path string, uid uint32) (*specs.LinuxIDMapping, error) {
+		return nil, fmt.Errorf("your fakeroot mapping has been disabled by the administrator")
+	}
+
+	tests := []struct {
+		name           string
+		getIDRange     func(string, uint32) (*specs.LinuxIDMapping, error)
+		allowSingleID  bool
+		expectedSize   int
+		expectSingleID bool
+		expectSuccess  bool
+	}{
+		{
+			name:          "Range",
+			getIDRange:    withRange,
+			allowSingleID: true,
+			expectedSize:  2,
+			expectSuccess: true,
+		},
+		{
+			name:           "SingleID",
+			getIDRange:     noSubGID,
+			allowSingleID:  true,
+			expectedSize:   1,
+			expectSingleID: true,
+			expectSuccess:  true,
+		},
+		{
+			name:          "SingleIDNotAllowed",
+			getIDRange:    noSubGID,
+			allowSingleID: false,
+			expectSuccess: false,
+		},
+		{
+			name:          "Disabled",
+			getIDRange:    disabled,
+			allowSingleID: true,
+			expectSuccess: false,
+		},
+	}
+	for _, tt := range tests {
+		uidMappings, gidMappings, singleID, err := GetIDMappings(tt.getIDRange, 1000, 1001, tt.allowSingleID)
+		if err != nil && tt.expectSuccess {
+			t.Errorf("unexpected error for %q: %s", tt.name, err)
+		} else if err == nil && !tt.expectSuccess {
+			t.Errorf("unexpected success for %q", tt.name)
+		} else if err == nil {
+			if singleID != tt.expectSingleID {
+				t.Errorf("unexpected single-ID mode %v for %q", singleID, tt.name)
+			}
+			if len(uidMappings) != tt.expectedSize || len(gidMappings) != tt.expectedSize {
+				t.Errorf("unexpected mappings for %q: %v %v", tt.name, uidMappings, gidMappings)
+			} else if uidMappings[0].HostID != 1000 || gidMappings[0].HostID != 1001 {
+				t.Errorf("user and group not mapped to root for %q: %v %v", tt.name, uidMappings, gidMappings)
+			}
+		}
+	}
+
+	if _, err := GetIDRange("/non/existent/subuid", 0); !errors.Is(err, ErrNoMapping) {
+		t.Errorf("expected ErrNoMapping for a missing file, got %v", err)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"syscall"
 
 	"github.com/hpcng/singularity/internal/pkg/util/user"
+	"github.com/hpcng/singularity/pkg/network"
 	"github.com/hpcng/singularity/pkg/syfs"
 )
 
@@ -38,17 +39,18 @@ const (
 
 // File represents an instance file storing instance information
 type File struct {
-	Path       string `json:"-"`
-	Pid        int    `json:"pid"`
-	PPid       int    `json:"ppid"`
-	Name       string `json:"name"`
-	User       string `json:"user"`
-	Image      string `json:"image"`
-	Config     []byte `json:"config"`
-	UserNs     bool   `json:"userns"`
-	IP         string `json:"ip"`
-	LogErrPath string `json:"logErrPath"`
-	LogOutPath string `json:"logOutPath"`
+	Path       string           `json:"-"`
+	Pid        int              `json:"pid"`
+	PPid       int              `json:"ppid"`
+	Name       string           `json:"name"`
+	User       string           `json:"user"`
+	Image      string           `json:"image"`
+	Config     []byte           `json:"config"`
+	UserNs     bool             `json:"userns"`
+	IP         string           `json:"ip"`
+	LogErrPath string           `json:"logErrPath"`
+	LogOutPath string           `json:"logOutPath"`
+	Networks   []network.Result `json:"networks,omitempty"`
 }
 
 // ProcName returns processus name based on instance name
@@ -5,6 +5,11 @@
 
 package credential
 
+import (
+	"encoding/base64"
+	"errors"
+)
+
 const (
 	// BasicPrefix is the prefix for the HTTP basic authentication.
 	BasicPrefix = "Basic "
@@ -20,6 +25,41 @@ type Config struct {
 	// - "Bearer <token>"
 	// An empty value means there no authentication at all
 	// or that credentials are stored elsewhere
-	Auth     string `yaml:"Auth,omitempty"`
+	Auth string `yaml:"Auth,omitempty"`
+	// Helper is the name of the docker credential helper storing
+	// the credentials, in which case Auth is empty.
+	Helper   string `yaml:"Helper,omitempty"`
 	Insecure bool   `yaml:"Insecure"`
 }
+
+// Authorization returns the value of the HTTP Authorization header for
+// the service, the credentials are read from the credential helper when
+// they are not stored in the configuration.
+func (c *Config) Authorization() (string, error) {
+	if c.Helper == "" {
+		return c.Auth, nil
+	}
+
+	hc, err := helperGet(c.Helper, c.URI)
+	if err != nil {
+		return "", err
+	}
+	if hc.Username == helperTokenUsername {
+		return TokenPrefix + hc.Secret, nil
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(hc.Username + ":" + hc.Secret))
+	return BasicPrefix + auth, nil
+}
+
+// Erase removes the credentials from the credential helper storing them,
+// if any.
+func (c *Config) Erase() error {
+	if c.Helper == "" {
+		return nil
+	}
+	err := helperErase(c.Helper, c.URI)
+	if errors.Is(err, ErrCredentialsNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package credential
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ocitypes "github.com/containers/image/v5/types"
+	"github.com/hpcng/singularity/pkg/syfs"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// dockerHubHost is the registry host of Docker Hub, and dockerHubServerURL
+// the server URL used by docker to store its credentials.
+const (
+	dockerHubHost      = "docker.io"
+	dockerHubServerURL = "https://index.docker.io/v1/"
+)
+
+// dockerAuth is an entry of the auths section of a docker configuration file.
+type dockerAuth struct {
+	Auth          string `json:"auth,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// dockerConfig holds the credentials related settings of a docker
+// config.json or containers auth.json file.
+type dockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore,omitempty"`
+	CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+}
+
+// DockerConfigPaths returns the paths of the configuration files searched
+// for registry credentials, by order of precedence:
+//   - the singularity docker configuration, written by 'remote login'
+//   - the docker configuration, $DOCKER_CONFIG/config.json or ~/.docker/config.json
+//   - the containers auth files, $REGISTRY_AUTH_FILE, $XDG_RUNTIME_DIR/containers/auth.json
+//     and $XDG_CONFIG_HOME/containers/auth.json
+func DockerConfigPaths() []string {
+	paths := []string{syfs.DockerConf()}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = ""
+	}
+
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "config.json"))
+	} else if home != "" {
+		paths = append(paths, filepath.Join(home, ".docker", "config.json"))
+	}
+
+	if path := os.Getenv("REGISTRY_AUTH_FILE"); path != "" {
+		paths = append(paths, path)
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "containers", "auth.json"))
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "containers", "auth.json"))
+	} else if home != "" {
+		paths = append(paths, filepath.Join(home, ".config", "containers", "auth.json"))
+	}
+
+	return paths
+}
+
+// readDockerConfig reads the docker configuration file at path, an empty
+// configuration is returned if the file doesn't exist.
+func readDockerConfig(path string) (*dockerConfig, error) {
+	c := new(dockerConfig)
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("while decoding %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// registryHost returns the host part of the registry reference s, which
+// may be a bare host or an URL. Docker Hub aliases are normalized to
+// docker.io.
+func registryHost(s string) string {
+	if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+3:]
+	}
+	if i := strings.Index(s, "/"); i >= 0 {
+		s = s[:i]
+	}
+
+	switch s {
+	case "index.docker.io", "registry-1.docker.io":
+		return dockerHubHost
+	}
+	return s
+}
+
+// helperServerURL returns the server URL identifying the credentials of the
+// registry host in credential helpers.
+func helperServerURL(host string) string {
+	if host == dockerHubHost {
+		return dockerHubServerURL
+	}
+	return host
+}
+
+// hostHelper returns the name of the credential helper configured for host
+// in the credHelpers section, or an empty string if there is none.
+func (c *dockerConfig) hostHelper(host string) string {
+	for server, name := range c.CredHelpers {
+		if registryHost(server) == host {
+			return name
+		}
+	}
+	return ""
+}
+
+// helper returns the name of the credential helper configured for host,
+// or an empty string if credentials are stored in the file.
+func (c *dockerConfig) helper(host string) string {
+	if name := c.hostHelper(host); name != "" {
+		return name
+	}
+	return c.CredsStore
+}
+
+// auth returns the credentials stored in the file for host.
+func (c *dockerConfig) auth(host string) (*ocitypes.DockerAuthConfig, error) {
+	for server, a := range c.Auths {
+		if registryHost(server) != host {
+			continue
+		}
+
+		ac := &ocitypes.DockerAuthConfig{
+			Username:      a.Username,
+			Password:      a.Password,
+			IdentityToken: a.IdentityToken,
+		}
+		if a.Auth != "" {
+			b, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("while decoding credentials of %s: %w", server, err)
+			}
+			parts := strings.SplitN(string(b), ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("malformed credentials for %s", server)
+			}
+			ac.Username, ac.Password = parts[0], parts[1]
+		}
+		return ac, nil
+	}
+	return nil, nil
+}
+
+// credentials returns the credentials of host held by the configuration,
+// either stored in the file or by a credential helper, or nil if none
+// are found.
+func (c *dockerConfig) credentials(host string) (*ocitypes.DockerAuthConfig, error) {
+	// registry specific helpers take precedence over the file
+	if c.hostHelper(host) == "" {
+		ac, err := c.auth(host)
+		if ac != nil || err != nil {
+			return ac, err
+		}
+	}
+
+	name := c.helper(host)
+	if name == "" {
+		return nil, nil
+	}
+
+	hc, err := helperGet(name, helperServerURL(host))
+	if errors.Is(err, ErrCredentialsNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if hc.Username == helperTokenUsername {
+		return &ocitypes.DockerAuthConfig{IdentityToken: hc.Secret}, nil
+	}
+	return &ocitypes.DockerAuthConfig{Username: hc.Username, Password: hc.Secret}, nil
+}
+
+// RegistryCredentials returns the credentials for the registry host found
+// in the configuration files returned by DockerConfigPaths, or nil if none
+// are found. Credentials are either stored in the files, or by the docker
+// credential helpers set with credsStore and credHelpers. Files and helpers
+// which can't be read are skipped with a warning.
+func RegistryCredentials(host string) *ocitypes.DockerAuthConfig {
+	host = registryHost(host)
+
+	for _, path := range DockerConfigPaths() {
+		c, err := readDockerConfig(path)
+		if err != nil {
+			sylog.Warningf("Couldn't read %s: %s", path, err)
+			continue
+		}
+
+		ac, err := c.credentials(host)
+		if err != nil {
+			// a missing or broken helper must not prevent anonymous access
+			sylog.Warningf("Couldn't get credentials for %s from %s: %s", host, path, err)
+			continue
+		}
+		if ac != nil {
+			sylog.Debugf("Using credentials for %s from %s", host, path)
+			return ac
+		}
+	}
+	return nil
+}
+
+// ResolverCredentials returns a credentials function for containerd docker
+// resolvers, returning the credentials ac when set, or those found by
+// RegistryCredentials for the registry host otherwise.
+func ResolverCredentials(ac *ocitypes.DockerAuthConfig) func(string) (string, string, error) {
+	return func(host string) (string, string, error) {
+		if ac != nil && (ac.Username != "" || ac.Password != "") {
+			return ac.Username, ac.Password, nil
+		}
+
+		// fall back to the docker configuration files and credential helpers
+		if rc := RegistryCredentials(host); rc != nil {
+			if rc.IdentityToken != "" {
+				return "", rc.IdentityToken, nil
+			}
+			return rc.Username, rc.Password, nil
+		}
+
+		return "", "", nil
+	}
+}
+
+// credentialHelper returns the name of the first credential helper
+// configured for host in the configuration files returned by
+// DockerConfigPaths, or an empty string if none is configured. Unreadable
+// configuration files are skipped so credentials fall back to being stored
+// in the configuration files.
+func credentialHelper(host string) string {
+	host = registryHost(host)
+
+	for _, path := range DockerConfigPaths() {
+		c, err := readDockerConfig(path)
+		if err != nil {
+			sylog.Warningf("Couldn't read %s: %s", path, err)
+			continue
+		}
+
+		if name := c.helper(host); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// setHostHelper records in the docker configuration file at path that the
+// credentials of server are held by the credential helper name, other
+// settings of the file are preserved.
+func setHostHelper(path, server, name string) error {
+	raw := make(map[string]json.RawMessage)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err == nil {
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return fmt.Errorf("while decoding %s: %w", path, err)
+		}
+	}
+
+	helpers := make(map[string]string)
+	if h, ok := raw["credHelpers"]; ok {
+		if err := json.Unmarshal(h, &helpers); err != nil {
+			return fmt.Errorf("while decoding %s: %w", path, err)
+		}
+	}
+	if helpers[server] == name {
+		return nil
+	}
+	helpers[server] = name
+
+	if raw["credHelpers"], err = json.Marshal(helpers); err != nil {
+		return err
+	}
+	if b, err = json.MarshalIndent(raw, "", "\t"); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0o600)
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package credential
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ocitypes "github.com/containers/image/v5/types"
+)
+
+// fakeHelper is a docker credential helper storing credentials as files
+// in the directory holding the helper.
+const fakeHelper = `#!/bin/sh
+store="$(dirname "$0")/store"
+mkdir -p "$store"
+key() { printf '%s' "$1" | tr -c 'a-zA-Z0-9' '_'; }
+case "$1" in
+get)
+	read -r server
+	f="$store/$(key "$server")"
+	if [ ! -f "$f" ]; then
+		echo "credentials not found in native keychain"
+		exit 1
+	fi
+	cat "$f"
+	;;
+store)
+	input=$(cat)
+	server=$(printf '%s' "$input" | sed 's/.*"ServerURL":"\([^"]*\)".*/\1/')
+	printf '%s' "$input" > "$store/$(key "$server")"
+	;;
+erase)
+	read -r server
+	rm -f "$store/$(key "$server")"
+	;;
+*)
+	echo "unknown action $1"
+	exit 1
+	;;
+esac
+`
+
+// setupFakeHelper installs the docker-credential-fake helper in a
+// temporary directory added to PATH, and returns a function restoring the
+// environment.
+func setupFakeHelper(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "credential-helper-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, helperPrefix+"fake"), []byte(fakeHelper), 0o755); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHelper(t *testing.T) {
+	defer setupFakeHelper(t)()
+
+	if _, err := helperGet("fake", "registry.example.com"); err != ErrCredentialsNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrCredentialsNotFound)
+	}
+
+	want := &helperCredentials{ServerURL: "registry.example.com", Username: "user", Secret: "secret"}
+	if err := helperStore("fake", want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := helperGet("fake", "registry.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got credentials %+v, want %+v", got, want)
+	}
+
+	if err := helperErase("fake", "registry.example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := helperGet("fake", "registry.example.com"); err != ErrCredentialsNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrCredentialsNotFound)
+	}
+
+	if _, err := helperGet("missing", "registry.example.com"); err == nil {
+		t.Fatalf("unexpected success with a missing helper")
+	}
+}
+
+func TestDockerConfigCredentials(t *testing.T) {
+	defer setupFakeHelper(t)()
+
+	for _, c := range []*helperCredentials{
+		{ServerURL: "helper.example.com", Username: "helper", Secret: "secret"},
+		{ServerURL: "store.example.com", Username: "store", Secret: "secret"},
+		{ServerURL: dockerHubServerURL, Username: helperTokenUsername, Secret: "token"},
+	} {
+		if err := helperStore("fake", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &dockerConfig{
+		Auths: map[string]dockerAuth{
+			"https://file.example.com": {Auth: base64.StdEncoding.EncodeToString([]byte("file:secret"))},
+			"helper.example.com":       {Auth: base64.StdEncoding.EncodeToString([]byte("ignored:secret"))},
+		},
+		CredHelpers: map[string]string{
+			"helper.example.com": "fake",
+		},
+		CredsStore: "fake",
+	}
+
+	tests := []struct {
+		name string
+		host string
+		want *ocitypes.DockerAuthConfig
+	}{
+		{"File", "file.example.com", &ocitypes.DockerAuthConfig{Username: "file", Password: "secret"}},
+		{"CredHelpers", "helper.example.com", &ocitypes.DockerAuthConfig{Username: "helper", Password: "secret"}},
+		{"CredsStore", "store.example.com", &ocitypes.DockerAuthConfig{Username: "store", Password: "secret"}},
+		{"IdentityToken", "docker.io", &ocitypes.DockerAuthConfig{IdentityToken: "token"}},
+		{"NotFound", "other.example.com", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.credentials(tt.host)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got credentials %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	defer setupFakeHelper(t)()
+
+	dir, err := ioutil.TempDir("", "docker-config-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dockerConfig := `{"credHelpers": {"registry.example.test": "fake"}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(dockerConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	authFile := filepath.Join(dir, "auth.json")
+	auth := `{"auths": {"auth.example.test": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("user:pass")) + `"}}}`
+	if err := ioutil.WriteFile(authFile, []byte(auth), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range []string{"DOCKER_CONFIG", "REGISTRY_AUTH_FILE"} {
+		defer os.Setenv(env, os.Getenv(env))
+	}
+	os.Setenv("DOCKER_CONFIG", dir)
+	os.Setenv("REGISTRY_AUTH_FILE", authFile)
+
+	hc := &helperCredentials{ServerURL: "registry.example.test", Username: "helper", Secret: "secret"}
+	if err := helperStore("fake", hc); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := RegistryCredentials("registry.example.test"), (&ocitypes.DockerAuthConfig{Username: "helper", Password: "secret"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got credentials %+v, want %+v", got, want)
+	}
+	if got, want := RegistryCredentials("auth.example.test"), (&ocitypes.DockerAuthConfig{Username: "user", Password: "pass"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got credentials %+v, want %+v", got, want)
+	}
+	if got := RegistryCredentials("none.example.test"); got != nil {
+		t.Errorf("got credentials %+v, want none", got)
+	}
+
+	// login records the helper of a registry without storing any secret
+	if err := setHostHelper(filepath.Join(dir, "singularity.json"), "login.example.test", "fake"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c, err := readDockerConfig(filepath.Join(dir, "singularity.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.helper("login.example.test"); got != "fake" {
+		t.Errorf("got helper %q, want %q", got, "fake")
+	}
+
+	// unreadable configuration files are skipped
+	if err := ioutil.WriteFile(authFile, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := credentialHelper("registry.example.test"); got != "fake" {
+		t.Errorf("got helper %q, want %q", got, "fake")
+	}
+	if got := credentialHelper("none.example.test"); got != "" {
+		t.Errorf("got helper %q, want none", got)
+	}
+}
+
+func TestConfigAuthorization(t *testing.T) {
+	defer setupFakeHelper(t)()
+
+	uri := "https://keys.example.com"
+	if err := helperStore("fake", &helperCredentials{ServerURL: uri, Username: helperTokenUsername, Secret: "token"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{URI: uri, Helper: "fake"}
+	auth, err := c.Authorization()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := TokenPrefix + "token"; auth != want {
+		t.Errorf("got authorization %q, want %q", auth, want)
+	}
+
+	if err := c.Erase(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.Authorization(); err != ErrCredentialsNotFound {
+		t.Errorf("got error %v, want %v", err, ErrCredentialsNotFound)
+	}
+	// erasing twice is harmless
+	if err := c.Erase(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
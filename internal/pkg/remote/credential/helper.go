@@ -0,0 +1,93 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package credential
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// helperPrefix is the prefix of the docker credential helper binaries,
+// a helper named "pass" is implemented by docker-credential-pass.
+const helperPrefix = "docker-credential-"
+
+// helperTokenUsername is the username used by docker credential helpers
+// to store an identity token instead of a password.
+const helperTokenUsername = "<token>"
+
+// errHelperNotFound is the message returned by docker credential helpers
+// when no credentials are stored for a server.
+const errHelperNotFound = "credentials not found in native keychain"
+
+// ErrCredentialsNotFound is returned when a credential helper doesn't
+// hold credentials for a server.
+var ErrCredentialsNotFound = errors.New("credentials not found")
+
+// helperCredentials are the credentials exchanged with a docker credential
+// helper.
+type helperCredentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// execHelper runs the action of the docker credential helper name with
+// input written to its standard input, and returns its standard output.
+func execHelper(name, action string, input []byte) ([]byte, error) {
+	var stdout bytes.Buffer
+
+	cmd := exec.Command(helperPrefix+name, action)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+
+	if err := cmd.Run(); err != nil {
+		out := strings.TrimSpace(stdout.String())
+		if out == errHelperNotFound {
+			return nil, ErrCredentialsNotFound
+		}
+		if out != "" {
+			return nil, fmt.Errorf("credential helper %s: %s", name, out)
+		}
+		return nil, fmt.Errorf("credential helper %s: %w", name, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// helperGet returns the credentials stored for serverURL by the docker
+// credential helper name.
+func helperGet(name, serverURL string) (*helperCredentials, error) {
+	out, err := execHelper(name, "get", []byte(serverURL))
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(helperCredentials)
+	if err := json.Unmarshal(out, c); err != nil {
+		return nil, fmt.Errorf("credential helper %s: while decoding credentials: %w", name, err)
+	}
+	return c, nil
+}
+
+// helperStore stores c with the docker credential helper name.
+func helperStore(name string, c *helperCredentials) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	_, err = execHelper(name, "store", b)
+	return err
+}
+
+// helperErase removes the credentials stored for serverURL by the docker
+// credential helper name.
+func helperErase(name, serverURL string) error {
+	_, err := execHelper(name, "erase", []byte(serverURL))
+	return err
+}
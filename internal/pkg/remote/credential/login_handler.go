@@ -68,11 +68,26 @@ func (h *ociHandler) login(u *url.URL, username, password string, insecure bool)
 	if err != nil {
 		return nil, err
 	}
+
+	// When a credential helper is configured for the registry, record it in
+	// the singularity docker configuration so credentials are stored by the
+	// helper instead of the configuration file.
+	hostname := u.Host + u.Path
+	if helper := credentialHelper(hostname); helper != "" {
+		server := hostname
+		if registryHost(server) == dockerHubHost {
+			server = dockerHubServerURL
+		}
+		if err := setHostHelper(syfs.DockerConf(), server, helper); err != nil {
+			return nil, fmt.Errorf("while configuring credential helper %s: %s", helper, err)
+		}
+	}
+
 	cli, err := auth.NewClient(syfs.DockerConf())
 	if err != nil {
 		return nil, err
 	}
-	if err := cli.Login(context.TODO(), u.Host+u.Path, username, pass, insecure); err != nil {
+	if err := cli.Login(context.TODO(), hostname, username, pass, insecure); err != nil {
 		return nil, err
 	}
 	return &Config{
@@ -134,6 +149,23 @@ func (h *keyserverHandler) login(u *url.URL, username, password string, insecure
 		return nil, fmt.Errorf("error response from server: %s", resp.Status)
 	}
 
+	// Store credentials with the credential helper configured for the
+	// keyserver, if any, rather than in the remote configuration.
+	if helper := credentialHelper(u.Host); helper != "" {
+		hc := &helperCredentials{ServerURL: u.String(), Username: username, Secret: pass}
+		if username == "" {
+			hc.Username = helperTokenUsername
+		}
+		if err := helperStore(helper, hc); err != nil {
+			return nil, err
+		}
+		return &Config{
+			URI:      u.String(),
+			Helper:   helper,
+			Insecure: insecure,
+		}, nil
+	}
+
 	return &Config{
 		URI:      u.String(),
 		Auth:     auth,
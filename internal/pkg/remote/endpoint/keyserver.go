@@ -142,10 +142,24 @@ func (ep *Config) UpdateKeyserversConfig() error {
 		} else {
 			// attempt to find credentials in the credential store
 			for _, cred := range ep.credentials {
-				if remoteutil.SameKeyserver(cred.URI, kc.URI) {
-					kc.credential = cred
-					break
+				if !remoteutil.SameKeyserver(cred.URI, kc.URI) {
+					continue
 				}
+				kc.credential = cred
+				if cred.Helper != "" {
+					// don't keep the secret in the credential store
+					auth, err := cred.Authorization()
+					if err != nil {
+						sylog.Warningf("Couldn't get credentials for %s from credential helper %s: %s", cred.URI, cred.Helper, err)
+						break
+					}
+					kc.credential = &credential.Config{
+						URI:      cred.URI,
+						Auth:     auth,
+						Insecure: cred.Insecure,
+					}
+				}
+				break
 			}
 		}
 	}
@@ -268,6 +268,9 @@ func (c *Config) Logout(uri string) error {
 	}
 	for i, cred := range c.Credentials {
 		if remoteutil.SameURI(cred.URI, uri) {
+			if err := cred.Erase(); err != nil {
+				return fmt.Errorf("while removing credentials from credential helper %s: %s", cred.Helper, err)
+			}
 			c.Credentials = append(c.Credentials[:i], c.Credentials[i+1:]...)
 			return nil
 		}
@@ -276,6 +276,14 @@ func (g *Generator) SetProcessApparmorProfile(prof string) {
 	g.Config.Process.ApparmorProfile = prof
 }
 
+// AddAnnotation adds or replaces the annotation key with value.
+func (g *Generator) AddAnnotation(key, value string) {
+	if g.Config.Annotations == nil {
+		g.Config.Annotations = make(map[string]string)
+	}
+	g.Config.Annotations[key] = value
+}
+
 // Save writes the configuration into w.
 func (g *Generator) Save(w io.Writer) (err error) {
 	var data []byte
@@ -61,6 +61,11 @@ func TestGenerate(t *testing.T) {
 		t.Fatalf("wrong OCI process selinux label: %v instead of %v", config.Process.SelinuxLabel, selinux)
 	}
 
+	g.AddAnnotation("key", "value")
+	if config.Annotations["key"] != "value" {
+		t.Fatalf("wrong OCI annotation: %q instead of %q", config.Annotations["key"], "value")
+	}
+
 	root := "/tmp"
 	g.SetRootPath(root)
 	if config.Root.Path != root {
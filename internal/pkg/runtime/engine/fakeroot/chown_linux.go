@@ -0,0 +1,130 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fakeroot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/security/seccomp"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// chownIgnoreTimeout is how long master waits for the processes still
+// using the chown filter once the build process exited.
+const chownIgnoreTimeout = time.Second
+
+// chownSyscalls are the file ownership changes ignored in single-ID mode.
+var chownSyscalls = []string{"chown", "chown32", "fchown", "fchown32", "fchownat", "lchown", "lchown32"}
+
+// chownIgnorer ignores and counts the file ownership changes of the build
+// process in single-ID mode, used by master process only.
+var chownIgnorer *seccomp.Ignorer
+
+// ignoresChown returns whether the file ownership changes of the build
+// process are ignored in single-ID mode, in which case the container
+// process hands over a listener to master.
+func (e *EngineOperations) ignoresChown() bool {
+	return e.EngineConfig.BuildEnv && e.EngineConfig.SingleID && seccomp.Enabled()
+}
+
+// announceStart is called from the container process to let master call
+// PreStartProcess.
+func announceStart(masterConnFd int) error {
+	if _, err := unix.Write(masterConnFd, []byte("c")); err != nil {
+		return fmt.Errorf("while sending data to master: %s", err)
+	}
+	return nil
+}
+
+// startChownIgnore is called from the container process right before the
+// execution of the build process in single-ID mode. It loads a filter
+// notifying a listener of the chown system calls, and hands the listener
+// over to master which ignores and counts them. If the filter can't be
+// loaded, master is told so and an error is returned, the chown system
+// calls must then be ignored by the seccomp profile. The filter applies to
+// the calling thread only, so the OS thread stays locked to execute the
+// build process.
+func startChownIgnore(masterConnFd int) error {
+	runtime.LockOSThread()
+
+	fd, err := seccomp.LoadIgnoreFilter(chownSyscalls)
+	if err != nil {
+		// a message without listener
+		if _, err := unix.Write(masterConnFd, []byte("c")); err != nil {
+			return fmt.Errorf("while sending data to master: %s", err)
+		}
+		return err
+	}
+	// notified system calls fail once the last listener is closed, so
+	// failing to hand it over is fatal
+	if err := unix.Sendmsg(masterConnFd, []byte("i"), unix.UnixRights(fd), nil, 0); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("while sending chown listener to master: %s", err)
+	}
+	return unix.Close(fd)
+}
+
+// PreStartProcess is called from master before the execution of the
+// container process. In single-ID mode, it receives the listener handed
+// over by the container process and starts ignoring the file ownership
+// changes of the build process.
+//
+// No additional privileges are gained during this call.
+func (e *EngineOperations) PreStartProcess(ctx context.Context, pid int, masterConn net.Conn, fatalChan chan error) error {
+	if !e.ignoresChown() {
+		return nil
+	}
+
+	conn, ok := masterConn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("master connection is not a unix socket")
+	}
+
+	data := make([]byte, 1)
+	oob := make([]byte, unix.CmsgSpace(4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(data, oob)
+	if err == io.EOF || (err == nil && oobn == 0) {
+		// the container process failed before handing over the
+		// listener, or ignores the chown system calls with its
+		// seccomp profile
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("while receiving chown listener: %s", err)
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		return fmt.Errorf("bad chown listener control message: %v", err)
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		return fmt.Errorf("bad chown listener control message: %v", err)
+	}
+
+	sylog.Debugf("Ignoring file ownership changes of build process")
+	chownIgnorer = seccomp.NewIgnorer(fds[0])
+	return nil
+}
+
+// reportIgnoredChown is called from master once the container process
+// exited, and reports the number of ignored file ownership changes.
+func reportIgnoredChown() {
+	if chownIgnorer == nil {
+		return
+	}
+	if err := chownIgnorer.Stop(chownIgnoreTimeout); err != nil {
+		sylog.Warningf("While ignoring file ownership changes: %s", err)
+	}
+	if n := chownIgnorer.Count(); n > 0 {
+		sylog.Warningf("%d file ownership changes were ignored in single-ID fakeroot mode, files are owned by root in the image", n)
+	}
+}
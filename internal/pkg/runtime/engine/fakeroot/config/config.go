@@ -1,4 +1,4 @@
-// Copyright (c) 2019, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -15,4 +15,5 @@ type EngineConfig struct {
 	Envs     []string `json:"envs"`
 	Home     string   `json:"home"`
 	BuildEnv bool     `json:"buildEnv"`
+	SingleID bool     `json:"singleID"`
 }
@@ -1,4 +1,4 @@
-// Copyright (c) 2019-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2019-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -77,20 +77,8 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		return fmt.Errorf("unable to parse singularity.conf file: %s", err)
 	}
 
-	if starterConfig.GetIsSUID() {
-		if !fileConfig.AllowSetuid {
-			return fmt.Errorf("fakeroot requires to set 'allow setuid = yes' in %s", configurationFile)
-		}
-	} else {
-		sylog.Verbosef("Fakeroot requested with unprivileged workflow, fallback to newuidmap/newgidmap")
-		sylog.Debugf("Search for newuidmap binary")
-		if err := starterConfig.SetNewUIDMapPath(); err != nil {
-			return err
-		}
-		sylog.Debugf("Search for newgidmap binary")
-		if err := starterConfig.SetNewGIDMapPath(); err != nil {
-			return err
-		}
+	if starterConfig.GetIsSUID() && !fileConfig.AllowSetuid {
+		return fmt.Errorf("fakeroot requires to set 'allow setuid = yes' in %s", configurationFile)
 	}
 
 	g.AddOrReplaceLinuxNamespace(specs.UserNamespace, "")
@@ -113,25 +101,43 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		getIDRange = callbacks[0].(fakerootcallback.UserMapping)
 	}
 
-	g.AddLinuxUIDMapping(uid, 0, 1)
-	idRange, err := getIDRange(fakerootutil.SubUIDFile, uid)
+	uidMappings, gidMappings, singleID, err := fakerootutil.GetIDMappings(getIDRange, uid, gid, fileConfig.AllowFakerootSingleID)
 	if err != nil {
 		return fmt.Errorf("could not use fakeroot: %s", err)
 	}
-	g.AddLinuxUIDMapping(idRange.HostID, idRange.ContainerID, idRange.Size)
-	starterConfig.AddUIDMappings(g.Config.Linux.UIDMappings)
+	e.EngineConfig.SingleID = singleID
+
+	if singleID {
+		sylog.Infof("No fakeroot mapping found for the user, using single-ID mode: only the user is mapped to root and file ownership changes are ignored")
+		// the mappings of the user only can be written without
+		// newuidmap/newgidmap as long as setgroups is denied
+		starterConfig.SetHybridWorkflow(starterConfig.GetIsSUID())
+		starterConfig.SetAllowSetgroups(false)
+	} else {
+		if !starterConfig.GetIsSUID() {
+			sylog.Verbosef("Fakeroot requested with unprivileged workflow, fallback to newuidmap/newgidmap")
+			sylog.Debugf("Search for newuidmap binary")
+			if err := starterConfig.SetNewUIDMapPath(); err != nil {
+				return err
+			}
+			sylog.Debugf("Search for newgidmap binary")
+			if err := starterConfig.SetNewGIDMapPath(); err != nil {
+				return err
+			}
+		}
+		starterConfig.SetHybridWorkflow(true)
+		starterConfig.SetAllowSetgroups(true)
+	}
 
-	g.AddLinuxGIDMapping(gid, 0, 1)
-	idRange, err = getIDRange(fakerootutil.SubGIDFile, uid)
-	if err != nil {
-		return fmt.Errorf("could not use fakeroot: %s", err)
+	for _, m := range uidMappings {
+		g.AddLinuxUIDMapping(m.HostID, m.ContainerID, m.Size)
+	}
+	starterConfig.AddUIDMappings(g.Config.Linux.UIDMappings)
+	for _, m := range gidMappings {
+		g.AddLinuxGIDMapping(m.HostID, m.ContainerID, m.Size)
 	}
-	g.AddLinuxGIDMapping(idRange.HostID, idRange.ContainerID, idRange.Size)
 	starterConfig.AddGIDMappings(g.Config.Linux.GIDMappings)
 
-	starterConfig.SetHybridWorkflow(true)
-	starterConfig.SetAllowSetgroups(true)
-
 	starterConfig.SetTargetUID(0)
 	starterConfig.SetTargetGID([]int{0})
 
@@ -157,14 +163,23 @@ func (e *EngineOperations) CreateContainer(context.Context, int, net.Conn) error
 
 // fakerootSeccompProfile returns a seccomp filter allowing to
 // set the return value to 0 for mknod and mknodat syscalls. It
-// allows build bootstrap like yum to work with fakeroot.
-func fakerootSeccompProfile() *specs.LinuxSeccomp {
+// allows build bootstrap like yum to work with fakeroot. In single-ID
+// mode, file ownership changes to unmapped IDs would fail, so if they
+// can't be ignored and counted by master, ignoreChown makes chown
+// syscalls also return 0 without changing anything.
+func fakerootSeccompProfile(ignoreChown bool) *specs.LinuxSeccomp {
 	syscalls := []specs.LinuxSyscall{
 		{
 			Names:  []string{"mknod", "mknodat"},
 			Action: specs.ActErrno,
 		},
 	}
+	if ignoreChown {
+		syscalls = append(syscalls, specs.LinuxSyscall{
+			Names:  chownSyscalls,
+			Action: specs.ActErrno,
+		})
+	}
 	return &specs.LinuxSeccomp{
 		DefaultAction: specs.ActAllow,
 		Syscalls:      syscalls,
@@ -193,6 +208,10 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 	}
 	env := e.EngineConfig.Envs
 
+	if err := announceStart(masterConnFd); err != nil {
+		return err
+	}
+
 	// simple command execution
 	if !e.EngineConfig.BuildEnv {
 		return syscall.Exec(args[0], args, env)
@@ -234,7 +253,14 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 	}
 
 	if seccomp.Enabled() {
-		if err := seccomp.LoadSeccompConfig(fakerootSeccompProfile(), false, 0); err != nil {
+		ignoreChown := false
+		if e.ignoresChown() {
+			if err := startChownIgnore(masterConnFd); err != nil {
+				sylog.Debugf("File ownership changes won't be counted: %s", err)
+				ignoreChown = true
+			}
+		}
+		if err := seccomp.LoadSeccompConfig(fakerootSeccompProfile(ignoreChown), false, 0); err != nil {
 			sylog.Warningf("Could not apply seccomp filter, some bootstrap may not work correctly")
 		}
 	} else {
@@ -278,8 +304,10 @@ func (e *EngineOperations) MonitorContainer(pid int, signals chan os.Signal) (sy
 	}
 }
 
-// CleanupContainer does nothing for the fakeroot engine.
+// CleanupContainer reports the file ownership changes ignored in single-ID
+// mode.
 func (e *EngineOperations) CleanupContainer(context.Context, error, syscall.WaitStatus) error {
+	reportIgnoredChown()
 	return nil
 }
 
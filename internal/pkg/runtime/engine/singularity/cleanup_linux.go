@@ -18,6 +18,7 @@ import (
 	fakerootConfig "github.com/hpcng/singularity/internal/pkg/runtime/engine/fakeroot/config"
 	"github.com/hpcng/singularity/internal/pkg/util/priv"
 	"github.com/hpcng/singularity/internal/pkg/util/starter"
+	"github.com/hpcng/singularity/pkg/network"
 	"github.com/hpcng/singularity/pkg/runtime/engine/config"
 	"github.com/hpcng/singularity/pkg/sylog"
 	"github.com/hpcng/singularity/pkg/util/capabilities"
@@ -41,6 +42,10 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 	// fakeroot workflow
 	e.stopFuseDrivers()
 
+	if seccompRecorder != nil {
+		e.writeSeccompProfile()
+	}
+
 	if imageDriver != nil {
 		if err := umount(); err != nil {
 			sylog.Errorf("%s", err)
@@ -79,6 +84,9 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 			priv.Escalate()
 			privileged = true
 		}
+		if err := removeManagedHost(); err != nil {
+			sylog.Errorf("could not remove instance from network: %v", err)
+		}
 		sylog.Debugf("Cleaning up CNI network config %s", net)
 		if err := networkSetup.DelNetworks(ctx); err != nil {
 			sylog.Errorf("could not delete networks: %v", err)
@@ -88,6 +96,13 @@ func (e *EngineOperations) CleanupContainer(ctx context.Context, fatal error, st
 		}
 	}
 
+	if slirpNetwork != nil {
+		sylog.Debugf("Stopping %s network", network.SlirpNetwork)
+		if err := slirpNetwork.Stop(); err != nil {
+			sylog.Errorf("could not stop %s network: %v", network.SlirpNetwork, err)
+		}
+	}
+
 	if cgroupManager != nil {
 		if err := cgroupManager.Remove(); err != nil {
 			sylog.Errorf("could not remove cgroups: %v", err)
@@ -276,13 +276,8 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 	}
 
 	if os.Geteuid() == 0 && !c.userNS {
-		path := engine.EngineConfig.GetCgroupsPath()
-		if path != "" {
-			cgroupPath := filepath.Join("/singularity", strconv.Itoa(pid))
-			cgroupManager = &cgroups.Manager{Pid: pid, Path: cgroupPath}
-			if err := cgroupManager.ApplyFromFile(path); err != nil {
-				return fmt.Errorf("failed to apply cgroups resources restriction: %s", err)
-			}
+		if err := c.applyCgroups(pid); err != nil {
+			return err
 		}
 	}
 
@@ -299,6 +294,46 @@ func create(ctx context.Context, engine *EngineOperations, rpcOps *client.RPC, p
 	return nil
 }
 
+// applyCgroups applies the cgroups resources restriction of the cgroups
+// configuration file, if any, along with the network class identifier and
+// interface priorities requested with the network arguments.
+func (c *container) applyCgroups(pid int) error {
+	var spec specs.LinuxResources
+
+	path := c.engine.EngineConfig.GetCgroupsPath()
+	if path != "" {
+		s, err := cgroups.ReadSpecFromFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to apply cgroups resources restriction: %s", err)
+		}
+		spec = s
+	}
+
+	var netResources *specs.LinuxNetwork
+	if networkSetup != nil {
+		netResources = networkSetup.NetworkResources()
+	}
+	if netResources != nil {
+		// network arguments take precedence over the configuration file
+		if spec.Network == nil {
+			spec.Network = &specs.LinuxNetwork{}
+		}
+		if netResources.ClassID != nil {
+			spec.Network.ClassID = netResources.ClassID
+		}
+		spec.Network.Priorities = append(spec.Network.Priorities, netResources.Priorities...)
+	} else if path == "" {
+		return nil
+	}
+
+	cgroupPath := filepath.Join("/singularity", strconv.Itoa(pid))
+	cgroupManager = &cgroups.Manager{Pid: pid, Path: cgroupPath}
+	if err := cgroupManager.ApplyFromSpec(&spec); err != nil {
+		return fmt.Errorf("failed to apply cgroups resources restriction: %s", err)
+	}
+	return nil
+}
+
 // setupSessionLayout will create the session layout according to the capabilities of Singularity
 // on the system. It will first attempt to use "overlay", followed by "underlay", and if neither
 // are available it will not use either. If neither are used, we will not be able to bind mount
@@ -2168,6 +2203,12 @@ func (c *container) addResolvConfMount(system *mount.System) error {
 
 		dns := c.engine.EngineConfig.GetDNS()
 
+		// host resolvers are reachable through the slirp network DNS
+		// server only
+		if dns == "" && c.netNS && c.engine.EngineConfig.GetNetwork() == network.SlirpNetwork {
+			dns = network.SlirpDNS
+		}
+
 		if dns == "" {
 			r, err := os.Open(resolvConf)
 			if err != nil {
@@ -2251,6 +2292,11 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 		return nil, nil
 	}
 
+	// user-mode network doesn't require any privileges
+	if net == network.SlirpNetwork {
+		return c.prepareSlirpNetwork(pid)
+	}
+
 	// Otherwise start checking what's permitted for the current user
 	euid := os.Geteuid()
 	allowedNetUnpriv := false
@@ -2312,6 +2358,11 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 		cniPath.Plugin = defaultCNIPluginPath
 	}
 
+	managed, err := c.addManagedHostsMount(system, cniPath.Conf, networks)
+	if err != nil {
+		return nil, err
+	}
+
 	setup, err := network.NewSetup(networks, strconv.Itoa(pid), nspath, cniPath)
 	if err != nil {
 		return nil, fmt.Errorf("network setup failed: %s", err)
@@ -2323,6 +2374,23 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 		return nil, fmt.Errorf("error while setting network arguments: %s", err)
 	}
 
+	if networkSetup.NetworkResources() != nil && (euid != 0 || c.userNS) {
+		return nil, fmt.Errorf("classid and priority network arguments require root without user namespace")
+	}
+
+	if euid != 0 {
+		limit, err := netBandwidthLimit(c.engine.EngineConfig.File.NetBandwidthLimits, euid)
+		if err != nil {
+			return nil, err
+		}
+		if limit > 0 {
+			sylog.Debugf("Limiting network bandwidth to %d bits per second", limit)
+			if err := networkSetup.SetBandwidthLimit(limit); err != nil {
+				return nil, fmt.Errorf("could not limit network bandwidth: %s", err)
+			}
+		}
+	}
+
 	return func(ctx context.Context) error {
 		if fakeroot || allowedNetUnpriv {
 			// prevent port hijacking between user processes
@@ -2342,10 +2410,51 @@ func (c *container) prepareNetworkSetup(system *mount.System, pid int) (func(con
 		if err := networkSetup.AddNetworks(ctx); err != nil {
 			return fmt.Errorf("%s", err)
 		}
+		if managed != "" && c.engine.EngineConfig.GetInstance() {
+			return c.addManagedHost(managed)
+		}
 		return nil
 	}, nil
 }
 
+// netBandwidthLimit returns the lowest rate in bits per second of the
+// "net bandwidth limits" directive applying to the user uid, or zero if the
+// user has no limit.
+func netBandwidthLimit(limits []string, uid int) (uint64, error) {
+	var lowest uint64
+
+	for _, limit := range limits {
+		var match bool
+		var err error
+
+		fields := strings.Split(limit, ":")
+		switch {
+		case len(fields) == 2 && fields[0] == "all":
+			match = true
+		case len(fields) == 3 && fields[0] == "user":
+			match, err = user.UIDInList(uid, fields[1:2])
+		case len(fields) == 3 && fields[0] == "group":
+			match, err = user.UIDInAnyGroup(uid, fields[1:2])
+		default:
+			return 0, fmt.Errorf("bad net bandwidth limit %q, must be user:<name>:<rate>, group:<name>:<rate> or all:<rate>", limit)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("while checking net bandwidth limit %q: %s", limit, err)
+		} else if !match {
+			continue
+		}
+
+		rate, err := network.ParseRate(fields[len(fields)-1])
+		if err != nil {
+			return 0, fmt.Errorf("bad net bandwidth limit %q: %s", limit, err)
+		}
+		if lowest == 0 || rate < lowest {
+			lowest = rate
+		}
+	}
+	return lowest, nil
+}
+
 // getFuseFdFromRPC returns fuse file descriptors from RPC server based on
 // the file descriptor list provided in argument, it also returns an
 // additional file descriptor corresponding to /proc/self/ns/user.
@@ -0,0 +1,162 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/syecl"
+	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"github.com/hpcng/singularity/pkg/sypgp"
+	"github.com/hpcng/singularity/pkg/util/capabilities"
+)
+
+// imageCaps returns the capabilities granted by the capability
+// configuration to the SIF image img, based on the fingerprints of its
+// signers and on the ECL execgroup it belongs to.
+func imageCaps(capConfig *capabilities.Config, img *image.Image) ([]string, error) {
+	fingerprints, execgroups := capConfig.ListAllImageCaps()
+	if len(fingerprints) == 0 && len(execgroups) == 0 {
+		return nil, nil
+	}
+
+	ecl, err := syecl.LoadConfig(buildcfg.ECL_FILE)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("while loading ECL configuration: %s", err)
+	}
+
+	keyring := sypgp.NewHandle(buildcfg.SINGULARITY_CONFDIR, sypgp.GlobalHandleOpt())
+	kr, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, fmt.Errorf("while obtaining global keyring: %s", err)
+	}
+
+	db, err := keyring.LoadTrustDB()
+	if err != nil {
+		return nil, fmt.Errorf("while obtaining global trust database: %s", err)
+	}
+
+	var fps []string
+	if len(fingerprints) > 0 {
+		fps, err = syecl.SignedByFp(img.File, kr, db)
+		if err != nil {
+			sylog.Debugf("No capabilities granted by image signatures: %s", err)
+		}
+	}
+
+	tag := ""
+	if len(execgroups) > 0 && len(ecl.ExecGroups) > 0 {
+		tag, err = ecl.ExecGroupFp(img.File, kr, db)
+		if err != nil {
+			sylog.Debugf("No capabilities granted by ECL execgroup: %s", err)
+		}
+	}
+
+	return capConfig.ImageCaps(fps, tag), nil
+}
+
+// checkImageOwner returns an error if the image file img, or the directory
+// containing it, could be modified by users once verified: both must be
+// owned by root and not writable by group and others.
+func checkImageOwner(img *image.Image) error {
+	fi, err := img.File.Stat()
+	if err != nil {
+		return fmt.Errorf("while getting information of %s: %s", img.Path, err)
+	}
+	if err := checkRootOwned(img.Path, fi); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(img.Path)
+	fi, err = os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("while getting information of %s: %s", dir, err)
+	}
+	return checkRootOwned(dir, fi)
+}
+
+// checkRootOwned returns an error if the file path described by fi isn't
+// owned by root or is writable by group and others.
+func checkRootOwned(path string, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("could not get owner of %s", path)
+	}
+	if st.Uid != 0 {
+		return fmt.Errorf("%s is not owned by root", path)
+	}
+	if fi.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("%s is writable by group or others", path)
+	}
+	return nil
+}
+
+// prepareImageCaps adds the capabilities granted to the root filesystem
+// image img by the capability configuration to the capabilities of the
+// container process. Capabilities requested with --drop-caps are not
+// added. Images opened for writing, or files which could be modified by
+// users once verified, don't get any capability. Processes joining an
+// instance only get user and group capabilities as the instance image
+// can't be verified again.
+func (e *EngineOperations) prepareImageCaps(img *image.Image) error {
+	if img.Type != image.SIF || img.Writable {
+		return nil
+	}
+
+	file, err := os.OpenFile(buildcfg.CAPABILITY_FILE, os.O_RDONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("while opening capability config file: %s", err)
+	}
+	defer file.Close()
+
+	capConfig, err := capabilities.ReadFrom(file)
+	if err != nil {
+		return fmt.Errorf("while parsing capability config data: %s", err)
+	}
+
+	caps, err := imageCaps(capConfig, img)
+	if err != nil {
+		return err
+	} else if len(caps) == 0 {
+		return nil
+	}
+	if err := checkImageOwner(img); err != nil {
+		sylog.Warningf("Image capabilities %s not granted: %s", strings.Join(caps, ","), err)
+		return nil
+	}
+
+	dropCaps, _ := capabilities.Split(e.EngineConfig.GetDropCaps())
+	for _, cap := range dropCaps {
+		for i, c := range caps {
+			if c == cap {
+				caps = append(caps[:i], caps[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(caps) == 0 {
+		return nil
+	}
+	sylog.Debugf("Image capabilities %s added", strings.Join(caps, ","))
+
+	commonCaps := make([]string, 0, len(e.EngineConfig.OciConfig.Process.Capabilities.Permitted)+len(caps))
+	commonCaps = append(commonCaps, e.EngineConfig.OciConfig.Process.Capabilities.Permitted...)
+	commonCaps = capabilities.RemoveDuplicated(append(commonCaps, caps...))
+
+	e.EngineConfig.OciConfig.Process.Capabilities.Permitted = commonCaps
+	e.EngineConfig.OciConfig.Process.Capabilities.Effective = commonCaps
+	e.EngineConfig.OciConfig.Process.Capabilities.Inheritable = commonCaps
+	e.EngineConfig.OciConfig.Process.Capabilities.Bounding = commonCaps
+	e.EngineConfig.OciConfig.Process.Capabilities.Ambient = commonCaps
+
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"strings"
+
+	"github.com/hpcng/singularity/internal/pkg/security"
+	"github.com/hpcng/singularity/internal/pkg/security/landlock"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// prepareLandlock sets the Landlock rulesets enforced on the container
+// process: the rulesets of the instance joined if any, or the ruleset set
+// by the "landlock rules" directive unless root requests --keep-privs,
+// followed by the ruleset requested with --security landlock.
+func (e *EngineOperations) prepareLandlock(instanceRulesets string) error {
+	rulesets := make([]string, 0, 2)
+
+	if instanceRulesets != "" {
+		rulesets = append(rulesets, instanceRulesets)
+	} else if rules := e.EngineConfig.File.LandlockRules; rules != "" {
+		if e.rootKeepPrivs() {
+			sylog.Debugf("--keep-privs requested, no default landlock ruleset applied")
+		} else {
+			rulesets = append(rulesets, rules)
+		}
+	}
+	if param := security.GetParam(e.EngineConfig.GetSecurity(), "landlock"); param != "" {
+		rulesets = append(rulesets, param)
+	}
+	if len(rulesets) == 0 {
+		return nil
+	}
+
+	parsed, err := landlock.Rulesets(strings.Join(rulesets, "\n"))
+	if err != nil {
+		return err
+	}
+	value := make([]string, 0, len(parsed))
+	for _, r := range parsed {
+		sylog.Debugf("Applying landlock ruleset %s", r)
+		value = append(value, r.String())
+	}
+	e.EngineConfig.OciConfig.AddAnnotation(landlock.Annotation, strings.Join(value, "\n"))
+
+	return nil
+}
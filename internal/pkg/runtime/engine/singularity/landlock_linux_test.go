@@ -0,0 +1,38 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"testing"
+
+	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci/generate"
+	"github.com/hpcng/singularity/internal/pkg/security/landlock"
+	"github.com/hpcng/singularity/internal/pkg/test"
+	singularityConfig "github.com/hpcng/singularity/pkg/runtime/engine/singularity/config"
+)
+
+func TestPrepareLandlockKeepPrivs(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	e := &EngineOperations{EngineConfig: singularityConfig.NewConfig()}
+	e.EngineConfig.OciConfig.Generator = *generate.New(&e.EngineConfig.OciConfig.Spec)
+	e.EngineConfig.File.LandlockRules = "rw=/tmp:/var/tmp"
+	e.EngineConfig.SetKeepPrivs(true)
+
+	if err := e.prepareLandlock(""); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	value := e.EngineConfig.OciConfig.Annotations[landlock.Annotation]
+	rulesets, err := landlock.Rulesets(value)
+	if err != nil {
+		t.Fatalf("unexpected error parsing %q: %s", value, err)
+	}
+	if len(rulesets) != 1 {
+		t.Fatalf("default landlock ruleset not applied with --keep-privs as a user, got %q", value)
+	}
+}
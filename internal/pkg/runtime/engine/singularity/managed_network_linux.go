@@ -0,0 +1,86 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/util/fs/mount"
+	"github.com/hpcng/singularity/pkg/network"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// managedHost is the entry of the instance in the hosts file of its
+// managed network, used by master process only.
+var managedHost struct {
+	hostsFile string
+	ip        net.IP
+}
+
+// addManagedHostsMount binds the hosts file of the first managed network
+// among networks on /etc/hosts, so the container resolves the instances of
+// the network by name. It returns the name of this network, if any.
+func (c *container) addManagedHostsMount(system *mount.System, confDir string, networks []string) (string, error) {
+	const hostsPath = "/etc/hosts"
+
+	for _, name := range networks {
+		n, err := network.GetManagedNetwork(confDir, name)
+		if err != nil {
+			return "", err
+		} else if n == nil {
+			continue
+		}
+
+		hostsFile := network.ManagedHostsFile(buildcfg.NETWORK_STATEDIR, name)
+		if _, err := os.Stat(hostsFile); err != nil {
+			sylog.Warningf("Instances of network %s can't be resolved: %s", name, err)
+			return "", nil
+		}
+
+		flags := uintptr(syscall.MS_BIND | syscall.MS_NOSUID | syscall.MS_NODEV)
+		if err := system.Points.AddBind(mount.FilesTag, hostsFile, hostsPath, flags); err != nil {
+			return "", fmt.Errorf("unable to add %s to mount list: %s", hostsFile, err)
+		}
+		if err := system.Points.AddRemount(mount.FilesTag, hostsPath, flags|syscall.MS_RDONLY); err != nil {
+			return "", fmt.Errorf("unable to add %s for remount: %s", hostsPath, err)
+		}
+		return name, nil
+	}
+	return "", nil
+}
+
+// addManagedHost adds the instance to the hosts file of the managed network
+// name, with its address on this network. The entry is owned by the master
+// process, so it's dropped if master is killed before removing it.
+func (c *container) addManagedHost(name string) error {
+	ip, err := networkSetup.GetNetworkIP(name, "4")
+	if err != nil {
+		return err
+	}
+	hostsFile := network.ManagedHostsFile(buildcfg.NETWORK_STATEDIR, name)
+	instance := c.engine.CommonConfig.ContainerID
+
+	sylog.Debugf("Adding instance %s with address %s to network %s", instance, ip, name)
+	if err := network.AddHost(hostsFile, ip, instance, os.Getpid()); err != nil {
+		return fmt.Errorf("while adding instance %s to network %s: %s", instance, name, err)
+	}
+	managedHost.hostsFile = hostsFile
+	managedHost.ip = ip
+	return nil
+}
+
+// removeManagedHost removes the instance from the hosts file of its
+// managed network.
+func removeManagedHost() error {
+	if managedHost.hostsFile == "" {
+		return nil
+	}
+	return network.RemoveHost(managedHost.hostsFile, managedHost.ip)
+}
@@ -14,6 +14,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
@@ -25,6 +26,7 @@ import (
 	"github.com/hpcng/singularity/internal/pkg/plugin"
 	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/starter"
 	"github.com/hpcng/singularity/internal/pkg/security"
+	"github.com/hpcng/singularity/internal/pkg/security/landlock"
 	"github.com/hpcng/singularity/internal/pkg/security/seccomp"
 	"github.com/hpcng/singularity/internal/pkg/syecl"
 	"github.com/hpcng/singularity/internal/pkg/util/fs"
@@ -146,6 +148,14 @@ func (e *EngineOperations) PrepareConfig(starterConfig *starter.Config) error {
 		if err := e.loadImages(starterConfig); err != nil {
 			return err
 		}
+		if err := e.prepareSeccompProfile(&e.EngineConfig.GetImageList()[0]); err != nil {
+			return err
+		}
+		if os.Getuid() != 0 {
+			if err := e.prepareImageCaps(&e.EngineConfig.GetImageList()[0]); err != nil {
+				return err
+			}
+		}
 	}
 
 	starterConfig.SetMasterPropagateMount(true)
@@ -540,19 +550,6 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 	}
 
 	if e.EngineConfig.GetFakeroot() {
-		if !starterConfig.GetIsSUID() {
-			// no SUID workflow, check if newuidmap/newgidmap are present
-			sylog.Verbosef("Fakeroot requested with unprivileged workflow, fallback to newuidmap/newgidmap")
-			sylog.Debugf("Search for newuidmap binary")
-			if err := starterConfig.SetNewUIDMapPath(); err != nil {
-				return err
-			}
-			sylog.Debugf("Search for newgidmap binary")
-			if err := starterConfig.SetNewGIDMapPath(); err != nil {
-				return err
-			}
-		}
-
 		uid := uint32(os.Getuid())
 		gid := uint32(os.Getgid())
 
@@ -569,28 +566,46 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 			getIDRange = callbacks[0].(fakerootcallback.UserMapping)
 		}
 
-		e.EngineConfig.OciConfig.AddLinuxUIDMapping(uid, 0, 1)
-		idRange, err := getIDRange(fakerootutil.SubUIDFile, uid)
+		uidMappings, gidMappings, singleID, err := fakerootutil.GetIDMappings(getIDRange, uid, gid, e.EngineConfig.File.AllowFakerootSingleID)
 		if err != nil {
 			return fmt.Errorf("could not use fakeroot: %s", err)
 		}
-		e.EngineConfig.OciConfig.AddLinuxUIDMapping(idRange.HostID, idRange.ContainerID, idRange.Size)
-		starterConfig.AddUIDMappings(e.EngineConfig.OciConfig.Linux.UIDMappings)
+		if singleID {
+			sylog.Infof("No fakeroot mapping found for the user, using single-ID mode: only the user is mapped to root")
+			// the mappings of the user only can be written without
+			// newuidmap/newgidmap as long as setgroups is denied
+			starterConfig.SetHybridWorkflow(starterConfig.GetIsSUID())
+		} else {
+			if !starterConfig.GetIsSUID() {
+				// no SUID workflow, check if newuidmap/newgidmap are present
+				sylog.Verbosef("Fakeroot requested with unprivileged workflow, fallback to newuidmap/newgidmap")
+				sylog.Debugf("Search for newuidmap binary")
+				if err := starterConfig.SetNewUIDMapPath(); err != nil {
+					return err
+				}
+				sylog.Debugf("Search for newgidmap binary")
+				if err := starterConfig.SetNewGIDMapPath(); err != nil {
+					return err
+				}
+			}
+			starterConfig.SetHybridWorkflow(true)
+		}
 
-		e.EngineConfig.OciConfig.AddLinuxGIDMapping(gid, 0, 1)
-		idRange, err = getIDRange(fakerootutil.SubGIDFile, uid)
-		if err != nil {
-			return fmt.Errorf("could not use fakeroot: %s", err)
+		for _, m := range uidMappings {
+			e.EngineConfig.OciConfig.AddLinuxUIDMapping(m.HostID, m.ContainerID, m.Size)
+		}
+		starterConfig.AddUIDMappings(e.EngineConfig.OciConfig.Linux.UIDMappings)
+		for _, m := range gidMappings {
+			e.EngineConfig.OciConfig.AddLinuxGIDMapping(m.HostID, m.ContainerID, m.Size)
 		}
-		e.EngineConfig.OciConfig.AddLinuxGIDMapping(idRange.HostID, idRange.ContainerID, idRange.Size)
 		starterConfig.AddGIDMappings(e.EngineConfig.OciConfig.Linux.GIDMappings)
 
 		e.EngineConfig.OciConfig.SetupPrivileged(true)
 
 		e.EngineConfig.OciConfig.AddOrReplaceLinuxNamespace(specs.UserNamespace, "")
 
-		starterConfig.SetHybridWorkflow(true)
-		starterConfig.SetAllowSetgroups(true)
+		// setgroups must be denied when only the user group is mapped
+		starterConfig.SetAllowSetgroups(!singleID)
 
 		starterConfig.SetTargetUID(0)
 		starterConfig.SetTargetGID([]int{0})
@@ -622,13 +637,8 @@ func (e *EngineOperations) prepareContainerConfig(starterConfig *starter.Config)
 		sylog.Debugf("Applying Apparmor profile %s", param)
 		e.EngineConfig.OciConfig.SetProcessApparmorProfile(param)
 	}
-	param = security.GetParam(e.EngineConfig.GetSecurity(), "seccomp")
-	if param != "" {
-		sylog.Debugf("Applying seccomp rule from %s", param)
-		generator := &e.EngineConfig.OciConfig.Generator
-		if err := seccomp.LoadProfileFromFile(param, generator); err != nil {
-			return err
-		}
+	if err := e.prepareLandlock(""); err != nil {
+		return err
 	}
 
 	// open file descriptors (autofs bug path)
@@ -877,9 +887,19 @@ func (e *EngineOperations) prepareInstanceJoinConfig(starterConfig *starter.Conf
 		e.EngineConfig.OciConfig.SetProcessSelinuxLabel(instanceEngineConfig.OciConfig.Process.SelinuxLabel)
 	}
 
+	// restore landlock rulesets and add a new one if provided
+	if err := e.prepareLandlock(instanceEngineConfig.OciConfig.Annotations[landlock.Annotation]); err != nil {
+		return err
+	}
+
 	// restore seccomp filter or apply a new one if provided
 	param = security.GetParam(e.EngineConfig.GetSecurity(), "seccomp")
-	if param != "" {
+	if err := e.checkSeccompParam(param); err != nil {
+		return err
+	}
+	if seccomp.RecordPath(param) != "" {
+		return fmt.Errorf("recording a seccomp profile is not supported for instances")
+	} else if param != "" {
 		sylog.Debugf("Applying seccomp rule from %s", param)
 		generator := &e.EngineConfig.OciConfig.Generator
 		if err := seccomp.LoadProfileFromFile(param, generator); err != nil {
@@ -1110,6 +1130,11 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config) error {
 		return fmt.Errorf("while getting root filesystem partition in %s: %s", e.EngineConfig.GetImage(), err)
 	}
 
+	// the image may run under emulation, or not at all
+	if img.Arch != "" && img.Arch != runtime.GOARCH {
+		sylog.Warningf("The image's architecture (%s) doesn't match the host's (%s)", img.Arch, runtime.GOARCH)
+	}
+
 	if writable && !img.Writable {
 		return fmt.Errorf("could not use %s for writing, you don't have write permissions", img.Path)
 	}
@@ -1177,15 +1202,20 @@ func (e *EngineOperations) loadImages(starterConfig *starter.Config) error {
 			// the ECL functions as this keeps the logic for applying / ignoring ECL in a
 			// single location.
 			var kr openpgp.KeyRing = openpgp.EntityList{}
+			var db sypgp.TrustDB
 			if ecl.Activated {
 				keyring := sypgp.NewHandle(buildcfg.SINGULARITY_CONFDIR, sypgp.GlobalHandleOpt())
 				kr, err = keyring.LoadPubKeyring()
 				if err != nil {
 					return fmt.Errorf("while obtaining keyring for ECL: %s", err)
 				}
+				db, err = keyring.LoadTrustDB()
+				if err != nil {
+					return fmt.Errorf("while obtaining trust database for ECL: %s", err)
+				}
 			}
 
-			if ok, err := ecl.ShouldRunFp(img.File, kr); err != nil {
+			if ok, err := ecl.ShouldRunFp(img.File, kr, db); err != nil {
 				return fmt.Errorf("while checking container image with ECL: %s", err)
 			} else if !ok {
 				return errors.New("image prohibited by ECL")
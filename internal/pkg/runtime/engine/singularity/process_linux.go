@@ -153,6 +153,10 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 		return fmt.Errorf("failed to apply security configuration: %s", err)
 	}
 
+	if err := e.announceSeccompRecord(masterConnFd); err != nil {
+		return err
+	}
+
 	// If necessary, set the umask that was saved from the calling environment
 	// https://github.com/hpcng/singularity/issues/5214
 	if e.EngineConfig.GetRestoreUmask() {
@@ -176,6 +180,10 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 			}
 		}
 
+		if err := e.startSeccompRecord(masterConnFd); err != nil {
+			return err
+		}
+
 		return e.execProcess(args, env)
 	}
 
@@ -187,24 +195,32 @@ func (e *EngineOperations) StartProcess(masterConnFd int) error {
 	if err != nil {
 		return err
 	} else if len(args) > 0 {
-	cmdexec:
-		// Spawn and wait container process, signal handler
-		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		cmd.Env = env
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Setpgid: isInstance,
-		}
-		if err := cmd.Start(); err != nil {
-			if e, ok := err.(*os.PathError); ok {
-				if e.Err.(syscall.Errno) == syscall.ENOEXEC && args[0] != defaultShell {
-					args = append([]string{defaultShell}, args...)
-					goto cmdexec
+		var cmd *exec.Cmd
+
+		start := func() error {
+		cmdexec:
+			// Spawn and wait container process, signal handler
+			cmd = exec.Command(args[0], args[1:]...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			cmd.Stdin = os.Stdin
+			cmd.Env = env
+			cmd.SysProcAttr = &syscall.SysProcAttr{
+				Setpgid: isInstance,
+			}
+			if err := cmd.Start(); err != nil {
+				if e, ok := err.(*os.PathError); ok {
+					if e.Err.(syscall.Errno) == syscall.ENOEXEC && args[0] != defaultShell {
+						args = append([]string{defaultShell}, args...)
+						goto cmdexec
+					}
 				}
+				return fmt.Errorf("exec %s failed: %s", args[0], err)
 			}
-			return fmt.Errorf("exec %s failed: %s", args[0], err)
+			return nil
+		}
+		if err := e.startRecordedProcess(masterConnFd, start); err != nil {
+			return err
 		}
 		cmdPid = cmd.Process.Pid
 
@@ -367,6 +383,13 @@ func (e *EngineOperations) PostStartProcess(ctx context.Context, pid int) error
 		}
 		file.IP = ip
 
+		if networkSetup != nil {
+			file.Networks, err = networkSetup.GetResults()
+			if err != nil {
+				sylog.Warningf("Could not get network results: %s", err)
+			}
+		}
+
 		// by default we add all namespaces except the user namespace which
 		// is added conditionally. This delegates checks to the C starter code
 		// which will determine if a namespace needs to be joined by
@@ -0,0 +1,178 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hpcng/singularity/internal/pkg/buildcfg"
+	"github.com/hpcng/singularity/internal/pkg/security"
+	"github.com/hpcng/singularity/internal/pkg/security/seccomp"
+	"github.com/hpcng/singularity/pkg/image"
+	"github.com/hpcng/singularity/pkg/inspect"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// seccompProfileLabel is the image label selecting a seccomp profile
+// among the profiles allowed by the "allowed seccomp profiles" directive.
+const seccompProfileLabel = "org.sylabs.singularity.seccomp-profile"
+
+// seccompProfilePath returns the path of the seccomp profile name set in
+// singularity.conf or in an image label, relative names are looked up in
+// the seccomp profiles directory.
+func seccompProfilePath(name string) string {
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	path := filepath.Join(buildcfg.SECCOMP_PROFILES_DIR, name)
+	if filepath.Ext(path) == "" {
+		path += ".json"
+	}
+	return path
+}
+
+// seccompProfileAllowed returns whether the profile at path is allowed by
+// the "allowed seccomp profiles" directive.
+func (e *EngineOperations) seccompProfileAllowed(path string) bool {
+	for _, name := range e.EngineConfig.File.AllowedSeccompProfiles {
+		if seccompProfilePath(name) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSeccompParam checks that the user is allowed to replace the default
+// seccomp profile with the --security seccomp parameter param. Root can use
+// any profile, other users can only use allowed profiles.
+func (e *EngineOperations) checkSeccompParam(param string) error {
+	if param == "" || e.EngineConfig.File.SeccompProfile == "" || os.Getuid() == 0 {
+		return nil
+	}
+	if seccomp.RecordPath(param) != "" {
+		return fmt.Errorf("recording a seccomp profile is not allowed, a seccomp profile is enforced by the administrator")
+	}
+	path, err := filepath.Abs(param)
+	if err != nil {
+		return fmt.Errorf("while resolving seccomp profile path %s: %s", param, err)
+	}
+	if !e.seccompProfileAllowed(path) {
+		return fmt.Errorf("seccomp profile %s not allowed by the administrator", param)
+	}
+	return nil
+}
+
+// imageLabels returns the labels of the image img. Labels are read from the
+// metadata descriptor of SIF images and from the metadata directory of
+// sandboxes, other image formats have no readable labels.
+func imageLabels(img *image.Image) (map[string]string, error) {
+	switch img.Type {
+	case image.SIF:
+		r, err := image.NewSectionReader(img, image.SIFDescInspectMetadataJSON, -1)
+		if err == image.ErrNoSection {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		metadata := new(inspect.Metadata)
+		if err := json.NewDecoder(r).Decode(metadata); err != nil {
+			return nil, fmt.Errorf("while decoding inspect metadata: %s", err)
+		}
+		return metadata.Attributes.Labels, nil
+	case image.SANDBOX:
+		b, err := ioutil.ReadFile(filepath.Join(img.Path, ".singularity.d", "labels.json"))
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		labels := make(map[string]string)
+		if err := json.Unmarshal(b, &labels); err != nil {
+			return nil, fmt.Errorf("while decoding labels: %s", err)
+		}
+		return labels, nil
+	}
+	return nil, nil
+}
+
+// rootKeepPrivs returns whether root requested --keep-privs, which lifts
+// the default security restrictions set by the administrator. Other users
+// can't escape them with --keep-privs.
+func (e *EngineOperations) rootKeepPrivs() bool {
+	return os.Getuid() == 0 && e.EngineConfig.GetKeepPrivs()
+}
+
+// prepareSeccompProfile selects the seccomp profile applied to the
+// container process, by order of precedence:
+//   - the profile requested with --security seccomp
+//   - the profile set by the image label, if allowed
+//   - the default profile set by the "seccomp profile" directive
+//
+// Neither the image label nor the default profile apply when root requests
+// --keep-privs.
+func (e *EngineOperations) prepareSeccompProfile(img *image.Image) error {
+	param := security.GetParam(e.EngineConfig.GetSecurity(), "seccomp")
+	if err := e.checkSeccompParam(param); err != nil {
+		return err
+	}
+
+	if path := seccomp.RecordPath(param); path != "" {
+		if !seccomp.Enabled() {
+			return fmt.Errorf("can't record seccomp profile: seccomp not enabled at compilation time")
+		}
+		if err := seccomp.RecordSupported(); err != nil {
+			return fmt.Errorf("can't record seccomp profile: %s", err)
+		}
+		if e.EngineConfig.GetInstance() {
+			return fmt.Errorf("recording a seccomp profile is not supported for instances")
+		}
+		sylog.Debugf("Recording seccomp profile to %s", path)
+		return nil
+	}
+
+	generator := &e.EngineConfig.OciConfig.Generator
+
+	if param != "" {
+		sylog.Debugf("Applying seccomp rule from %s", param)
+		return seccomp.LoadProfileFromFile(param, generator)
+	}
+
+	if e.rootKeepPrivs() {
+		sylog.Debugf("--keep-privs requested, no default seccomp profile applied")
+		return nil
+	}
+
+	profile := ""
+	if e.EngineConfig.File.SeccompProfile != "" {
+		profile = seccompProfilePath(e.EngineConfig.File.SeccompProfile)
+	}
+	if len(e.EngineConfig.File.AllowedSeccompProfiles) > 0 {
+		labels, err := imageLabels(img)
+		if err != nil {
+			sylog.Warningf("Could not read labels of %s: %s", img.Path, err)
+		}
+		if name := labels[seccompProfileLabel]; name != "" {
+			if path := seccompProfilePath(name); e.seccompProfileAllowed(path) {
+				profile = path
+			} else {
+				sylog.Warningf("Ignoring seccomp profile %s set by image label, not allowed by the administrator", name)
+			}
+		}
+	}
+	if profile == "" {
+		return nil
+	}
+
+	if !seccomp.Enabled() {
+		return fmt.Errorf("can't apply seccomp profile %s: seccomp not enabled at compilation time", profile)
+	}
+	sylog.Debugf("Applying seccomp profile %s", profile)
+	return seccomp.LoadProfileFromFile(profile, generator)
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hpcng/singularity/internal/pkg/runtime/engine/config/oci/generate"
+	"github.com/hpcng/singularity/internal/pkg/security/seccomp"
+	"github.com/hpcng/singularity/internal/pkg/test"
+	singularityConfig "github.com/hpcng/singularity/pkg/runtime/engine/singularity/config"
+)
+
+func TestPrepareSeccompProfileKeepPrivs(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	profile, err := filepath.Abs("../../../../../etc/seccomp-profiles/default.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &EngineOperations{EngineConfig: singularityConfig.NewConfig()}
+	e.EngineConfig.OciConfig.Generator = *generate.New(&e.EngineConfig.OciConfig.Spec)
+	e.EngineConfig.File.SeccompProfile = profile
+	e.EngineConfig.SetKeepPrivs(true)
+
+	err = e.prepareSeccompProfile(nil)
+	if !seccomp.Enabled() {
+		// the default profile is selected but can't be applied
+		if err == nil {
+			t.Fatalf("unexpected success applying %s without seccomp support", profile)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if linux := e.EngineConfig.OciConfig.Linux; linux == nil || linux.Seccomp == nil {
+		t.Fatalf("default seccomp profile not applied with --keep-privs as a user")
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/security"
+	"github.com/hpcng/singularity/internal/pkg/security/seccomp"
+	"github.com/hpcng/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// seccompRecordTimeout is how long master waits for processes left over
+// by the container process before writing the recorded profile. Once
+// recording stopped, the system calls of processes still running fail
+// with ENOSYS.
+const seccompRecordTimeout = time.Second
+
+// seccompRecorder records the system calls of the container process with
+// --security seccomp:record=<profile>, used by master process only.
+var seccompRecorder *seccomp.Recorder
+
+// seccompRecordPath returns the path of the seccomp profile to record, or
+// an empty string if no profile is recorded.
+func (e *EngineOperations) seccompRecordPath() string {
+	return seccomp.RecordPath(security.GetParam(e.EngineConfig.GetSecurity(), "seccomp"))
+}
+
+// announceSeccompRecord is called from the container process to tell
+// master whether it will hand over a seccomp listener before executing
+// the container process.
+func (e *EngineOperations) announceSeccompRecord(masterConnFd int) error {
+	data := []byte("c")
+	if e.seccompRecordPath() != "" {
+		data = []byte("r")
+	}
+	if _, err := unix.Write(masterConnFd, data); err != nil {
+		return fmt.Errorf("while sending data to master: %s", err)
+	}
+	return nil
+}
+
+// startSeccompRecord is called from the container process right before
+// its execution when a seccomp profile is recorded. It loads a filter
+// notifying a listener of all system calls, and hands the listener over
+// to master. The filter applies to the calling thread only, so the OS
+// thread stays locked to execute the container process, or to spawn it
+// with startRecordedProcess.
+func (e *EngineOperations) startSeccompRecord(masterConnFd int) error {
+	if e.seccompRecordPath() == "" {
+		return nil
+	}
+
+	runtime.LockOSThread()
+
+	fd, err := seccomp.LoadNotifyFilter(masterConnFd)
+	if err != nil {
+		return err
+	}
+	// from there, system calls block until master receives the listener,
+	// except the one handing it over
+	if err := unix.Sendmsg(masterConnFd, []byte("r"), unix.UnixRights(fd), nil, 0); err != nil {
+		return fmt.Errorf("while sending seccomp listener to master: %s", err)
+	}
+	return unix.Close(fd)
+}
+
+// startRecordedProcess calls start to spawn the container process, from
+// a dedicated OS thread loading the seccomp filter when a seccomp profile
+// is recorded, so the system calls of the Go runtime waiting for the
+// container process are not recorded. The thread is never unlocked, so
+// the Go runtime terminates it once start returned, only the few system
+// calls spawning the process are recorded along with those of the
+// container process.
+func (e *EngineOperations) startRecordedProcess(masterConnFd int, start func() error) error {
+	if e.seccompRecordPath() == "" {
+		return start()
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		// the main thread is never terminated, the process is spawned
+		// from another thread while this one is held
+		if unix.Gettid() == unix.Getpid() {
+			defer runtime.UnlockOSThread()
+			errChan <- e.startRecordedProcess(masterConnFd, start)
+			return
+		}
+
+		if err := e.startSeccompRecord(masterConnFd); err != nil {
+			errChan <- err
+			return
+		}
+		errChan <- start()
+	}()
+	return <-errChan
+}
+
+// PreStartProcess is called from master before the execution of the
+// container process. When a seccomp profile is recorded, it receives the
+// seccomp listener handed over by the container process and starts
+// recording system calls.
+//
+// No additional privileges are gained during this call.
+func (e *EngineOperations) PreStartProcess(ctx context.Context, pid int, masterConn net.Conn, fatalChan chan error) error {
+	if e.seccompRecordPath() == "" {
+		return nil
+	}
+
+	conn, ok := masterConn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("master connection is not a unix socket")
+	}
+
+	data := make([]byte, 1)
+	oob := make([]byte, unix.CmsgSpace(4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(data, oob)
+	if err == io.EOF || (err == nil && oobn == 0) {
+		// the container process failed before handing over the
+		// listener, the error is reported by the container process
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("while receiving seccomp listener: %s", err)
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		return fmt.Errorf("bad seccomp listener control message: %v", err)
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		return fmt.Errorf("bad seccomp listener control message: %v", err)
+	}
+
+	sylog.Debugf("Recording system calls of container process")
+	seccompRecorder = seccomp.NewRecorder(fds[0])
+	return nil
+}
+
+// writeSeccompProfile is called from master once the container process
+// exited, and writes the recorded seccomp profile once all processes
+// recorded exited, or after seccompRecordTimeout.
+func (e *EngineOperations) writeSeccompProfile() {
+	path := e.seccompRecordPath()
+
+	if err := seccompRecorder.Stop(seccompRecordTimeout); err != nil {
+		sylog.Errorf("Seccomp profile recording failed: %s", err)
+		return
+	}
+	if err := seccompRecorder.WriteProfile(path); err != nil {
+		sylog.Errorf("Could not write seccomp profile %s: %s", path, err)
+		return
+	}
+	sylog.Infof("Seccomp profile written to %s", path)
+}
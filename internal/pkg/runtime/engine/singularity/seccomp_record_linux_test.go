@@ -0,0 +1,176 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hpcng/singularity/internal/pkg/security/seccomp"
+	singularityConfig "github.com/hpcng/singularity/pkg/runtime/engine/singularity/config"
+	"golang.org/x/sys/unix"
+)
+
+const recordedProcessHelperEnv = "SECCOMP_RECORDED_PROCESS_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(recordedProcessHelperEnv) != "" {
+		recordedProcessHelper()
+	}
+	os.Exit(m.Run())
+}
+
+// filteredThreads returns the IDs of the threads of the current process
+// running under a seccomp filter.
+func filteredThreads() ([]string, error) {
+	tasks, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []string
+	for _, task := range tasks {
+		f, err := os.Open(filepath.Join("/proc/self/task", task.Name(), "status"))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[0] == "Seccomp:" && fields[1] != "0" {
+				filtered = append(filtered, task.Name())
+			}
+		}
+		f.Close()
+	}
+	return filtered, nil
+}
+
+// recordedProcessHelper spawns /bin/true with startRecordedProcess, handing
+// the seccomp listener over to the test process with the socket inherited
+// as file descriptor 3, and checks that no thread is left running under
+// the seccomp filter.
+func recordedProcessHelper() {
+	e := &EngineOperations{EngineConfig: singularityConfig.NewConfig()}
+	e.EngineConfig.SetSecurity([]string{"seccomp:record=/profile.json"})
+
+	var cmd *exec.Cmd
+	start := func() error {
+		cmd = exec.Command("/bin/true")
+		return cmd.Start()
+	}
+	if err := e.startRecordedProcess(3, start); err != nil {
+		// report the error with a message without rights
+		unix.Write(3, []byte(err.Error()))
+		os.Exit(1)
+	}
+	if err := cmd.Wait(); err != nil {
+		fmt.Fprintf(os.Stderr, "unexpected process error: %s\n", err)
+		os.Exit(2)
+	}
+
+	// the thread loading the filter exits once the process is spawned
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		filtered, err := filteredThreads()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(3)
+		}
+		if len(filtered) == 0 {
+			os.Exit(0)
+		}
+		if time.Now().After(deadline) {
+			fmt.Fprintf(os.Stderr, "threads %v still running under the seccomp filter\n", filtered)
+			os.Exit(4)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartRecordedProcess(t *testing.T) {
+	if err := seccomp.RecordSupported(); err != nil {
+		t.Skip(err)
+	}
+	if filtered, err := filteredThreads(); err != nil {
+		t.Fatal(err)
+	} else if len(filtered) > 0 {
+		t.Skip("test process already running under a seccomp filter")
+	}
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := os.NewFile(uintptr(fds[1]), "child")
+	defer unix.Close(fds[0])
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), recordedProcessHelperEnv+"=1")
+	cmd.ExtraFiles = []*os.File{child}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	child.Close()
+
+	buf := make([]byte, 256)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := unix.Recvmsg(fds[0], buf, oob, 0)
+	if err != nil {
+		t.Fatalf("while receiving listener: %s", err)
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		cmd.Wait()
+		t.Skipf("seccomp notify filter not supported: %s", buf[:n])
+	}
+	rights, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(rights) != 1 {
+		t.Fatalf("unexpected control message: %v", err)
+	}
+
+	r := seccomp.NewRecorder(rights[0])
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("unexpected helper error: %s", err)
+	}
+	if err := r.Stop(5 * time.Second); err != nil {
+		t.Fatalf("unexpected recording error: %s", err)
+	}
+
+	if !seccomp.Enabled() {
+		// system call names can't be resolved
+		return
+	}
+	profile, err := r.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := make(map[string]bool)
+	for _, s := range profile.Syscalls {
+		for _, name := range s.Names {
+			recorded[name] = true
+		}
+	}
+	if !recorded["execve"] {
+		t.Errorf("execve of the process not recorded")
+	}
+	// system calls of the helper waiting for the process are not recorded
+	for _, name := range []string{"wait4", "waitid"} {
+		if recorded[name] {
+			t.Errorf("system call %s of the helper recorded", name)
+		}
+	}
+}
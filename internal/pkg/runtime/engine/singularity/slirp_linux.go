@@ -0,0 +1,61 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package singularity
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/hpcng/singularity/pkg/network"
+	"github.com/hpcng/singularity/pkg/sylog"
+)
+
+// slirpNetwork provides the user-mode network of the container, used by
+// master process only.
+var slirpNetwork *network.Slirp
+
+// slirp4netnsPath returns the path of the slirp4netns program set by the
+// "slirp4netns path" directive, or found in PATH if not set.
+func slirp4netnsPath(path string) (string, error) {
+	if path == "" {
+		return exec.LookPath("slirp4netns")
+	}
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, "slirp4netns")
+	}
+	return exec.LookPath(path)
+}
+
+// prepareSlirpNetwork returns the function starting the user-mode network
+// of the container process pid. Non-root users own the container network
+// namespace with a user namespace only.
+func (c *container) prepareSlirpNetwork(pid int) (func(context.Context) error, error) {
+	if !c.userNS && os.Geteuid() != 0 {
+		return nil, fmt.Errorf("%s network requires a user namespace for non-root users, use --userns", network.SlirpNetwork)
+	}
+
+	binary, err := slirp4netnsPath(c.engine.EngineConfig.File.Slirp4netnsPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s network requires slirp4netns: %s", network.SlirpNetwork, err)
+	}
+
+	slirp, err := network.NewSlirp(binary, pid, c.engine.EngineConfig.GetNetworkArgs())
+	if err != nil {
+		return nil, fmt.Errorf("error while setting network arguments: %s", err)
+	}
+
+	return func(ctx context.Context) error {
+		sylog.Debugf("Starting %s network with %s", network.SlirpNetwork, binary)
+		if err := slirp.Start(ctx); err != nil {
+			return err
+		}
+		slirpNetwork = slirp
+		return nil
+	}, nil
+}
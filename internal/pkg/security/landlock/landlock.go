@@ -0,0 +1,92 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package landlock restricts the filesystem accesses of the container
+// process with the Landlock LSM, which doesn't require any privilege or
+// policy installed by the administrator.
+package landlock
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Annotation is the OCI annotation holding the Landlock rulesets applied
+// to the container process, one ruleset per line. Each ruleset further
+// restricts the accesses allowed by the previous ones.
+const Annotation = "org.sylabs.singularity.landlock"
+
+// Ruleset describes the filesystem accesses allowed to the container
+// process. Files can be read everywhere unless ReadOnly paths are set, in
+// which case read access is limited to ReadOnly and ReadWrite paths, and
+// to the system directories of the container. Files can be written beneath
+// ReadWrite paths and /dev only.
+type Ruleset struct {
+	// ReadOnly are the paths beneath which files can be read and executed.
+	ReadOnly []string
+	// ReadWrite are the paths beneath which files can also be written.
+	ReadWrite []string
+}
+
+// Parse parses a ruleset in the ro=<path>[:<path>...],rw=<path>[:<path>...]
+// format, ro and rw can be repeated.
+func Parse(s string) (*Ruleset, error) {
+	r := new(Ruleset)
+
+	for _, rule := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(rule), "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("bad landlock rule %q (format is ro=<path> or rw=<path>)", rule)
+		}
+
+		var paths *[]string
+		switch kv[0] {
+		case "ro":
+			paths = &r.ReadOnly
+		case "rw":
+			paths = &r.ReadWrite
+		default:
+			return nil, fmt.Errorf("unknown landlock access %q, must be ro or rw", kv[0])
+		}
+
+		for _, path := range strings.Split(kv[1], ":") {
+			if !filepath.IsAbs(path) {
+				return nil, fmt.Errorf("landlock path %q is not an absolute path", path)
+			}
+			*paths = append(*paths, filepath.Clean(path))
+		}
+	}
+
+	return r, nil
+}
+
+// String returns the ruleset r in the format accepted by Parse.
+func (r *Ruleset) String() string {
+	rules := make([]string, 0, 2)
+	if len(r.ReadOnly) > 0 {
+		rules = append(rules, "ro="+strings.Join(r.ReadOnly, ":"))
+	}
+	if len(r.ReadWrite) > 0 {
+		rules = append(rules, "rw="+strings.Join(r.ReadWrite, ":"))
+	}
+	return strings.Join(rules, ",")
+}
+
+// Rulesets parses the rulesets held by the Annotation value.
+func Rulesets(value string) ([]*Ruleset, error) {
+	rulesets := make([]*Ruleset, 0)
+	for _, s := range strings.Split(value, "\n") {
+		if s == "" {
+			continue
+		}
+		r, err := Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		rulesets = append(rulesets, r)
+	}
+	return rulesets, nil
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package landlock
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/hpcng/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	createRulesetVersion = 1 << 0
+	rulePathBeneath      = 1
+)
+
+// filesystem access rights, up to the Landlock ABI version 3, rights
+// from 1<<4 to 1<<12 remove and make files of the different types
+const (
+	accessExecute   = 1 << 0
+	accessWriteFile = 1 << 1
+	accessReadFile  = 1 << 2
+	accessReadDir   = 1 << 3
+	accessRefer     = 1 << 13
+	accessTruncate  = 1 << 14
+
+	accessRead = accessExecute | accessReadFile | accessReadDir
+	accessFile = accessExecute | accessWriteFile | accessReadFile | accessTruncate
+)
+
+// systemPaths can be read when read access is limited to read-only paths,
+// so the container process can still run.
+var systemPaths = []string{
+	"/.singularity.d",
+	"/bin",
+	"/etc",
+	"/lib",
+	"/lib32",
+	"/lib64",
+	"/libx32",
+	"/opt",
+	"/proc",
+	"/sbin",
+	"/sys",
+	"/usr",
+}
+
+type rulesetAttr struct {
+	handledAccessFS uint64
+}
+
+// pathBeneathAttr is packed in the kernel ABI, the padding at the end
+// of this structure is ignored.
+type pathBeneathAttr struct {
+	allowedAccess uint64
+	parentFd      int32
+}
+
+// abiVersion returns the Landlock ABI version supported by the kernel.
+func abiVersion() (int, error) {
+	v, _, errno := unix.Syscall(sysLandlockCreateRuleset, 0, 0, createRulesetVersion)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(v), nil
+}
+
+// Enabled returns whether Landlock is supported and enabled by the kernel.
+func Enabled() bool {
+	v, err := abiVersion()
+	return err == nil && v > 0
+}
+
+// handledAccess returns the access rights handled by Landlock ABI version,
+// all rights of the first version are below accessRefer.
+func handledAccess(version int) uint64 {
+	access := uint64(accessRefer - 1)
+	if version >= 2 {
+		access |= accessRefer
+	}
+	if version >= 3 {
+		access |= accessTruncate
+	}
+	return access
+}
+
+// addRule allows access beneath path to the ruleset fd. A missing path is
+// ignored, with a warning unless optional is true.
+func addRule(fd int, path string, access uint64, optional bool) error {
+	parent, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err == unix.ENOENT && optional {
+		return nil
+	} else if err == unix.ENOENT {
+		sylog.Warningf("Landlock path %s doesn't exist in container, ignoring it", path)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("while opening landlock path %s: %s", path, err)
+	}
+	defer unix.Close(parent)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(parent, &st); err != nil {
+		return fmt.Errorf("while getting landlock path %s information: %s", path, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= accessFile
+	}
+
+	attr := pathBeneathAttr{
+		allowedAccess: access,
+		parentFd:      int32(parent),
+	}
+	_, _, errno := unix.Syscall6(sysLandlockAddRule, uintptr(fd), rulePathBeneath, uintptr(unsafe.Pointer(&attr)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("while adding landlock rule for %s: %s", path, errno)
+	}
+	return nil
+}
+
+// restrict enforces the ruleset r on the current thread.
+func restrict(r *Ruleset, version int) error {
+	handled := handledAccess(version)
+	write := handled &^ accessRead
+
+	attr := rulesetAttr{handledAccessFS: handled}
+	fd, _, errno := unix.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("while creating landlock ruleset: %s", errno)
+	}
+	defer unix.Close(int(fd))
+
+	if len(r.ReadOnly) == 0 {
+		if err := addRule(int(fd), "/", accessRead, false); err != nil {
+			return err
+		}
+	} else {
+		for _, path := range systemPaths {
+			if err := addRule(int(fd), path, accessRead, true); err != nil {
+				return err
+			}
+		}
+		for _, path := range r.ReadOnly {
+			if err := addRule(int(fd), path, accessRead, false); err != nil {
+				return err
+			}
+		}
+	}
+	if err := addRule(int(fd), "/dev", accessRead|write, true); err != nil {
+		return err
+	}
+	for _, path := range r.ReadWrite {
+		if err := addRule(int(fd), path, accessRead|write, false); err != nil {
+			return err
+		}
+	}
+
+	_, _, errno = unix.Syscall(sysLandlockRestrictSelf, fd, 0, 0)
+	if errno == unix.EPERM {
+		return fmt.Errorf("while enforcing landlock ruleset: no new privileges or CAP_SYS_ADMIN required")
+	} else if errno != 0 {
+		return fmt.Errorf("while enforcing landlock ruleset: %s", errno)
+	}
+	return nil
+}
+
+// Restrict enforces the rulesets on the current thread, and the processes
+// it executes. Landlock requires the no new privileges flag or the
+// CAP_SYS_ADMIN capability, the flag is set if noNewPrivs is true.
+func Restrict(rulesets []*Ruleset, noNewPrivs bool) error {
+	version, err := abiVersion()
+	if err != nil {
+		return fmt.Errorf("landlock not supported: %s", err)
+	}
+
+	if noNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("while setting no new privileges flag: %s", err)
+		}
+	}
+
+	for _, r := range rulesets {
+		sylog.Debugf("Enforcing landlock ruleset %s", r)
+		if err := restrict(r, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package landlock
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+const (
+	restrictHelperEnv = "LANDLOCK_RESTRICT_HELPER"
+	restrictDirEnv    = "LANDLOCK_RESTRICT_DIR"
+)
+
+func TestMain(m *testing.M) {
+	if rules := os.Getenv(restrictHelperEnv); rules != "" {
+		restrictHelper(rules, os.Getenv(restrictDirEnv))
+	}
+	os.Exit(m.Run())
+}
+
+// restrictHelper enforces the ruleset rules and checks the accesses
+// allowed beneath the directory dir, which holds the rw and ro
+// directories.
+func restrictHelper(rules, dir string) {
+	runtime.LockOSThread()
+
+	r, err := Parse(rules)
+	if err != nil {
+		os.Exit(10)
+	}
+	if err := Restrict([]*Ruleset{r}, true); err != nil {
+		os.Exit(11)
+	}
+
+	exit := 0
+	if err := ioutil.WriteFile(filepath.Join(dir, "rw", "file"), nil, 0o644); err != nil {
+		exit |= 1
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "ro", "file"), nil, 0o644); err == nil {
+		exit |= 2
+	}
+	if _, err := ioutil.ReadDir(filepath.Join(dir, "ro")); err != nil {
+		exit |= 4
+	}
+	os.Exit(exit)
+}
+
+func TestRestrict(t *testing.T) {
+	if !Enabled() {
+		t.Skip("landlock not supported")
+	}
+
+	dir, err := ioutil.TempDir("", "landlock-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{"rw", "ro"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		rules string
+		exit  int
+	}{
+		{
+			name:  "ReadWrite",
+			rules: "rw=" + filepath.Join(dir, "rw"),
+			exit:  0,
+		},
+		{
+			name:  "ReadOnly",
+			rules: "ro=" + filepath.Join(dir, "ro") + ",rw=" + filepath.Join(dir, "rw"),
+			exit:  0,
+		},
+		{
+			name:  "NoAccess",
+			rules: "ro=" + filepath.Join(dir, "rw"),
+			exit:  1 | 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0])
+			cmd.Env = append(os.Environ(), restrictHelperEnv+"="+tt.rules, restrictDirEnv+"="+dir)
+			err := cmd.Run()
+
+			exit := 0
+			if e, ok := err.(*exec.ExitError); ok {
+				exit = e.ExitCode()
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if exit != tt.exit {
+				t.Errorf("helper exited with %d, want %d", exit, tt.exit)
+			}
+		})
+	}
+}
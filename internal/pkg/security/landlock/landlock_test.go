@@ -0,0 +1,85 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package landlock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		want    *Ruleset
+		wantErr bool
+	}{
+		{
+			name:  "ReadOnly",
+			rules: "ro=/data",
+			want:  &Ruleset{ReadOnly: []string{"/data"}},
+		},
+		{
+			name:  "ReadOnlyReadWrite",
+			rules: "ro=/data,rw=/scratch",
+			want:  &Ruleset{ReadOnly: []string{"/data"}, ReadWrite: []string{"/scratch"}},
+		},
+		{
+			name:  "MultiplePaths",
+			rules: "rw=/tmp:/var/tmp/,rw=/scratch",
+			want:  &Ruleset{ReadWrite: []string{"/tmp", "/var/tmp", "/scratch"}},
+		},
+		{
+			name:    "RelativePath",
+			rules:   "ro=data",
+			wantErr: true,
+		},
+		{
+			name:    "UnknownAccess",
+			rules:   "wo=/data",
+			wantErr: true,
+		},
+		{
+			name:    "NoPath",
+			rules:   "ro=",
+			wantErr: true,
+		},
+		{
+			name:    "BadFormat",
+			rules:   "/data",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Parse(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.want) {
+				t.Errorf("got %+v, want %+v", r, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesets(t *testing.T) {
+	rulesets, err := Rulesets("rw=/tmp\nro=/data:/opt,rw=/scratch")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rulesets) != 2 {
+		t.Fatalf("got %d rulesets, want 2", len(rulesets))
+	}
+	if s := rulesets[1].String(); s != "ro=/data:/opt,rw=/scratch" {
+		t.Errorf("got ruleset %q, want %q", s, "ro=/data:/opt,rw=/scratch")
+	}
+
+	if _, err := Rulesets("rw=/tmp\nrw=tmp"); err == nil {
+		t.Errorf("unexpected success with a bad ruleset")
+	}
+}
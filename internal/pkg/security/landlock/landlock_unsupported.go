@@ -0,0 +1,20 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !linux
+
+package landlock
+
+import "fmt"
+
+// Enabled returns false for unsupported platforms
+func Enabled() bool {
+	return false
+}
+
+// Restrict returns an error for unsupported platforms
+func Restrict(rulesets []*Ruleset, noNewPrivs bool) error {
+	return fmt.Errorf("can't enforce landlock ruleset: not supported by OS")
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package landlock
+
+// Landlock system call numbers of architectures using the generic system
+// call table.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+)
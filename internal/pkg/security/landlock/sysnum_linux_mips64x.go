@@ -0,0 +1,15 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build linux,mips64 linux,mips64le
+
+package landlock
+
+// Landlock system call numbers of the mips n64 ABI, offset by 5000.
+const (
+	sysLandlockCreateRuleset = 5444
+	sysLandlockAddRule       = 5445
+	sysLandlockRestrictSelf  = 5446
+)
@@ -0,0 +1,15 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build linux,mips linux,mipsle
+
+package landlock
+
+// Landlock system call numbers of the mips o32 ABI, offset by 4000.
+const (
+	sysLandlockCreateRuleset = 4444
+	sysLandlockAddRule       = 4445
+	sysLandlockRestrictSelf  = 4446
+)
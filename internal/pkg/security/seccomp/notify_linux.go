@@ -0,0 +1,218 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/hpcng/singularity/pkg/sylog"
+	"golang.org/x/sys/unix"
+)
+
+// notifyListener answers the system calls notified to a seccomp listener
+// with the responses returned by handle.
+type notifyListener struct {
+	fd     int
+	stop   chan struct{}
+	done   chan struct{}
+	handle func(req *seccompNotif) seccompNotifResp
+	err    error
+}
+
+// newNotifyListener starts answering the system calls notified to the
+// seccomp listener fd, until all processes using the filter exit or Stop
+// is called.
+func newNotifyListener(fd int, handle func(req *seccompNotif) seccompNotifResp) *notifyListener {
+	l := &notifyListener{
+		fd:     fd,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		handle: handle,
+	}
+	go l.listen()
+	return l
+}
+
+func (l *notifyListener) listen() {
+	defer close(l.done)
+	defer unix.Close(l.fd)
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		default:
+		}
+
+		fds := []unix.PollFd{{Fd: int32(l.fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, 100)
+		if err == unix.EINTR || n == 0 {
+			continue
+		} else if err != nil {
+			l.err = fmt.Errorf("while polling seccomp listener: %s", err)
+			return
+		}
+
+		if fds[0].Revents&unix.POLLIN != 0 {
+			if err := l.answer(); err != nil {
+				l.err = err
+				return
+			}
+		} else if fds[0].Revents&(unix.POLLHUP|unix.POLLERR) != 0 {
+			// no more process uses the filter
+			return
+		}
+	}
+}
+
+// answer receives a notified system call and sends the response of handle.
+func (l *notifyListener) answer() error {
+	var req seccompNotif
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(l.fd), ioctlNotifRecv, uintptr(unsafe.Pointer(&req))); errno != 0 {
+		if errno == unix.EINTR || errno == unix.ENOENT {
+			return nil
+		}
+		return fmt.Errorf("while receiving seccomp notification: %s", errno)
+	}
+
+	resp := l.handle(&req)
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(l.fd), ioctlNotifSend, uintptr(unsafe.Pointer(&resp))); errno != 0 {
+		// the process was interrupted or killed meanwhile
+		if errno == unix.ENOENT {
+			return nil
+		}
+		return fmt.Errorf("while answering seccomp notification: %s", errno)
+	}
+	return nil
+}
+
+// Stop waits up to timeout for all processes using the filter to exit,
+// and stops answering notifications.
+func (l *notifyListener) Stop(timeout time.Duration) error {
+	select {
+	case <-l.done:
+	case <-time.After(timeout):
+		close(l.stop)
+		<-l.done
+	}
+	return l.err
+}
+
+// ignoreFilter returns a filter notifying the listener of the native
+// system calls nrs.
+func ignoreFilter(nrs []uint32) ([]unix.SockFilter, error) {
+	arch, ok := nativeAuditArch[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("seccomp notifications are not supported on %s", runtime.GOARCH)
+	}
+
+	const (
+		load = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+		jeq  = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		ret  = unix.BPF_RET | unix.BPF_K
+	)
+
+	// jump offsets are 8-bit
+	n := len(nrs)
+	if n > 250 {
+		return nil, fmt.Errorf("too many system calls to notify")
+	}
+	filter := []unix.SockFilter{
+		{Code: load, K: seccompDataArch},
+		{Code: jeq, K: arch, Jt: 0, Jf: uint8(n + 1)},
+		{Code: load, K: seccompDataNr},
+	}
+	for i, nr := range nrs {
+		filter = append(filter, unix.SockFilter{Code: jeq, K: nr, Jt: uint8(n - i), Jf: 0})
+	}
+	return append(filter,
+		unix.SockFilter{Code: ret, K: seccompRetAllow},
+		unix.SockFilter{Code: ret, K: seccompRetUserNotif},
+	), nil
+}
+
+// LoadIgnoreFilter loads a seccomp filter notifying a listener of the
+// system calls names made by the calling thread and its future children,
+// and returns the listener file descriptor, to be answered by an Ignorer.
+// Names unknown to the native architecture are skipped. The caller must
+// lock its OS thread, and have CAP_SYS_ADMIN in its user namespace as the
+// no new privileges flag isn't set.
+func LoadIgnoreFilter(names []string) (int, error) {
+	if err := notifySupported(); err != nil {
+		return -1, err
+	}
+
+	nrs := make([]uint32, 0, len(names))
+	for _, name := range names {
+		if nr, ok := syscallNumber(name); ok {
+			nrs = append(nrs, uint32(nr))
+		}
+	}
+	return loadIgnoreFilter(nrs)
+}
+
+// loadIgnoreFilter loads a seccomp filter notifying a listener of the
+// native system calls nrs, and returns the listener file descriptor.
+func loadIgnoreFilter(nrs []uint32) (int, error) {
+	filter, err := ignoreFilter(nrs)
+	if err != nil {
+		return -1, err
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+
+	fd, _, errno := unix.Syscall(
+		unix.SYS_SECCOMP,
+		seccompSetModeFilter,
+		seccompFilterFlagNewListener,
+		uintptr(unsafe.Pointer(&prog)),
+	)
+	if errno != 0 {
+		return -1, fmt.Errorf("failed to load seccomp notify filter: %s", errno)
+	}
+	return int(fd), nil
+}
+
+// Ignorer answers the system calls notified to a seccomp listener as if
+// they succeeded, without executing them, and counts them.
+type Ignorer struct {
+	*notifyListener
+	mu    sync.Mutex
+	count int
+}
+
+// NewIgnorer starts ignoring the system calls notified to the seccomp
+// listener fd, until all processes using the filter exit or Stop is called.
+func NewIgnorer(fd int) *Ignorer {
+	i := &Ignorer{}
+	i.notifyListener = newNotifyListener(fd, i.ignore)
+	return i
+}
+
+// ignore counts a notified system call and returns 0 to the caller.
+func (i *Ignorer) ignore(req *seccompNotif) seccompNotifResp {
+	i.mu.Lock()
+	i.count++
+	i.mu.Unlock()
+
+	if name, err := syscallName(auditArchMap[req.arch], req.nr); err == nil {
+		sylog.Debugf("Ignored %s system call of process %d", name, req.pid)
+	}
+	return seccompNotifResp{id: req.id}
+}
+
+// Count returns the number of system calls ignored so far.
+func (i *Ignorer) Count() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.count
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const ignoreHelperEnv = "SECCOMP_IGNORE_HELPER"
+
+// ignoreHelper loads a filter notifying fchown calls, hands the listener
+// over to the test process with the socket inherited as file descriptor 3,
+// and changes the owner of the file path.
+func ignoreHelper(path string) {
+	runtime.LockOSThread()
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		os.Exit(1)
+	}
+	fd, err := loadIgnoreFilter([]uint32{unix.SYS_FCHOWN})
+	if err != nil {
+		// report the error with a message without rights
+		unix.Sendmsg(3, []byte(err.Error()), nil, nil, 0)
+		os.Exit(1)
+	}
+	if err := unix.Sendmsg(3, []byte("i"), unix.UnixRights(fd), nil, 0); err != nil {
+		os.Exit(2)
+	}
+	unix.Close(fd)
+
+	f, err := os.Open(path)
+	if err != nil {
+		os.Exit(3)
+	}
+	if err := unix.Fchown(int(f.Fd()), 4242, 4242); err != nil {
+		os.Exit(4)
+	}
+	os.Exit(0)
+}
+
+func TestIgnorer(t *testing.T) {
+	if err := notifySupported(); err != nil {
+		t.Skip(err)
+	}
+
+	f, err := ioutil.TempFile("", "seccomp-ignore-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := os.NewFile(uintptr(fds[1]), "child")
+	defer unix.Close(fds[0])
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), ignoreHelperEnv+"="+f.Name())
+	cmd.ExtraFiles = []*os.File{child}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	child.Close()
+
+	buf := make([]byte, 256)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := unix.Recvmsg(fds[0], buf, oob, 0)
+	if err != nil {
+		t.Fatalf("while receiving listener: %s", err)
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		cmd.Wait()
+		t.Skipf("seccomp notify filter not supported: %s", buf[:n])
+	}
+	rights, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(rights) != 1 {
+		t.Fatalf("unexpected control message: %v", err)
+	}
+
+	i := NewIgnorer(rights[0])
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("unexpected helper error: %s", err)
+	}
+	if err := i.Stop(5 * time.Second); err != nil {
+		t.Fatalf("unexpected ignorer error: %s", err)
+	}
+
+	if got := i.Count(); got != 1 {
+		t.Errorf("got %d ignored system calls, want 1", got)
+	}
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid := fi.Sys().(*syscall.Stat_t).Uid; uid != uint32(os.Getuid()) {
+		t.Errorf("file owner changed to %d", uid)
+	}
+}
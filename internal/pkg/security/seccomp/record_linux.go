@@ -0,0 +1,363 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/hpcng/singularity/pkg/sylog"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"golang.org/x/sys/unix"
+)
+
+// recordPrefix prefixes the path of the profile to record in the seccomp
+// security parameter, as in --security seccomp:record=profile.json.
+const recordPrefix = "record="
+
+const (
+	seccompSetModeFilter         = 1
+	seccompGetNotifSizes         = 3
+	seccompFilterFlagNewListener = 1 << 3
+	seccompRetUserNotif          = 0x7fc00000
+	seccompRetAllow              = 0x7fff0000
+	seccompUserNotifFlagContinue = 1
+
+	// offsets in struct seccomp_data
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArgs = 16
+)
+
+// audit architectures from linux/audit.h, as reported in seccomp_data
+const (
+	auditArchI386        = 0x40000003
+	auditArchX86_64      = 0xc000003e
+	auditArchARM         = 0x40000028
+	auditArchAARCH64     = 0xc00000b7
+	auditArchPPC         = 0x00000014
+	auditArchPPC64       = 0x80000015
+	auditArchPPC64LE     = 0xc0000015
+	auditArchS390        = 0x00000016
+	auditArchS390X       = 0x80000016
+	auditArchMIPS        = 0x00000008
+	auditArchMIPSEL      = 0x40000008
+	auditArchMIPS64      = 0x80000008
+	auditArchMIPSEL64    = 0xc0000008
+	auditArchMIPS64N32   = 0xa0000008
+	auditArchMIPSEL64N32 = 0xe0000008
+
+	// x32 system calls are reported with the x86_64 audit architecture
+	// and this bit set in their number
+	x32SyscallBit = 0x40000000
+)
+
+var auditArchMap = map[uint32]specs.Arch{
+	auditArchI386:        specs.ArchX86,
+	auditArchX86_64:      specs.ArchX86_64,
+	auditArchARM:         specs.ArchARM,
+	auditArchAARCH64:     specs.ArchAARCH64,
+	auditArchPPC:         specs.ArchPPC,
+	auditArchPPC64:       specs.ArchPPC64,
+	auditArchPPC64LE:     specs.ArchPPC64LE,
+	auditArchS390:        specs.ArchS390,
+	auditArchS390X:       specs.ArchS390X,
+	auditArchMIPS:        specs.ArchMIPS,
+	auditArchMIPSEL:      specs.ArchMIPSEL,
+	auditArchMIPS64:      specs.ArchMIPS64,
+	auditArchMIPSEL64:    specs.ArchMIPSEL64,
+	auditArchMIPS64N32:   specs.ArchMIPS64N32,
+	auditArchMIPSEL64N32: specs.ArchMIPSEL64N32,
+}
+
+var nativeAuditArch = map[string]uint32{
+	"386":      auditArchI386,
+	"amd64":    auditArchX86_64,
+	"arm":      auditArchARM,
+	"arm64":    auditArchAARCH64,
+	"ppc64":    auditArchPPC64,
+	"ppc64le":  auditArchPPC64LE,
+	"s390x":    auditArchS390X,
+	"mips":     auditArchMIPS,
+	"mipsle":   auditArchMIPSEL,
+	"mips64":   auditArchMIPS64,
+	"mips64le": auditArchMIPSEL64,
+}
+
+// alwaysAllowed are the system calls never notified to the listener, so
+// the recording thread can't block on them before the listener is handed
+// over. sendmsg is only let through on the file descriptor handing the
+// listener over, but it can't be recorded when the workload uses it on
+// that file descriptor, so both are allowed in recorded profiles.
+var alwaysAllowed = []string{"rt_sigreturn", "sendmsg"}
+
+// seccompNotif is struct seccomp_notif.
+type seccompNotif struct {
+	id    uint64
+	pid   uint32
+	flags uint32
+	nr    int32
+	arch  uint32
+	ip    uint64
+	args  [6]uint64
+}
+
+// seccompNotifResp is struct seccomp_notif_resp.
+type seccompNotifResp struct {
+	id    uint64
+	val   int64
+	error int32
+	flags uint32
+}
+
+var (
+	ioctlNotifRecv = iowr('!', 0, unsafe.Sizeof(seccompNotif{}))
+	ioctlNotifSend = iowr('!', 1, unsafe.Sizeof(seccompNotifResp{}))
+)
+
+// iowr returns the number of a read/write ioctl, like the _IOWR macro.
+func iowr(t, nr, size uintptr) uintptr {
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le", "ppc64", "ppc64le":
+		return (2|4)<<29 | size<<16 | t<<8 | nr
+	default:
+		return (2|1)<<30 | size<<16 | t<<8 | nr
+	}
+}
+
+// RecordPath returns the path of the profile to record from the seccomp
+// security parameter param, or an empty string if param doesn't request
+// recording.
+func RecordPath(param string) string {
+	if !strings.HasPrefix(param, recordPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(param, recordPrefix)
+}
+
+// notifyFilter returns a filter notifying the listener of all system calls,
+// except rt_sigreturn and sendmsg calls on the file descriptor allowedFd.
+func notifyFilter(allowedFd int) ([]unix.SockFilter, error) {
+	arch, ok := nativeAuditArch[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("seccomp recording is not supported on %s", runtime.GOARCH)
+	}
+
+	// the lower 32 bits of the first argument
+	fdArg := uint32(seccompDataArgs)
+	var i uint16 = 1
+	if (*[2]byte)(unsafe.Pointer(&i))[0] == 0 {
+		fdArg += 4
+	}
+
+	const (
+		load = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+		jeq  = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		ret  = unix.BPF_RET | unix.BPF_K
+	)
+
+	return []unix.SockFilter{
+		{Code: load, K: seccompDataArch},
+		{Code: jeq, K: arch, Jt: 0, Jf: 5},
+		{Code: load, K: seccompDataNr},
+		{Code: jeq, K: unix.SYS_RT_SIGRETURN, Jt: 4, Jf: 0},
+		{Code: jeq, K: unix.SYS_SENDMSG, Jt: 0, Jf: 2},
+		{Code: load, K: fdArg},
+		{Code: jeq, K: uint32(allowedFd), Jt: 1, Jf: 0},
+		{Code: ret, K: seccompRetUserNotif},
+		{Code: ret, K: seccompRetAllow},
+	}, nil
+}
+
+// seccompNotifSizes is struct seccomp_notif_sizes.
+type seccompNotifSizes struct {
+	notif     uint16
+	notifResp uint16
+	data      uint16
+}
+
+// RecordSupported returns an error if the running kernel can't record the
+// system calls of a process. Notified system calls can only be let through
+// with SECCOMP_USER_NOTIF_FLAG_CONTINUE, which was introduced in the kernel
+// 5.5 and can't be probed without loading a filter.
+func RecordSupported() error {
+	if _, ok := nativeAuditArch[runtime.GOARCH]; !ok {
+		return fmt.Errorf("seccomp recording is not supported on %s", runtime.GOARCH)
+	}
+
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return fmt.Errorf("while getting kernel release: %s", err)
+	}
+	release := unix.ByteSliceToString(uts.Release[:])
+	var major, minor int
+	if _, err := fmt.Sscanf(release, "%d.%d", &major, &minor); err != nil {
+		return fmt.Errorf("while parsing kernel release %s: %s", release, err)
+	}
+	if major < 5 || (major == 5 && minor < 5) {
+		return fmt.Errorf("seccomp recording requires kernel 5.5 or later, running %s", release)
+	}
+
+	// user notifications may still be disabled, or filtered by an
+	// enclosing seccomp profile
+	return notifySupported()
+}
+
+// notifySupported returns an error if seccomp user notifications are not
+// available, they were introduced in the kernel 5.0.
+func notifySupported() error {
+	var sizes seccompNotifSizes
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompGetNotifSizes, 0, uintptr(unsafe.Pointer(&sizes))); errno != 0 {
+		return fmt.Errorf("seccomp user notifications are not available: %s", errno)
+	}
+	if uintptr(sizes.notif) < unsafe.Sizeof(seccompNotif{}) || uintptr(sizes.notifResp) < unsafe.Sizeof(seccompNotifResp{}) {
+		return fmt.Errorf("unexpected seccomp notification sizes %d and %d", sizes.notif, sizes.notifResp)
+	}
+	return nil
+}
+
+// LoadNotifyFilter loads a seccomp filter notifying a listener of every
+// system call made by the calling thread and its future children, and
+// returns the listener file descriptor. Only sendmsg calls on allowedFd,
+// used to hand the listener over to the recording process, and
+// rt_sigreturn are let through. The caller must lock its OS thread, and
+// the kernel must pass RecordSupported, otherwise notified calls would never
+// continue.
+func LoadNotifyFilter(allowedFd int) (int, error) {
+	if err := RecordSupported(); err != nil {
+		return -1, err
+	}
+	filter, err := notifyFilter(allowedFd)
+	if err != nil {
+		return -1, err
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return -1, fmt.Errorf("failed to set no new privs flag: %s", err)
+	}
+	fd, _, errno := unix.Syscall(
+		unix.SYS_SECCOMP,
+		seccompSetModeFilter,
+		seccompFilterFlagNewListener,
+		uintptr(unsafe.Pointer(&prog)),
+	)
+	if errno != 0 {
+		return -1, fmt.Errorf("failed to load seccomp notify filter: %s", errno)
+	}
+	return int(fd), nil
+}
+
+type recordedSyscall struct {
+	arch uint32
+	nr   int32
+}
+
+// Recorder records the system calls notified to a seccomp listener, and
+// lets them continue.
+type Recorder struct {
+	*notifyListener
+	mu       sync.Mutex
+	syscalls map[recordedSyscall]struct{}
+}
+
+// NewRecorder starts recording the system calls notified to the seccomp
+// listener fd, until all processes using the filter exit or Stop is called.
+func NewRecorder(fd int) *Recorder {
+	r := &Recorder{
+		syscalls: make(map[recordedSyscall]struct{}),
+	}
+	r.notifyListener = newNotifyListener(fd, r.record)
+	return r
+}
+
+// record records a notified system call and lets it continue.
+func (r *Recorder) record(req *seccompNotif) seccompNotifResp {
+	r.mu.Lock()
+	r.syscalls[recordedSyscall{arch: req.arch, nr: req.nr}] = struct{}{}
+	r.mu.Unlock()
+
+	return seccompNotifResp{
+		id:    req.id,
+		flags: seccompUserNotifFlagContinue,
+	}
+}
+
+// Profile returns a profile allowing the recorded system calls and denying
+// all others.
+func (r *Recorder) Profile() (*specs.LinuxSeccomp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	native := auditArchMap[nativeAuditArch[runtime.GOARCH]]
+	arches := map[specs.Arch]bool{native: true}
+	names := make(map[string]bool)
+	for _, n := range alwaysAllowed {
+		names[n] = true
+	}
+
+	for s := range r.syscalls {
+		arch, ok := auditArchMap[s.arch]
+		if !ok {
+			sylog.Warningf("Ignoring system call %d of unknown architecture %#x", s.nr, s.arch)
+			continue
+		}
+		if arch == specs.ArchX86_64 && s.nr&x32SyscallBit != 0 {
+			arch = specs.ArchX32
+		}
+		name, err := syscallName(arch, s.nr)
+		if err != nil {
+			return nil, err
+		}
+		arches[arch] = true
+		names[name] = true
+	}
+
+	profile := &specs.LinuxSeccomp{
+		DefaultAction: specs.ActErrno,
+		Architectures: []specs.Arch{native},
+		Syscalls: []specs.LinuxSyscall{
+			{Action: specs.ActAllow},
+		},
+	}
+	for arch := range arches {
+		if arch != native {
+			profile.Architectures = append(profile.Architectures, arch)
+		}
+	}
+	sort.Slice(profile.Architectures[1:], func(i, j int) bool {
+		return profile.Architectures[i+1] < profile.Architectures[j+1]
+	})
+	for name := range names {
+		profile.Syscalls[0].Names = append(profile.Syscalls[0].Names, name)
+	}
+	sort.Strings(profile.Syscalls[0].Names)
+
+	return profile, nil
+}
+
+// WriteProfile writes the recorded profile to the file path, in the JSON
+// format loaded by LoadProfileFromFile.
+func (r *Recorder) WriteProfile(path string) error {
+	profile, err := r.Profile()
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(profile, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0o644)
+}
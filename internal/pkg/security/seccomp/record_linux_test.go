@@ -0,0 +1,123 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package seccomp
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const recordHelperEnv = "SECCOMP_RECORD_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(recordHelperEnv) != "" {
+		recordHelper()
+	}
+	if path := os.Getenv(ignoreHelperEnv); path != "" {
+		ignoreHelper(path)
+	}
+	os.Exit(m.Run())
+}
+
+// recordHelper loads the notify filter, hands the listener over to the
+// test process with the socket inherited as file descriptor 3, and
+// executes /bin/true.
+func recordHelper() {
+	runtime.LockOSThread()
+
+	fd, err := LoadNotifyFilter(3)
+	if err != nil {
+		// report the error with a message without rights
+		unix.Sendmsg(3, []byte(err.Error()), nil, nil, 0)
+		os.Exit(1)
+	}
+	if err := unix.Sendmsg(3, []byte("r"), unix.UnixRights(fd), nil, 0); err != nil {
+		os.Exit(2)
+	}
+	unix.Close(fd)
+
+	syscall.Exec("/bin/true", []string{"true"}, os.Environ())
+	os.Exit(3)
+}
+
+func TestRecorder(t *testing.T) {
+	if err := RecordSupported(); err != nil {
+		t.Skip(err)
+	}
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := os.NewFile(uintptr(fds[1]), "child")
+	defer unix.Close(fds[0])
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), recordHelperEnv+"=1")
+	cmd.ExtraFiles = []*os.File{child}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	child.Close()
+
+	buf := make([]byte, 256)
+	oob := make([]byte, unix.CmsgSpace(4))
+	n, oobn, _, _, err := unix.Recvmsg(fds[0], buf, oob, 0)
+	if err != nil {
+		t.Fatalf("while receiving listener: %s", err)
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		cmd.Wait()
+		t.Skipf("seccomp notify filter not supported: %s", buf[:n])
+	}
+	rights, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(rights) != 1 {
+		t.Fatalf("unexpected control message: %v", err)
+	}
+
+	r := NewRecorder(rights[0])
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("unexpected helper error: %s", err)
+	}
+	if err := r.Stop(5 * time.Second); err != nil {
+		t.Fatalf("unexpected recording error: %s", err)
+	}
+
+	arch := nativeAuditArch[runtime.GOARCH]
+	for _, nr := range []int32{unix.SYS_EXECVE, unix.SYS_EXIT_GROUP} {
+		if _, ok := r.syscalls[recordedSyscall{arch: arch, nr: nr}]; !ok {
+			t.Errorf("system call %d not recorded", nr)
+		}
+	}
+	if _, ok := r.syscalls[recordedSyscall{arch: arch, nr: unix.SYS_RT_SIGRETURN}]; ok {
+		t.Errorf("rt_sigreturn unexpectedly notified")
+	}
+}
+
+func TestRecordPath(t *testing.T) {
+	tests := []struct {
+		param string
+		want  string
+	}{
+		{param: "record=/tmp/profile.json", want: "/tmp/profile.json"},
+		{param: "/tmp/profile.json", want: ""},
+		{param: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := RecordPath(tt.param); got != tt.want {
+			t.Errorf("RecordPath(%q) = %q, want %q", tt.param, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// +build !seccomp
+
+package seccomp
+
+import (
+	"fmt"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// syscallName returns an error without seccomp support
+func syscallName(arch specs.Arch, nr int32) (string, error) {
+	return "", fmt.Errorf("can't resolve system call names: seccomp not enabled at compilation time")
+}
+
+// syscallNumber returns false without seccomp support
+func syscallNumber(name string) (int32, bool) {
+	return 0, false
+}
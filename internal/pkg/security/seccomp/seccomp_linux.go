@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -220,3 +220,27 @@ func LoadProfileFromFile(profile string, generator *generate.Generator) error {
 
 	return nil
 }
+
+// syscallName returns the name of the system call number nr of the
+// architecture arch.
+func syscallName(arch specs.Arch, nr int32) (string, error) {
+	scmpArch, ok := scmpArchMap[arch]
+	if !ok {
+		return "", fmt.Errorf("invalid architecture '%s' specified", arch)
+	}
+	name, err := lseccomp.ScmpSyscall(nr).GetNameByArch(scmpArch)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve system call %d of architecture %s: %s", nr, arch, err)
+	}
+	return name, nil
+}
+
+// syscallNumber returns the number of the native system call name, or false
+// if unknown to the native architecture.
+func syscallNumber(name string) (int32, bool) {
+	nr, err := lseccomp.GetSyscallFromName(name)
+	if err != nil {
+		return 0, false
+	}
+	return int32(nr), true
+}
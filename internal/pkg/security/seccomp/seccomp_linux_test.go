@@ -10,6 +10,9 @@ package seccomp
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"syscall"
 	"testing"
 
@@ -97,3 +100,42 @@ func TestLoadProfileFromFile(t *testing.T) {
 
 	testFchmod(t)
 }
+
+func TestRecorderProfile(t *testing.T) {
+	arch, ok := nativeAuditArch[runtime.GOARCH]
+	if !ok {
+		t.Skipf("seccomp recording not supported on %s", runtime.GOARCH)
+	}
+
+	r := &Recorder{
+		syscalls: map[recordedSyscall]struct{}{
+			{arch: arch, nr: syscall.SYS_FCHMOD}:     {},
+			{arch: arch, nr: syscall.SYS_EXIT_GROUP}: {},
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "seccomp-record-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	profile := filepath.Join(dir, "profile.json")
+	if err := r.WriteProfile(profile); err != nil {
+		t.Fatalf("while writing profile: %s", err)
+	}
+
+	gen := generate.New(nil)
+	if err := LoadProfileFromFile(profile, gen); err != nil {
+		t.Fatalf("while loading recorded profile: %s", err)
+	}
+
+	seccomp := gen.Config.Linux.Seccomp
+	if seccomp.DefaultAction != specs.ActErrno {
+		t.Errorf("unexpected default action %s", seccomp.DefaultAction)
+	}
+	want := []string{"exit_group", "fchmod", "rt_sigreturn", "sendmsg"}
+	if len(seccomp.Syscalls) != 1 || !reflect.DeepEqual(seccomp.Syscalls[0].Names, want) {
+		t.Errorf("got syscalls %v, want %v", seccomp.Syscalls, want)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/hpcng/singularity/internal/pkg/security/apparmor"
+	"github.com/hpcng/singularity/internal/pkg/security/landlock"
 	"github.com/hpcng/singularity/internal/pkg/security/seccomp"
 	"github.com/hpcng/singularity/internal/pkg/security/selinux"
 	"github.com/hpcng/singularity/pkg/sylog"
@@ -40,6 +41,22 @@ func Configure(config *specs.Spec) error {
 			}
 		}
 	}
+	// landlock rulesets are enforced before the seccomp filter which may
+	// not allow landlock system calls
+	if value := config.Annotations[landlock.Annotation]; value != "" {
+		if landlock.Enabled() {
+			rulesets, err := landlock.Rulesets(value)
+			if err != nil {
+				return err
+			}
+			noNewPrivs := config.Process != nil && config.Process.NoNewPrivileges
+			if err := landlock.Restrict(rulesets, noNewPrivs); err != nil {
+				return err
+			}
+		} else {
+			sylog.Warningf("landlock is not enabled or supported on this system")
+		}
+	}
 	if config.Linux != nil && config.Linux.Seccomp != nil {
 		if seccomp.Enabled() {
 			if err := seccomp.LoadSeccompConfig(config.Linux.Seccomp, config.Process.NoNewPrivileges, 1); err != nil {
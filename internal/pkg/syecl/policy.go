@@ -0,0 +1,272 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package syecl
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hpcng/sif/pkg/integrity"
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/sypki"
+	"github.com/hpcng/singularity/pkg/sypgp"
+	toml "github.com/pelletier/go-toml"
+	"golang.org/x/crypto/openpgp"
+)
+
+// Policy describes the structure of a verification policy file. An image
+// satisfies a policy when the selected object groups hold valid signatures
+// matching all rules and none of the forbidden keys.
+//	Groups: object groups which must be signed, all object groups if empty
+//	Rules: all rules must be satisfied
+//	Forbidden: list of Key Fingerprints of entities which must not sign any
+//	of the selected object groups
+type Policy struct {
+	Groups    []uint32     `toml:"groups"`
+	Rules     []PolicyRule `toml:"rule"`
+	Forbidden []string     `toml:"forbidden"`
+}
+
+// PolicyRule describes a policy rule:
+//	Name: a descriptive identifier
+//	Threshold: the minimum number of KeyFP's which must have signed all the
+//	selected object groups, 0 requires all of them
+//	KeyFPs: list of Key Fingerprints of entities to verify
+type PolicyRule struct {
+	Name      string   `toml:"name"`
+	Threshold int      `toml:"threshold"`
+	KeyFPs    []string `toml:"keyfp"`
+}
+
+// PolicyRuleReport describes the evaluation of a policy rule.
+type PolicyRuleReport struct {
+	Name      string   `json:"name"`
+	Required  int      `json:"required"`
+	Matched   []string `json:"matched"`
+	Satisfied bool     `json:"satisfied"`
+}
+
+// PolicyReport describes the evaluation of a policy against an image.
+type PolicyReport struct {
+	Satisfied bool               `json:"satisfied"`
+	Groups    []uint32           `json:"groups"`
+	Signers   []string           `json:"signers"`
+	Rules     []PolicyRuleReport `json:"rules"`
+	Forbidden []string           `json:"forbidden,omitempty"`
+	Reasons   []string           `json:"reasons,omitempty"`
+	Warnings  []string           `json:"warnings,omitempty"`
+}
+
+// fail records the formatted reason as a cause of the evaluation failure.
+func (r *PolicyReport) fail(format string, a ...interface{}) {
+	r.Satisfied = false
+	r.Reasons = append(r.Reasons, fmt.Sprintf(format, a...))
+}
+
+// Err returns an error describing why the policy is not satisfied, nil
+// if it is.
+func (r *PolicyReport) Err() error {
+	if r.Satisfied {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errPolicyNotSatisfied, strings.Join(r.Reasons, "; "))
+}
+
+var errPolicyNotSatisfied = errors.New("verification policy not satisfied")
+
+// LoadPolicy opens a verification policy file and unmarshals it into
+// structures.
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := new(Policy)
+	if err := toml.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("while parsing policy %s: %s", path, err)
+	}
+	return p, nil
+}
+
+// validateFingerprints makes sure fps are 40 chars hex fingerprint strings.
+func validateFingerprints(fps []string) error {
+	for _, k := range fps {
+		decoded, err := hex.DecodeString(k)
+		if err != nil || len(decoded) != 20 {
+			return fmt.Errorf("expecting a 40 chars hex fingerprint string")
+		}
+	}
+	return nil
+}
+
+// Validate makes sure the values of a policy are logically correct.
+func (p *Policy) Validate() error {
+	if len(p.Rules) == 0 && len(p.Forbidden) == 0 {
+		return fmt.Errorf("policy must contain at least one rule or forbidden key")
+	}
+	for _, g := range p.Groups {
+		if g == 0 {
+			return fmt.Errorf("invalid object group ID 0")
+		}
+	}
+	for i, r := range p.Rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if len(r.KeyFPs) == 0 {
+			return fmt.Errorf("rule %s: no key fingerprint", name)
+		}
+		if r.Threshold < 0 || r.Threshold > len(r.KeyFPs) {
+			return fmt.Errorf("rule %s: threshold must be between 0 and %d", name, len(r.KeyFPs))
+		}
+		if err := validateFingerprints(r.KeyFPs); err != nil {
+			return fmt.Errorf("rule %s: %s", name, err)
+		}
+	}
+	if err := validateFingerprints(p.Forbidden); err != nil {
+		return fmt.Errorf("forbidden keys: %s", err)
+	}
+	return nil
+}
+
+// containsFingerprint returns true if fp is in fps.
+func containsFingerprint(fps []string, fp string) bool {
+	for _, v := range fps {
+		if strings.EqualFold(v, fp) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate verifies the signatures of the object groups selected by the
+// policy with keyring kr and checks the signing entities against the trust
+// database db and the policy rules. The cb callback, if not nil, is called
+// after each signature is verified.
+//
+// Signatures which can't be verified with kr, or made with a revoked or
+// distrusted key, don't count toward the policy rules and are reported,
+// images whose data doesn't match signatures never satisfy a policy. An
+// error is returned only if the evaluation couldn't be completed, the
+// returned report tells if the policy is satisfied.
+func (p *Policy) Evaluate(f *sif.FileImage, kr openpgp.KeyRing, db sypgp.TrustDB, cb integrity.VerifyCallback) (*PolicyReport, error) {
+	r := &PolicyReport{Satisfied: true, Groups: p.Groups, Rules: []PolicyRuleReport{}, Signers: []string{}}
+	if len(r.Groups) == 0 {
+		r.Groups = sypki.ObjectGroupIDs(f)
+	}
+	now := time.Now()
+
+	// fingerprints of the entities which have validly signed each group
+	signed := make(map[string]map[uint32]bool)
+	// whether signing entities, once checked, are revoked or distrusted
+	untrusted := make(map[string]bool)
+
+	vcb := func(vr integrity.VerifyResult) bool {
+		ignore := false
+		if cb != nil {
+			ignore = cb(vr)
+		}
+
+		err := vr.Error()
+		if err == nil && vr.Entity() != nil {
+			fp := hex.EncodeToString(vr.Entity().PrimaryKey.Fingerprint[:])
+			if _, ok := untrusted[fp]; !ok {
+				err := db.CheckKey(vr.Entity(), now)
+				untrusted[fp] = errors.Is(err, sypgp.ErrKeyRevoked) || errors.Is(err, sypgp.ErrKeyDistrusted)
+				if untrusted[fp] {
+					r.Warnings = append(r.Warnings, fmt.Sprintf("signing key %s", err))
+				}
+			}
+			for _, id := range vr.Verified() {
+				od, _, err := f.GetFromDescrID(id)
+				if err != nil {
+					continue
+				}
+				if signed[fp] == nil {
+					signed[fp] = make(map[uint32]bool)
+				}
+				signed[fp][od.Groupid&^sif.DescrGroupMask] = true
+			}
+		} else if errors.Is(err, &integrity.SignatureNotValidError{}) {
+			// doesn't count toward rules, but the image data isn't
+			// compromised
+			r.Warnings = append(r.Warnings, err.Error())
+			return true
+		}
+		return ignore
+	}
+
+	// revoked keys are checked against the trust database
+	opts := []integrity.VerifierOpt{
+		integrity.OptVerifyWithKeyRing(sypgp.NewRevokedKeyRing(kr)),
+		integrity.OptVerifyCallback(vcb),
+	}
+	for _, g := range r.Groups {
+		opts = append(opts, integrity.OptVerifyGroup(g))
+	}
+
+	v, err := integrity.NewVerifier(f, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Verify(); err != nil {
+		r.fail("image signature not valid: %s", err)
+		return r, nil
+	}
+
+	var anySigners []string
+	for fp, groups := range signed {
+		anySigners = append(anySigners, fp)
+
+		all := !untrusted[fp]
+		for _, g := range r.Groups {
+			all = all && groups[g]
+		}
+		if all {
+			r.Signers = append(r.Signers, fp)
+		}
+	}
+	sort.Strings(r.Signers)
+	sort.Strings(anySigners)
+
+	for i, rule := range p.Rules {
+		rr := PolicyRuleReport{Name: rule.Name, Required: rule.Threshold, Matched: []string{}}
+		if rr.Name == "" {
+			rr.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if rr.Required == 0 {
+			rr.Required = len(rule.KeyFPs)
+		}
+
+		for _, fp := range r.Signers {
+			if containsFingerprint(rule.KeyFPs, fp) {
+				rr.Matched = append(rr.Matched, fp)
+			}
+		}
+
+		rr.Satisfied = len(rr.Matched) >= rr.Required
+		if !rr.Satisfied {
+			r.fail("rule %s: signed by %d of the %d required keys", rr.Name, len(rr.Matched), rr.Required)
+		}
+		r.Rules = append(r.Rules, rr)
+	}
+
+	for _, fp := range anySigners {
+		if containsFingerprint(p.Forbidden, fp) {
+			r.Forbidden = append(r.Forbidden, fp)
+			r.fail("signed by forbidden key %s", strings.ToUpper(fp))
+		}
+	}
+
+	return r, nil
+}
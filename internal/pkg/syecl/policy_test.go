@@ -0,0 +1,281 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package syecl
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/pkg/sypgp"
+	toml "github.com/pelletier/go-toml"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+const KeyFP3 = "5994BE54C31CF1B5E1994F987C52CF6D055F072B"
+
+func TestLoadPolicy(t *testing.T) {
+	p, err := LoadPolicy(filepath.Join("testdata", "policies", "TwoRules.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Policy{
+		Groups: []uint32{1},
+		Rules: []PolicyRule{
+			{Name: "team", KeyFPs: []string{"12045C8C0B1004D058DE4BEDA20C27EE7FF7BA84"}},
+			{Name: "release", Threshold: 2, KeyFPs: []string{"12045C8C0B1004D058DE4BEDA20C27EE7FF7BA84", KeyFP2, KeyFP3}},
+		},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got policy %+v, want %+v", p, want)
+	}
+	if err := p.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       Policy
+		wantErr bool
+	}{
+		{"Empty", Policy{}, true},
+		{"Rule", Policy{Rules: []PolicyRule{{KeyFPs: []string{KeyFP1}}}}, false},
+		{"Forbidden", Policy{Forbidden: []string{KeyFP1}}, false},
+		{"BadGroup", Policy{Groups: []uint32{0}, Forbidden: []string{KeyFP1}}, true},
+		{"NoKey", Policy{Rules: []PolicyRule{{Name: "r"}}}, true},
+		{"BadThreshold", Policy{Rules: []PolicyRule{{Threshold: 2, KeyFPs: []string{KeyFP1}}}}, true},
+		{"NegativeThreshold", Policy{Rules: []PolicyRule{{Threshold: -1, KeyFPs: []string{KeyFP1}}}}, true},
+		{"BadFingerprint", Policy{Rules: []PolicyRule{{KeyFPs: []string{"bad"}}}}, true},
+		{"BadForbidden", Policy{Forbidden: []string{"bad"}}, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	e := getTestEntity(t)
+	kr := openpgp.EntityList{e}
+
+	revoked := *e
+	revoked.Revocations = []*packet.Signature{{CreationTime: time.Now()}}
+
+	unsigned := filepath.Join("testdata", "images", "one-group.sif")
+	signed := filepath.Join("testdata", "images", "one-group-signed.sif")
+
+	tests := []struct {
+		name          string
+		path          string
+		p             Policy
+		kr            openpgp.KeyRing
+		db            sypgp.TrustDB
+		wantSatisfied bool
+		wantReasons   int
+		wantWarnings  int
+	}{
+		{
+			name:          "AnyOf",
+			path:          signed,
+			p:             Policy{Rules: []PolicyRule{{Threshold: 1, KeyFPs: []string{KeyFP1, KeyFP2}}}},
+			kr:            kr,
+			wantSatisfied: true,
+		},
+		{
+			name:        "AllOf",
+			path:        signed,
+			p:           Policy{Rules: []PolicyRule{{KeyFPs: []string{KeyFP1, KeyFP2}}}},
+			kr:          kr,
+			wantReasons: 1,
+		},
+		{
+			name: "AllRules",
+			path: signed,
+			p: Policy{Rules: []PolicyRule{
+				{Name: "team", KeyFPs: []string{KeyFP1}},
+				{Name: "release", KeyFPs: []string{KeyFP2}},
+			}},
+			kr:          kr,
+			wantReasons: 1,
+		},
+		{
+			name:          "Group",
+			path:          signed,
+			p:             Policy{Groups: []uint32{1}, Rules: []PolicyRule{{KeyFPs: []string{KeyFP1}}}},
+			kr:            kr,
+			wantSatisfied: true,
+		},
+		{
+			name:        "Forbidden",
+			path:        signed,
+			p:           Policy{Forbidden: []string{KeyFP1}},
+			kr:          kr,
+			wantReasons: 1,
+		},
+		{
+			name:          "NotForbidden",
+			path:          signed,
+			p:             Policy{Forbidden: []string{KeyFP2}},
+			kr:            kr,
+			wantSatisfied: true,
+		},
+		{
+			name:        "Unsigned",
+			path:        unsigned,
+			p:           Policy{Rules: []PolicyRule{{KeyFPs: []string{KeyFP1}}}},
+			kr:          kr,
+			wantReasons: 1,
+		},
+		{
+			name:         "UnknownKey",
+			path:         signed,
+			p:            Policy{Rules: []PolicyRule{{KeyFPs: []string{KeyFP1}}}},
+			kr:           openpgp.EntityList{},
+			wantReasons:  1,
+			wantWarnings: 1,
+		},
+		{
+			name:         "RevokedKey",
+			path:         signed,
+			p:            Policy{Rules: []PolicyRule{{KeyFPs: []string{KeyFP1}}}},
+			kr:           openpgp.EntityList{&revoked},
+			wantReasons:  1,
+			wantWarnings: 1,
+		},
+		{
+			name:         "DistrustedKey",
+			path:         signed,
+			p:            Policy{Rules: []PolicyRule{{KeyFPs: []string{KeyFP1}}}},
+			kr:           kr,
+			db:           sypgp.TrustDB{strings.ToUpper(KeyFP1): sypgp.TrustNever},
+			wantReasons:  1,
+			wantWarnings: 1,
+		},
+		{
+			name:         "RevokedForbidden",
+			path:         signed,
+			p:            Policy{Forbidden: []string{KeyFP1}},
+			kr:           openpgp.EntityList{&revoked},
+			wantReasons:  1,
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := sif.LoadContainer(tt.path, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.UnloadContainer()
+
+			r, err := tt.p.Evaluate(&f, tt.kr, tt.db, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got, want := r.Satisfied, tt.wantSatisfied; got != want {
+				t.Errorf("got satisfied %v, want %v (reasons: %v)", got, want, r.Reasons)
+			}
+			if got, want := len(r.Reasons), tt.wantReasons; got != want {
+				t.Errorf("got %d reasons, want %d: %v", got, want, r.Reasons)
+			}
+			if got, want := len(r.Warnings), tt.wantWarnings; got != want {
+				t.Errorf("got %d warnings, want %d: %v", got, want, r.Warnings)
+			}
+			if err := r.Err(); (err == nil) != tt.wantSatisfied {
+				t.Errorf("got error %v, want satisfied %v", err, tt.wantSatisfied)
+			} else if err != nil && !errors.Is(err, errPolicyNotSatisfied) {
+				t.Errorf("got error %v, want %v", err, errPolicyNotSatisfied)
+			}
+		})
+	}
+}
+
+func TestShouldRunPolicy(t *testing.T) {
+	dirPath, err := filepath.Abs(filepath.Join("testdata", "images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "ecl-policy-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writePolicy := func(name string, p Policy) string {
+		b, err := toml.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name+".toml")
+		if err := ioutil.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	okPolicy := writePolicy("ok", Policy{Rules: []PolicyRule{{KeyFPs: []string{KeyFP1}}}})
+	errPolicy := writePolicy("err", Policy{Rules: []PolicyRule{{KeyFPs: []string{KeyFP2}}}})
+
+	tests := []struct {
+		name    string
+		eg      Execgroup
+		legacy  bool
+		wantErr bool
+	}{
+		{"PolicyOK", Execgroup{ListMode: "policy", DirPath: dirPath, Policy: okPolicy}, false, false},
+		{"PolicyError", Execgroup{ListMode: "policy", DirPath: dirPath, Policy: errPolicy}, false, true},
+		{"PolicyNotFound", Execgroup{ListMode: "policy", DirPath: dirPath, Policy: filepath.Join(dir, "none")}, false, true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := EclConfig{Activated: true, ExecGroups: []Execgroup{tt.eg}}
+
+			got, err := c.ShouldRun(filepath.Join(dirPath, "one-group-signed.sif"), openpgp.EntityList{getTestEntity(t)}, nil)
+			if want := !tt.wantErr; got != want {
+				t.Errorf("got run %v, want %v", got, want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// policy mode validation
+	for _, c := range []EclConfig{
+		{ExecGroups: []Execgroup{{ListMode: "policy"}}},
+		{ExecGroups: []Execgroup{{ListMode: "policy", Policy: "relative.toml"}}},
+		{Legacy: true, ExecGroups: []Execgroup{{ListMode: "policy", Policy: okPolicy}}},
+	} {
+		if err := c.ValidateConfig(); err == nil {
+			t.Errorf("unexpected success validating %+v", c)
+		}
+	}
+	c := EclConfig{ExecGroups: []Execgroup{{ListMode: "policy", Policy: okPolicy}}}
+	if err := c.ValidateConfig(); err != nil {
+		t.Errorf("unexpected error validating %+v: %v", c, err)
+	}
+}
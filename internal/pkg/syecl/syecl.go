@@ -1,5 +1,5 @@
 // Copyright (c) 2020, Control Command Inc. All rights reserved.
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -11,6 +11,7 @@
 package syecl
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -18,9 +19,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/hpcng/sif/pkg/integrity"
 	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/sypki"
+	"github.com/hpcng/singularity/pkg/sypgp"
 	toml "github.com/pelletier/go-toml"
 	"golang.org/x/crypto/openpgp"
 )
@@ -39,17 +43,20 @@ type EclConfig struct {
 
 // Execgroup describes an execution group, the main unit of configuration:
 //	TagName: a descriptive identifier
-//	ListMode: whether the execgroup follows a whitelist, whitestrict or blacklist model
+//	ListMode: whether the execgroup follows a whitelist, whitestrict, blacklist or policy model
 //		whitelist: one or more KeyFP's present and verified,
 //		whitestrict: all KeyFP's present and verified,
 //		blacklist: none of the KeyFP should be present
+//		policy: the verification policy file is satisfied
 //	DirPath: containers must be stored in this directory path
 //	KeyFPs: list of Key Fingerprints of entities to verify
+//	Policy: path of the verification policy file used by the policy mode
 type Execgroup struct {
 	TagName  string   `toml:"tagname"`
 	ListMode string   `toml:"mode"`
 	DirPath  string   `toml:"dirpath"`
 	KeyFPs   []string `toml:"keyfp"`
+	Policy   string   `toml:"policy,omitempty"`
 }
 
 // LoadConfig opens an ECL config file and unmarshals it into structures
@@ -100,8 +107,22 @@ func (ecl *EclConfig) ValidateConfig() error {
 				return fmt.Errorf("all execgroup dirpath`s should be fully cleaned with symlinks resolved")
 			}
 		}
-		if v.ListMode != "whitelist" && v.ListMode != "whitestrict" && v.ListMode != "blacklist" {
-			return fmt.Errorf("the mode field can only be either: whitelist, whitestrict, blacklist")
+		if v.ListMode == "policy" {
+			if ecl.Legacy {
+				return fmt.Errorf("policy mode can't be used with legacy signatures")
+			}
+			if !filepath.IsAbs(v.Policy) {
+				return fmt.Errorf("policy mode requires an absolute policy file path")
+			}
+			p, err := LoadPolicy(v.Policy)
+			if err != nil {
+				return err
+			}
+			if err := p.Validate(); err != nil {
+				return fmt.Errorf("while validating policy %s: %s", v.Policy, err)
+			}
+		} else if v.ListMode != "whitelist" && v.ListMode != "whitestrict" && v.ListMode != "blacklist" {
+			return fmt.Errorf("the mode field can only be either: whitelist, whitestrict, blacklist, policy")
 		}
 		for _, k := range v.KeyFPs {
 			decoded, err := hex.DecodeString(k)
@@ -186,26 +207,67 @@ func checkBlackList(v *integrity.Verifier, egroup *Execgroup) (ok bool, err erro
 	return true, nil
 }
 
-func shouldRun(ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (ok bool, err error) {
-	var egroup *Execgroup
+// checkPolicy evaluates authorization by requiring the image to satisfy the
+// execgroup verification policy, signers being checked against the trust
+// database db
+func checkPolicy(f *sif.FileImage, kr openpgp.KeyRing, db sypgp.TrustDB, egroup *Execgroup) (ok bool, err error) {
+	p, err := LoadPolicy(egroup.Policy)
+	if err != nil {
+		return false, err
+	}
+
+	r, err := p.Evaluate(f, kr, db, nil)
+	if err != nil {
+		return false, err
+	}
+	if err := r.Err(); err != nil {
+		return false, err
+	}
 
+	return true, nil
+}
+
+// execGroup returns the execgroup of the container at path, or the execgroup
+// with an empty dirpath if the container isn't part of any execgroup.
+func (ecl *EclConfig) execGroup(path string) *Execgroup {
 	// look what execgroup a container is part of
-	for _, v := range ecl.ExecGroups {
-		if filepath.Dir(fp.Name()) == v.DirPath {
-			egroup = &v
-			break
+	for i := range ecl.ExecGroups {
+		if filepath.Dir(path) == ecl.ExecGroups[i].DirPath {
+			return &ecl.ExecGroups[i]
 		}
 	}
 	// go back at it and this time look for an empty dirpath execgroup to fallback into
-	if egroup == nil {
-		for _, v := range ecl.ExecGroups {
-			if v.DirPath == "" {
-				egroup = &v
-				break
-			}
+	for i := range ecl.ExecGroups {
+		if ecl.ExecGroups[i].DirPath == "" {
+			return &ecl.ExecGroups[i]
+		}
+	}
+	return nil
+}
+
+// newVerifier returns a verifier of the signatures of the container f with
+// the keyring kr. Legacy signatures only cover the primary partition, and
+// the object group holding X.509 signatures isn't covered by OpenPGP
+// signatures.
+func newVerifier(f *sif.FileImage, kr openpgp.KeyRing, legacy bool) (*integrity.Verifier, error) {
+	opts := []integrity.VerifierOpt{integrity.OptVerifyWithKeyRing(kr)}
+	if legacy {
+		// Legacy behavior is to verify the primary partition only.
+		od, _, err := f.GetPartPrimSys()
+		if err != nil {
+			return nil, fmt.Errorf("get primary system partition: %v", err)
+		}
+		opts = append(opts, integrity.OptVerifyLegacy(), integrity.OptVerifyObject(od.ID))
+	} else if sypki.SignatureGroupID(f) != 0 {
+		for _, groupID := range sypki.ObjectGroupIDs(f) {
+			opts = append(opts, integrity.OptVerifyGroup(groupID))
 		}
 	}
+	return integrity.NewVerifier(f, opts...)
+}
 
+func shouldRun(ecl *EclConfig, fp *os.File, kr openpgp.KeyRing, db sypgp.TrustDB) (ok bool, err error) {
+	egroup := ecl.execGroup(fp.Name())
 	if egroup == nil {
 		return false, fmt.Errorf("%s not part of any execgroup", fp.Name())
 	}
@@ -215,17 +277,11 @@ func shouldRun(ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (ok bool, err er
 		return false, err
 	}
 
-	opts := []integrity.VerifierOpt{integrity.OptVerifyWithKeyRing(kr)}
-	if ecl.Legacy {
-		// Legacy behavior is to verify the primary partition only.
-		od, _, err := f.GetPartPrimSys()
-		if err != nil {
-			return false, fmt.Errorf("get primary system partition: %v", err)
-		}
-		opts = append(opts, integrity.OptVerifyLegacy(), integrity.OptVerifyObject(od.ID))
+	if egroup.ListMode == "policy" {
+		return checkPolicy(&f, kr, db, egroup)
 	}
 
-	v, err := integrity.NewVerifier(&f, opts...)
+	v, err := newVerifier(&f, kr, ecl.Legacy)
 	if err != nil {
 		return false, err
 	}
@@ -248,8 +304,9 @@ func shouldRun(ecl *EclConfig, fp *os.File, kr openpgp.KeyRing) (ok bool, err er
 	return false, fmt.Errorf("ecl config file invalid")
 }
 
-// ShouldRun determines if a container should run according to its execgroup rules
-func (ecl *EclConfig) ShouldRun(cpath string, kr openpgp.KeyRing) (ok bool, err error) {
+// ShouldRun determines if a container should run according to its execgroup rules,
+// policy execgroups check signers against the trust database db
+func (ecl *EclConfig) ShouldRun(cpath string, kr openpgp.KeyRing, db sypgp.TrustDB) (ok bool, err error) {
 	// look if ECL rules are activated
 	if !ecl.Activated {
 		return true, nil
@@ -261,15 +318,108 @@ func (ecl *EclConfig) ShouldRun(cpath string, kr openpgp.KeyRing) (ok bool, err
 	}
 	defer fp.Close()
 
-	return shouldRun(ecl, fp, kr)
+	return shouldRun(ecl, fp, kr, db)
 }
 
-// ShouldRunFp determines if an already opened container should run according to its execgroup rules
-func (ecl *EclConfig) ShouldRunFp(fp *os.File, kr openpgp.KeyRing) (ok bool, err error) {
+// ShouldRunFp determines if an already opened container should run according to its execgroup rules,
+// policy execgroups check signers against the trust database db
+func (ecl *EclConfig) ShouldRunFp(fp *os.File, kr openpgp.KeyRing, db sypgp.TrustDB) (ok bool, err error) {
 	// look if ECL rules are activated
 	if !ecl.Activated {
 		return true, nil
 	}
 
-	return shouldRun(ecl, fp, kr)
+	return shouldRun(ecl, fp, kr, db)
+}
+
+// ExecGroupFp returns the tag name of the execgroup of an already opened
+// container, used to grant capabilities to the container. A tag name is
+// only returned if the ECL rules are activated, and if the container
+// satisfies the rules of a whitelist, whitestrict or policy execgroup, as
+// a blacklist execgroup says nothing about the signers of the container.
+// Legacy signatures never grant capabilities. Policy execgroups check
+// signers against the trust database db.
+func (ecl *EclConfig) ExecGroupFp(fp *os.File, kr openpgp.KeyRing, db sypgp.TrustDB) (string, error) {
+	if !ecl.Activated {
+		return "", nil
+	}
+	if ecl.Legacy {
+		return "", fmt.Errorf("legacy signatures can't grant capabilities")
+	}
+
+	egroup := ecl.execGroup(fp.Name())
+	if egroup == nil {
+		return "", nil
+	}
+	switch egroup.ListMode {
+	case "whitelist", "whitestrict":
+		if len(egroup.KeyFPs) == 0 {
+			return "", nil
+		}
+	case "policy":
+	default:
+		return "", nil
+	}
+
+	if ok, err := shouldRun(ecl, fp, kr, db); err != nil {
+		return "", err
+	} else if !ok {
+		return "", nil
+	}
+	return egroup.TagName, nil
+}
+
+// SignedByFp returns the fingerprints of the entities of the keyring kr
+// that have signed all objects of an already opened container. Legacy
+// signatures are not considered. Signers are checked against the trust
+// database db: an image signed with a revoked, expired or distrusted key
+// is rejected.
+func SignedByFp(fp *os.File, kr openpgp.KeyRing, db sypgp.TrustDB) ([]string, error) {
+	return signedByFp(fp, kr, db, time.Now())
+}
+
+// signedByFp implements SignedByFp, checking key expiration at time t.
+func signedByFp(fp *os.File, kr openpgp.KeyRing, db sypgp.TrustDB, t time.Time) ([]string, error) {
+	f, err := sif.LoadContainerFp(fp, true)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := newVerifier(&f, kr, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Verify(); err != nil {
+		return nil, fmt.Errorf("image signature not valid: %v", err)
+	}
+
+	keyfps, err := v.AllSignedBy()
+	if err != nil {
+		return nil, err
+	}
+
+	fps := make([]string, 0, len(keyfps))
+	for _, u := range keyfps {
+		e := signingEntity(kr, u)
+		if e == nil {
+			return nil, fmt.Errorf("signing entity %X not found in keyring", u)
+		}
+		err := db.CheckKey(e, t)
+		if errors.Is(err, sypgp.ErrKeyRevoked) || errors.Is(err, sypgp.ErrKeyExpired) || errors.Is(err, sypgp.ErrKeyDistrusted) {
+			return nil, fmt.Errorf("signing key %v", err)
+		}
+		fps = append(fps, strings.ToUpper(hex.EncodeToString(u[:])))
+	}
+	return fps, nil
+}
+
+// signingEntity returns the entity of the keyring kr with the primary key
+// fingerprint fp, or nil if not found.
+func signingEntity(kr openpgp.KeyRing, fp [20]byte) *openpgp.Entity {
+	for _, k := range kr.KeysById(binary.BigEndian.Uint64(fp[12:])) {
+		if k.Entity != nil && k.Entity.PrimaryKey.Fingerprint == fp {
+			return k.Entity
+		}
+	}
+	return nil
 }
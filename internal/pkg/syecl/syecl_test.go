@@ -1,5 +1,5 @@
 // Copyright (c) 2020, Control Command Inc. All rights reserved.
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -7,14 +7,24 @@
 package syecl
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/hpcng/sif/pkg/sif"
+	"github.com/hpcng/singularity/internal/pkg/sypki"
+	"github.com/hpcng/singularity/pkg/sypgp"
 	"golang.org/x/crypto/openpgp"
 	"gotest.tools/v3/golden"
 )
@@ -436,7 +446,7 @@ func TestShouldRun(t *testing.T) {
 			}
 
 			// Test ShouldRun (takes path).
-			got, err := c.ShouldRun(tt.path, openpgp.EntityList{getTestEntity(t)})
+			got, err := c.ShouldRun(tt.path, openpgp.EntityList{getTestEntity(t)}, nil)
 
 			if want := !tt.wantErr; got != want {
 				t.Errorf("got run %v, want %v", got, want)
@@ -453,7 +463,7 @@ func TestShouldRun(t *testing.T) {
 			}
 			defer f.Close()
 
-			got, err = c.ShouldRunFp(f, openpgp.EntityList{getTestEntity(t)})
+			got, err = c.ShouldRunFp(f, openpgp.EntityList{getTestEntity(t)}, nil)
 
 			if want := !tt.wantErr; got != want {
 				t.Errorf("got run %v, want %v", got, want)
@@ -465,3 +475,180 @@ func TestShouldRun(t *testing.T) {
 		})
 	}
 }
+
+func TestSignedByFp(t *testing.T) {
+	e := getTestEntity(t)
+	expiry, ok := sypgp.KeyExpiry(e)
+	if !ok {
+		t.Fatal("test key has no expiration")
+	}
+	beforeExpiry := expiry.Add(-time.Hour)
+
+	signed := filepath.Join("testdata", "images", "one-group-signed.sif")
+	legacySigned := filepath.Join("testdata", "images", "one-group-legacy-signed.sif")
+	unsigned := filepath.Join("testdata", "images", "one-group.sif")
+
+	tests := []struct {
+		name    string
+		path    string
+		db      sypgp.TrustDB
+		t       time.Time
+		want    []string
+		wantErr bool
+	}{
+		{"Signed", signed, nil, beforeExpiry, []string{strings.ToUpper(KeyFP1)}, false},
+		{"NotFullyTrusted", signed, sypgp.TrustDB{strings.ToUpper(KeyFP1): sypgp.TrustMarginal}, beforeExpiry, []string{strings.ToUpper(KeyFP1)}, false},
+		{"Distrusted", signed, sypgp.TrustDB{strings.ToUpper(KeyFP1): sypgp.TrustNever}, beforeExpiry, nil, true},
+		{"Expired", signed, nil, expiry, nil, true},
+		{"Unsigned", unsigned, nil, beforeExpiry, nil, true},
+		{"LegacySigned", legacySigned, nil, beforeExpiry, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, err := signedByFp(f, openpgp.EntityList{e}, tt.db, tt.t)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got fingerprints %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecGroupFp(t *testing.T) {
+	dirPath, err := filepath.Abs(filepath.Join("testdata", "images"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wl1 := Execgroup{TagName: "wl1", ListMode: "whitelist", DirPath: dirPath, KeyFPs: []string{KeyFP1}}
+	wl2 := Execgroup{TagName: "wl2", ListMode: "whitelist", DirPath: dirPath, KeyFPs: []string{KeyFP2}}
+	ws1 := Execgroup{TagName: "ws1", ListMode: "whitestrict", DirPath: dirPath, KeyFPs: []string{KeyFP1}}
+	wsNoKey := Execgroup{TagName: "ws", ListMode: "whitestrict", DirPath: dirPath}
+	bl2 := Execgroup{TagName: "bl2", ListMode: "blacklist", DirPath: dirPath, KeyFPs: []string{KeyFP2}}
+
+	unsigned := filepath.Join(dirPath, "one-group.sif")
+	signed := filepath.Join(dirPath, "one-group-signed.sif")
+	legacySigned := filepath.Join(dirPath, "one-group-legacy-signed.sif")
+
+	//nolint:maligned // the aligned form, with eg first, is not as easy to read
+	tests := []struct {
+		name      string
+		activated bool
+		legacy    bool
+		eg        Execgroup
+		path      string
+		want      string
+		wantErr   bool
+	}{
+		{"Whitelist", true, false, wl1, signed, "wl1", false},
+		{"WhitelistNotSigner", true, false, wl2, signed, "", true},
+		{"WhitelistUnsigned", true, false, wl1, unsigned, "", true},
+		{"Whitestrict", true, false, ws1, signed, "ws1", false},
+		{"WhitestrictNoKey", true, false, wsNoKey, unsigned, "", false},
+		{"Blacklist", true, false, bl2, signed, "", false},
+		{"Deactivated", false, false, wl1, signed, "", false},
+		{"Legacy", true, true, wl1, legacySigned, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := EclConfig{
+				Activated:  tt.activated,
+				Legacy:     tt.legacy,
+				ExecGroups: []Execgroup{tt.eg},
+			}
+
+			f, err := os.Open(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, err := c.ExecGroupFp(f, openpgp.EntityList{getTestEntity(t)}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got err %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got execgroup %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// x509Signed returns the path of a copy of the container at path, with an
+// X.509 signature added in a temporary directory dir.
+func x509Signed(t *testing.T, dir, path string) string {
+	t.Helper()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := filepath.Join(dir, filepath.Base(path))
+	if err := ioutil.WriteFile(signed, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := sif.LoadContainer(signed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.UnloadContainer()
+
+	s, err := sypki.NewSigner(&f, key, []*x509.Certificate{cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign(); err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestShouldRunX509Signed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ecl-x509-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := x509Signed(t, dir, filepath.Join("testdata", "images", "one-group-signed.sif"))
+	c := EclConfig{
+		Activated:  true,
+		ExecGroups: []Execgroup{{ListMode: "whitestrict", DirPath: dir, KeyFPs: []string{KeyFP1}}},
+	}
+
+	if ok, err := c.ShouldRun(path, openpgp.EntityList{getTestEntity(t)}, nil); !ok || err != nil {
+		t.Errorf("got run %v (err %v), want true", ok, err)
+	}
+}
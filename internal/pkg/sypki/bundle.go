@@ -0,0 +1,175 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypki
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+const bundleVersion1 = 1
+
+var (
+	errBundleVersion            = errors.New("unsupported signature bundle version")
+	errBundleEmpty              = errors.New("signature bundle holds no signature")
+	errClearsignedMsgNotFound   = errors.New("clearsigned message not found")
+	errBundleSignatureMalformed = errors.New("signature holds neither an OpenPGP nor an X.509 signature")
+	errBundleSignatureAmbiguous = errors.New("signature holds both an OpenPGP and an X.509 signature")
+)
+
+// bundleSignature is a signature of an object group held in a Bundle, either OpenPGP or X.509.
+type bundleSignature struct {
+	// GroupID is the ID of the object group covered by the signature.
+	GroupID uint32 `json:"groupId"`
+	// PGP is the imageMetadata clearsigned with an OpenPGP key.
+	PGP string `json:"pgp,omitempty"`
+	// X509 is the signature envelope of an X.509 signature.
+	X509 *envelope `json:"x509,omitempty"`
+}
+
+// Bundle holds signatures of a SIF image stored outside of the image, so they can be kept next
+// to the image or distributed separately. Signatures cover the same integrity-protected fields
+// as the signatures embedded in the image.
+type Bundle struct {
+	Version    int               `json:"version"`
+	Signatures []bundleSignature `json:"signatures"`
+}
+
+// LoadBundle reads the signature bundle stored in the file at path.
+func LoadBundle(path string) (*Bundle, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	b := new(Bundle)
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("while decoding signature bundle %s: %w", path, err)
+	}
+	if b.Version != bundleVersion1 {
+		return nil, fmt.Errorf("%s: %w", path, errBundleVersion)
+	}
+	if len(b.Signatures) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, errBundleEmpty)
+	}
+	for i, s := range b.Signatures {
+		if s.PGP == "" && s.X509 == nil {
+			return nil, fmt.Errorf("%s: signature %d: %w", path, i+1, errBundleSignatureMalformed)
+		}
+		if s.PGP != "" && s.X509 != nil {
+			return nil, fmt.Errorf("%s: signature %d: %w", path, i+1, errBundleSignatureAmbiguous)
+		}
+	}
+	return b, nil
+}
+
+// WriteFile writes the signature bundle to the file at path, which is created or truncated.
+func (b *Bundle) WriteFile(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// signPGP returns the metadata md clearsigned with the OpenPGP entity of s.
+func (s *Signer) signPGP(md []byte) (string, error) {
+	var buf bytes.Buffer
+
+	w, err := clearsign.Encode(&buf, s.entity.PrivateKey, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(md); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// SignDetached computes one or more signatures of the image and returns them in a Bundle, the
+// image is left untouched.
+func (s *Signer) SignDetached() (*Bundle, error) {
+	tasks, err := s.tasks()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{Version: bundleVersion1}
+
+	for _, t := range tasks {
+		bs := bundleSignature{GroupID: t.groupID}
+
+		if s.entity != nil {
+			md, err := s.metadata(t)
+			if err != nil {
+				return nil, err
+			}
+			if bs.PGP, err = s.signPGP(md); err != nil {
+				return nil, fmt.Errorf("while signing: %w", err)
+			}
+		} else if bs.X509, err = s.sign(t); err != nil {
+			return nil, err
+		}
+
+		b.Signatures = append(b.Signatures, bs)
+	}
+
+	return b, nil
+}
+
+// signature is a signature to verify, stored either in the image or in a Bundle.
+type signature struct {
+	// id is the ID of the signature object, or the position of the signature in the bundle.
+	id uint32
+	// pgp is the clearsigned metadata of an OpenPGP signature.
+	pgp []byte
+	// x509 is the JSON encoded envelope of an X.509 signature.
+	x509 []byte
+}
+
+// bundleSignatures returns the signatures of b covering group groupID. Only OpenPGP signatures
+// are returned if pgp is true, only X.509 signatures otherwise.
+func bundleSignatures(b *Bundle, groupID uint32, pgp bool) ([]signature, error) {
+	var sigs []signature
+
+	for i, s := range b.Signatures {
+		if s.GroupID != groupID {
+			continue
+		}
+
+		sig := signature{id: uint32(i + 1)}
+		if pgp && s.PGP != "" {
+			sig.pgp = []byte(s.PGP)
+		} else if !pgp && s.X509 != nil {
+			data, err := json.Marshal(s.X509)
+			if err != nil {
+				return nil, err
+			}
+			sig.x509 = data
+		} else {
+			continue
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// decodeClearsigned returns the clearsigned block found in data.
+func decodeClearsigned(data []byte) (*clearsign.Block, error) {
+	b, _ := clearsign.Decode(data)
+	if b == nil {
+		return nil, errClearsignedMsgNotFound
+	}
+	return b, nil
+}
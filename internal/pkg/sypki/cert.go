@@ -0,0 +1,109 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypki
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// LoadCertificates returns the certificates found in the PEM file at path,
+// in the order they appear in the file.
+func LoadCertificates(path string) ([]*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading certificates: %s", err)
+	}
+
+	var certs []*x509.Certificate
+
+	for {
+		var block *pem.Block
+
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("while parsing certificate from %s: %s", path, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+
+	return certs, nil
+}
+
+// LoadCertPool returns a certificate pool populated with the certificates
+// found in the PEM file at path.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	certs, err := LoadCertificates(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return pool, nil
+}
+
+// CertificateSubject returns the subject distinguished name of cert.
+func CertificateSubject(cert *x509.Certificate) string {
+	return cert.Subject.String()
+}
+
+// CertificateSANs returns the subject alternative names of cert.
+func CertificateSANs(cert *x509.Certificate) []string {
+	var sans []string
+
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+// matchesSubject returns true if either the subject distinguished name or
+// the subject common name of cert is equal to one of subjects.
+func matchesSubject(cert *x509.Certificate, subjects []string) bool {
+	for _, s := range subjects {
+		if s == CertificateSubject(cert) || s == cert.Subject.CommonName {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSAN returns true if one of the subject alternative names of cert
+// is equal to one of sans, DNS names and email addresses are compared
+// case-insensitively.
+func matchesSAN(cert *x509.Certificate, sans []string) bool {
+	for _, s := range sans {
+		for _, san := range CertificateSANs(cert) {
+			if strings.EqualFold(s, san) {
+				return true
+			}
+		}
+	}
+	return false
+}
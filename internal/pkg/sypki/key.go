@@ -0,0 +1,97 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+var errNoPrivateKey = errors.New("no private key found")
+
+// PINFunc returns the PIN used to log in a PKCS#11 token when
+// the PIN isn't provided by the PKCS#11 URI.
+type PINFunc func() (string, error)
+
+// Key is a private key used to sign images, it may be loaded
+// from a PEM file or be stored in a PKCS#11 token.
+type Key interface {
+	crypto.Signer
+
+	// Certificate returns the certificate associated to the key
+	// if available, nil otherwise.
+	Certificate() *x509.Certificate
+
+	// Close releases resources associated to the key.
+	Close() error
+}
+
+// LoadKey loads the private key referenced by ref which is either
+// the path of a PEM encoded private key or a PKCS#11 URI (RFC 7512).
+func LoadKey(ref string, pin PINFunc) (Key, error) {
+	if strings.HasPrefix(ref, pkcs11Scheme) {
+		return loadPKCS11Key(ref, pin)
+	}
+	return loadPEMKey(ref)
+}
+
+type pemKey struct {
+	crypto.Signer
+}
+
+func (k *pemKey) Certificate() *x509.Certificate {
+	return nil
+}
+
+func (k *pemKey) Close() error {
+	return nil
+}
+
+// loadPEMKey loads the first private key found in the PEM file at path.
+func loadPEMKey(path string) (Key, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading private key: %s", err)
+	}
+
+	for {
+		var block *pem.Block
+
+		block, b = pem.Decode(b)
+		if block == nil {
+			return nil, fmt.Errorf("%s: %w", path, errNoPrivateKey)
+		}
+
+		var key interface{}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, fmt.Errorf("%s: encrypted private keys are not supported", path)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("while parsing private key: %s", err)
+		}
+
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported private key type %T", path, key)
+		}
+		return &pemKey{signer}, nil
+	}
+}
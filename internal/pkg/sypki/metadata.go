@@ -0,0 +1,232 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+// Package sypki implements signing and verification of SIF images with X.509 certificates.
+//
+// Signatures cover the same integrity-protected fields as OpenPGP signatures (SIF global header,
+// data object descriptors and data objects) and are stored in the SIF as generic data objects
+// linked to the signed object group.
+//
+// Signatures can also be detached from the image and stored in a signature bundle, which holds
+// X.509 or OpenPGP signatures computed over the same fields.
+package sypki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hpcng/sif/pkg/integrity"
+	"github.com/hpcng/sif/pkg/sif"
+)
+
+const metadataVersion1 = 1
+
+var (
+	errObjectNotSigned      = errors.New("object not signed")
+	errSignedObjectNotFound = errors.New("signed object not found")
+	errDigestMalformed      = errors.New("digest malformed")
+	errMetadataVersion      = errors.New("unsupported metadata version")
+)
+
+// digest is a SHA-256 digest encoded as an hexadecimal string.
+type digest string
+
+// newDigest returns the digest of the content read from r.
+func newDigest(r io.Reader) (digest, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return digest(hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// matches returns true if the digest of the content read from r matches d.
+func (d digest) matches(r io.Reader) (bool, error) {
+	if len(d) != hex.EncodedLen(crypto.SHA256.Size()) {
+		return false, errDigestMalformed
+	}
+	v, err := newDigest(r)
+	if err != nil {
+		return false, err
+	}
+	return v == d, nil
+}
+
+// writeHeader writes the integrity-protected fields of h to w.
+func writeHeader(w io.Writer, h sif.Header) error {
+	fields := []interface{}{
+		h.Launch,
+		h.Magic,
+		h.Version,
+		h.ID,
+	}
+
+	for _, f := range fields {
+		if err := binary.Write(w, binary.LittleEndian, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDescriptor writes the integrity-protected fields of od to w.
+func writeDescriptor(w io.Writer, relativeID uint32, od sif.Descriptor) error {
+	fields := []interface{}{
+		od.Datatype,
+		od.Used,
+		relativeID,
+		od.Link,
+		od.Filelen,
+		od.Ctime,
+		od.UID,
+		od.Gid,
+		od.Name,
+		od.Extra,
+	}
+
+	for _, f := range fields {
+		if err := binary.Write(w, binary.LittleEndian, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type objectMetadata struct {
+	RelativeID       uint32 `json:"relativeId"`
+	DescriptorDigest digest `json:"descriptorDigest"`
+	ObjectDigest     digest `json:"objectDigest"`
+}
+
+// imageMetadata describes the integrity-protected content of a SIF image covered by a signature.
+type imageMetadata struct {
+	Version      int              `json:"version"`
+	HeaderDigest digest           `json:"headerDigest"`
+	Objects      []objectMetadata `json:"objects"`
+}
+
+// getImageMetadata returns imageMetadata for object descriptors ods in f, object IDs are
+// recorded relative to minID.
+func getImageMetadata(f *sif.FileImage, minID uint32, ods []*sif.Descriptor) (imageMetadata, error) {
+	im := imageMetadata{Version: metadataVersion1}
+
+	b := bytes.Buffer{}
+	if err := writeHeader(&b, f.Header); err != nil {
+		return imageMetadata{}, err
+	}
+	d, err := newDigest(&b)
+	if err != nil {
+		return imageMetadata{}, err
+	}
+	im.HeaderDigest = d
+
+	for _, od := range ods {
+		if od.ID < minID {
+			return imageMetadata{}, fmt.Errorf("object %d: minimum ID value invalid", od.ID)
+		}
+		om := objectMetadata{RelativeID: od.ID - minID}
+
+		b.Reset()
+		if err := writeDescriptor(&b, om.RelativeID, *od); err != nil {
+			return imageMetadata{}, err
+		}
+		if om.DescriptorDigest, err = newDigest(&b); err != nil {
+			return imageMetadata{}, err
+		}
+		if om.ObjectDigest, err = newDigest(od.GetReadSeeker(f)); err != nil {
+			return imageMetadata{}, err
+		}
+
+		im.Objects = append(im.Objects, om)
+	}
+
+	return im, nil
+}
+
+// objectIDsMatch verifies the object IDs described by ods match exactly the object IDs described
+// by im.
+func (im imageMetadata) objectIDsMatch(minID uint32, ods []*sif.Descriptor) error {
+	ids := make(map[uint32]bool)
+	for _, om := range im.Objects {
+		ids[minID+om.RelativeID] = false
+	}
+
+	for _, od := range ods {
+		if _, ok := ids[od.ID]; !ok {
+			return fmt.Errorf("object %d: %w", od.ID, errObjectNotSigned)
+		}
+		ids[od.ID] = true
+	}
+
+	for id, seen := range ids {
+		if !seen {
+			return fmt.Errorf("object %d: %w", id, errSignedObjectNotFound)
+		}
+	}
+	return nil
+}
+
+// matches verifies the header and objects described by ods match the metadata in im, and returns
+// the IDs of the verified objects.
+//
+// If the SIF global header does not match, integrity.ErrHeaderIntegrity is returned. If a data
+// object descriptor does not match, an integrity.DescriptorIntegrityError is returned. If a data
+// object does not match, an integrity.ObjectIntegrityError is returned.
+func (im imageMetadata) matches(f *sif.FileImage, minID uint32, ods []*sif.Descriptor) ([]uint32, error) {
+	verified := make([]uint32, 0, len(ods))
+
+	if im.Version != metadataVersion1 {
+		return verified, errMetadataVersion
+	}
+
+	b := bytes.Buffer{}
+	if err := writeHeader(&b, f.Header); err != nil {
+		return verified, err
+	}
+	if ok, err := im.HeaderDigest.matches(&b); err != nil {
+		return verified, err
+	} else if !ok {
+		return verified, integrity.ErrHeaderIntegrity
+	}
+
+	for _, od := range ods {
+		var om *objectMetadata
+		for i := range im.Objects {
+			if minID+im.Objects[i].RelativeID == od.ID {
+				om = &im.Objects[i]
+				break
+			}
+		}
+		if om == nil {
+			return verified, fmt.Errorf("object %d: %w", od.ID, errObjectNotSigned)
+		}
+
+		b.Reset()
+		if err := writeDescriptor(&b, om.RelativeID, *od); err != nil {
+			return verified, err
+		}
+		if ok, err := om.DescriptorDigest.matches(&b); err != nil {
+			return verified, err
+		} else if !ok {
+			return verified, &integrity.DescriptorIntegrityError{ID: od.ID}
+		}
+
+		if ok, err := om.ObjectDigest.matches(od.GetReadSeeker(f)); err != nil {
+			return verified, err
+		} else if !ok {
+			return verified, &integrity.ObjectIntegrityError{ID: od.ID}
+		}
+
+		verified = append(verified, od.ID)
+	}
+
+	return verified, nil
+}
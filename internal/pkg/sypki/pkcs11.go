@@ -0,0 +1,181 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypki
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ThalesIgnite/crypto11"
+)
+
+const pkcs11Scheme = "pkcs11:"
+
+// pkcs11URI holds the attributes of a PKCS#11 URI used to
+// identify a private key.
+type pkcs11URI struct {
+	token      string
+	serial     string
+	slotID     *int
+	object     string
+	id         []byte
+	pin        string
+	modulePath string
+}
+
+// parsePKCS11URI parses a PKCS#11 URI as described by RFC 7512, only the
+// attributes relevant to private key selection are supported.
+func parsePKCS11URI(s string) (*pkcs11URI, error) {
+	if !strings.HasPrefix(s, pkcs11Scheme) {
+		return nil, fmt.Errorf("%q is not a PKCS#11 URI", s)
+	}
+	s = strings.TrimPrefix(s, pkcs11Scheme)
+
+	path, query := s, ""
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		path, query = s[:i], s[i+1:]
+	}
+
+	u := &pkcs11URI{}
+
+	for _, attr := range strings.Split(path, ";") {
+		if attr == "" {
+			continue
+		}
+		k, v, err := splitPKCS11Attr(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch k {
+		case "token":
+			u.token = v
+		case "serial":
+			u.serial = v
+		case "slot-id":
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid PKCS#11 slot-id %q: %s", v, err)
+			}
+			u.slotID = &id
+		case "object":
+			u.object = v
+		case "id":
+			u.id = []byte(v)
+		case "type":
+			if v != "private" {
+				return nil, fmt.Errorf("PKCS#11 URI must reference a private key object, got type %q", v)
+			}
+		}
+	}
+
+	for _, attr := range strings.Split(query, "&") {
+		if attr == "" {
+			continue
+		}
+		k, v, err := splitPKCS11Attr(attr)
+		if err != nil {
+			return nil, err
+		}
+		switch k {
+		case "pin-value":
+			u.pin = v
+		case "pin-source":
+			b, err := ioutil.ReadFile(strings.TrimPrefix(v, "file:"))
+			if err != nil {
+				return nil, fmt.Errorf("while reading PKCS#11 PIN: %s", err)
+			}
+			u.pin = strings.TrimRight(string(b), "\r\n")
+		case "module-path":
+			u.modulePath = v
+		}
+	}
+
+	if u.modulePath == "" {
+		return nil, fmt.Errorf("PKCS#11 URI requires a module-path query attribute")
+	}
+	if u.object == "" && u.id == nil {
+		return nil, fmt.Errorf("PKCS#11 URI requires an object or id attribute")
+	}
+
+	return u, nil
+}
+
+// splitPKCS11Attr splits a PKCS#11 URI attribute into its percent-decoded
+// name and value.
+func splitPKCS11Attr(attr string) (string, string, error) {
+	kv := strings.SplitN(attr, "=", 2)
+	if len(kv) != 2 {
+		return "", "", fmt.Errorf("malformed PKCS#11 URI attribute %q", attr)
+	}
+	v, err := url.PathUnescape(kv[1])
+	if err != nil {
+		return "", "", fmt.Errorf("malformed PKCS#11 URI attribute %q: %s", attr, err)
+	}
+	return kv[0], v, nil
+}
+
+type pkcs11Key struct {
+	crypto11.Signer
+
+	ctx  *crypto11.Context
+	cert *x509.Certificate
+}
+
+func (k *pkcs11Key) Certificate() *x509.Certificate {
+	return k.cert
+}
+
+func (k *pkcs11Key) Close() error {
+	return k.ctx.Close()
+}
+
+// loadPKCS11Key returns the private key referenced by the PKCS#11 URI ref.
+func loadPKCS11Key(ref string, pin PINFunc) (Key, error) {
+	u, err := parsePKCS11URI(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.pin == "" && pin != nil {
+		if u.pin, err = pin(); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:        u.modulePath,
+		TokenLabel:  u.token,
+		TokenSerial: u.serial,
+		SlotNumber:  u.slotID,
+		Pin:         u.pin,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("while opening PKCS#11 token: %s", err)
+	}
+
+	var label []byte
+	if u.object != "" {
+		label = []byte(u.object)
+	}
+
+	signer, err := ctx.FindKeyPair(u.id, label)
+	if err != nil {
+		ctx.Close()
+		return nil, fmt.Errorf("while searching PKCS#11 private key: %s", err)
+	} else if signer == nil {
+		ctx.Close()
+		return nil, fmt.Errorf("%s: %w", ref, errNoPrivateKey)
+	}
+
+	// the certificate is optional and may be provided separately
+	cert, _ := ctx.FindCertificate(u.id, label, nil)
+
+	return &pkcs11Key{Signer: signer, ctx: ctx, cert: cert}, nil
+}
@@ -0,0 +1,363 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hpcng/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+// SignatureName is the name of the SIF data objects holding X.509 signatures.
+//
+// X.509 signatures are stored as generic data objects in a dedicated object group, so they don't
+// interfere with OpenPGP signatures, each signature object is linked to the object group it
+// covers.
+const SignatureName = "x509-signature"
+
+var (
+	errNoObjects         = errors.New("no objects to sign")
+	errNoCertificate     = errors.New("no certificate provided")
+	errKeyMismatch       = errors.New("certificate public key doesn't match the private key")
+	errUnsupportedKey    = errors.New("unsupported key type")
+	errObjectNotInGroup  = errors.New("object is not part of an object group")
+	errGroupNotFound     = errors.New("group not found")
+	errSignatureGroup    = errors.New("group holds X.509 signatures")
+	errSignatureEnvelope = errors.New("malformed signature")
+	errDetachedOnly      = errors.New("OpenPGP signatures can only be detached")
+	errNoPrivateEntity   = errors.New("entity has no usable private key")
+)
+
+// envelope is the content of a SIF signature object.
+type envelope struct {
+	// Metadata is the JSON encoded imageMetadata covered by the signature.
+	Metadata json.RawMessage `json:"metadata"`
+	// Signature is the signature computed over Metadata.
+	Signature []byte `json:"signature"`
+	// Certificates is the DER encoded certificate chain, starting with
+	// the signing certificate.
+	Certificates [][]byte `json:"certificates"`
+}
+
+// signTask describes a set of objects of a group covered by one signature.
+type signTask struct {
+	groupID uint32
+	ods     []*sif.Descriptor
+}
+
+// Signer describes a SIF image signer.
+type Signer struct {
+	f      *sif.FileImage
+	key    crypto.Signer
+	certs  []*x509.Certificate
+	entity *openpgp.Entity
+
+	groupIDs  []uint32
+	objectIDs []uint32
+}
+
+// SignerOpt are used to configure a Signer.
+type SignerOpt func(s *Signer) error
+
+// OptSignGroup specifies that a signature be applied to cover all objects in the group with the
+// specified groupID. This may be called multiple times to add multiple group signatures.
+func OptSignGroup(groupID uint32) SignerOpt {
+	return func(s *Signer) error {
+		s.groupIDs = append(s.groupIDs, groupID)
+		return nil
+	}
+}
+
+// OptSignObjects specifies that one or more signature(s) be applied to cover objects with the
+// specified ids. One signature will be applied for each group ID associated with the object(s).
+func OptSignObjects(ids ...uint32) SignerOpt {
+	return func(s *Signer) error {
+		s.objectIDs = append(s.objectIDs, ids...)
+		return nil
+	}
+}
+
+// NewSigner returns a Signer to sign the objects of f with key, certs is the certificate chain
+// starting with the certificate associated to key.
+//
+// By default, one signature is added per object group in f. To override this behavior, consider
+// using OptSignGroup and/or OptSignObjects.
+func NewSigner(f *sif.FileImage, key crypto.Signer, certs []*x509.Certificate, opts ...SignerOpt) (*Signer, error) {
+	if len(certs) == 0 {
+		return nil, errNoCertificate
+	}
+	if !publicKeysEqual(certs[0].PublicKey, key.Public()) {
+		return nil, errKeyMismatch
+	}
+
+	s := &Signer{f: f, key: key, certs: certs}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// NewOpenPGPSigner returns a Signer to sign the objects of f with the OpenPGP entity e. Such a
+// Signer only produces detached signatures, OpenPGP signatures embedded in the image being
+// handled by the integrity package.
+//
+// By default, one signature is computed per object group in f. To override this behavior,
+// consider using OptSignGroup and/or OptSignObjects.
+func NewOpenPGPSigner(f *sif.FileImage, e *openpgp.Entity, opts ...SignerOpt) (*Signer, error) {
+	if e == nil || e.PrivateKey == nil || e.PrivateKey.Encrypted {
+		return nil, errNoPrivateEntity
+	}
+
+	s := &Signer{f: f, entity: e}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// publicKeysEqual returns true if a and b are the same public key.
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	da, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	db, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(da, db)
+}
+
+// groupObjects returns the objects of f in group groupID sorted by ID.
+func groupObjects(f *sif.FileImage, groupID uint32) ([]*sif.Descriptor, error) {
+	var ods []*sif.Descriptor
+
+	for i, od := range f.DescrArr {
+		if od.Used && od.Groupid == groupID|sif.DescrGroupMask {
+			ods = append(ods, &f.DescrArr[i])
+		}
+	}
+	if len(ods) == 0 {
+		return nil, fmt.Errorf("group %d: %w", groupID, errGroupNotFound)
+	}
+
+	sort.Slice(ods, func(i, j int) bool { return ods[i].ID < ods[j].ID })
+	return ods, nil
+}
+
+// isSignature returns true if od is an X.509 signature object.
+func isSignature(od *sif.Descriptor) bool {
+	return od.Used && od.Datatype == sif.DataGeneric && od.GetName() == SignatureName
+}
+
+// SignatureGroupID returns the ID of the object group holding the X.509 signatures of f, or 0 if
+// f doesn't contain any X.509 signature.
+func SignatureGroupID(f *sif.FileImage) uint32 {
+	for i := range f.DescrArr {
+		od := &f.DescrArr[i]
+		if isSignature(od) && od.Groupid != sif.DescrUnusedGroup {
+			return od.Groupid &^ sif.DescrGroupMask
+		}
+	}
+	return 0
+}
+
+// groupIDs returns the IDs of the object groups in f, the X.509 signature group is excluded
+// unless all is true.
+func groupIDs(f *sif.FileImage, all bool) []uint32 {
+	var ids []uint32
+
+	sigGroupID := SignatureGroupID(f)
+
+	seen := make(map[uint32]bool)
+	for _, od := range f.DescrArr {
+		if !od.Used || od.Groupid == sif.DescrUnusedGroup {
+			continue
+		}
+		id := od.Groupid &^ sif.DescrGroupMask
+		if id == sigGroupID && !all {
+			continue
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// ObjectGroupIDs returns the IDs of the object groups of f, the group holding X.509 signatures
+// is excluded.
+func ObjectGroupIDs(f *sif.FileImage) []uint32 {
+	return groupIDs(f, false)
+}
+
+// tasks returns the list of signatures to compute.
+func (s *Signer) tasks() ([]signTask, error) {
+	var tasks []signTask
+
+	sigGroupID := SignatureGroupID(s.f)
+
+	groups := s.groupIDs
+	if len(groups) == 0 && len(s.objectIDs) == 0 {
+		groups = groupIDs(s.f, false)
+	}
+
+	for _, groupID := range groups {
+		if sigGroupID != 0 && groupID == sigGroupID {
+			return nil, fmt.Errorf("group %d: %w", groupID, errSignatureGroup)
+		}
+		ods, err := groupObjects(s.f, groupID)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, signTask{groupID: groupID, ods: ods})
+	}
+
+	byGroup := make(map[uint32][]*sif.Descriptor)
+	var order []uint32
+
+	for _, id := range s.objectIDs {
+		od, _, err := s.f.GetFromDescrID(id)
+		if err != nil {
+			return nil, err
+		}
+		if od.Groupid == sif.DescrUnusedGroup {
+			return nil, fmt.Errorf("object %d: %w", id, errObjectNotInGroup)
+		}
+		groupID := od.Groupid &^ sif.DescrGroupMask
+		if sigGroupID != 0 && groupID == sigGroupID {
+			return nil, fmt.Errorf("object %d: %w", id, errSignatureGroup)
+		}
+		if _, ok := byGroup[groupID]; !ok {
+			order = append(order, groupID)
+		}
+		byGroup[groupID] = append(byGroup[groupID], od)
+	}
+	for _, groupID := range order {
+		ods := byGroup[groupID]
+		sort.Slice(ods, func(i, j int) bool { return ods[i].ID < ods[j].ID })
+		tasks = append(tasks, signTask{groupID: groupID, ods: ods})
+	}
+
+	if len(tasks) == 0 {
+		return nil, errNoObjects
+	}
+	return tasks, nil
+}
+
+// signMetadata returns the signature of the JSON encoded metadata b.
+func signMetadata(key crypto.Signer, b []byte) ([]byte, error) {
+	switch key.Public().(type) {
+	case ed25519.PublicKey:
+		return key.Sign(rand.Reader, b, crypto.Hash(0))
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		sum := sha256.Sum256(b)
+		return key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	return nil, errUnsupportedKey
+}
+
+// metadata returns the JSON encoded imageMetadata of the objects of task t.
+func (s *Signer) metadata(t signTask) ([]byte, error) {
+	// object IDs are relative to the lowest ID of the group
+	gods, err := groupObjects(s.f, t.groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	im, err := getImageMetadata(s.f, gods[0].ID, t.ods)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(im)
+}
+
+// sign computes the signature for task t.
+func (s *Signer) sign(t signTask) (*envelope, error) {
+	md, err := s.metadata(t)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := signMetadata(s.key, md)
+	if err != nil {
+		return nil, fmt.Errorf("while signing: %w", err)
+	}
+
+	e := &envelope{Metadata: md, Signature: sig}
+	for _, c := range s.certs {
+		e.Certificates = append(e.Certificates, c.Raw)
+	}
+	return e, nil
+}
+
+// Sign adds one or more X.509 signatures to the image.
+func (s *Signer) Sign() error {
+	if s.entity != nil {
+		return errDetachedOnly
+	}
+
+	tasks, err := s.tasks()
+	if err != nil {
+		return err
+	}
+
+	// signatures go in a dedicated group, created on first signature
+	sigGroupID := SignatureGroupID(s.f)
+	if sigGroupID == 0 {
+		for _, id := range groupIDs(s.f, true) {
+			if id > sigGroupID {
+				sigGroupID = id
+			}
+		}
+		sigGroupID++
+	}
+
+	for _, t := range tasks {
+		e, err := s.sign(t)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		di := sif.DescriptorInput{
+			Datatype: sif.DataGeneric,
+			Groupid:  sigGroupID | sif.DescrGroupMask,
+			Link:     t.groupID | sif.DescrGroupMask,
+			Fname:    SignatureName,
+			Data:     data,
+			Size:     int64(len(data)),
+		}
+
+		if err := s.f.AddObject(di); err != nil {
+			return fmt.Errorf("while adding signature object: %w", err)
+		}
+	}
+
+	return nil
+}
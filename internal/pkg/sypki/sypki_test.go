@@ -0,0 +1,836 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hpcng/sif/pkg/integrity"
+	"github.com/hpcng/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+// testPKI holds a certificate authority and a code signing certificate issued by it.
+type testPKI struct {
+	ca      *x509.Certificate
+	leaf    *x509.Certificate
+	leafKey crypto.Signer
+}
+
+func (p testPKI) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(p.ca)
+	return pool
+}
+
+func newTestCertificate(t *testing.T, tmpl, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.Signer) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+	return c
+}
+
+func newTestPKI(t *testing.T, leafKey crypto.Signer) testPKI {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+
+	now := time.Now()
+
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	ca := newTestCertificate(t, caTmpl, caTmpl, caKey.Public(), caKey)
+
+	leafTmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: "Test Signer", Organization: []string{"Sylabs"}},
+		EmailAddresses: []string{"signer@example.com"},
+		NotBefore:      now.Add(-time.Hour),
+		NotAfter:       now.Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	leaf := newTestCertificate(t, leafTmpl, ca, leafKey.Public(), caKey)
+
+	return testPKI{ca: ca, leaf: leaf, leafKey: leafKey}
+}
+
+// tempImage copies the SIF image at path to a temporary file and returns its path, the caller is
+// responsible for removing it.
+func tempImage(t *testing.T, path string) string {
+	src, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	dst, err := ioutil.TempFile("", "sypki-*.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	dst.Close()
+
+	return dst.Name()
+}
+
+// loadImage loads the SIF image at path, the caller is responsible for unloading it.
+func loadImage(t *testing.T, path string, rdonly bool) *sif.FileImage {
+	f, err := sif.LoadContainer(path, rdonly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &f
+}
+
+func TestSignVerify(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image := filepath.Join("testdata", "images", "one-group.sif")
+
+	tests := []struct {
+		name       string
+		key        crypto.Signer
+		signOpts   []SignerOpt
+		verifyOpts func(p testPKI) []VerifierOpt
+		wantErr    error
+	}{
+		{
+			name: "ECDSA",
+			key:  ecKey,
+			verifyOpts: func(p testPKI) []VerifierOpt {
+				return []VerifierOpt{OptVerifyWithRoots(p.roots())}
+			},
+		},
+		{
+			name: "RSA",
+			key:  rsaKey,
+			verifyOpts: func(p testPKI) []VerifierOpt {
+				return []VerifierOpt{OptVerifyWithRoots(p.roots())}
+			},
+		},
+		{
+			name: "Ed25519",
+			key:  edKey,
+			verifyOpts: func(p testPKI) []VerifierOpt {
+				return []VerifierOpt{OptVerifyWithRoots(p.roots())}
+			},
+		},
+		{
+			name:     "SignGroupVerifyObject",
+			key:      ecKey,
+			signOpts: []SignerOpt{OptSignGroup(1)},
+			verifyOpts: func(p testPKI) []VerifierOpt {
+				return []VerifierOpt{OptVerifyWithRoots(p.roots()), OptVerifyObject(1)}
+			},
+		},
+		{
+			name:     "SignObjectVerifyGroup",
+			key:      ecKey,
+			signOpts: []SignerOpt{OptSignObjects(1)},
+			verifyOpts: func(p testPKI) []VerifierOpt {
+				return []VerifierOpt{OptVerifyWithRoots(p.roots()), OptVerifyGroup(1)}
+			},
+			wantErr: errObjectNotSigned,
+		},
+		{
+			name: "TrustedSubject",
+			key:  ecKey,
+			verifyOpts: func(p testPKI) []VerifierOpt {
+				return []VerifierOpt{OptVerifyWithRoots(p.roots()), OptVerifyTrustedSubjects("Test Signer")}
+			},
+		},
+		{
+			name: "TrustedSAN",
+			key:  ecKey,
+			verifyOpts: func(p testPKI) []VerifierOpt {
+				return []VerifierOpt{OptVerifyWithRoots(p.roots()), OptVerifyTrustedSANs("Signer@Example.com")}
+			},
+		},
+		{
+			name: "UntrustedSubject",
+			key:  ecKey,
+			verifyOpts: func(p testPKI) []VerifierOpt {
+				return []VerifierOpt{OptVerifyWithRoots(p.roots()), OptVerifyTrustedSubjects("Someone Else")}
+			},
+			wantErr: errUntrustedSigner,
+		},
+		{
+			name: "UnknownAuthority",
+			key:  ecKey,
+			verifyOpts: func(p testPKI) []VerifierOpt {
+				return []VerifierOpt{OptVerifyWithRoots(x509.NewCertPool())}
+			},
+			wantErr: &integrity.SignatureNotValidError{},
+		},
+		{
+			name: "Expired",
+			key:  ecKey,
+			verifyOpts: func(p testPKI) []VerifierOpt {
+				return []VerifierOpt{OptVerifyWithRoots(p.roots()), optVerifyTime(time.Now().Add(2 * time.Hour))}
+			},
+			wantErr: &integrity.SignatureNotValidError{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPKI(t, tt.key)
+			path := tempImage(t, image)
+			defer os.Remove(path)
+
+			f := loadImage(t, path, false)
+
+			s, err := NewSigner(f, tt.key, []*x509.Certificate{p.leaf, p.ca}, tt.signOpts...)
+			if err != nil {
+				t.Fatalf("failed to create signer: %s", err)
+			}
+			if err := s.Sign(); err != nil {
+				t.Fatalf("failed to sign: %s", err)
+			}
+			f.UnloadContainer()
+
+			f = loadImage(t, path, true)
+			defer f.UnloadContainer()
+
+			var results []VerifyResult
+
+			opts := append(tt.verifyOpts(p), OptVerifyCallback(func(r VerifyResult) bool {
+				results = append(results, r)
+				return false
+			}))
+
+			v, err := NewVerifier(f, opts...)
+			if err != nil {
+				t.Fatalf("failed to create verifier: %s", err)
+			}
+
+			err = v.Verify()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			if got := results[0].Certificate; got == nil || !got.Equal(p.leaf) {
+				t.Errorf("unexpected signing certificate")
+			}
+			if len(results[0].Verified) == 0 {
+				t.Errorf("no object verified")
+			}
+		})
+	}
+}
+
+func TestSignatureGroup(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPKI(t, key)
+	path := tempImage(t, filepath.Join("testdata", "images", "one-group.sif"))
+	defer os.Remove(path)
+
+	f := loadImage(t, path, false)
+
+	if id := SignatureGroupID(f); id != 0 {
+		t.Fatalf("got signature group %d, want none", id)
+	}
+
+	// sign twice, the second signature must not cover the first one
+	for i := 0; i < 2; i++ {
+		s, err := NewSigner(f, key, []*x509.Certificate{p.leaf})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Sign(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f.UnloadContainer()
+
+	f = loadImage(t, path, false)
+	defer f.UnloadContainer()
+
+	if id := SignatureGroupID(f); id != 2 {
+		t.Fatalf("got signature group %d, want 2", id)
+	}
+	if n := len(groupSignatures(f, 1)); n != 2 {
+		t.Fatalf("got %d signatures, want 2", n)
+	}
+
+	v, err := NewVerifier(f, OptVerifyWithRoots(p.roots()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	s, err := NewSigner(f, key, []*x509.Certificate{p.leaf}, OptSignGroup(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign(); !errors.Is(err, errSignatureGroup) {
+		t.Fatalf("got error %v, want %v", err, errSignatureGroup)
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	f := loadImage(t, filepath.Join("testdata", "images", "one-group.sif"), true)
+	defer f.UnloadContainer()
+
+	v, err := NewVerifier(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify(); !errors.Is(err, &integrity.SignatureNotFoundError{}) {
+		t.Fatalf("got error %v, want signature not found", err)
+	}
+}
+
+// corruptImage flips the last byte of the SIF image at path, which belongs to its last data
+// object.
+func corruptImage(t *testing.T, path string) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 0xff
+	if err := ioutil.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignVerifyDetached(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPKI(t, key)
+
+	e, err := openpgp.NewEntity("Test Signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("Someone Else", "", "else@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		pgp        bool
+		corrupt    bool
+		verifyOpts []VerifierOpt
+		wantErr    error
+	}{
+		{
+			name:       "X509",
+			verifyOpts: []VerifierOpt{OptVerifyWithRoots(p.roots())},
+		},
+		{
+			name:       "OpenPGP",
+			pgp:        true,
+			verifyOpts: []VerifierOpt{OptVerifyWithKeyRing(openpgp.EntityList{e})},
+		},
+		{
+			name:       "OpenPGPVerifyObject",
+			pgp:        true,
+			verifyOpts: []VerifierOpt{OptVerifyWithKeyRing(openpgp.EntityList{e}), OptVerifyObject(1)},
+		},
+		{
+			name:       "OpenPGPUnknownKey",
+			pgp:        true,
+			verifyOpts: []VerifierOpt{OptVerifyWithKeyRing(openpgp.EntityList{other})},
+			wantErr:    &integrity.SignatureNotValidError{},
+		},
+		{
+			name:       "X509VerifyOpenPGP",
+			verifyOpts: []VerifierOpt{OptVerifyWithKeyRing(openpgp.EntityList{e})},
+			wantErr:    &integrity.SignatureNotFoundError{},
+		},
+		{
+			name:       "OpenPGPVerifyX509",
+			pgp:        true,
+			verifyOpts: []VerifierOpt{OptVerifyWithRoots(p.roots())},
+			wantErr:    &integrity.SignatureNotFoundError{},
+		},
+		{
+			name:       "Corrupted",
+			pgp:        true,
+			corrupt:    true,
+			verifyOpts: []VerifierOpt{OptVerifyWithKeyRing(openpgp.EntityList{e})},
+			wantErr:    &integrity.ObjectIntegrityError{},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			path := tempImage(t, filepath.Join("testdata", "images", "one-group.sif"))
+			defer os.Remove(path)
+
+			f := loadImage(t, path, true)
+
+			var s *Signer
+			if tt.pgp {
+				s, err = NewOpenPGPSigner(f, e)
+			} else {
+				s, err = NewSigner(f, key, []*x509.Certificate{p.leaf})
+			}
+			if err != nil {
+				t.Fatalf("failed to create signer: %s", err)
+			}
+			b, err := s.SignDetached()
+			if err != nil {
+				t.Fatalf("failed to sign: %s", err)
+			}
+			f.UnloadContainer()
+
+			// round trip through a file
+			bundle := path + ".sig"
+			defer os.Remove(bundle)
+
+			if err := b.WriteFile(bundle); err != nil {
+				t.Fatalf("failed to write bundle: %s", err)
+			}
+			if b, err = LoadBundle(bundle); err != nil {
+				t.Fatalf("failed to load bundle: %s", err)
+			}
+
+			if tt.corrupt {
+				corruptImage(t, path)
+			}
+
+			f = loadImage(t, path, true)
+			defer f.UnloadContainer()
+
+			// the image itself is left unsigned
+			if id := SignatureGroupID(f); id != 0 {
+				t.Fatalf("got signature group %d, want none", id)
+			}
+
+			var results []VerifyResult
+
+			opts := append(tt.verifyOpts, OptVerifyBundle(b), OptVerifyCallback(func(r VerifyResult) bool {
+				results = append(results, r)
+				return false
+			}))
+
+			v, err := NewVerifier(f, opts...)
+			if err != nil {
+				t.Fatalf("failed to create verifier: %s", err)
+			}
+
+			err = v.Verify()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			if tt.pgp && results[0].Entity != e {
+				t.Errorf("unexpected signing entity")
+			}
+			if len(results[0].Verified) == 0 {
+				t.Errorf("no object verified")
+			}
+		})
+	}
+}
+
+func TestOpenPGPSignerEmbedded(t *testing.T) {
+	e, err := openpgp.NewEntity("Test Signer", "", "signer@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := loadImage(t, filepath.Join("testdata", "images", "one-group.sif"), true)
+	defer f.UnloadContainer()
+
+	s, err := NewOpenPGPSigner(f, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sign(); !errors.Is(err, errDetachedOnly) {
+		t.Fatalf("got error %v, want %v", err, errDetachedOnly)
+	}
+
+	if _, err := NewVerifier(f, OptVerifyWithKeyRing(openpgp.EntityList{e})); !errors.Is(err, errKeyRingNoBundle) {
+		t.Fatalf("got error %v, want %v", err, errKeyRingNoBundle)
+	}
+}
+
+func TestNewSignerKeyMismatch(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newTestPKI(t, key)
+
+	if _, err := NewSigner(nil, other, []*x509.Certificate{p.leaf}); !errors.Is(err, errKeyMismatch) {
+		t.Errorf("got error %v, want %v", err, errKeyMismatch)
+	}
+	if _, err := NewSigner(nil, key, nil); !errors.Is(err, errNoCertificate) {
+		t.Errorf("got error %v, want %v", err, errNoCertificate)
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "sypki-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		block   *pem.Block
+		pub     crypto.PublicKey
+		wantErr bool
+	}{
+		{"PKCS8", &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}, ecKey.Public(), false},
+		{"PKCS1", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, rsaKey.Public(), false},
+		{"SEC1", &pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}, ecKey.Public(), false},
+		{"Encrypted", &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: pkcs8}, nil, true},
+		{"NoKey", &pem.Block{Type: "CERTIFICATE", Bytes: []byte{}}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".pem")
+			if err := ioutil.WriteFile(path, pem.EncodeToMemory(tt.block), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			k, err := LoadKey(path, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer k.Close()
+
+			if !publicKeysEqual(tt.pub, k.Public()) {
+				t.Errorf("unexpected public key")
+			}
+		})
+	}
+}
+
+func TestParsePKCS11URI(t *testing.T) {
+	slot := 1
+
+	tests := []struct {
+		name    string
+		uri     string
+		want    pkcs11URI
+		wantErr bool
+	}{
+		{
+			name: "Object",
+			uri:  "pkcs11:token=my%20token;object=signing-key;type=private?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234",
+			want: pkcs11URI{
+				token:      "my token",
+				object:     "signing-key",
+				pin:        "1234",
+				modulePath: "/usr/lib/softhsm/libsofthsm2.so",
+			},
+		},
+		{
+			name: "ID",
+			uri:  "pkcs11:slot-id=1;id=%01%02?module-path=/lib/p11.so",
+			want: pkcs11URI{
+				slotID:     &slot,
+				id:         []byte{1, 2},
+				modulePath: "/lib/p11.so",
+			},
+		},
+		{
+			name:    "NotPKCS11",
+			uri:     "/path/to/key.pem",
+			wantErr: true,
+		},
+		{
+			name:    "NoModule",
+			uri:     "pkcs11:object=key",
+			wantErr: true,
+		},
+		{
+			name:    "NoObject",
+			uri:     "pkcs11:token=t?module-path=/lib/p11.so",
+			wantErr: true,
+		},
+		{
+			name:    "PublicKey",
+			uri:     "pkcs11:object=key;type=public?module-path=/lib/p11.so",
+			wantErr: true,
+		},
+		{
+			name:    "BadSlot",
+			uri:     "pkcs11:slot-id=x;object=key?module-path=/lib/p11.so",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := parsePKCS11URI(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if u.token != tt.want.token || u.object != tt.want.object || u.pin != tt.want.pin ||
+				u.modulePath != tt.want.modulePath || string(u.id) != string(tt.want.id) {
+				t.Errorf("got %+v, want %+v", *u, tt.want)
+			}
+			if (u.slotID == nil) != (tt.want.slotID == nil) || (u.slotID != nil && *u.slotID != *tt.want.slotID) {
+				t.Errorf("got slot-id %v, want %v", u.slotID, tt.want.slotID)
+			}
+		})
+	}
+}
+
+// softHSMModules lists the usual locations of the SoftHSM PKCS#11 module.
+var softHSMModules = []string{
+	"/usr/lib/softhsm/libsofthsm2.so",
+	"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib/aarch64-linux-gnu/softhsm/libsofthsm2.so",
+	"/usr/lib64/pkcs11/libsofthsm2.so",
+	"/usr/local/lib/softhsm/libsofthsm2.so",
+}
+
+// newSoftHSMToken initializes a SoftHSM token labelled token in a temporary directory, imports
+// key in it under the label object and returns the path of the PKCS#11 module. The test is
+// skipped if SoftHSM is not installed.
+func newSoftHSMToken(t *testing.T, dir, token, object, pin string, key crypto.Signer) string {
+	util, err := exec.LookPath("softhsm2-util")
+	if err != nil {
+		t.Skip("softhsm2-util not found, skipping PKCS#11 test")
+	}
+
+	module := os.Getenv("SOFTHSM2_MODULE")
+	for _, m := range softHSMModules {
+		if module != "" {
+			break
+		}
+		if _, err := os.Stat(m); err == nil {
+			module = m
+		}
+	}
+	if module == "" {
+		t.Skip("SoftHSM PKCS#11 module not found, skipping PKCS#11 test")
+	}
+
+	tokenDir := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokenDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(dir, "softhsm2.conf")
+	data := "directories.tokendir = " + tokenDir + "\nobjectstore.backend = file\n"
+	if err := ioutil.WriteFile(conf, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// the module is loaded in the test process and reads its configuration from there
+	if err := os.Setenv("SOFTHSM2_CONF", conf); err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"--init-token", "--free", "--label", token, "--pin", pin, "--so-pin", pin},
+		{"--import", keyPath, "--token", token, "--label", object, "--id", "01", "--pin", pin},
+	} {
+		cmd := exec.Command(util, args...)
+		cmd.Env = append(os.Environ(), "SOFTHSM2_CONF="+conf)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("softhsm2-util %s failed: %s: %s", args[0], err, out)
+		}
+	}
+
+	return module
+}
+
+func TestSignVerifyPKCS11(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "sypki-softhsm-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if conf, ok := os.LookupEnv("SOFTHSM2_CONF"); ok {
+		defer os.Setenv("SOFTHSM2_CONF", conf)
+	} else {
+		defer os.Unsetenv("SOFTHSM2_CONF")
+	}
+
+	const pin = "1234"
+
+	module := newSoftHSMToken(t, dir, "sypki test", "signing-key", pin, ecKey)
+	p := newTestPKI(t, ecKey)
+
+	tests := []struct {
+		name    string
+		uri     string
+		pin     PINFunc
+		wantErr bool
+	}{
+		{
+			name: "PINValue",
+			uri:  "pkcs11:token=sypki%20test;object=signing-key;type=private?module-path=" + module + "&pin-value=" + pin,
+		},
+		{
+			name: "PINFunc",
+			uri:  "pkcs11:token=sypki%20test;id=%01?module-path=" + module,
+			pin:  func() (string, error) { return pin, nil },
+		},
+		{
+			name:    "NoKey",
+			uri:     "pkcs11:token=sypki%20test;object=other-key?module-path=" + module + "&pin-value=" + pin,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := LoadKey(tt.uri, tt.pin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer k.Close()
+
+			if !publicKeysEqual(ecKey.Public(), k.Public()) {
+				t.Fatalf("unexpected public key")
+			}
+
+			path := tempImage(t, filepath.Join("testdata", "images", "one-group.sif"))
+			defer os.Remove(path)
+
+			f := loadImage(t, path, false)
+
+			s, err := NewSigner(f, k, []*x509.Certificate{p.leaf, p.ca})
+			if err != nil {
+				t.Fatalf("failed to create signer: %s", err)
+			}
+			if err := s.Sign(); err != nil {
+				t.Fatalf("failed to sign: %s", err)
+			}
+			f.UnloadContainer()
+
+			f = loadImage(t, path, true)
+			defer f.UnloadContainer()
+
+			v, err := NewVerifier(f, OptVerifyWithRoots(p.roots()))
+			if err != nil {
+				t.Fatalf("failed to create verifier: %s", err)
+			}
+			if err := v.Verify(); err != nil {
+				t.Fatalf("failed to verify: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,470 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hpcng/sif/pkg/integrity"
+	"github.com/hpcng/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+)
+
+var (
+	errSignatureInvalid = errors.New("signature verification failed")
+	errUntrustedSigner  = errors.New("certificate subject is not trusted")
+	errKeyRingNoBundle  = errors.New("OpenPGP keyring requires a signature bundle")
+)
+
+// VerifyResult describes the result of the verification of a signature.
+type VerifyResult struct {
+	// Signature is the ID of the signature object, or the position of
+	// the signature in the bundle for detached signatures.
+	Signature uint32
+	// Certificate is the signing certificate, nil if the signature
+	// couldn't be decoded.
+	Certificate *x509.Certificate
+	// Entity is the signing entity of a detached OpenPGP signature, nil
+	// if it couldn't be determined.
+	Entity *openpgp.Entity
+	// Signed is the list of object IDs covered by the signature.
+	Signed []uint32
+	// Chain is the validated certificate chain, from the signing
+	// certificate to the root certificate.
+	Chain []*x509.Certificate
+	// Verified is the list of verified object IDs.
+	Verified []uint32
+	// Err describes why verification failed, nil on success.
+	Err error
+}
+
+// VerifyCallback is called immediately after a signature is verified. If r contains a non-nil
+// error, and the callback returns true, the error is ignored, and verification proceeds as if no
+// error occurred.
+type VerifyCallback func(r VerifyResult) (ignoreError bool)
+
+// verifyTask describes a set of objects of a group to verify.
+type verifyTask struct {
+	groupID uint32
+	ods     []*sif.Descriptor
+	// subsetOK permits ods to be a subset of the objects covered by a signature.
+	subsetOK bool
+}
+
+// Verifier describes a SIF image verifier for X.509 signatures.
+type Verifier struct {
+	f *sif.FileImage
+
+	roots    *x509.CertPool
+	subjects []string
+	sans     []string
+	groups   []uint32
+	objects  []uint32
+	cb       VerifyCallback
+	now      time.Time
+	bundle   *Bundle
+	kr       openpgp.KeyRing
+}
+
+// VerifierOpt are used to configure a Verifier.
+type VerifierOpt func(v *Verifier) error
+
+// OptVerifyWithRoots sets the pool of root certificates used to validate the signing certificate
+// chains. When not set, the system certificate pool is used.
+func OptVerifyWithRoots(roots *x509.CertPool) VerifierOpt {
+	return func(v *Verifier) error {
+		v.roots = roots
+		return nil
+	}
+}
+
+// OptVerifyTrustedSubjects restricts the trusted signing certificates to those with a subject
+// distinguished name or common name in subjects.
+func OptVerifyTrustedSubjects(subjects ...string) VerifierOpt {
+	return func(v *Verifier) error {
+		v.subjects = append(v.subjects, subjects...)
+		return nil
+	}
+}
+
+// OptVerifyTrustedSANs restricts the trusted signing certificates to those with a subject
+// alternative name in sans.
+func OptVerifyTrustedSANs(sans ...string) VerifierOpt {
+	return func(v *Verifier) error {
+		v.sans = append(v.sans, sans...)
+		return nil
+	}
+}
+
+// OptVerifyGroup adds a verification task for the group with the specified groupID. This may be
+// called multiple times to request verification of more than one group.
+func OptVerifyGroup(groupID uint32) VerifierOpt {
+	return func(v *Verifier) error {
+		v.groups = append(v.groups, groupID)
+		return nil
+	}
+}
+
+// OptVerifyObject adds a verification task for the object with the specified id. This may be
+// called multiple times to request verification of more than one object.
+func OptVerifyObject(id uint32) VerifierOpt {
+	return func(v *Verifier) error {
+		v.objects = append(v.objects, id)
+		return nil
+	}
+}
+
+// OptVerifyCallback registers cb as the verification callback, which is called after each
+// signature is verified.
+func OptVerifyCallback(cb VerifyCallback) VerifierOpt {
+	return func(v *Verifier) error {
+		v.cb = cb
+		return nil
+	}
+}
+
+// OptVerifyBundle specifies that signatures be read from the detached signature bundle b instead
+// of the image.
+func OptVerifyBundle(b *Bundle) VerifierOpt {
+	return func(v *Verifier) error {
+		v.bundle = b
+		return nil
+	}
+}
+
+// OptVerifyWithKeyRing specifies that the OpenPGP signatures of the signature bundle be verified
+// with kr, instead of its X.509 signatures. It requires OptVerifyBundle, as OpenPGP signatures
+// embedded in the image are handled by the integrity package.
+func OptVerifyWithKeyRing(kr openpgp.KeyRing) VerifierOpt {
+	return func(v *Verifier) error {
+		v.kr = kr
+		return nil
+	}
+}
+
+// optVerifyTime sets the time used to check certificates validity, for testing purpose.
+func optVerifyTime(t time.Time) VerifierOpt {
+	return func(v *Verifier) error {
+		v.now = t
+		return nil
+	}
+}
+
+// NewVerifier returns a Verifier to verify the X.509 signatures in f according to opts.
+//
+// By default, the returned Verifier verifies all object groups. To override this behavior,
+// consider using OptVerifyGroup and/or OptVerifyObject.
+func NewVerifier(f *sif.FileImage, opts ...VerifierOpt) (*Verifier, error) {
+	v := &Verifier{f: f}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+	if v.kr != nil && v.bundle == nil {
+		return nil, errKeyRingNoBundle
+	}
+	return v, nil
+}
+
+// tasks returns the list of verification tasks.
+func (v *Verifier) tasks() ([]verifyTask, error) {
+	var tasks []verifyTask
+
+	groups := v.groups
+	if len(groups) == 0 && len(v.objects) == 0 {
+		groups = groupIDs(v.f, false)
+	}
+
+	for _, groupID := range groups {
+		ods, err := groupObjects(v.f, groupID)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, verifyTask{groupID: groupID, ods: ods})
+	}
+
+	for _, id := range v.objects {
+		od, _, err := v.f.GetFromDescrID(id)
+		if err != nil {
+			return nil, err
+		}
+		if od.Groupid == sif.DescrUnusedGroup {
+			return nil, fmt.Errorf("object %d: %w", id, errObjectNotInGroup)
+		}
+		groupID := od.Groupid &^ sif.DescrGroupMask
+		tasks = append(tasks, verifyTask{groupID: groupID, ods: []*sif.Descriptor{od}, subsetOK: true})
+	}
+
+	if len(tasks) == 0 {
+		return nil, errNoObjects
+	}
+	return tasks, nil
+}
+
+// groupSignatures returns the X.509 signature objects of f linked to group groupID.
+func groupSignatures(f *sif.FileImage, groupID uint32) []signature {
+	var sigs []signature
+
+	for i := range f.DescrArr {
+		od := &f.DescrArr[i]
+		if isSignature(od) && od.Link == groupID|sif.DescrGroupMask {
+			sigs = append(sigs, signature{id: od.ID, x509: od.GetData(f)})
+		}
+	}
+	return sigs
+}
+
+// signatures returns the signatures to verify for group groupID.
+func (v *Verifier) signatures(groupID uint32) ([]signature, error) {
+	if v.bundle != nil {
+		return bundleSignatures(v.bundle, groupID, v.kr != nil)
+	}
+	return groupSignatures(v.f, groupID), nil
+}
+
+// checkSignature verifies sig is the signature of b computed with the private key associated to
+// pub.
+func checkSignature(pub crypto.PublicKey, b, sig []byte) error {
+	sum := sha256.Sum256(b)
+
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig); err != nil {
+			return errSignatureInvalid
+		}
+	case *ecdsa.PublicKey:
+		var es struct{ R, S *big.Int }
+		if rest, err := asn1.Unmarshal(sig, &es); err != nil || len(rest) != 0 {
+			return errSignatureInvalid
+		}
+		if !ecdsa.Verify(k, sum[:], es.R, es.S) {
+			return errSignatureInvalid
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, b, sig) {
+			return errSignatureInvalid
+		}
+	default:
+		return errUnsupportedKey
+	}
+	return nil
+}
+
+// decodeEnvelope returns the signature envelope stored in data along with the decoded
+// certificates.
+func decodeEnvelope(data []byte) (*envelope, []*x509.Certificate, error) {
+	e := new(envelope)
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", errSignatureEnvelope, err)
+	}
+	if len(e.Certificates) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s", errSignatureEnvelope, errNoCertificate)
+	}
+
+	certs := make([]*x509.Certificate, 0, len(e.Certificates))
+	for _, der := range e.Certificates {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", errSignatureEnvelope, err)
+		}
+		certs = append(certs, c)
+	}
+	return e, certs, nil
+}
+
+// verifyCertificate validates the chain of trust of the signing certificate certs[0] and checks
+// it against the trusted subjects, it returns the validated chain.
+func (v *Verifier) verifyCertificate(certs []*x509.Certificate) ([]*x509.Certificate, error) {
+	opts := x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   v.now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	for _, c := range certs[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+
+	chains, err := certs[0].Verify(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(v.subjects) > 0 || len(v.sans) > 0 {
+		if !matchesSubject(certs[0], v.subjects) && !matchesSAN(certs[0], v.sans) {
+			return nil, fmt.Errorf("%q: %w", CertificateSubject(certs[0]), errUntrustedSigner)
+		}
+	}
+	return chains[0], nil
+}
+
+// checkMetadata verifies the signature sig, and returns the metadata it covers.
+func (v *Verifier) checkMetadata(sig signature, r *VerifyResult) ([]byte, error) {
+	if sig.pgp != nil {
+		b, err := decodeClearsigned(sig.pgp)
+		if err != nil {
+			return nil, err
+		}
+		r.Entity, err = openpgp.CheckDetachedSignature(v.kr, bytes.NewReader(b.Bytes), b.ArmoredSignature.Body)
+		if err != nil {
+			return nil, err
+		}
+		return b.Plaintext, nil
+	}
+
+	e, certs, err := decodeEnvelope(sig.x509)
+	if err != nil {
+		return nil, err
+	}
+	r.Certificate = certs[0]
+
+	if err := checkSignature(certs[0].PublicKey, e.Metadata, e.Signature); err != nil {
+		return nil, err
+	}
+
+	if r.Chain, err = v.verifyCertificate(certs); err != nil {
+		return nil, err
+	}
+	return e.Metadata, nil
+}
+
+// verifySignature verifies the objects of task t against signature sig.
+func (v *Verifier) verifySignature(t verifyTask, sig signature) VerifyResult {
+	r := VerifyResult{Signature: sig.id}
+
+	md, err := v.checkMetadata(sig, &r)
+	if err != nil {
+		r.Err = &integrity.SignatureNotValidError{ID: sig.id, Err: err}
+		return r
+	}
+
+	var im imageMetadata
+	if err := json.Unmarshal(md, &im); err != nil {
+		r.Err = &integrity.SignatureNotValidError{ID: sig.id, Err: err}
+		return r
+	}
+
+	// object IDs are relative to the lowest ID of the group
+	gods, err := groupObjects(v.f, t.groupID)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	minID := gods[0].ID
+
+	for _, om := range im.Objects {
+		r.Signed = append(r.Signed, minID+om.RelativeID)
+	}
+
+	if !t.subsetOK {
+		if err := im.objectIDsMatch(minID, t.ods); err != nil {
+			r.Err = err
+			return r
+		}
+	}
+
+	r.Verified, r.Err = im.matches(v.f, minID, t.ods)
+	return r
+}
+
+// Verify performs all cryptographic verification tasks specified by v.
+//
+// If no signatures are found for a task, an error wrapping an integrity.SignatureNotFoundError is
+// returned. If an invalid signature is encountered, an error wrapping an
+// integrity.SignatureNotValidError is returned.
+func (v *Verifier) Verify() error {
+	tasks, err := v.tasks()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tasks {
+		sigs, err := v.signatures(t.groupID)
+		if err != nil {
+			return err
+		}
+		if len(sigs) == 0 {
+			return &integrity.SignatureNotFoundError{ID: t.groupID, IsGroup: true}
+		}
+
+		n := 0
+		for _, sig := range sigs {
+			// when verifying an object subset, skip signatures not covering it
+			if t.subsetOK && !v.covers(sig, t) {
+				continue
+			}
+			n++
+
+			r := v.verifySignature(t, sig)
+			err := r.Err
+			if v.cb != nil && v.cb(r) {
+				err = nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			return &integrity.SignatureNotFoundError{ID: t.ods[0].ID}
+		}
+	}
+	return nil
+}
+
+// covers returns true if sig covers all the objects of task t, signatures which can't be
+// decoded are considered as covering t so verification reports them.
+func (v *Verifier) covers(sig signature, t verifyTask) bool {
+	var md []byte
+	if sig.pgp != nil {
+		b, err := decodeClearsigned(sig.pgp)
+		if err != nil {
+			return true
+		}
+		md = b.Plaintext
+	} else {
+		e, _, err := decodeEnvelope(sig.x509)
+		if err != nil {
+			return true
+		}
+		md = e.Metadata
+	}
+
+	var im imageMetadata
+	if err := json.Unmarshal(md, &im); err != nil {
+		return true
+	}
+
+	gods, err := groupObjects(v.f, t.groupID)
+	if err != nil {
+		return true
+	}
+	for _, od := range t.ods {
+		found := false
+		for _, om := range im.Objects {
+			if gods[0].ID+om.RelativeID == od.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// kernelOptions maps compression algorithms to the kernel
+// configuration option enabling their support in squashfs.
+var kernelOptions = map[string]string{
+	"gzip": "CONFIG_SQUASHFS_ZLIB",
+	"lzo":  "CONFIG_SQUASHFS_LZO",
+	"lz4":  "CONFIG_SQUASHFS_LZ4",
+	"xz":   "CONFIG_SQUASHFS_XZ",
+	"zstd": "CONFIG_SQUASHFS_ZSTD",
+}
+
+// kernelConfigFiles returns the list of possible locations of
+// the running kernel configuration.
+func kernelConfigFiles() ([]string, error) {
+	var uts unix.Utsname
+
+	if err := unix.Uname(&uts); err != nil {
+		return nil, fmt.Errorf("while getting kernel release: %s", err)
+	}
+	release := unix.ByteSliceToString(uts.Release[:])
+
+	return []string{
+		"/proc/config.gz",
+		"/boot/config-" + release,
+		"/lib/modules/" + release + "/build/.config",
+	}, nil
+}
+
+// KernelSupport returns if the running kernel is able to mount
+// squashfs images compressed with comp. The second returned value
+// is false when the kernel configuration is not available and the
+// support couldn't be determined.
+func KernelSupport(comp string) (supported bool, known bool, err error) {
+	option, ok := kernelOptions[comp]
+	if !ok {
+		// lzma is recognized but was never supported by the kernel
+		return false, true, nil
+	}
+
+	files, err := kernelConfigFiles()
+	if err != nil {
+		return false, false, err
+	}
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		var r io.Reader = f
+
+		if strings.HasSuffix(file, ".gz") {
+			gr, err := gzip.NewReader(f)
+			if err != nil {
+				return false, false, fmt.Errorf("while reading %s: %s", file, err)
+			}
+			defer gr.Close()
+			r = gr
+		}
+
+		return scanKernelConfig(r, option)
+	}
+
+	return false, false, nil
+}
+
+func scanKernelConfig(r io.Reader, option string) (bool, bool, error) {
+	// squashfs support itself is required
+	squashfs := false
+	supported := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch line {
+		case "CONFIG_SQUASHFS=y", "CONFIG_SQUASHFS=m":
+			squashfs = true
+		case option + "=y":
+			supported = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, false, fmt.Errorf("while reading kernel configuration: %s", err)
+	}
+
+	return squashfs && supported, true, nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"strings"
+	"testing"
+)
+
+const testKernelConfig = `CONFIG_SQUASHFS=m
+CONFIG_SQUASHFS_ZLIB=y
+CONFIG_SQUASHFS_XZ=y
+# CONFIG_SQUASHFS_ZSTD is not set
+`
+
+func TestScanKernelConfig(t *testing.T) {
+	tests := []struct {
+		comp      string
+		supported bool
+	}{
+		{"gzip", true},
+		{"xz", true},
+		{"zstd", false},
+		{"lz4", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.comp, func(t *testing.T) {
+			supported, known, err := scanKernelConfig(strings.NewReader(testKernelConfig), kernelOptions[tt.comp])
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !known {
+				t.Fatalf("unexpected unknown support")
+			}
+			if supported != tt.supported {
+				t.Errorf("got support %v instead of %v", supported, tt.supported)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	minBlockSize = 4 * 1024
+	maxBlockSize = 1024 * 1024
+)
+
+// compressionLevels maps the compression algorithms supported
+// by mksquashfs to their maximum compression level, a zero value
+// indicates that the algorithm doesn't support compression level.
+var compressionLevels = map[string]uint{
+	"gzip": 9,
+	"lzo":  9,
+	"lz4":  0,
+	"xz":   0,
+	"zstd": 22,
+}
+
+// Compressions returns the list of compression algorithms
+// which can be used to build images.
+func Compressions() []string {
+	return []string{"gzip", "lzo", "lz4", "xz", "zstd"}
+}
+
+// CheckCompression returns an error if the compression algorithm
+// comp is not supported or if level is not a valid compression
+// level for this algorithm, a zero level means the default level.
+func CheckCompression(comp string, level uint) error {
+	max, ok := compressionLevels[comp]
+	if !ok {
+		return fmt.Errorf("unsupported compression algorithm %q, must be one of %s", comp, strings.Join(Compressions(), ", "))
+	}
+	if level == 0 {
+		return nil
+	} else if max == 0 {
+		return fmt.Errorf("compression algorithm %s doesn't support compression level", comp)
+	} else if level > max {
+		return fmt.Errorf("compression level %d out of range for %s, must be between 1 and %d", level, comp, max)
+	}
+	return nil
+}
+
+// CompressionArgs returns the mksquashfs arguments to build an image
+// with the compression algorithm comp and the compression level,
+// a zero level means the default level.
+func CompressionArgs(comp string, level uint) ([]string, error) {
+	if err := CheckCompression(comp, level); err != nil {
+		return nil, err
+	}
+	args := []string{"-comp", comp}
+	if level != 0 {
+		args = append(args, "-Xcompression-level", fmt.Sprint(level))
+	}
+	return args, nil
+}
+
+// ParseBlockSize parses the block size string s which can use the K
+// or M suffixes (eg: 128K, 1M) and returns the block size in bytes.
+// The block size must be a power of two between 4K and 1M.
+func ParseBlockSize(s string) (uint, error) {
+	mult := uint64(1)
+	size := strings.ToUpper(strings.TrimSpace(s))
+
+	if strings.HasSuffix(size, "K") {
+		mult = 1024
+		size = strings.TrimSuffix(size, "K")
+	} else if strings.HasSuffix(size, "M") {
+		mult = 1024 * 1024
+		size = strings.TrimSuffix(size, "M")
+	}
+
+	n, err := strconv.ParseUint(size, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid block size %q: %s", s, err)
+	}
+	n *= mult
+
+	if n < minBlockSize || n > maxBlockSize || n&(n-1) != 0 {
+		return 0, fmt.Errorf("invalid block size %q: must be a power of two between 4K and 1M", s)
+	}
+
+	return uint(n), nil
+}
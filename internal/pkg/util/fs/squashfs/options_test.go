@@ -0,0 +1,94 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package squashfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompressionArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		comp        string
+		level       uint
+		expectArgs  []string
+		expectError bool
+	}{
+		{
+			name:       "gzip default level",
+			comp:       "gzip",
+			expectArgs: []string{"-comp", "gzip"},
+		},
+		{
+			name:       "zstd level",
+			comp:       "zstd",
+			level:      19,
+			expectArgs: []string{"-comp", "zstd", "-Xcompression-level", "19"},
+		},
+		{
+			name:        "gzip level out of range",
+			comp:        "gzip",
+			level:       10,
+			expectError: true,
+		},
+		{
+			name:        "xz with level",
+			comp:        "xz",
+			level:       1,
+			expectError: true,
+		},
+		{
+			name:        "unknown compression",
+			comp:        "bzip2",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := CompressionArgs(tt.comp, tt.level)
+			if err != nil && !tt.expectError {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.expectError {
+				t.Fatalf("unexpected success")
+			}
+			if !tt.expectError && !reflect.DeepEqual(args, tt.expectArgs) {
+				t.Errorf("got args %v instead of %v", args, tt.expectArgs)
+			}
+		})
+	}
+}
+
+func TestParseBlockSize(t *testing.T) {
+	tests := []struct {
+		size        string
+		expectSize  uint
+		expectError bool
+	}{
+		{size: "4096", expectSize: 4096},
+		{size: "128K", expectSize: 128 * 1024},
+		{size: "1m", expectSize: 1024 * 1024},
+		{size: "2K", expectError: true},
+		{size: "2M", expectError: true},
+		{size: "100K", expectError: true},
+		{size: "big", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			size, err := ParseBlockSize(tt.size)
+			if err != nil && !tt.expectError {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.expectError {
+				t.Fatalf("unexpected success")
+			}
+			if size != tt.expectSize {
+				t.Errorf("got size %d instead of %d", size, tt.expectSize)
+			}
+		})
+	}
+}
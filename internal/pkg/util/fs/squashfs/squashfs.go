@@ -73,3 +73,36 @@ func GetMem() (string, error) {
 
 	return mem, err
 }
+
+func GetCompression() (string, error) {
+	c, err := getConfig()
+	if err != nil {
+		return "", err
+	}
+	// comp is either "gzip" or the string value in the conf file
+	comp := c.MksquashfsCompression
+
+	return comp, err
+}
+
+func GetCompressionLevel() (uint, error) {
+	c, err := getConfig()
+	if err != nil {
+		return 0, err
+	}
+	// level is either 0 or the value in the conf file
+	level := c.MksquashfsCompLevel
+
+	return level, err
+}
+
+func GetBlockSize() (string, error) {
+	c, err := getConfig()
+	if err != nil {
+		return "", err
+	}
+	// size is either "" or the string value in the conf file
+	size := c.MksquashfsBlockSize
+
+	return size, err
+}
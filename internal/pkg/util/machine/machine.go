@@ -314,3 +314,37 @@ func CompatibleWith(arch string) bool {
 
 	return canEmulate(arch)
 }
+
+// Platform describes an image platform, as found in OCI image indexes.
+type Platform struct {
+	OS      string
+	Arch    string
+	Variant string
+}
+
+// String returns the platform in the os/arch[/variant] format.
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Arch
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// ParsePlatform parses a platform in the os/arch[/variant] format, like
+// linux/arm64 or linux/arm/v7.
+func ParsePlatform(platform string) (Platform, error) {
+	parts := strings.Split(platform, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+	}
+
+	p := Platform{OS: parts[0], Arch: parts[1]}
+	if len(parts) == 3 {
+		if parts[2] == "" {
+			return Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", platform)
+		}
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
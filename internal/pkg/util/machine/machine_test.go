@@ -0,0 +1,41 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package machine
+
+import (
+	"testing"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     Platform
+		wantErr  bool
+	}{
+		{platform: "linux/amd64", want: Platform{OS: "linux", Arch: "amd64"}},
+		{platform: "linux/arm/v7", want: Platform{OS: "linux", Arch: "arm", Variant: "v7"}},
+		{platform: "linux", wantErr: true},
+		{platform: "linux/", wantErr: true},
+		{platform: "/amd64", wantErr: true},
+		{platform: "linux/arm/", wantErr: true},
+		{platform: "linux/arm/v7/extra", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			got, err := ParsePlatform(tt.platform)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if !tt.wantErr && got.String() != tt.platform {
+				t.Errorf("got string %s, want %s", got, tt.platform)
+			}
+		})
+	}
+}
@@ -21,6 +21,8 @@ const (
 	HTTPS = "https"
 	// Oras is the keyword for an oras ref
 	Oras = "oras"
+	// S3 is the keyword for an s3 ref
+	S3 = "s3"
 )
 
 // validURIs contains a list of known uris
@@ -35,6 +37,7 @@ var validURIs = map[string]bool{
 	"http":           true,
 	"https":          true,
 	"oras":           true,
+	"s3":             true,
 }
 
 // IsValid returns whether or not the given source is valid
@@ -66,7 +69,7 @@ func GetName(uri string) string {
 	ref = strings.TrimLeft(ref, "/")    // Trim leading "/" characters
 	refSplit := strings.Split(ref, "/") // Split ref into parts
 
-	if transport == HTTP || transport == HTTPS {
+	if transport == HTTP || transport == HTTPS || transport == S3 {
 		imageName := refSplit[len(refSplit)-1]
 		return imageName
 	}
@@ -19,6 +19,7 @@ func Test_GetName(t *testing.T) {
 		{"docker scoped", "docker://user/image", "image_latest.sif"},
 		{"dave's magical lolcow", "docker://godlovedc/lolcow", "lolcow_latest.sif"},
 		{"docker w/ tags", "docker://godlovedc/lolcow:3.7", "lolcow_3.7.sif"},
+		{"s3 object", "s3://bucket/images/alpine.sif", "alpine.sif"},
 	}
 
 	for _, tt := range tests {
@@ -75,6 +75,18 @@ type Options struct {
 	// To warn when the above is needed, we need to know if the target of this
 	// bundle will be a sandbox
 	SandboxTarget bool
+	// Compression is the squashfs compression algorithm used for SIF
+	// images, the value from singularity.conf is used when empty.
+	Compression string `json:"compression"`
+	// CompressionLevel is the squashfs compression level used for SIF
+	// images, the value from singularity.conf is used when zero.
+	CompressionLevel uint `json:"compressionLevel"`
+	// BlockSize is the squashfs block size used for SIF images (eg: 1M),
+	// the value from singularity.conf is used when empty.
+	BlockSize string `json:"blockSize"`
+	// Platform is the os/arch[/variant] platform of the images pulled from
+	// OCI sources, the host platform is used when empty.
+	Platform string `json:"platform"`
 }
 
 // NewEncryptedBundle creates an Encrypted Bundle environment.
@@ -135,6 +135,8 @@ type Image struct {
 	Fd         uintptr   `json:"fd"`
 	Writable   bool      `json:"writable"`
 	Usage      Usage     `json:"usage"`
+	// Arch is the GOARCH architecture of the image, when known.
+	Arch string `json:"arch,omitempty"`
 }
 
 // ReInit fills in the File object if needed.  This function should be
@@ -21,6 +21,9 @@ const (
 	SIFDescOCIConfigJSON = "oci-config.json"
 	// SIFDescInspectMetadataJSON is the name of the SIF descriptor holding the container metadata.
 	SIFDescInspectMetadataJSON = "inspect-metadata.json"
+	// SIFDescProvenanceJSON is the name of the SIF descriptor holding the provenance
+	// of the image source.
+	SIFDescProvenanceJSON = "provenance.json"
 )
 
 type sifFormat struct{}
@@ -108,6 +111,8 @@ func (f *sifFormat) initializer(img *Image, fi os.FileInfo) error {
 		goArch := sif.GetGoArch(sifArch)
 		if sifArch != sif.HdrArchUnknown && !machine.CompatibleWith(goArch) {
 			return fmt.Errorf("the image's architecture (%s) could not run on the host's (%s)", goArch, runtime.GOARCH)
+		} else if sifArch != sif.HdrArchUnknown {
+			img.Arch = goArch
 		}
 
 		img.Partitions = []Section{
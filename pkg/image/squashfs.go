@@ -1,4 +1,4 @@
-// Copyright (c) 2018-2020, Sylabs Inc. All rights reserved.
+// Copyright (c) 2018-2021, Sylabs Inc. All rights reserved.
 // This software is licensed under a 3-clause BSD license. Please consult the
 // LICENSE.md file distributed with the sources of this project regarding your
 // rights to use or distribute this software.
@@ -22,6 +22,7 @@ const (
 	squashfsLzoComp  = 3
 	squashfsXzComp   = 4
 	squashfsLz4Comp  = 5
+	squashfsZstdComp = 6
 )
 
 // this represents the superblock of a v4 squashfs image
@@ -90,6 +91,8 @@ func CheckSquashfsHeader(b []byte) (uint64, error) {
 			compressionType = "lzo"
 		case squashfsXzComp:
 			compressionType = "xz"
+		case squashfsZstdComp:
+			compressionType = "zstd"
 		default:
 			return 0, fmt.Errorf("corrupted image: unknown compression algorithm value %d", sinfo.Compression)
 		}
@@ -120,6 +123,8 @@ func GetSquashfsComp(b []byte) (string, error) {
 			compType = "lzo"
 		case squashfsXzComp:
 			compType = "xz"
+		case squashfsZstdComp:
+			compType = "zstd"
 		}
 		return compType, nil
 	} else if sb.Major < 4 {
@@ -132,6 +137,57 @@ func GetSquashfsComp(b []byte) (string, error) {
 	return "", fmt.Errorf("not a valid squashfs image")
 }
 
+// GetSquashfsBlockSize checks if byte content contains a valid squashfs
+// header and returns the block size used
+func GetSquashfsBlockSize(b []byte) (uint32, error) {
+	sb, _, err := parseSquashfsHeader(b)
+	if err != nil {
+		return 0, fmt.Errorf("while parsing squashfs super block: %v", err)
+	}
+	return sb.BlockSize, nil
+}
+
+// readRootFsSuperBlock returns the beginning of the squashfs root
+// filesystem partition of the image, nil is returned if the root
+// filesystem is not a squashfs filesystem.
+func readRootFsSuperBlock(img *Image) ([]byte, error) {
+	part, err := img.GetRootFsPartition()
+	if err != nil {
+		return nil, err
+	}
+	if part.Type != SQUASHFS {
+		return nil, nil
+	}
+
+	b := make([]byte, bufferSize)
+	if _, err := img.File.ReadAt(b, int64(part.Offset)); err != nil {
+		return nil, fmt.Errorf("failed to read squashfs super block: %s", err)
+	}
+	return b, nil
+}
+
+// GetRootFsComp returns the type of compression used by the squashfs
+// root filesystem partition of the image, an empty string is returned
+// if the root filesystem is not a squashfs filesystem.
+func GetRootFsComp(img *Image) (string, error) {
+	b, err := readRootFsSuperBlock(img)
+	if err != nil || b == nil {
+		return "", err
+	}
+	return GetSquashfsComp(b)
+}
+
+// GetRootFsBlockSize returns the block size used by the squashfs root
+// filesystem partition of the image, zero is returned if the root
+// filesystem is not a squashfs filesystem.
+func GetRootFsBlockSize(img *Image) (uint32, error) {
+	b, err := readRootFsSuperBlock(img)
+	if err != nil || b == nil {
+		return 0, err
+	}
+	return GetSquashfsBlockSize(b)
+}
+
 func (f *squashfsFormat) initializer(img *Image, fileinfo os.FileInfo) error {
 	if fileinfo.IsDir() {
 		return debugError("not a squashfs image")
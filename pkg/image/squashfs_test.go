@@ -6,6 +6,8 @@
 package image
 
 import (
+	"bytes"
+	"encoding/binary"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -181,3 +183,39 @@ func TestSquashfsCompression(t *testing.T) {
 		})
 	}
 }
+
+func TestSquashfsZstdCompression(t *testing.T) {
+	sb := squashfsInfo{
+		Compression: squashfsZstdComp,
+		BlockSize:   1 << 20,
+		Major:       4,
+	}
+	copy(sb.Magic[:], squashfsMagic)
+
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.LittleEndian, sb); err != nil {
+		t.Fatalf("While writing squashfs super block: %v", err)
+	}
+	// pad the super block as a real image would
+	buf.Write(make([]byte, bufferSize-buf.Len()))
+
+	if _, err := CheckSquashfsHeader(buf.Bytes()); err != nil {
+		t.Errorf("Unexpected error for zstd compressed image: %v", err)
+	}
+
+	comp, err := GetSquashfsComp(buf.Bytes())
+	if err != nil {
+		t.Errorf("While looking for compression type: %v", err)
+	}
+	if comp != "zstd" {
+		t.Errorf("Incorrect compression found: %s", comp)
+	}
+
+	bs, err := GetSquashfsBlockSize(buf.Bytes())
+	if err != nil {
+		t.Errorf("While looking for block size: %v", err)
+	}
+	if bs != 1<<20 {
+		t.Errorf("Incorrect block size found: %d", bs)
+	}
+}
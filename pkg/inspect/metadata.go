@@ -5,6 +5,8 @@
 
 package inspect
 
+import "time"
+
 // ContainerType defines the container type (used by default).
 const ContainerType = "container"
 
@@ -27,6 +29,24 @@ type Attributes struct {
 	Helpfile    string                    `json:"helpfile,omitempty"`
 	Deffile     string                    `json:"deffile,omitempty"`
 	Startscript string                    `json:"startscript,omitempty"`
+	Compression string                    `json:"compression,omitempty"`
+	BlockSize   uint32                    `json:"blocksize,omitempty"`
+	Provenance  *Provenance               `json:"provenance,omitempty"`
+}
+
+// Provenance describes the source an image was pulled or built from.
+type Provenance struct {
+	// Source is the URI of the source image.
+	Source string `json:"source"`
+	// Digest is the manifest digest the source image resolved to.
+	Digest string `json:"digest,omitempty"`
+	// Checksum is the checksum of the image file as it was pulled, for
+	// SIF images stored as is.
+	Checksum string `json:"checksum,omitempty"`
+	// Platform is the OS/architecture of the source image.
+	Platform string `json:"platform,omitempty"`
+	// Time is the time the source image was pulled.
+	Time time.Time `json:"time"`
 }
 
 // Data holds the container metadata attributes.
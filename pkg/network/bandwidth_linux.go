@@ -0,0 +1,115 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// BandwidthEntry describes the bandwidth limits of a container interface,
+// as expected by the bandwidth plugin capability. Rates are in bits per
+// second and bursts in bits, zero means no limit.
+type BandwidthEntry struct {
+	IngressRate  uint64 `json:"ingressRate"`
+	IngressBurst uint64 `json:"ingressBurst"`
+	EgressRate   uint64 `json:"egressRate"`
+	EgressBurst  uint64 `json:"egressBurst"`
+}
+
+// maxBurst is the largest burst in bits, 512MiB, well below the 4GiB the
+// bandwidth plugin can store, in bytes, in a 32-bit field.
+const maxBurst = 1 << 32
+
+// burst returns the burst allowed at rate, the traffic of one second
+// capped to maxBurst.
+func burst(rate uint64) uint64 {
+	if rate > maxBurst {
+		return maxBurst
+	}
+	return rate
+}
+
+// ParseRate parses a rate in bits per second, with an optional k, M or G
+// decimal suffix.
+func ParseRate(s string) (uint64, error) {
+	value := s
+	multiplier := uint64(1)
+
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		multiplier = 1000
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1000 * 1000
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1000 * 1000 * 1000
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	rate, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || rate == 0 {
+		return 0, fmt.Errorf("bad rate %q, must be a positive number of bits per second with an optional k, M or G suffix", s)
+	}
+	if rate > math.MaxUint64/multiplier {
+		return 0, fmt.Errorf("bad rate %q, must be lower than %d bits per second", value, uint64(math.MaxUint64))
+	}
+	return rate * multiplier, nil
+}
+
+// parseBandwidth parses a bandwidth argument value in the
+// ingress:rate,egress:rate format, one direction may be omitted.
+func parseBandwidth(value string) (*BandwidthEntry, error) {
+	bw := &BandwidthEntry{}
+
+	for _, limit := range strings.Split(value, ",") {
+		splitted := strings.SplitN(limit, ":", 2)
+		if len(splitted) != 2 {
+			return nil, fmt.Errorf("badly formatted bandwidth argument '%s', must be of form bandwidth=ingress:rate,egress:rate", value)
+		}
+		rate, err := ParseRate(splitted[1])
+		if err != nil {
+			return nil, err
+		}
+		switch splitted[0] {
+		case "ingress":
+			bw.IngressRate = rate
+			bw.IngressBurst = burst(rate)
+		case "egress":
+			bw.EgressRate = rate
+			bw.EgressBurst = burst(rate)
+		default:
+			return nil, fmt.Errorf("unknown bandwidth direction %s, must be ingress or egress", splitted[0])
+		}
+	}
+	return bw, nil
+}
+
+// SetBandwidthLimit caps the ingress and egress rates of all configured
+// networks to rate bits per second, requested rates above the limit are
+// lowered. The configured networks must have the bandwidth capability.
+func (m *Setup) SetBandwidthLimit(rate uint64) error {
+	for i := range m.networks {
+		if !m.hasCapability(i, "bandwidth") {
+			return fmt.Errorf("%s network doesn't have bandwidth capability required to limit bandwidth", m.networks[i])
+		}
+
+		bw, _ := m.runtimeConf[i].CapabilityArgs["bandwidth"].(BandwidthEntry)
+		if bw.IngressRate == 0 || bw.IngressRate > rate {
+			bw.IngressRate = rate
+			bw.IngressBurst = burst(rate)
+		}
+		if bw.EgressRate == 0 || bw.EgressRate > rate {
+			bw.EgressRate = rate
+			bw.EgressBurst = burst(rate)
+		}
+		m.runtimeConf[i].CapabilityArgs["bandwidth"] = bw
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"testing"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/cni/pkg/types"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    BandwidthEntry
+		wantErr bool
+	}{
+		{
+			name:  "ingress and egress",
+			value: "ingress:10M,egress:5M",
+			want:  BandwidthEntry{IngressRate: 10000000, IngressBurst: 10000000, EgressRate: 5000000, EgressBurst: 5000000},
+		},
+		{
+			name:  "egress only",
+			value: "egress:1G",
+			want:  BandwidthEntry{EgressRate: 1000000000, EgressBurst: 1000000000},
+		},
+		{
+			name:  "capped burst",
+			value: "ingress:40G",
+			want:  BandwidthEntry{IngressRate: 40000000000, IngressBurst: maxBurst},
+		},
+		{
+			name:  "no suffix",
+			value: "ingress:800k,egress:64000",
+			want:  BandwidthEntry{IngressRate: 800000, IngressBurst: 800000, EgressRate: 64000, EgressBurst: 64000},
+		},
+		{
+			name:    "bad direction",
+			value:   "upload:10M",
+			wantErr: true,
+		},
+		{
+			name:    "bad rate",
+			value:   "ingress:10T",
+			wantErr: true,
+		},
+		{
+			name:    "zero rate",
+			value:   "ingress:0",
+			wantErr: true,
+		},
+		{
+			name:    "overflowing rate",
+			value:   "ingress:99999999999G",
+			wantErr: true,
+		},
+		{
+			name:    "missing rate",
+			value:   "ingress",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bw, err := parseBandwidth(tt.value)
+			if err != nil && !tt.wantErr {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.wantErr {
+				t.Fatalf("unexpected success")
+			} else if err == nil && *bw != tt.want {
+				t.Errorf("got %+v, expected %+v", *bw, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetBandwidthLimit(t *testing.T) {
+	newSetup := func(capabilities map[string]bool) *Setup {
+		return &Setup{
+			networks: []string{"test"},
+			networkConfList: []*libcni.NetworkConfigList{
+				{
+					Name: "test",
+					Plugins: []*libcni.NetworkConfig{
+						{Network: &types.NetConf{Type: "bandwidth", Capabilities: capabilities}},
+					},
+				},
+			},
+			runtimeConf: []*libcni.RuntimeConf{
+				{CapabilityArgs: make(map[string]interface{})},
+			},
+		}
+	}
+
+	m := newSetup(map[string]bool{"bandwidth": true})
+	if err := m.SetArgs([]string{"bandwidth=ingress:1M,egress:100M"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := m.SetBandwidthLimit(10000000); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := BandwidthEntry{IngressRate: 1000000, IngressBurst: 1000000, EgressRate: 10000000, EgressBurst: 10000000}
+	if bw := m.runtimeConf[0].CapabilityArgs["bandwidth"]; bw != want {
+		t.Errorf("got %+v, expected %+v", bw, want)
+	}
+
+	m = newSetup(map[string]bool{"portMappings": true})
+	if err := m.SetBandwidthLimit(10000000); err == nil {
+		t.Errorf("unexpected success with a network without bandwidth capability")
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	managedPrefix       = "managed_"
+	managedBridgePrefix = "snet"
+	managedSubnetFormat = "10.24.%d.0/24"
+	maxManagedNetworks  = 256
+)
+
+var managedNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// managedConfList is the CNI configuration of managed networks, a bridge
+// with host-local IP address management, the same as the default bridge
+// network.
+const managedConfList = `{
+    "cniVersion": "0.4.0",
+    "name": %q,
+    "plugins": [
+        {
+            "type": "bridge",
+            "bridge": %q,
+            "isGateway": true,
+            "ipMasq": true,
+            "ipam": {
+                "type": "host-local",
+                "subnet": %q,
+                "routes": [
+                    { "dst": "0.0.0.0/0" }
+                ]
+            }
+        },
+        {
+            "type": "firewall"
+        },
+        {
+            "type": "portmap",
+            "capabilities": {"portMappings": true},
+            "snat": true
+        },
+        {
+            "type": "bandwidth",
+            "capabilities": {"bandwidth": true}
+        }
+    ]
+}
+`
+
+// ManagedNetwork describes a network created with the network create
+// command. Containers attached to the same managed network share a bridge
+// and resolve instances of the network by name.
+type ManagedNetwork struct {
+	Name   string
+	Subnet string
+	Bridge string
+}
+
+// managedConfFile returns the path of the CNI configuration of the managed
+// network name.
+func managedConfFile(confDir string, name string) string {
+	return filepath.Join(confDir, managedPrefix+name+".conflist")
+}
+
+// ManagedHostsFile returns the path of the hosts file shared by the
+// containers of the managed network name.
+func ManagedHostsFile(stateDir string, name string) string {
+	return filepath.Join(stateDir, name+".hosts")
+}
+
+// loadManagedNetwork reads the managed network from the CNI configuration
+// file.
+func loadManagedNetwork(file string) (*ManagedNetwork, error) {
+	conf, err := libcni.ConfListFromFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	if len(conf.Plugins) == 0 {
+		return nil, fmt.Errorf("%s: no bridge plugin", file)
+	}
+
+	var bridge struct {
+		Bridge string `json:"bridge"`
+		IPAM   struct {
+			Subnet string `json:"subnet"`
+		} `json:"ipam"`
+	}
+	if err := json.Unmarshal(conf.Plugins[0].Bytes, &bridge); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	return &ManagedNetwork{
+		Name:   conf.Name,
+		Subnet: bridge.IPAM.Subnet,
+		Bridge: bridge.Bridge,
+	}, nil
+}
+
+// ManagedNetworks returns the managed networks configured in the CNI
+// configuration directory confDir.
+func ManagedNetworks(confDir string) ([]*ManagedNetwork, error) {
+	files, err := filepath.Glob(filepath.Join(confDir, managedPrefix+"*.conflist"))
+	if err != nil {
+		return nil, err
+	}
+
+	networks := make([]*ManagedNetwork, 0, len(files))
+	for _, file := range files {
+		n, err := loadManagedNetwork(file)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
+
+// GetManagedNetwork returns the managed network name, or nil if name isn't
+// a managed network.
+func GetManagedNetwork(confDir string, name string) (*ManagedNetwork, error) {
+	file := managedConfFile(confDir, name)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return loadManagedNetwork(file)
+}
+
+// CreateManagedNetwork writes the CNI configuration of the managed network
+// name in confDir. If subnet is empty, the first free 10.24.X.0/24 subnet is
+// allocated.
+func CreateManagedNetwork(confDir string, name string, subnet string) (*ManagedNetwork, error) {
+	if !managedNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("network name %q must only contain alphanumeric, '.', '_' and '-' characters", name)
+	}
+	if name == "none" || name == SlirpNetwork {
+		return nil, fmt.Errorf("network name %q is reserved", name)
+	}
+
+	existing, err := GetAllNetworkConfigList(&CNIPath{Conf: confDir})
+	if err != nil {
+		if _, ok := err.(libcni.NoConfigsFoundError); !ok {
+			return nil, fmt.Errorf("while reading CNI configurations: %s", err)
+		}
+	}
+	type usedSubnet struct {
+		network string
+		ipnet   *net.IPNet
+	}
+	usedSubnets := make([]usedSubnet, 0, len(existing))
+	for _, conf := range existing {
+		if conf.Name == name {
+			return nil, fmt.Errorf("network %s already exists", name)
+		}
+		for _, plugin := range conf.Plugins {
+			var p struct {
+				IPAM struct {
+					Subnet string `json:"subnet"`
+				} `json:"ipam"`
+			}
+			if err := json.Unmarshal(plugin.Bytes, &p); err != nil || p.IPAM.Subnet == "" {
+				continue
+			}
+			if _, ipnet, err := net.ParseCIDR(p.IPAM.Subnet); err == nil {
+				usedSubnets = append(usedSubnets, usedSubnet{conf.Name, ipnet})
+			}
+		}
+	}
+
+	overlaps := func(ipnet *net.IPNet) string {
+		for _, used := range usedSubnets {
+			if used.ipnet.Contains(ipnet.IP) || ipnet.Contains(used.ipnet.IP) {
+				return used.network
+			}
+		}
+		return ""
+	}
+
+	managed, err := ManagedNetworks(confDir)
+	if err != nil {
+		return nil, err
+	}
+	usedIndex := make(map[int]bool)
+	for _, n := range managed {
+		if i, err := strconv.Atoi(strings.TrimPrefix(n.Bridge, managedBridgePrefix)); err == nil {
+			usedIndex[i] = true
+		}
+	}
+
+	index := -1
+	for i := 0; i < maxManagedNetworks; i++ {
+		if usedIndex[i] {
+			continue
+		}
+		if subnet == "" {
+			_, ipnet, _ := net.ParseCIDR(fmt.Sprintf(managedSubnetFormat, i))
+			if overlaps(ipnet) != "" {
+				continue
+			}
+			subnet = ipnet.String()
+		}
+		index = i
+		break
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("no more than %d managed networks can be created", maxManagedNetworks)
+	}
+
+	_, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, fmt.Errorf("bad subnet %s: %s", subnet, err)
+	}
+	if n := overlaps(ipnet); n != "" {
+		return nil, fmt.Errorf("subnet %s overlaps subnet of network %s", subnet, n)
+	}
+
+	n := &ManagedNetwork{
+		Name:   name,
+		Subnet: ipnet.String(),
+		Bridge: managedBridgePrefix + strconv.Itoa(index),
+	}
+	content := fmt.Sprintf(managedConfList, n.Name, n.Bridge, n.Subnet)
+	if err := ioutil.WriteFile(managedConfFile(confDir, name), []byte(content), 0644); err != nil {
+		return nil, fmt.Errorf("while writing network configuration: %s", err)
+	}
+	return n, nil
+}
+
+// RemoveManagedNetwork removes the CNI configuration of the managed network
+// name from confDir.
+func RemoveManagedNetwork(confDir string, name string) error {
+	n, err := GetManagedNetwork(confDir, name)
+	if err != nil {
+		return err
+	} else if n == nil {
+		return fmt.Errorf("no managed network %s", name)
+	}
+	return os.Remove(managedConfFile(confDir, name))
+}
+
+// updateHosts locks the hosts file at path and replaces its content with
+// the lines returned by update, unless update returns an error. The file is
+// rewritten in place as it is bind mounted in containers.
+func updateHosts(path string, update func(lines []string) ([]string, error)) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+		return fmt.Errorf("while locking %s: %s", path, err)
+	}
+	defer unix.Flock(int(f.Fd()), unix.LOCK_UN)
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("while reading %s: %s", path, err)
+	}
+
+	lines, err = update(lines)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.Write(b.Bytes())
+	return err
+}
+
+// hostPIDComment prefixes the PID of the process owning a hosts entry, in
+// the comment ending the entry.
+const hostPIDComment = "# pid "
+
+// deadHost returns whether the hosts file line is the entry of a process
+// which doesn't exist anymore, like an instance whose master process was
+// killed before removing its entry.
+func deadHost(line string) bool {
+	i := strings.Index(line, hostPIDComment)
+	if i < 0 {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(line[i+len(hostPIDComment):]))
+	if err != nil || pid <= 0 {
+		return false
+	}
+	return unix.Kill(pid, 0) == unix.ESRCH
+}
+
+// withoutHost returns lines without the entry of ip and the entries of
+// dead processes.
+func withoutHost(lines []string, ip net.IP) []string {
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if ip != nil && len(fields) > 0 && net.ParseIP(fields[0]).Equal(ip) {
+			continue
+		}
+		if deadHost(line) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+// hostNames returns the names of the hosts file line.
+func hostNames(line string) []string {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil
+	}
+	return fields[1:]
+}
+
+// AddHost adds name resolving to ip to the hosts file at path, owned by the
+// process pid. The entry is ignored and removed once this process is dead.
+// Instance names are only unique per user while the hosts file is shared by
+// all users, so name is rejected if the entry of a live process uses it.
+func AddHost(path string, ip net.IP, name string, pid int) error {
+	return updateHosts(path, func(lines []string) ([]string, error) {
+		lines = withoutHost(lines, ip)
+		for _, line := range lines {
+			for _, n := range hostNames(line) {
+				if n == name {
+					return nil, fmt.Errorf("host name %s is already used by another instance", name)
+				}
+			}
+		}
+		return append(lines, fmt.Sprintf("%s\t%s\t%s%d", ip, name, hostPIDComment, pid)), nil
+	})
+}
+
+// RemoveHost removes the entry of ip from the hosts file at path.
+func RemoveHost(path string, ip net.IP) error {
+	return updateHosts(path, func(lines []string) ([]string, error) {
+		return withoutHost(lines, ip), nil
+	})
+}
+
+// PruneHosts removes the entries of dead processes from the hosts file at
+// path.
+func PruneHosts(path string) error {
+	return updateHosts(path, func(lines []string) ([]string, error) {
+		return withoutHost(lines, nil), nil
+	})
+}
+
+// Hosts returns the names of the hosts file at path, excluding the
+// loopback and multicast entries and the entries of dead processes.
+func Hosts(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]string, 0)
+	for _, line := range strings.Split(string(b), "\n") {
+		if deadHost(line) {
+			continue
+		}
+		names := hostNames(line)
+		if len(names) == 0 {
+			continue
+		}
+		if ip := net.ParseIP(strings.Fields(line)[0]); ip == nil || ip.IsLoopback() || ip.IsMulticast() {
+			continue
+		}
+		hosts = append(hosts, names...)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestManagedNetwork(t *testing.T) {
+	confDir, err := ioutil.TempDir("", "managed_conf_test_")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(confDir)
+
+	ptp := `{"cniVersion": "0.4.0", "name": "ptp", "plugins": [{"type": "ptp", "ipam": {"type": "host-local", "subnet": "10.23.0.0/16"}}]}`
+	if err := ioutil.WriteFile(filepath.Join(confDir, "10_ptp.conflist"), []byte(ptp), 0644); err != nil {
+		t.Fatalf("could not write ptp configuration: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		subnet  string
+		want    *ManagedNetwork
+		wantErr bool
+	}{
+		{
+			name: "app",
+			want: &ManagedNetwork{Name: "app", Subnet: "10.24.0.0/24", Bridge: "snet0"},
+		},
+		{
+			name:    "app",
+			wantErr: true,
+		},
+		{
+			name:   "db",
+			subnet: "10.50.1.0/24",
+			want:   &ManagedNetwork{Name: "db", Subnet: "10.50.1.0/24", Bridge: "snet1"},
+		},
+		{
+			name:    "overlap",
+			subnet:  "10.50.0.0/16",
+			wantErr: true,
+		},
+		{
+			name:    "ptp",
+			wantErr: true,
+		},
+		{
+			name:    "ptp-overlap",
+			subnet:  "10.23.5.0/24",
+			wantErr: true,
+		},
+		{
+			name:    "bad/name",
+			wantErr: true,
+		},
+		{
+			name:    SlirpNetwork,
+			wantErr: true,
+		},
+		{
+			name:    "bad-subnet",
+			subnet:  "10.50.2.0",
+			wantErr: true,
+		},
+		{
+			name: "web",
+			want: &ManagedNetwork{Name: "web", Subnet: "10.24.2.0/24", Bridge: "snet2"},
+		},
+	}
+
+	for _, tt := range tests {
+		n, err := CreateManagedNetwork(confDir, tt.name, tt.subnet)
+		if err != nil && !tt.wantErr {
+			t.Errorf("unexpected error while creating network %s: %s", tt.name, err)
+		} else if err == nil && tt.wantErr {
+			t.Errorf("unexpected success while creating network %s", tt.name)
+		} else if err == nil && !reflect.DeepEqual(n, tt.want) {
+			t.Errorf("got network %+v, expected %+v", n, tt.want)
+		}
+	}
+
+	if _, err := GetAllNetworkConfigList(&CNIPath{Conf: confDir}); err != nil {
+		t.Errorf("unexpected error while loading networks: %s", err)
+	}
+
+	if err := RemoveManagedNetwork(confDir, "db"); err != nil {
+		t.Errorf("unexpected error while removing network db: %s", err)
+	}
+	if err := RemoveManagedNetwork(confDir, "db"); err == nil {
+		t.Errorf("unexpected success while removing network db twice")
+	}
+
+	networks, err := ManagedNetworks(confDir)
+	if err != nil {
+		t.Fatalf("unexpected error while listing networks: %s", err)
+	}
+	if len(networks) != 2 || networks[0].Name != "app" || networks[1].Name != "web" {
+		t.Errorf("got networks %+v, expected app and web", networks)
+	}
+
+	if n, err := GetManagedNetwork(confDir, "db"); err != nil || n != nil {
+		t.Errorf("unexpected network db: %+v %v", n, err)
+	}
+}
+
+func TestManagedHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "managed_hosts_test_")
+	if err != nil {
+		t.Fatalf("could not create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hosts")
+	content := "127.0.0.1   localhost\n::1         localhost\nff02::1     ip6-allnodes\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("could not write hosts file: %s", err)
+	}
+
+	db := net.ParseIP("10.23.0.2")
+	app := net.ParseIP("10.23.0.3")
+	killed := net.ParseIP("10.23.0.4")
+	restarted := net.ParseIP("10.23.0.5")
+
+	// the PID of a process which exited and was reaped
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("could not run true: %s", err)
+	}
+	deadPid := cmd.Process.Pid
+
+	if err := AddHost(path, db, "db", os.Getpid()); err != nil {
+		t.Fatalf("unexpected error while adding host: %s", err)
+	}
+	if err := AddHost(path, killed, "killed", deadPid); err != nil {
+		t.Fatalf("unexpected error while adding host: %s", err)
+	}
+
+	// entries of dead processes are ignored, then pruned
+	hosts, err := Hosts(path)
+	if err != nil {
+		t.Fatalf("unexpected error while reading hosts: %s", err)
+	}
+	if !reflect.DeepEqual(hosts, []string{"db"}) {
+		t.Errorf("got hosts %v, expected [db]", hosts)
+	}
+	if err := PruneHosts(path); err != nil {
+		t.Fatalf("unexpected error while pruning hosts: %s", err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil {
+		t.Fatalf("could not read hosts file: %s", err)
+	} else if strings.Contains(string(b), "killed") {
+		t.Errorf("entry of dead process not pruned: %q", string(b))
+	}
+
+	if err := AddHost(path, app, "app", os.Getpid()); err != nil {
+		t.Fatalf("unexpected error while adding host: %s", err)
+	}
+	// the instance of another user with the same name
+	if err := AddHost(path, killed, "app", os.Getpid()); err == nil {
+		t.Errorf("unexpected success adding host name used by a live entry")
+	}
+	// the name of a dead process is reused
+	if err := AddHost(path, killed, "killed", deadPid); err != nil {
+		t.Fatalf("unexpected error while adding host: %s", err)
+	}
+	if err := AddHost(path, restarted, "killed", os.Getpid()); err != nil {
+		t.Fatalf("unexpected error while reusing host name of dead entry: %s", err)
+	}
+	if err := RemoveHost(path, restarted); err != nil {
+		t.Fatalf("unexpected error while removing host: %s", err)
+	}
+	if err := AddHost(path, db, "db2", os.Getpid()); err != nil {
+		t.Fatalf("unexpected error while adding host: %s", err)
+	}
+
+	hosts, err = Hosts(path)
+	if err != nil {
+		t.Fatalf("unexpected error while reading hosts: %s", err)
+	}
+	if !reflect.DeepEqual(hosts, []string{"app", "db2"}) {
+		t.Errorf("got hosts %v, expected [app db2]", hosts)
+	}
+
+	if err := RemoveHost(path, app); err != nil {
+		t.Fatalf("unexpected error while removing host: %s", err)
+	}
+	if err := RemoveHost(path, db); err != nil {
+		t.Fatalf("unexpected error while removing host: %s", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read hosts file: %s", err)
+	}
+	if string(b) != content {
+		t.Errorf("got hosts file %q, expected %q", string(b), content)
+	}
+}
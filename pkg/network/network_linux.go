@@ -22,6 +22,7 @@ import (
 	"github.com/containernetworking/cni/pkg/types/current"
 	"github.com/containernetworking/plugins/plugins/ipam/host-local/backend/allocator"
 	"github.com/hpcng/singularity/internal/pkg/util/env"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
 
 type netError string
@@ -52,6 +53,8 @@ type Setup struct {
 	containerID     string
 	netNS           string
 	envPath         string
+	classID         *uint32
+	priorities      []specs.LinuxInterfacePriority
 }
 
 // PortMapEntry describes a port mapping between host and container
@@ -191,20 +194,63 @@ func parseArg(arg string) ([][2]string, error) {
 	return argList, nil
 }
 
+// parsePortMap parses a portmap argument value in the
+// hostPort[:containerPort]/protocol format.
+func parsePortMap(value string) (*PortMapEntry, error) {
+	pm := &PortMapEntry{}
+
+	splittedPort := strings.SplitN(value, "/", 2)
+	if len(splittedPort) != 2 {
+		return nil, fmt.Errorf("badly formatted portmap argument '%s', must be of form portmap=hostPort:containerPort/protocol", value)
+	}
+	pm.Protocol = splittedPort[1]
+	if pm.Protocol != "tcp" && pm.Protocol != "udp" {
+		return nil, fmt.Errorf("only tcp and udp protocol can be specified")
+	}
+	ports := strings.Split(splittedPort[0], ":")
+	if len(ports) != 1 && len(ports) != 2 {
+		return nil, fmt.Errorf("portmap port argument is badly formatted")
+	}
+	if n, err := strconv.ParseUint(ports[0], 0, 16); err == nil {
+		pm.HostPort = int(n)
+		if pm.HostPort <= 0 || pm.HostPort > 65535 {
+			return nil, fmt.Errorf("host port must be greater than 0 and less than 65535")
+		}
+	} else {
+		return nil, fmt.Errorf("can't convert host port '%s': %s", ports[0], err)
+	}
+	if len(ports) == 2 {
+		if n, err := strconv.ParseUint(ports[1], 0, 16); err == nil {
+			pm.ContainerPort = int(n)
+			if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 {
+				return nil, fmt.Errorf("container port must be greater than 0 and less than 65535")
+			}
+		} else {
+			return nil, fmt.Errorf("can't convert container port '%s': %s", ports[1], err)
+		}
+	} else {
+		pm.ContainerPort = pm.HostPort
+	}
+	return pm, nil
+}
+
+// hasCapability returns whether a plugin of the configured network at
+// index i has the capability capName.
+func (m *Setup) hasCapability(i int, capName string) bool {
+	for _, plugin := range m.networkConfList[i].Plugins {
+		if plugin.Network.Capabilities[capName] {
+			return true
+		}
+	}
+	return false
+}
+
 // SetCapability sets capability arguments for the corresponding network plugin
 // uses by a configured network
 func (m *Setup) SetCapability(network string, capName string, args interface{}) error {
 	for i := range m.networks {
 		if m.networks[i] == network {
-			hasCap := false
-			for _, plugin := range m.networkConfList[i].Plugins {
-				if plugin.Network.Capabilities[capName] {
-					hasCap = true
-					break
-				}
-			}
-
-			if !hasCap {
+			if !m.hasCapability(i, capName) {
 				return fmt.Errorf("%s network doesn't have %s capability", network, capName)
 			}
 
@@ -217,6 +263,8 @@ func (m *Setup) SetCapability(network string, capName string, args interface{})
 					m.runtimeConf[i].CapabilityArgs[capName].([]PortMapEntry),
 					args,
 				)
+			case BandwidthEntry:
+				m.runtimeConf[i].CapabilityArgs[capName] = args
 			case []allocator.Range:
 				if m.runtimeConf[i].CapabilityArgs[capName] == nil {
 					m.runtimeConf[i].CapabilityArgs[capName] = []allocator.RangeSet{args}
@@ -269,43 +317,33 @@ func (m *Setup) SetArgs(args []string) error {
 			key := kv[0]
 			value := kv[1]
 			if key == "portmap" {
-				pm := &PortMapEntry{}
-
-				splittedPort := strings.SplitN(value, "/", 2)
-				if len(splittedPort) != 2 {
-					return fmt.Errorf("badly formatted portmap argument '%s', must be of form portmap=hostPort:containerPort/protocol", value)
+				pm, err := parsePortMap(value)
+				if err != nil {
+					return err
 				}
-				pm.Protocol = splittedPort[1]
-				if pm.Protocol != "tcp" && pm.Protocol != "udp" {
-					return fmt.Errorf("only tcp and udp protocol can be specified")
+				if err := m.SetCapability(networkName, "portMappings", *pm); err != nil {
+					return err
 				}
-				ports := strings.Split(splittedPort[0], ":")
-				if len(ports) != 1 && len(ports) != 2 {
-					return fmt.Errorf("portmap port argument is badly formatted")
+			} else if key == "bandwidth" {
+				bw, err := parseBandwidth(value)
+				if err != nil {
+					return err
 				}
-				if n, err := strconv.ParseUint(ports[0], 0, 16); err == nil {
-					pm.HostPort = int(n)
-					if pm.HostPort <= 0 || pm.HostPort > 65535 {
-						return fmt.Errorf("host port must be greater than 0 and less than 65535")
-					}
-				} else {
-					return fmt.Errorf("can't convert host port '%s': %s", ports[0], err)
+				if err := m.SetCapability(networkName, "bandwidth", *bw); err != nil {
+					return err
 				}
-				if len(ports) == 2 {
-					if n, err := strconv.ParseUint(ports[1], 0, 16); err == nil {
-						pm.ContainerPort = int(n)
-						if pm.ContainerPort <= 0 || pm.ContainerPort > 65535 {
-							return fmt.Errorf("container port must be greater than 0 and less than 65535")
-						}
-					} else {
-						return fmt.Errorf("can't convert container port '%s': %s", ports[1], err)
-					}
-				} else {
-					pm.ContainerPort = pm.HostPort
+			} else if key == "classid" {
+				classID, err := parseClassID(value)
+				if err != nil {
+					return err
 				}
-				if err := m.SetCapability(networkName, "portMappings", *pm); err != nil {
+				m.classID = &classID
+			} else if key == "priority" {
+				priorities, err := parsePriorities(value)
+				if err != nil {
 					return err
 				}
+				m.priorities = append(m.priorities, priorities...)
 			} else if key == "ipRange" {
 				ipRange := make([]allocator.Range, 1)
 				_, subnet, err := net.ParseCIDR(value)
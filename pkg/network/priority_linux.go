@@ -0,0 +1,69 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// parseClassID parses a classid argument value, a net_cls class identifier
+// in the major:minor hexadecimal format of traffic control handles.
+func parseClassID(value string) (uint32, error) {
+	splitted := strings.SplitN(value, ":", 2)
+	if len(splitted) != 2 {
+		return 0, fmt.Errorf("badly formatted classid argument '%s', must be of form classid=major:minor", value)
+	}
+	major, err := strconv.ParseUint(splitted[0], 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("bad classid major number %q, must be a hexadecimal number lower than 0x10000", splitted[0])
+	}
+	minor, err := strconv.ParseUint(splitted[1], 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("bad classid minor number %q, must be a hexadecimal number lower than 0x10000", splitted[1])
+	}
+	return uint32(major<<16 | minor), nil
+}
+
+// parsePriorities parses a priority argument value in the
+// interface:priority[,interface:priority] format.
+func parsePriorities(value string) ([]specs.LinuxInterfacePriority, error) {
+	var priorities []specs.LinuxInterfacePriority
+
+	for _, p := range strings.Split(value, ",") {
+		splitted := strings.SplitN(p, ":", 2)
+		if len(splitted) != 2 || splitted[0] == "" {
+			return nil, fmt.Errorf("badly formatted priority argument '%s', must be of form priority=interface:priority", value)
+		}
+		prio, err := strconv.ParseUint(splitted[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad priority %q for interface %s", splitted[1], splitted[0])
+		}
+		priorities = append(priorities, specs.LinuxInterfacePriority{
+			Name:     splitted[0],
+			Priority: uint32(prio),
+		})
+	}
+	return priorities, nil
+}
+
+// NetworkResources returns the cgroups network resources requested with
+// the classid and priority arguments, or nil if none were requested. The
+// class identifier tags the packets of the container for the traffic
+// control of the host, and the priorities of the named host interfaces
+// order the traffic of the container on these interfaces.
+func (m *Setup) NetworkResources() *specs.LinuxNetwork {
+	if m.classID == nil && len(m.priorities) == 0 {
+		return nil
+	}
+	return &specs.LinuxNetwork{
+		ClassID:    m.classID,
+		Priorities: m.priorities,
+	}
+}
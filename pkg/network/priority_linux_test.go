@@ -0,0 +1,103 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/containernetworking/cni/libcni"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestParseClassID(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    uint32
+		wantErr bool
+	}{
+		{name: "valid", value: "10:1", want: 0x100001},
+		{name: "hexadecimal", value: "ffff:ff", want: 0xffff00ff},
+		{name: "missing minor", value: "10", wantErr: true},
+		{name: "bad major", value: "x:1", wantErr: true},
+		{name: "too large minor", value: "1:10000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := parseClassID(tt.value)
+			if err != nil && !tt.wantErr {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.wantErr {
+				t.Fatalf("unexpected success")
+			} else if err == nil && id != tt.want {
+				t.Errorf("got %#x, expected %#x", id, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePriorities(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []specs.LinuxInterfacePriority
+		wantErr bool
+	}{
+		{
+			name:  "single interface",
+			value: "eth0:5",
+			want:  []specs.LinuxInterfacePriority{{Name: "eth0", Priority: 5}},
+		},
+		{
+			name:  "several interfaces",
+			value: "eth0:5,ib0:10",
+			want: []specs.LinuxInterfacePriority{
+				{Name: "eth0", Priority: 5},
+				{Name: "ib0", Priority: 10},
+			},
+		},
+		{name: "missing priority", value: "eth0", wantErr: true},
+		{name: "missing interface", value: ":5", wantErr: true},
+		{name: "bad priority", value: "eth0:-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parsePriorities(tt.value)
+			if err != nil && !tt.wantErr {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.wantErr {
+				t.Fatalf("unexpected success")
+			} else if err == nil && !reflect.DeepEqual(p, tt.want) {
+				t.Errorf("got %+v, expected %+v", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetworkResources(t *testing.T) {
+	m := &Setup{
+		networks:    []string{"test"},
+		runtimeConf: []*libcni.RuntimeConf{{}},
+	}
+	if r := m.NetworkResources(); r != nil {
+		t.Errorf("unexpected network resources %+v without arguments", r)
+	}
+
+	if err := m.SetArgs([]string{"classid=10:1;priority=eth0:5"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	classID := uint32(0x100001)
+	want := &specs.LinuxNetwork{
+		ClassID:    &classID,
+		Priorities: []specs.LinuxInterfacePriority{{Name: "eth0", Priority: 5}},
+	}
+	if r := m.NetworkResources(); !reflect.DeepEqual(r, want) {
+		t.Errorf("got %+v, expected %+v", r, want)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types/current"
+)
+
+// Result holds the CNI result of a network attached to a container, along
+// with the container interface and the port mappings of the network.
+type Result struct {
+	Network      string          `json:"network"`
+	Interface    string          `json:"interface"`
+	PortMappings []PortMapEntry  `json:"portMappings,omitempty"`
+	CNIResult    json.RawMessage `json:"cniResult"`
+}
+
+// Info describes the container interface of a network attached to a
+// container.
+type Info struct {
+	Network      string         `json:"network"`
+	Interface    string         `json:"interface"`
+	MAC          string         `json:"mac,omitempty"`
+	IPv4         []string       `json:"ipv4,omitempty"`
+	IPv6         []string       `json:"ipv6,omitempty"`
+	Gateway4     string         `json:"gateway4,omitempty"`
+	Gateway6     string         `json:"gateway6,omitempty"`
+	PortMappings []PortMapEntry `json:"portMappings,omitempty"`
+}
+
+// GetResults returns the results of the configured networks, once
+// AddNetworks succeeded.
+func (m *Setup) GetResults() ([]Result, error) {
+	results := make([]Result, 0, len(m.result))
+
+	for i := 0; i < len(m.result); i++ {
+		res, err := current.NewResultFromResult(m.result[i])
+		if err != nil {
+			return nil, fmt.Errorf("could not convert result: %v", err)
+		}
+		b, err := json.Marshal(res)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode result: %v", err)
+		}
+		r := Result{
+			Network:   m.networkConfList[i].Name,
+			Interface: m.runtimeConf[i].IfName,
+			CNIResult: b,
+		}
+		if pm, ok := m.runtimeConf[i].CapabilityArgs["portMappings"].([]PortMapEntry); ok {
+			r.PortMappings = pm
+		}
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// Info returns the details of the container interface from the CNI result.
+func (r *Result) Info() (*Info, error) {
+	res, err := current.NewResult(r.CNIResult)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode result of network %s: %v", r.Network, err)
+	}
+	result, err := current.GetResult(res)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert result of network %s: %v", r.Network, err)
+	}
+
+	info := &Info{
+		Network:      r.Network,
+		Interface:    r.Interface,
+		PortMappings: r.PortMappings,
+	}
+
+	// the container interface is the one with a sandbox, results may
+	// also list host interfaces like bridges and veth peers
+	ifIndex := -1
+	for i, iface := range result.Interfaces {
+		if iface.Sandbox != "" && iface.Name == r.Interface {
+			ifIndex = i
+			info.MAC = iface.Mac
+			break
+		}
+	}
+
+	for _, ip := range result.IPs {
+		if ip.Interface != nil && ifIndex >= 0 && *ip.Interface != ifIndex {
+			continue
+		}
+		if ip.Version == "4" {
+			info.IPv4 = append(info.IPv4, ip.Address.String())
+			if ip.Gateway != nil && info.Gateway4 == "" {
+				info.Gateway4 = ip.Gateway.String()
+			}
+		} else {
+			info.IPv6 = append(info.IPv6, ip.Address.String())
+			if ip.Gateway != nil && info.Gateway6 == "" {
+				info.Gateway6 = ip.Gateway.String()
+			}
+		}
+	}
+
+	return info, nil
+}
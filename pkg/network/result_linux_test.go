@@ -0,0 +1,81 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"reflect"
+	"testing"
+)
+
+const bridgeResult = `{
+	"cniVersion": "0.4.0",
+	"interfaces": [
+		{"name": "sbr0", "mac": "f6:2b:1c:63:a3:9e"},
+		{"name": "veth4dfa9b9b", "mac": "46:0c:c3:56:24:3c"},
+		{"name": "eth0", "mac": "5e:d4:82:5f:1c:a3", "sandbox": "/proc/1234/ns/net"}
+	],
+	"ips": [
+		{"version": "4", "interface": 2, "address": "10.22.0.2/16", "gateway": "10.22.0.1"},
+		{"version": "6", "interface": 2, "address": "fd00::2/64", "gateway": "fd00::1"}
+	],
+	"routes": [{"dst": "0.0.0.0/0"}],
+	"dns": {}
+}`
+
+func TestResultInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  Result
+		want    *Info
+		wantErr bool
+	}{
+		{
+			name: "bridge",
+			result: Result{
+				Network:   "bridge",
+				Interface: "eth0",
+				PortMappings: []PortMapEntry{
+					{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+				},
+				CNIResult: []byte(bridgeResult),
+			},
+			want: &Info{
+				Network:   "bridge",
+				Interface: "eth0",
+				MAC:       "5e:d4:82:5f:1c:a3",
+				IPv4:      []string{"10.22.0.2/16"},
+				IPv6:      []string{"fd00::2/64"},
+				Gateway4:  "10.22.0.1",
+				Gateway6:  "fd00::1",
+				PortMappings: []PortMapEntry{
+					{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+				},
+			},
+		},
+		{
+			name: "bad result",
+			result: Result{
+				Network:   "bridge",
+				Interface: "eth0",
+				CNIResult: []byte("{"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := tt.result.Info()
+			if err != nil && !tt.wantErr {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.wantErr {
+				t.Fatalf("unexpected success")
+			} else if err == nil && !reflect.DeepEqual(info, tt.want) {
+				t.Errorf("got %+v, expected %+v", info, tt.want)
+			}
+		})
+	}
+}
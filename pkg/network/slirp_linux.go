@@ -0,0 +1,273 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// SlirpNetwork is the name of the user-mode network provided by
+	// slirp4netns, which doesn't require any CNI configuration.
+	SlirpNetwork = "slirp"
+	// SlirpDNS is the address of the DNS server forwarding queries to
+	// the host resolvers in the slirp network.
+	SlirpDNS = "10.0.2.3"
+)
+
+const (
+	slirpInterface    = "tap0"
+	slirpMTU          = 65520
+	slirpReadyTimeout = 10 * time.Second
+	slirpStopTimeout  = 5 * time.Second
+)
+
+// Slirp provides user-mode networking to the network namespace of a
+// container process with slirp4netns, without any privileges.
+type Slirp struct {
+	binary   string
+	pid      int
+	portMaps []*PortMapEntry
+	cmd      *exec.Cmd
+	exitFd   *os.File
+	tmpDir   string
+	stderr   bytes.Buffer
+}
+
+// NewSlirp returns a slirp network setup for the network namespace of the
+// process pid, using the slirp4netns program binary. Network arguments args
+// are in the same format as Setup.SetArgs arguments, only portmap keys are
+// supported.
+func NewSlirp(binary string, pid int, args []string) (*Slirp, error) {
+	s := &Slirp{
+		binary: binary,
+		pid:    pid,
+	}
+
+	for _, arg := range args {
+		if i := strings.IndexByte(arg, ':'); i >= 0 && i < strings.IndexByte(arg, '=') {
+			splitted := strings.SplitN(arg, ":", 2)
+			if splitted[0] != SlirpNetwork {
+				return nil, fmt.Errorf("network %s wasn't specified in --network option", splitted[0])
+			}
+			arg = splitted[1]
+		}
+		argList, err := parseArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range argList {
+			if kv[0] != "portmap" {
+				return nil, fmt.Errorf("unsupported %s network argument %s, only portmap is supported", SlirpNetwork, kv[0])
+			}
+			pm, err := parsePortMap(kv[1])
+			if err != nil {
+				return nil, err
+			}
+			s.portMaps = append(s.portMaps, pm)
+		}
+	}
+
+	return s, nil
+}
+
+// nsPath returns the path of the namespace ns of the process pid.
+func nsPath(pid int, ns string) string {
+	return filepath.Join("/proc", strconv.Itoa(pid), "ns", ns)
+}
+
+// sameNamespace returns whether the process pid and the current process
+// share the namespace ns.
+func sameNamespace(pid int, ns string) (bool, error) {
+	var self, other syscall.Stat_t
+
+	if err := syscall.Stat(nsPath(os.Getpid(), ns), &self); err != nil {
+		return false, err
+	}
+	if err := syscall.Stat(nsPath(pid, ns), &other); err != nil {
+		return false, err
+	}
+	return self.Dev == other.Dev && self.Ino == other.Ino, nil
+}
+
+// Start starts slirp4netns and waits until the network namespace is
+// configured, then adds port forwarding rules. slirp4netns exits with
+// the calling process.
+func (s *Slirp) Start(ctx context.Context) error {
+	var err error
+
+	s.tmpDir, err = ioutil.TempDir("", "singularity-slirp-")
+	if err != nil {
+		return fmt.Errorf("while creating slirp4netns directory: %s", err)
+	}
+	apiSocket := filepath.Join(s.tmpDir, "api.sock")
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("while creating slirp4netns ready pipe: %s", err)
+	}
+	defer readyR.Close()
+	exitR, exitW, err := os.Pipe()
+	if err != nil {
+		readyW.Close()
+		return fmt.Errorf("while creating slirp4netns exit pipe: %s", err)
+	}
+	defer exitR.Close()
+
+	args := []string{
+		"--configure",
+		"--mtu=" + strconv.Itoa(slirpMTU),
+		"--disable-host-loopback",
+		"--api-socket=" + apiSocket,
+		"--ready-fd=3",
+		"--exit-fd=4",
+		"--netns-type=path",
+	}
+
+	attr := &syscall.SysProcAttr{}
+
+	sameUserNs, err := sameNamespace(s.pid, "user")
+	if err != nil {
+		readyW.Close()
+		return fmt.Errorf("while checking user namespace: %s", err)
+	}
+	if sameUserNs {
+		// we share the user namespace owning the container network
+		// namespace, slirp4netns requires our capabilities to join it
+		// and create the tap device
+		attr.AmbientCaps = []uintptr{unix.CAP_SYS_ADMIN, unix.CAP_NET_ADMIN}
+	} else {
+		args = append(args, "--userns-path="+nsPath(s.pid, "user"))
+	}
+	args = append(args, nsPath(s.pid, "net"), slirpInterface)
+
+	s.cmd = exec.Command(s.binary, args...)
+	s.cmd.ExtraFiles = []*os.File{readyW, exitR}
+	s.cmd.Stderr = &s.stderr
+	s.cmd.SysProcAttr = attr
+
+	err = s.cmd.Start()
+	readyW.Close()
+	if err != nil {
+		exitW.Close()
+		return fmt.Errorf("while starting slirp4netns: %s", err)
+	}
+	s.exitFd = exitW
+
+	ready := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		_, err := readyR.Read(b)
+		ready <- err
+	}()
+
+	select {
+	case err = <-ready:
+	case <-time.After(slirpReadyTimeout):
+		err = fmt.Errorf("timeout")
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		s.Stop()
+		return fmt.Errorf("slirp4netns failed to configure network: %s: %s", err, strings.TrimSpace(s.stderr.String()))
+	}
+
+	for _, pm := range s.portMaps {
+		if err := s.addHostForward(apiSocket, pm); err != nil {
+			s.Stop()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addHostForward adds the port forwarding rule pm with the slirp4netns
+// API socket.
+func (s *Slirp) addHostForward(apiSocket string, pm *PortMapEntry) error {
+	hostIP := pm.HostIP
+	if hostIP == "" {
+		hostIP = "0.0.0.0"
+	}
+
+	req := map[string]interface{}{
+		"execute": "add_hostfwd",
+		"arguments": map[string]interface{}{
+			"proto":      pm.Protocol,
+			"host_addr":  hostIP,
+			"host_port":  pm.HostPort,
+			"guest_port": pm.ContainerPort,
+		},
+	}
+
+	conn, err := net.Dial("unix", apiSocket)
+	if err != nil {
+		return fmt.Errorf("while connecting to slirp4netns API socket: %s", err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("while sending slirp4netns request: %s", err)
+	}
+	if err := conn.(*net.UnixConn).CloseWrite(); err != nil {
+		return fmt.Errorf("while sending slirp4netns request: %s", err)
+	}
+
+	var res struct {
+		Error *struct {
+			Desc string `json:"desc"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return fmt.Errorf("while reading slirp4netns response: %s", err)
+	}
+	if res.Error != nil {
+		return fmt.Errorf("could not forward port %d/%s: %s", pm.HostPort, pm.Protocol, res.Error.Desc)
+	}
+	return nil
+}
+
+// Stop stops slirp4netns.
+func (s *Slirp) Stop() error {
+	defer os.RemoveAll(s.tmpDir)
+
+	if s.cmd == nil || s.cmd.Process == nil {
+		return nil
+	}
+	cmd := s.cmd
+	s.cmd = nil
+
+	// slirp4netns exits once the exit pipe is closed
+	s.exitFd.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(slirpStopTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("slirp4netns didn't exit, killed")
+	}
+}
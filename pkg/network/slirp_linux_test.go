@@ -0,0 +1,74 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE.md file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package network
+
+import (
+	"testing"
+)
+
+func TestNewSlirp(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		portMaps []PortMapEntry
+		wantErr  bool
+	}{
+		{
+			name: "no arguments",
+		},
+		{
+			name: "portmap",
+			args: []string{"portmap=8080:80/tcp"},
+			portMaps: []PortMapEntry{
+				{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+			},
+		},
+		{
+			name: "portmaps with network prefix",
+			args: []string{"slirp:portmap=8080:80/tcp;portmap=5353:53/udp"},
+			portMaps: []PortMapEntry{
+				{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+				{HostPort: 5353, ContainerPort: 53, Protocol: "udp"},
+			},
+		},
+		{
+			name:    "other network",
+			args:    []string{"bridge:portmap=8080:80/tcp"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported argument",
+			args:    []string{"IP=10.0.2.100"},
+			wantErr: true,
+		},
+		{
+			name:    "bad portmap",
+			args:    []string{"portmap=8080:80/sctp"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSlirp("slirp4netns", 1, tt.args)
+			if err != nil && !tt.wantErr {
+				t.Fatalf("unexpected error: %s", err)
+			} else if err == nil && tt.wantErr {
+				t.Fatalf("unexpected success")
+			} else if err != nil {
+				return
+			}
+			if len(s.portMaps) != len(tt.portMaps) {
+				t.Fatalf("got %d port mappings, expected %d", len(s.portMaps), len(tt.portMaps))
+			}
+			for i, pm := range s.portMaps {
+				if *pm != tt.portMaps[i] {
+					t.Errorf("got port mapping %+v, expected %+v", *pm, tt.portMaps[i])
+				}
+			}
+		})
+	}
+}
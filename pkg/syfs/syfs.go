@@ -18,10 +18,11 @@ import (
 )
 
 const (
-	RemoteConfFile = "remote.yaml"
-	RemoteCache    = "remote-cache"
-	DockerConfFile = "docker-config.json"
-	singularityDir = ".singularity"
+	RemoteConfFile     = "remote.yaml"
+	RemoteCache        = "remote-cache"
+	DockerConfFile     = "docker-config.json"
+	RegistriesConfFile = "registries.conf"
+	singularityDir     = ".singularity"
 )
 
 // cache contains the information for the current user
@@ -71,6 +72,12 @@ func DockerConf() string {
 	return filepath.Join(ConfigDir(), DockerConfFile)
 }
 
+// RegistriesConf returns the path of the user registries configuration
+// file, which takes precedence over the system one.
+func RegistriesConf() string {
+	return filepath.Join(ConfigDir(), RegistriesConfFile)
+}
+
 // ConfigDirForUsername returns the directory where the singularity
 // configuration and data for the specified username is located.
 func ConfigDirForUsername(username string) (string, error) {
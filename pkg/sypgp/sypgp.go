@@ -296,8 +296,9 @@ func loadKeysFromFile(fn string) (openpgp.EntityList, error) {
 	return openpgp.ReadArmoredKeyRing(buf)
 }
 
-// printEntity pretty prints an entity entry to w
-func printEntity(w io.Writer, index int, e *openpgp.Entity) {
+// printEntity pretty prints an entity entry to w, along with its trust
+// level found in db if not nil
+func printEntity(w io.Writer, index int, e *openpgp.Entity, db TrustDB) {
 	// TODO(mem): this should not be here, this is presentation
 	for _, v := range e.Identities {
 		fmt.Fprintf(w, "%d) U: %s (%s) <%s>\n", index, v.UserId.Name, v.UserId.Comment, v.UserId.Email)
@@ -306,29 +307,47 @@ func printEntity(w io.Writer, index int, e *openpgp.Entity) {
 	fmt.Fprintf(w, "   F: %0X\n", e.PrimaryKey.Fingerprint)
 	bits, _ := e.PrimaryKey.BitLength()
 	fmt.Fprintf(w, "   L: %d\n", bits)
-
+	if expiry, ok := KeyExpiry(e); ok {
+		status := ""
+		if !time.Now().Before(expiry) {
+			status = " (expired)"
+		}
+		fmt.Fprintf(w, "   E: %s%s\n", expiry, status)
+	}
+	if sig := Revocation(e); sig != nil {
+		fmt.Fprintf(w, "   R: %s\n", sig.CreationTime)
+	}
+	if db != nil {
+		fmt.Fprintf(w, "   T: %s\n", db.Level(e))
+	}
 }
 
-func printEntities(w io.Writer, entities openpgp.EntityList) {
+func printEntities(w io.Writer, entities openpgp.EntityList, db TrustDB) {
 	for i, e := range entities {
-		printEntity(w, i, e)
+		printEntity(w, i, e, db)
 		fmt.Fprint(w, "   --------\n")
 	}
 }
 
 // PrintEntity pretty prints an entity entry
 func PrintEntity(index int, e *openpgp.Entity) {
-	printEntity(os.Stdout, index, e)
+	printEntity(os.Stdout, index, e, nil)
 }
 
 // PrintPubKeyring prints the public keyring read from the public local store
+// along with the key trust levels
 func (keyring *Handle) PrintPubKeyring() error {
 	pubEntlist, err := keyring.LoadPubKeyring()
 	if err != nil {
 		return err
 	}
 
-	printEntities(os.Stdout, pubEntlist)
+	db, err := keyring.LoadTrustDB()
+	if err != nil {
+		return err
+	}
+
+	printEntities(os.Stdout, pubEntlist, db)
 
 	return nil
 }
@@ -340,7 +359,7 @@ func (keyring *Handle) PrintPrivKeyring() error {
 		return err
 	}
 
-	printEntities(os.Stdout, privEntlist)
+	printEntities(os.Stdout, privEntlist, nil)
 
 	return nil
 }
@@ -371,10 +390,45 @@ func (keyring *Handle) appendPrivateKey(e *openpgp.Entity) error {
 	return storePrivKeys(f, openpgp.EntityList{e})
 }
 
+// serializePublicEntity writes the public part of entity e to the writer w like
+// openpgp.Entity.Serialize does, along with the key revocation signatures.
+func serializePublicEntity(w io.Writer, e *openpgp.Entity) error {
+	if err := e.PrimaryKey.Serialize(w); err != nil {
+		return err
+	}
+	for _, sig := range e.Revocations {
+		if err := sig.Serialize(w); err != nil {
+			return err
+		}
+	}
+	for _, ident := range e.Identities {
+		if err := ident.UserId.Serialize(w); err != nil {
+			return err
+		}
+		if err := ident.SelfSignature.Serialize(w); err != nil {
+			return err
+		}
+		for _, sig := range ident.Signatures {
+			if err := sig.Serialize(w); err != nil {
+				return err
+			}
+		}
+	}
+	for _, subkey := range e.Subkeys {
+		if err := subkey.PublicKey.Serialize(w); err != nil {
+			return err
+		}
+		if err := subkey.Sig.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // storePubKeys writes all the public keys in list to the writer w.
 func storePubKeys(w io.Writer, list openpgp.EntityList) error {
 	for _, e := range list {
-		if err := e.Serialize(w); err != nil {
+		if err := serializePublicEntity(w, e); err != nil {
 			return err
 		}
 	}
@@ -412,7 +466,7 @@ func (keyring *Handle) storePubKeyring(keys openpgp.EntityList) error {
 	defer f.Close()
 
 	for _, k := range keys {
-		if err := k.Serialize(f); err != nil {
+		if err := serializePublicEntity(f, k); err != nil {
 			return fmt.Errorf("could not store public key: %s", err)
 		}
 	}
@@ -573,7 +627,7 @@ func selectPubKey(el openpgp.EntityList) (*openpgp.Entity, error) {
 	if len(el) == 0 {
 		return nil, ErrEmptyKeyring
 	}
-	printEntities(os.Stdout, el)
+	printEntities(os.Stdout, el, nil)
 
 	n, err := interactive.AskNumberInRange(0, len(el)-1, "Enter # of public key to use : ")
 	if err != nil {
@@ -588,7 +642,7 @@ func SelectPrivKey(el openpgp.EntityList) (*openpgp.Entity, error) {
 	if len(el) == 0 {
 		return nil, ErrEmptyKeyring
 	}
-	printEntities(os.Stdout, el)
+	printEntities(os.Stdout, el, nil)
 
 	n, err := interactive.AskNumberInRange(0, len(el)-1, "Enter # of private key to use : ")
 	if err != nil {
@@ -902,7 +956,7 @@ func serializeEntity(e *openpgp.Entity, blockType string) (string, error) {
 		return "", err
 	}
 
-	if err = e.Serialize(wr); err != nil {
+	if err = serializePublicEntity(wr, e); err != nil {
 		wr.Close()
 		return "", err
 	}
@@ -1028,7 +1082,7 @@ func (keyring *Handle) ExportPubKey(kpath string, armor bool) error {
 		keyText, err = serializeEntity(entityToExport, openpgp.PublicKeyType)
 		file.WriteString(keyText)
 	} else {
-		err = entityToExport.Serialize(file)
+		err = serializePublicEntity(file, entityToExport)
 	}
 
 	if err != nil {
@@ -1111,6 +1165,16 @@ func (keyring *Handle) importPublicKey(entity *openpgp.Entity) error {
 	}
 
 	if findEntityByFingerprint(publicEntityList, entity.PrimaryKey.Fingerprint) != nil {
+		// an updated key may carry new revocation signatures
+		if len(entity.Revocations) > 0 {
+			revoked, err := keyring.importRevocations(entity.Revocations)
+			if err != nil {
+				return err
+			}
+			if len(revoked) > 0 {
+				return nil
+			}
+		}
 		return &KeyExistsError{fingerprint: entity.PrimaryKey.Fingerprint}
 	}
 
@@ -1123,12 +1187,18 @@ func (keyring *Handle) importPublicKey(entity *openpgp.Entity) error {
 
 // ImportKey imports one or more keys from the specified file. The keys
 // can be either a public or private keys, and the file can be either in
-// binary or ascii-armored format.
+// binary or ascii-armored format. The file can also hold revocation
+// certificates for keys of the public keyring.
 func (keyring *Handle) ImportKey(kpath string, setNewPassword bool) error {
 	// Load the private key as an entitylist
 	pathEntityList, err := loadKeysFromFile(kpath)
 	if err != nil {
-		return fmt.Errorf("unable to get entity from: %s: %v", kpath, err)
+		// not a key, perhaps a revocation certificate?
+		sigs, rerr := loadRevocationsFromFile(kpath)
+		if rerr != nil {
+			return fmt.Errorf("unable to get entity from: %s: %v", kpath, err)
+		}
+		return keyring.importRevocationCerts(sigs)
 	}
 
 	for _, pathEntity := range pathEntityList {
@@ -1160,6 +1230,25 @@ func (keyring *Handle) ImportKey(kpath string, setNewPassword bool) error {
 	return nil
 }
 
+// importRevocationCerts imports the revocation certificates sigs into the
+// public keyring.
+func (keyring *Handle) importRevocationCerts(sigs []*packet.Signature) error {
+	revoked, err := keyring.importRevocations(sigs)
+	if err != nil {
+		return err
+	}
+
+	if len(revoked) == 0 {
+		fmt.Printf("Revocation certificate already present in the public keyring\n")
+	}
+	for _, e := range revoked {
+		fmt.Printf("Key with fingerprint %X successfully revoked in the public keyring\n",
+			e.PrimaryKey.Fingerprint)
+	}
+
+	return nil
+}
+
 // PushPubkey pushes a public key to the Key Service.
 func PushPubkey(ctx context.Context, e *openpgp.Entity, opts ...client.Option) error {
 	keyText, err := serializeEntity(e, openpgp.PublicKeyType)
@@ -390,7 +390,7 @@ func TestPrintEntity(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			var b bytes.Buffer
 
-			printEntity(&b, tc.index, tc.entity)
+			printEntity(&b, tc.index, tc.entity, nil)
 
 			if actual := b.String(); actual != tc.expected {
 				t.Errorf("Unexpected output from printEntity: expecting %q, got %q",
@@ -450,7 +450,7 @@ func TestPrintEntities(t *testing.T) {
 
 	var b bytes.Buffer
 
-	printEntities(&b, entities)
+	printEntities(&b, entities, nil)
 
 	if actual := b.String(); actual != expected {
 		t.Errorf("Unexpected output from printEntities: expecting %q, got %q",
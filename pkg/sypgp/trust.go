@@ -0,0 +1,383 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypgp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hpcng/singularity/pkg/sylog"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// TrustLevel describes how much the owner of a public key is trusted to sign images.
+type TrustLevel int
+
+const (
+	// TrustUnknown is the trust level of keys without explicit trust.
+	TrustUnknown TrustLevel = iota
+	// TrustNever is the trust level of keys which must not be relied upon.
+	TrustNever
+	// TrustMarginal is the trust level of partially trusted keys.
+	TrustMarginal
+	// TrustFull is the trust level of fully trusted keys.
+	TrustFull
+)
+
+var trustLevelNames = map[TrustLevel]string{
+	TrustUnknown:  "unknown",
+	TrustNever:    "never",
+	TrustMarginal: "marginal",
+	TrustFull:     "full",
+}
+
+var (
+	// ErrKeyRevoked is the error returned when a key has been revoked.
+	ErrKeyRevoked = errors.New("key has been revoked")
+	// ErrKeyExpired is the error returned when a key has expired.
+	ErrKeyExpired = errors.New("key has expired")
+	// ErrKeyDistrusted is the error returned when a key has the trust level never.
+	ErrKeyDistrusted = errors.New("key is not trusted")
+	// ErrKeyNotFullyTrusted is the error returned when a key has an unknown or marginal trust
+	// level.
+	ErrKeyNotFullyTrusted = errors.New("key is not fully trusted")
+
+	errNoRevocation = errors.New("no revocation certificate found")
+)
+
+// String returns the name of the trust level l.
+func (l TrustLevel) String() string {
+	if name, ok := trustLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("TrustLevel(%d)", int(l))
+}
+
+// ParseTrustLevel returns the trust level named s.
+func ParseTrustLevel(s string) (TrustLevel, error) {
+	for l, name := range trustLevelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+	return TrustUnknown, fmt.Errorf("unknown trust level %q, must be one of full, marginal, never or unknown", s)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (l TrustLevel) MarshalText() ([]byte, error) {
+	if _, ok := trustLevelNames[l]; !ok {
+		return nil, fmt.Errorf("invalid trust level %d", int(l))
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (l *TrustLevel) UnmarshalText(b []byte) error {
+	level, err := ParseTrustLevel(string(b))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// TrustDB maps the upper case hex fingerprints of public keys to their trust level.
+type TrustDB map[string]TrustLevel
+
+// Level returns the trust level of entity e.
+func (db TrustDB) Level(e *openpgp.Entity) TrustLevel {
+	return db[fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)]
+}
+
+// CheckKey checks the signing entity e for revocation, expiration at time t, and against the trust
+// level stored in db. The returned error wraps ErrKeyRevoked, ErrKeyDistrusted, ErrKeyExpired or
+// ErrKeyNotFullyTrusted, in that order of precedence.
+func (db TrustDB) CheckKey(e *openpgp.Entity, t time.Time) error {
+	if sig := Revocation(e); sig != nil {
+		return fmt.Errorf("%X: %w on %s", e.PrimaryKey.Fingerprint, ErrKeyRevoked, sig.CreationTime.Format(time.RFC3339))
+	}
+
+	level := db.Level(e)
+	if level == TrustNever {
+		return fmt.Errorf("%X: %w", e.PrimaryKey.Fingerprint, ErrKeyDistrusted)
+	}
+
+	if expiry, ok := KeyExpiry(e); ok && !t.Before(expiry) {
+		return fmt.Errorf("%X: %w on %s", e.PrimaryKey.Fingerprint, ErrKeyExpired, expiry.Format(time.RFC3339))
+	}
+
+	if level != TrustFull {
+		return fmt.Errorf("%X: %w (trust level %s)", e.PrimaryKey.Fingerprint, ErrKeyNotFullyTrusted, level)
+	}
+	return nil
+}
+
+// selfSignature returns the self signature of the primary identity of e, or the first identity if
+// none are marked as primary.
+func selfSignature(e *openpgp.Entity) *packet.Signature {
+	var first *packet.Signature
+	for _, id := range e.Identities {
+		if id.SelfSignature == nil {
+			continue
+		}
+		if first == nil {
+			first = id.SelfSignature
+		}
+		if id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			return id.SelfSignature
+		}
+	}
+	return first
+}
+
+// KeyExpiry returns the expiration time of the primary key of e. The returned boolean is false if
+// the key never expires.
+func KeyExpiry(e *openpgp.Entity) (time.Time, bool) {
+	sig := selfSignature(e)
+	if sig == nil || sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return time.Time{}, false
+	}
+	return e.PrimaryKey.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second), true
+}
+
+// Revocation returns the revocation signature of the primary key of e, or nil if the key hasn't
+// been revoked.
+func Revocation(e *openpgp.Entity) *packet.Signature {
+	if len(e.Revocations) > 0 {
+		return e.Revocations[0]
+	}
+	return nil
+}
+
+// TrustPath returns a string describing the path to the trust levels store.
+func (keyring *Handle) TrustPath() string {
+	if keyring.global {
+		return filepath.Join(keyring.path, "global-pgp-trust")
+	}
+	return filepath.Join(keyring.path, "pgp-trust")
+}
+
+// LoadTrustDB loads the trust levels of the public keys from local store.
+func (keyring *Handle) LoadTrustDB() (TrustDB, error) {
+	db := make(TrustDB)
+
+	b, err := ioutil.ReadFile(keyring.TrustPath())
+	if os.IsNotExist(err) {
+		return db, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &db); err != nil {
+		return nil, fmt.Errorf("while parsing %s: %s", keyring.TrustPath(), err)
+	}
+	return db, nil
+}
+
+// MergeTrustDBs loads the trust levels of the public keys of keyrings, the levels found in the
+// last keyrings taking precedence.
+func MergeTrustDBs(keyrings ...*Handle) (TrustDB, error) {
+	db := make(TrustDB)
+	for _, keyring := range keyrings {
+		kdb, err := keyring.LoadTrustDB()
+		if err != nil {
+			return nil, err
+		}
+		for fp, l := range kdb {
+			db[fp] = l
+		}
+	}
+	return db, nil
+}
+
+// SetTrust sets the trust level of the public key matching fingerprint, which must be present in
+// the public keyring. Setting TrustUnknown removes the trust level of the key.
+func (keyring *Handle) SetTrust(fingerprint string, level TrustLevel) error {
+	elist, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return fmt.Errorf("unable to load local keyring: %v", err)
+	}
+
+	e := findKeyByFingerprint(elist, strings.ToUpper(strings.TrimPrefix(fingerprint, "0x")))
+	if e == nil {
+		return fmt.Errorf("no key matching given fingerprint found")
+	}
+
+	db, err := keyring.LoadTrustDB()
+	if err != nil {
+		return err
+	}
+
+	fp := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+	if level == TrustUnknown {
+		delete(db, fp)
+	} else {
+		db[fp] = level
+	}
+
+	b, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0600)
+	if keyring.global {
+		mode = os.FileMode(0644)
+	}
+
+	f, err := createOrTruncateFile(keyring.TrustPath(), mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sylog.Verbosef("Updating trust levels: %v", keyring.TrustPath())
+
+	_, err = f.Write(b)
+	return err
+}
+
+// loadRevocationsFromFile loads the key revocation signatures from the specified file, which might
+// be in binary or ascii armored format.
+func loadRevocationsFromFile(fn string) ([]*packet.Signature, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader = bytes.NewReader(data)
+	if block, err := armor.Decode(bytes.NewReader(data)); err == nil {
+		r = block.Body
+	}
+
+	var sigs []*packet.Signature
+
+	pr := packet.NewReader(r)
+	for {
+		p, err := pr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if sig, ok := p.(*packet.Signature); ok && sig.SigType == packet.SigTypeKeyRevocation {
+			sigs = append(sigs, sig)
+		}
+	}
+
+	if len(sigs) == 0 {
+		return nil, errNoRevocation
+	}
+	return sigs, nil
+}
+
+// hasRevocation returns true if e holds a revocation signature created at the same time as sig.
+func hasRevocation(e *openpgp.Entity, sig *packet.Signature) bool {
+	for _, r := range e.Revocations {
+		if r.CreationTime.Equal(sig.CreationTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// importRevocations verifies the revocation signatures sigs against the matching keys of the
+// public keyring, and adds them to the keys. The revoked entities are returned.
+func (keyring *Handle) importRevocations(sigs []*packet.Signature) (openpgp.EntityList, error) {
+	elist, err := keyring.LoadPubKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	var revoked openpgp.EntityList
+
+	for _, sig := range sigs {
+		if sig.IssuerKeyId == nil {
+			return nil, fmt.Errorf("revocation certificate doesn't identify the revoked key")
+		}
+
+		var e *openpgp.Entity
+		for _, k := range elist {
+			if k.PrimaryKey.KeyId == *sig.IssuerKeyId {
+				e = k
+				break
+			}
+		}
+		if e == nil {
+			return nil, fmt.Errorf("no key with ID %X found for revocation certificate", *sig.IssuerKeyId)
+		}
+
+		if err := e.PrimaryKey.VerifyRevocationSignature(sig); err != nil {
+			return nil, fmt.Errorf("invalid revocation certificate for key %X: %v", e.PrimaryKey.Fingerprint, err)
+		}
+
+		if !hasRevocation(e, sig) {
+			e.Revocations = append(e.Revocations, sig)
+			revoked = append(revoked, e)
+		}
+	}
+
+	if len(revoked) > 0 {
+		if err := keyring.storePubKeyring(elist); err != nil {
+			return nil, err
+		}
+	}
+	return revoked, nil
+}
+
+// revokedKeyRing is a keyring which doesn't exclude revoked keys from signature checks. The type
+// satisfies the openpgp.KeyRing interface.
+type revokedKeyRing struct {
+	openpgp.KeyRing
+}
+
+// NewRevokedKeyRing returns a keyring backed by kr, which returns revoked keys along with the
+// others, so the signing entity of a signature made with a revoked key is reported and can be
+// checked with TrustDB.CheckKey.
+func NewRevokedKeyRing(kr openpgp.KeyRing) openpgp.KeyRing {
+	return revokedKeyRing{kr}
+}
+
+// KeysByIdUsage returns the set of keys with the given id that also meet the key usage given by
+// requiredUsage. The requiredUsage is expressed as the bitwise-OR of packet.KeyFlag* values.
+//nolint:golint  // golang/x/crypto uses Id instead of ID so we have to too
+func (kr revokedKeyRing) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.Key {
+	var keys []openpgp.Key
+
+	for _, key := range kr.KeysById(id) {
+		if key.SelfSignature != nil && key.SelfSignature.FlagsValid && requiredUsage != 0 {
+			var usage byte
+			if key.SelfSignature.FlagCertify {
+				usage |= packet.KeyFlagCertify
+			}
+			if key.SelfSignature.FlagSign {
+				usage |= packet.KeyFlagSign
+			}
+			if key.SelfSignature.FlagEncryptCommunications {
+				usage |= packet.KeyFlagEncryptCommunications
+			}
+			if key.SelfSignature.FlagEncryptStorage {
+				usage |= packet.KeyFlagEncryptStorage
+			}
+			if usage&requiredUsage != requiredUsage {
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
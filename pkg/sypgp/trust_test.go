@@ -0,0 +1,252 @@
+// Copyright (c) 2021, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the LICENSE.md file
+// distributed with the sources of this project regarding your rights to use or distribute this
+// software.
+
+package sypgp
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// revocationCert returns an armored revocation certificate for the primary key of e.
+func revocationCert(t *testing.T, e *openpgp.Entity) []byte {
+	var buf bytes.Buffer
+	if err := e.PrimaryKey.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// skip the new format packet header
+	b := buf.Bytes()
+	switch l := b[1]; {
+	case l < 192:
+		b = b[2:]
+	case l < 224:
+		b = b[3:]
+	default:
+		b = b[6:]
+	}
+
+	h := crypto.SHA256.New()
+	e.PrimaryKey.SerializeSignaturePrefix(h)
+	h.Write(b)
+
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeKeyRevocation,
+		PubKeyAlgo:   e.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: time.Now(),
+		IssuerKeyId:  &e.PrimaryKey.KeyId,
+	}
+	if err := sig.Sign(h, e.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sig.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	return buf.Bytes()
+}
+
+func TestParseTrustLevel(t *testing.T) {
+	for _, l := range []TrustLevel{TrustUnknown, TrustNever, TrustMarginal, TrustFull} {
+		got, err := ParseTrustLevel(l.String())
+		if err != nil {
+			t.Errorf("unexpected error parsing %s: %v", l, err)
+		} else if got != l {
+			t.Errorf("got level %s, want %s", got, l)
+		}
+	}
+
+	if _, err := ParseTrustLevel("ultimate"); err == nil {
+		t.Errorf("unexpected success parsing unknown trust level")
+	}
+}
+
+func TestSetTrust(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trust-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyring := NewHandle(dir)
+	if err := keyring.importPublicKey(testEntity); err != nil {
+		t.Fatal(err)
+	}
+	fp := fmt.Sprintf("%X", testEntity.PrimaryKey.Fingerprint)
+
+	if err := keyring.SetTrust(invalidFingerprint(fp), TrustFull); err == nil {
+		t.Errorf("unexpected success setting trust of unknown key")
+	}
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		level       TrustLevel
+	}{
+		{"Full", fp, TrustFull},
+		{"Never", "0x" + fp, TrustNever},
+		{"LowerCase", fmt.Sprintf("%x", testEntity.PrimaryKey.Fingerprint), TrustMarginal},
+		{"Unknown", fp, TrustUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := keyring.SetTrust(tt.fingerprint, tt.level); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			db, err := keyring.LoadTrustDB()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, want := db.Level(testEntity), tt.level; got != want {
+				t.Errorf("got level %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// invalidFingerprint returns fp with its last digit modified.
+func invalidFingerprint(fp string) string {
+	last := "0"
+	if fp[len(fp)-1] == '0' {
+		last = "1"
+	}
+	return fp[:len(fp)-1] + last
+}
+
+func TestCheckKey(t *testing.T) {
+	e, err := openpgp.NewEntity(testName, testComment, testEmail, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+
+	expiring, err := openpgp.NewEntity(testName, testComment, testEmail, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lifetime := uint32(3600)
+	for _, id := range expiring.Identities {
+		id.SelfSignature.KeyLifetimeSecs = &lifetime
+	}
+	expiry := expiring.PrimaryKey.CreationTime.Add(time.Hour)
+
+	revoked, err := openpgp.NewEntity(testName, testComment, testEmail, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked.Revocations = []*packet.Signature{{CreationTime: time.Now()}}
+
+	tests := []struct {
+		name    string
+		e       *openpgp.Entity
+		db      TrustDB
+		t       time.Time
+		wantErr error
+	}{
+		{"Full", e, TrustDB{fp: TrustFull}, time.Now(), nil},
+		{"Marginal", e, TrustDB{fp: TrustMarginal}, time.Now(), ErrKeyNotFullyTrusted},
+		{"Unknown", e, TrustDB{}, time.Now(), ErrKeyNotFullyTrusted},
+		{"Never", e, TrustDB{fp: TrustNever}, time.Now(), ErrKeyDistrusted},
+		{"NotExpired", expiring, TrustDB{fmt.Sprintf("%X", expiring.PrimaryKey.Fingerprint): TrustFull}, expiry.Add(-time.Second), nil},
+		{"Expired", expiring, TrustDB{fmt.Sprintf("%X", expiring.PrimaryKey.Fingerprint): TrustFull}, expiry, ErrKeyExpired},
+		{"Revoked", revoked, TrustDB{fmt.Sprintf("%X", revoked.PrimaryKey.Fingerprint): TrustFull}, time.Now(), ErrKeyRevoked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.db.CheckKey(tt.e, tt.t)
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, ok := KeyExpiry(e); ok {
+		t.Errorf("unexpected expiry for key without lifetime")
+	}
+	if got, ok := KeyExpiry(expiring); !ok || !got.Equal(expiry) {
+		t.Errorf("got expiry %v, want %v", got, expiry)
+	}
+}
+
+func TestImportRevocation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revocation-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e, err := openpgp.NewEntity(testName, testComment, testEmail, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := filepath.Join(dir, "revocation.asc")
+	if err := ioutil.WriteFile(cert, revocationCert(t, e), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := NewHandle(filepath.Join(dir, "keyring"))
+
+	// the revoked key must be present in the keyring
+	if err := keyring.ImportKey(cert, false); err == nil {
+		t.Errorf("unexpected success importing revocation of unknown key")
+	}
+
+	if err := keyring.importPublicKey(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.ImportKey(cert, false); err != nil {
+		t.Fatalf("unexpected error importing revocation: %v", err)
+	}
+	// importing twice is harmless
+	if err := keyring.ImportKey(cert, false); err != nil {
+		t.Fatalf("unexpected error importing revocation again: %v", err)
+	}
+
+	el, err := keyring.LoadPubKeyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 1 {
+		t.Fatalf("got %d keys, want 1", len(el))
+	}
+	if got := len(el[0].Revocations); got != 1 {
+		t.Errorf("got %d revocations, want 1", got)
+	}
+	if err := (TrustDB{}).CheckKey(el[0], time.Now()); !errors.Is(err, ErrKeyRevoked) {
+		t.Errorf("got error %v, want %v", err, ErrKeyRevoked)
+	}
+
+	// revoked keys are excluded from signature checks, unless requested
+	if keys := el.KeysByIdUsage(e.PrimaryKey.KeyId, packet.KeyFlagSign); len(keys) != 0 {
+		t.Errorf("got %d keys from keyring, want 0", len(keys))
+	}
+	if keys := NewRevokedKeyRing(el).KeysByIdUsage(e.PrimaryKey.KeyId, packet.KeyFlagSign); len(keys) != 1 {
+		t.Errorf("got %d keys from revoked keyring, want 1", len(keys))
+	}
+}
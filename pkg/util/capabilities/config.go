@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 
 	"github.com/hpcng/singularity/pkg/sylog"
 )
@@ -18,10 +19,14 @@ import (
 type Caplist map[string][]string
 
 // Config is the in memory representation of the user/group capability
-// authorizations as set by an admin
+// authorizations as set by an admin. Capabilities of fingerprints and
+// execgroups are granted to any user running an image signed by the
+// fingerprint, or satisfying the rules of the ECL execgroup.
 type Config struct {
-	Users  Caplist `json:"users,omitempty"`
-	Groups Caplist `json:"groups,omitempty"`
+	Users        Caplist `json:"users,omitempty"`
+	Groups       Caplist `json:"groups,omitempty"`
+	Fingerprints Caplist `json:"fingerprints,omitempty"`
+	Execgroups   Caplist `json:"execgroups,omitempty"`
 }
 
 // ReadFrom reads a capability configuration from an io.Reader and returns a capability
@@ -235,3 +240,117 @@ func (c *Config) CheckGroupCaps(group string, caps []string) (authorized []strin
 	}
 	return authorized, unauthorized
 }
+
+// addCaps adds an authorized capability set to the entry key of list
+func (c *Config) addCaps(list Caplist, kind string, key string, caps []string) error {
+	if err := c.checkCaps(caps); err != nil {
+		return err
+	}
+	for _, cap := range caps {
+		present := false
+		for _, c := range list[key] {
+			if c == cap {
+				present = true
+			}
+		}
+		if !present {
+			list[key] = append(list[key], cap)
+		} else {
+			sylog.Warningf("Won't add capability '%s', already assigned to %s %s", cap, kind, key)
+		}
+	}
+	return nil
+}
+
+// dropCaps drops a set of capabilities from the entry key of list
+func (c *Config) dropCaps(list Caplist, kind string, key string, caps []string) error {
+	if err := c.checkCaps(caps); err != nil {
+		return err
+	}
+	if _, ok := list[key]; !ok {
+		return fmt.Errorf("%s '%s' doesn't have any capability assigned", kind, key)
+	}
+	for _, cap := range caps {
+		dropped := false
+		for i := len(list[key]) - 1; i >= 0; i-- {
+			if list[key][i] == cap {
+				list[key] = append(list[key][:i], list[key][i+1:]...)
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			sylog.Warningf("Won't drop capability '%s', not assigned to %s %s", cap, kind, key)
+		}
+	}
+	if len(list[key]) == 0 {
+		delete(list, key)
+	}
+	return nil
+}
+
+// normalizeFingerprint returns the fingerprint fp in upper case
+// hexadecimal without spaces, as displayed by the key list command
+func normalizeFingerprint(fp string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(fp), ""))
+}
+
+// AddFingerprintCaps adds an authorized capability set to the images
+// signed by the entity with fingerprint fp
+func (c *Config) AddFingerprintCaps(fp string, caps []string) error {
+	if c.Fingerprints == nil {
+		c.Fingerprints = make(Caplist)
+	}
+	return c.addCaps(c.Fingerprints, "fingerprint", normalizeFingerprint(fp), caps)
+}
+
+// AddExecgroupCaps adds an authorized capability set to the images
+// satisfying the rules of the ECL execgroup tag
+func (c *Config) AddExecgroupCaps(tag string, caps []string) error {
+	if c.Execgroups == nil {
+		c.Execgroups = make(Caplist)
+	}
+	return c.addCaps(c.Execgroups, "execgroup", tag, caps)
+}
+
+// DropFingerprintCaps drops a set of capabilities for fingerprint fp
+func (c *Config) DropFingerprintCaps(fp string, caps []string) error {
+	return c.dropCaps(c.Fingerprints, "fingerprint", normalizeFingerprint(fp), caps)
+}
+
+// DropExecgroupCaps drops a set of capabilities for execgroup tag
+func (c *Config) DropExecgroupCaps(tag string, caps []string) error {
+	return c.dropCaps(c.Execgroups, "execgroup", tag, caps)
+}
+
+// ListFingerprintCaps returns a capability list authorized for images
+// signed by fingerprint fp
+func (c *Config) ListFingerprintCaps(fp string) []string {
+	return c.Fingerprints[normalizeFingerprint(fp)]
+}
+
+// ListExecgroupCaps returns a capability list authorized for images of
+// execgroup tag
+func (c *Config) ListExecgroupCaps(tag string) []string {
+	return c.Execgroups[tag]
+}
+
+// ListAllImageCaps returns capability list for both authorized
+// fingerprints and execgroups
+func (c *Config) ListAllImageCaps() (Caplist, Caplist) {
+	return c.Fingerprints, c.Execgroups
+}
+
+// ImageCaps returns the capabilities authorized for an image signed by
+// the fingerprints fps and satisfying the rules of the execgroup tag, an
+// empty tag matches no execgroup
+func (c *Config) ImageCaps(fps []string, tag string) []string {
+	caps := make([]string, 0)
+	for _, fp := range fps {
+		caps = append(caps, c.ListFingerprintCaps(fp)...)
+	}
+	if tag != "" {
+		caps = append(caps, c.ListExecgroupCaps(tag)...)
+	}
+	return RemoveDuplicated(caps)
+}
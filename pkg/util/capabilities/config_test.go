@@ -605,3 +605,66 @@ func TestCheckCaps(t *testing.T) {
 	}
 
 }
+
+func TestImageCaps(t *testing.T) {
+	conf := Config{}
+
+	fp := "8883 491F 4268 F173 C6E5  DC49 3230 4223 3D60 2F10"
+	if err := conf.AddFingerprintCaps(fp, []string{"CAP_NET_RAW"}); err != nil {
+		t.Fatalf("unexpected failure adding fingerprint capabilities: %s", err)
+	}
+	if err := conf.AddExecgroupCaps("network", []string{"CAP_NET_RAW", "CAP_NET_ADMIN"}); err != nil {
+		t.Fatalf("unexpected failure adding execgroup capabilities: %s", err)
+	}
+	if err := conf.AddExecgroupCaps("network", []string{"CAP_FAKE"}); err == nil {
+		t.Errorf("unexpected success adding unknown capability")
+	}
+
+	tests := []struct {
+		name string
+		fps  []string
+		tag  string
+		caps []string
+	}{
+		{
+			name: "no match",
+			fps:  []string{"0000000000000000000000000000000000000000"},
+			caps: []string{},
+		},
+		{
+			name: "fingerprint",
+			fps:  []string{"8883491f4268f173c6e5dc4932304223 3d602f10"},
+			caps: []string{"CAP_NET_RAW"},
+		},
+		{
+			name: "execgroup",
+			tag:  "network",
+			caps: []string{"CAP_NET_RAW", "CAP_NET_ADMIN"},
+		},
+		{
+			name: "fingerprint and execgroup",
+			fps:  []string{"8883491F4268F173C6E5DC49323042233D602F10"},
+			tag:  "network",
+			caps: []string{"CAP_NET_RAW", "CAP_NET_ADMIN"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caps := conf.ImageCaps(tt.fps, tt.tag)
+			if !reflect.DeepEqual(caps, tt.caps) {
+				t.Errorf("got capabilities %v, expected %v", caps, tt.caps)
+			}
+		})
+	}
+
+	if err := conf.DropFingerprintCaps(fp, []string{"CAP_NET_RAW"}); err != nil {
+		t.Fatalf("unexpected failure dropping fingerprint capabilities: %s", err)
+	}
+	if len(conf.Fingerprints) != 0 {
+		t.Errorf("fingerprint entry not removed: %v", conf.Fingerprints)
+	}
+	if err := conf.DropExecgroupCaps("other", []string{"CAP_NET_RAW"}); err == nil {
+		t.Errorf("unexpected success dropping capabilities of unknown execgroup")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"io"
 	"os"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
@@ -27,6 +28,41 @@ func Exclusive(path string) (fd int, err error) {
 	return fd, nil
 }
 
+// ErrLockTimeout corresponds to the error returned when
+// a lock is not acquired before a timeout.
+var ErrLockTimeout = errors.New("timeout while waiting for lock")
+
+// lockPollInterval is the interval between two attempts to
+// acquire a lock with ExclusiveTimeout.
+const lockPollInterval = 100 * time.Millisecond
+
+// ExclusiveTimeout applies an exclusive lock on path, it returns
+// ErrLockTimeout if the lock is still held by another file
+// descriptor after timeout.
+func ExclusiveTimeout(path string, timeout time.Duration) (fd int, err error) {
+	fd, err = unix.Open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return fd, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err = unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB)
+		if err == nil {
+			return fd, nil
+		} else if err != unix.EWOULDBLOCK {
+			unix.Close(fd)
+			return -1, err
+		}
+
+		if time.Now().After(deadline) {
+			unix.Close(fd)
+			return -1, ErrLockTimeout
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
 // Release removes a lock on path referenced by fd
 func Release(fd int) error {
 	defer unix.Close(fd)
@@ -45,6 +45,49 @@ func TestExclusive(t *testing.T) {
 	}
 }
 
+func TestExclusiveTimeout(t *testing.T) {
+	test.DropPrivilege(t)
+	defer test.ResetPrivilege(t)
+
+	if _, err := ExclusiveTimeout("", time.Second); err == nil {
+		t.Errorf("unexpected success with empty path")
+	}
+
+	f, err := ioutil.TempFile("", "lock-")
+	if err != nil {
+		t.Fatalf("failed to create temporary lock file: %s", err)
+	}
+	lockFile := f.Name()
+	defer os.Remove(lockFile)
+
+	f.Close()
+
+	fd, err := ExclusiveTimeout(lockFile, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error while locking %s: %s", lockFile, err)
+	}
+
+	// the lock is held by fd
+	start := time.Now()
+	if _, err := ExclusiveTimeout(lockFile, 500*time.Millisecond); err != ErrLockTimeout {
+		t.Errorf("got error %v, want %v", err, ErrLockTimeout)
+	}
+	if time.Since(start) < 500*time.Millisecond {
+		t.Errorf("returned before timeout")
+	}
+
+	// the lock is released while waiting
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		Release(fd)
+	}()
+	fd, err = ExclusiveTimeout(lockFile, 5*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error while locking %s: %s", lockFile, err)
+	}
+	Release(fd)
+}
+
 func TestByteRange(t *testing.T) {
 	test.DropPrivilege(t)
 	defer test.ResetPrivilege(t)
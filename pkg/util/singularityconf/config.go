@@ -44,6 +44,7 @@ type File struct {
 	AlwaysUseNv             bool     `default:"no" authorized:"yes,no" directive:"always use nv"`
 	AlwaysUseRocm           bool     `default:"no" authorized:"yes,no" directive:"always use rocm"`
 	SharedLoopDevices       bool     `default:"no" authorized:"yes,no" directive:"shared loop devices"`
+	AllowFakerootSingleID   bool     `default:"no" authorized:"yes,no" directive:"allow fakeroot single id"`
 	MaxLoopDevices          uint     `default:"256" directive:"max loop devices"`
 	SessiondirMaxSize       uint     `default:"16" directive:"sessiondir max size"`
 	MountDev                string   `default:"yes" authorized:"yes,no,minimal" directive:"mount dev"`
@@ -55,6 +56,7 @@ type File struct {
 	AllowNetUsers           []string `directive:"allow net users"`
 	AllowNetGroups          []string `directive:"allow net groups"`
 	AllowNetNetworks        []string `directive:"allow net networks"`
+	NetBandwidthLimits      []string `directive:"net bandwidth limits"`
 	RootDefaultCapabilities string   `default:"full" authorized:"full,file,no" directive:"root default capabilities"`
 	MemoryFSType            string   `default:"tmpfs" authorized:"tmpfs,ramfs" directive:"memory fs type"`
 	CniConfPath             string   `directive:"cni configuration path"`
@@ -62,8 +64,19 @@ type File struct {
 	MksquashfsPath          string   `directive:"mksquashfs path"`
 	MksquashfsProcs         uint     `default:"0" directive:"mksquashfs procs"`
 	MksquashfsMem           string   `directive:"mksquashfs mem"`
+	MksquashfsCompression   string   `default:"gzip" authorized:"gzip,lzo,lz4,xz,zstd" directive:"mksquashfs compression"`
+	MksquashfsCompLevel     uint     `default:"0" directive:"mksquashfs compression level"`
+	MksquashfsBlockSize     string   `directive:"mksquashfs block size"`
 	CryptsetupPath          string   `directive:"cryptsetup path"`
+	Slirp4netnsPath         string   `directive:"slirp4netns path"`
+	CacheMaxSize            string   `directive:"cache max size"`
+	SharedCacheDir          string   `directive:"shared cache dir"`
+	CacheLockTimeout        uint     `default:"600" directive:"cache lock timeout"`
+	DownloadConcurrency     uint     `default:"3" directive:"download concurrency"`
 	ImageDriver             string   `directive:"image driver"`
+	SeccompProfile          string   `directive:"seccomp profile"`
+	AllowedSeccompProfiles  []string `directive:"allowed seccomp profiles"`
+	LandlockRules           string   `directive:"landlock rules"`
 }
 
 const TemplateAsset = `# SINGULARITY.CONF
@@ -97,6 +110,17 @@ max loop devices = {{ .MaxLoopDevices }}
 # systems, the PID namespace is always used)
 allow pid ns = {{ if eq .AllowPidNs true }}yes{{ else }}no{{ end }}
 
+# ALLOW FAKEROOT SINGLE ID: [BOOL]
+# DEFAULT: no
+# Should we allow users without a mapping entry in /etc/subuid and
+# /etc/subgid to use --fakeroot in single-ID mode? In this degraded mode only
+# the user and its primary group are mapped to root in the user namespace, like
+# with 'unshare -r', and changes of file ownership done during a fakeroot build
+# are ignored and counted at the end of the build. Note that with a setuid
+# installation, the user namespace is created by the privileged starter even if
+# unprivileged user namespaces are disabled on the host.
+allow fakeroot single id = {{ if eq .AllowFakerootSingleID true }}yes{{ else }}no{{ end }}
+
 # CONFIG PASSWD: [BOOL]
 # DEFAULT: yes
 # If /etc/passwd exists within the container, this will automatically append
@@ -299,6 +323,19 @@ allow container encrypted = {{ if eq .AllowContainerEncrypted true }}yes{{ else
 {{- if eq $index 0 }}allow net networks = {{ else }}, {{ end }}{{$group}}
 {{- end }}
 
+# NET BANDWIDTH LIMITS: [STRING]
+# DEFAULT: NULL
+# Limit the ingress and egress bandwidth of the CNI networks used by non-root
+# users, including the users and groups listed in the allow net users / allow
+# net groups directives and fakeroot users. Limits are in the user:<name>:<rate>,
+# group:<name>:<rate> or all:<rate> format, with rates in bits per second
+# and an optional k, M or G suffix. The lowest limit applying to the user is
+# enforced, a limited user can't use networks without the bandwidth plugin.
+#net bandwidth limits = user:gmk:1G, group:singularity:100M, all:10M
+{{ range $index, $limit := .NetBandwidthLimits }}
+{{- if eq $index 0 }}net bandwidth limits = {{ else }}, {{ end }}{{$limit}}
+{{- end }}
+
 # ALWAYS USE NV ${TYPE}: [BOOL]
 # DEFAULT: no
 # This feature allows an administrator to determine that every action command
@@ -364,6 +401,31 @@ mksquashfs procs = {{ .MksquashfsProcs }}
 # mksquashfs mem = 1G
 {{ if ne .MksquashfsMem "" }}mksquashfs mem = {{ .MksquashfsMem }}{{ end }}
 
+# MKSQUASHFS COMPRESSION: [STRING]
+# DEFAULT: gzip
+# This allows the administrator to set the default compression algorithm used
+# by mksquashfs when building an image, users can override it with the build
+# --compress option. Supported values are gzip, lzo, lz4, xz and zstd.
+# NOTE: the kernel of hosts running the images must support the compression
+# algorithm, gzip is the only one supported by all squashfs enabled kernels.
+mksquashfs compression = {{ .MksquashfsCompression }}
+
+# MKSQUASHFS COMPRESSION LEVEL: [UINT]
+# DEFAULT: 0 (compressor default)
+# This allows the administrator to set the default compression level used by
+# mksquashfs when building an image, users can override it with the build
+# --compress-level option. Only gzip, lzo (1-9) and zstd (1-22) support a
+# compression level, it is ignored for other compression algorithms.
+mksquashfs compression level = {{ .MksquashfsCompLevel }}
+
+# MKSQUASHFS BLOCK SIZE: [STRING]
+# DEFAULT: Undefined (128K)
+# This allows the administrator to set the default block size used by
+# mksquashfs when building an image, users can override it with the build
+# --block-size option. It must be a power of two between 4K and 1M.
+# mksquashfs block size = 1M
+{{ if ne .MksquashfsBlockSize "" }}mksquashfs block size = {{ .MksquashfsBlockSize }}{{ end }}
+
 # CRYPTSETUP PATH: [STRING]
 # DEFAULT: Undefined
 # This allows the administrator to specify the location of cryptsetup if
@@ -372,6 +434,54 @@ mksquashfs procs = {{ .MksquashfsProcs }}
 # recorded at build time.
 # cryptsetup path =
 {{ if ne .CryptsetupPath "" }}cryptsetup path = {{ .CryptsetupPath }}{{ end }}
+
+# SLIRP4NETNS PATH: [STRING]
+# DEFAULT: Undefined
+# This allows the administrator to specify the location of slirp4netns,
+# which provides the user-mode 'slirp' network to unprivileged users. If
+# this value is undefined, slirp4netns is searched in PATH.
+# slirp4netns path =
+{{ if ne .Slirp4netnsPath "" }}slirp4netns path = {{ .Slirp4netnsPath }}{{ end }}
+
+# CACHE MAX SIZE: [STRING]
+# DEFAULT: Undefined (unlimited)
+# This allows the administrator to limit the size of the user image caches,
+# e.g. 500M for 500mb or 10G for 10gb. When a new entry is written to a cache
+# exceeding this size, the least recently used entries are evicted. Users can
+# override it with the SINGULARITY_CACHE_MAXSIZE environment variable.
+# cache max size = 10G
+{{ if ne .CacheMaxSize "" }}cache max size = {{ .CacheMaxSize }}{{ end }}
+
+# CACHE LOCK TIMEOUT: [UINT]
+# DEFAULT: 600
+# This allows the administrator to set the number of seconds a process waits
+# for another process creating the same image cache entry, e.g. array jobs
+# pulling the same image, before failing. A process holding the lock while
+# stuck, e.g. on a hung network filesystem, would otherwise block all others.
+# 0 means waiting indefinitely. Users can override it with the
+# SINGULARITY_CACHE_LOCK_TIMEOUT environment variable.
+cache lock timeout = {{ .CacheLockTimeout }}
+
+# SHARED CACHE DIR: [STRING]
+# DEFAULT: Undefined
+# This allows the administrator to specify a shared, system-wide image cache
+# consulted before the user caches, so images are not pulled into the cache
+# of each user. The directory is populated by root with the
+# 'singularity cache prefetch' command and is read-only to users. The checksum
+# of shared entries is recorded by root in an index when they are written, and
+# entries are hashed again each time they are used and only used if they match
+# it, which takes longer for large images.
+# shared cache dir = /var/lib/singularity/cache
+{{ if ne .SharedCacheDir "" }}shared cache dir = {{ .SharedCacheDir }}{{ end }}
+
+# DOWNLOAD CONCURRENCY: [UINT]
+# DEFAULT: 3
+# This allows the administrator to set the maximum number of layers downloaded
+# concurrently when pulling images from docker registries. Interrupted layer
+# downloads are resumed from the partial content kept in the cache. Users can
+# override it with the SINGULARITY_DOWNLOAD_CONCURRENCY environment variable.
+download concurrency = {{ .DownloadConcurrency }}
+
 # SHARED LOOP DEVICES: [BOOL]
 # DEFAULT: no
 # Allow to share same images associated with loop devices to minimize loop
@@ -387,4 +497,40 @@ shared loop devices = {{ if eq .SharedLoopDevices true }}yes{{ else }}no{{ end }
 # If the driver name specified has not been registered via a plugin installation
 # the run-time will abort.
 image driver = {{ .ImageDriver }}
+
+# SECCOMP PROFILE: [STRING]
+# DEFAULT: Undefined
+# This option specifies a seccomp profile applied by default to all
+# containers, unless another profile is requested with --security seccomp by
+# root or is set by an allowed image label. A relative name is looked up in
+# the seccomp-profiles directory of the configuration directory, and the
+# '.json' extension can be omitted. The default profile is not applied when
+# root requests --keep-privs.
+# seccomp profile = default
+{{ if ne .SeccompProfile "" }}seccomp profile = {{ .SeccompProfile }}{{ end }}
+
+# ALLOWED SECCOMP PROFILES: [STRING]
+# DEFAULT: Undefined
+# This option specifies a comma separated list of seccomp profiles which can
+# replace the default seccomp profile. Images select one of these profiles
+# with the 'org.sylabs.singularity.seccomp-profile' label, and users other
+# than root can only request one of these profiles with --security seccomp
+# when a default profile is set. Profiles are referenced like the default
+# profile.
+# allowed seccomp profiles = default, /etc/seccomp/mpi.json
+{{ range $index, $profile := .AllowedSeccompProfiles }}
+{{- if eq $index 0 }}allowed seccomp profiles = {{ else }}, {{ end }}{{$profile}}
+{{- end }}
+
+# LANDLOCK RULES: [STRING]
+# DEFAULT: Undefined
+# This option specifies a Landlock ruleset enforced on all containers, on
+# kernels supporting Landlock, in the same format as --security landlock:
+# 'ro=<path>[:<path>...]' limits read access to these paths and the system
+# directories of the container, 'rw=<path>[:<path>...]' allows write access
+# beneath these paths in addition to /dev. Paths are container paths.
+# Rulesets requested with --security landlock further restrict this one.
+# The ruleset is not enforced when root requests --keep-privs.
+# landlock rules = rw=/tmp:/var/tmp
+{{ if ne .LandlockRules "" }}landlock rules = {{ .LandlockRules }}{{ end }}
 `